@@ -0,0 +1,236 @@
+// Package admin serves the gateway's operational HTTP endpoints (health
+// probes and introspection) on a port separate from ingress traffic.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/logging"
+	"eddisonso.com/edd-gateway/internal/proxy"
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// Server is the admin HTTP server.
+type Server struct {
+	router *router.Router
+	proxy  *proxy.Server
+	errors *logging.ErrorRing // nil when error capture is disabled
+	mux    *http.ServeMux
+
+	routesToken string // bearer token for protected endpoints; empty disables them
+}
+
+// New creates an admin server for the given router and proxy.
+func New(r *router.Router, p *proxy.Server) *Server {
+	s := &Server{
+		router: r,
+		proxy:  p,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("GET /backends", s.handleBackends)
+	s.mux.HandleFunc("GET /connections", s.handleConnections)
+	s.mux.HandleFunc("GET /targets", s.handleTargets)
+	s.mux.HandleFunc("GET /certificates", s.handleCertificates)
+	s.mux.HandleFunc("GET /debug/errors", s.handleErrors)
+	s.mux.HandleFunc("GET /debug/keys", s.handleKeys)
+	s.mux.HandleFunc("GET /debug/cache", s.handleCache)
+	s.mux.HandleFunc("GET /debug/router", s.handleRouterStats)
+	s.mux.HandleFunc("GET /canaries", s.handleCanaries)
+	s.mux.HandleFunc("POST /canaries/{action}", s.requireToken(s.handleCanaryAction))
+	s.mux.HandleFunc("GET /maintenance", s.handleMaintenance)
+	s.mux.HandleFunc("POST /maintenance/{action}", s.requireToken(s.handleMaintenanceAction))
+	s.mux.HandleFunc("GET /routes", s.requireToken(s.handleListRoutes))
+	s.mux.HandleFunc("POST /routes", s.requireToken(s.handleAddRoute))
+	s.mux.HandleFunc("DELETE /routes", s.requireToken(s.handleDeleteRoute))
+	s.mux.HandleFunc("PUT /routes/weights", s.requireToken(s.handleSetWeights))
+	s.mux.HandleFunc("POST /routes/drain", s.requireToken(s.handleDrainRoutes))
+	return s
+}
+
+// SetErrorRing exposes the recent errors captured by ring on /debug/errors.
+func (s *Server) SetErrorRing(ring *logging.ErrorRing) {
+	s.errors = ring
+}
+
+// ListenAndServe serves admin requests on port until the listener fails.
+func (s *Server) ListenAndServe(port int) error {
+	addr := fmt.Sprintf(":%d", port)
+	slog.Info("admin listening", "addr", addr)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// handleHealthz reports liveness: the process is up and serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeText(w, http.StatusOK, "ok")
+}
+
+// handleReadyz reports readiness: the initial route load succeeded and the
+// router has not lost its database connection.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.router.Loaded() {
+		writeText(w, http.StatusServiceUnavailable, "routes not loaded")
+		return
+	}
+	if !s.router.Connected() {
+		writeText(w, http.StatusServiceUnavailable, "database unreachable")
+		return
+	}
+
+	writeText(w, http.StatusOK, "ok")
+}
+
+// handleConnections reports current and peak connection counts against
+// the configured limits.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.ConnectionStats())
+}
+
+// handleBackends lists backends with recent dial failures and whether they
+// are ejected from rotation.
+func (s *Server) handleBackends(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.BackendHealth())
+}
+
+// handleTargets lists the latest active health check result per route target.
+func (s *Server) handleTargets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.TargetHealth())
+}
+
+// handleCertificates lists loaded TLS certificates, or with ?host= the
+// certificate that host's handshakes are served.
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		writeJSON(w, http.StatusOK, s.proxy.Certificates())
+		return
+	}
+	cert := s.proxy.CertificateForHost(host)
+	if cert == nil {
+		writeText(w, http.StatusNotFound, "no certificate for host")
+		return
+	}
+	writeJSON(w, http.StatusOK, proxy.DescribeCertificate(cert))
+}
+
+// handleErrors lists recently logged errors, newest first.
+func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
+	if s.errors == nil {
+		writeJSON(w, http.StatusOK, []logging.ErrorEntry{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.errors.Recent())
+}
+
+// handleKeys lists fingerprints of the SSH keys and TLS certificates in use.
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.Keys())
+}
+
+// handleCache reports the container cache size and how long ago it was last
+// synced.
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.router.CacheAge())
+}
+
+// handleRouterStats reports the router's state in one snapshot.
+func (s *Server) handleRouterStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.router.Stats())
+}
+
+// handleCanaries lists the ramp status of every route with a canary target.
+func (s *Server) handleCanaries(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.router.ListCanaries())
+}
+
+// handleCanaryAction pauses, resumes or aborts the canary ramp of the route
+// given by ?host= and ?path=.
+func (s *Server) handleCanaryAction(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	path := r.URL.Query().Get("path")
+	if host == "" {
+		writeText(w, http.StatusBadRequest, "host is required")
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	var (
+		status router.CanaryStatus
+		err    error
+	)
+	switch r.PathValue("action") {
+	case "pause":
+		status, err = s.router.PauseCanary(host, path)
+	case "resume":
+		status, err = s.router.ResumeCanary(host, path)
+	case "abort":
+		status, err = s.router.AbortCanary(host, path)
+	default:
+		writeText(w, http.StatusNotFound, "unknown canary action")
+		return
+	}
+	switch {
+	case errors.Is(err, router.ErrNoRoute), errors.Is(err, router.ErrNoCanary):
+		writeText(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleMaintenance lists the hosts in maintenance.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.Maintenance())
+}
+
+// handleMaintenanceAction puts the host given by ?host= in or out of
+// maintenance, or every host when it is omitted.
+func (s *Server) handleMaintenanceAction(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		host = proxy.MaintenanceAllHosts
+	}
+
+	var enabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		enabled = true
+	case "disable":
+	default:
+		writeText(w, http.StatusNotFound, "unknown maintenance action")
+		return
+	}
+	s.proxy.SetMaintenance(host, enabled)
+	writeJSON(w, http.StatusOK, s.proxy.Maintenance())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("failed to write admin response", "error", err)
+	}
+}
+
+func writeText(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, msg)
+}
@@ -0,0 +1,346 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// RoutesTokenEnv names the environment variable holding the bearer token
+// for the /routes API and the other protected admin endpoints.
+const RoutesTokenEnv = "ADMIN_TOKEN"
+
+// maxRouteBody caps the size of a POST /routes request body.
+const maxRouteBody = 64 << 10
+
+// routeInfo is the JSON form of a static route.
+type routeInfo struct {
+	ID                 int               `json:"id"`
+	Host               string            `json:"host"`
+	Path               string            `json:"path"`
+	Match              string            `json:"match"`
+	Target             string            `json:"target"`
+	Weights            []int             `json:"weights,omitempty"`
+	StripPrefix        bool              `json:"strip_prefix"`
+	ReplacePrefix      string            `json:"replace_prefix,omitempty"`
+	HeaderName         string            `json:"header_name,omitempty"`
+	HeaderValue        string            `json:"header_value,omitempty"`
+	Priority           int               `json:"priority"`
+	UpstreamTLS        bool              `json:"upstream_tls,omitempty"`
+	UpstreamServerName string            `json:"upstream_server_name,omitempty"`
+	ClientCAFile       string            `json:"client_ca_file,omitempty"`
+	ProxyProtocol      string            `json:"proxy_protocol,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	ResponseHeaders    map[string]string `json:"response_headers,omitempty"`
+	Draining           bool              `json:"draining,omitempty"`
+	HashKey            string            `json:"hash_key,omitempty"`
+	CanaryTarget       string            `json:"canary_target,omitempty"`
+	BufferBody         bool              `json:"buffer_body,omitempty"`
+	Compress           bool              `json:"compress,omitempty"`
+	BasicAuthUser      string            `json:"basic_auth_user,omitempty"`
+	RateLimit          float64           `json:"rate_limit,omitempty"`
+	RateBurst          int               `json:"rate_burst,omitempty"`
+	RateLimitByClient  bool              `json:"rate_limit_by_client,omitempty"`
+	Source             string            `json:"source,omitempty"`
+	Hits               uint64            `json:"hits"`
+	LastMatched        time.Time         `json:"last_matched,omitempty"`
+}
+
+func describeRoute(route router.StaticRoute) routeInfo {
+	return routeInfo{
+		ID:                 route.ID,
+		Host:               route.Host,
+		Path:               route.PathPrefix,
+		Match:              route.MatchType,
+		Target:             route.Target,
+		Weights:            route.Weights,
+		StripPrefix:        route.StripPrefix,
+		ReplacePrefix:      route.ReplacePrefix,
+		HeaderName:         route.HeaderName,
+		HeaderValue:        route.HeaderValue,
+		Priority:           route.Priority,
+		UpstreamTLS:        route.UpstreamTLS,
+		UpstreamServerName: route.UpstreamServerName,
+		ClientCAFile:       route.ClientCAFile,
+		ProxyProtocol:      route.ProxyProtocol,
+		Labels:             route.Labels,
+		ResponseHeaders:    route.ResponseHeaders,
+		Draining:           route.Draining,
+		HashKey:            route.HashKey,
+		CanaryTarget:       route.CanaryTarget,
+		BufferBody:         route.BufferBody,
+		Compress:           route.Compress,
+		BasicAuthUser:      route.BasicAuthUser,
+		RateLimit:          route.RateLimit,
+		RateBurst:          route.RateBurst,
+		RateLimitByClient:  route.RateLimitByClient,
+		Source:             route.Source,
+		Hits:               route.Hits,
+		LastMatched:        route.LastMatched,
+	}
+}
+
+// routeRequest is the body of POST /routes.
+type routeRequest struct {
+	Host          string            `json:"host"`
+	Path          string            `json:"path"`
+	Match         string            `json:"match"`
+	Target        string            `json:"target"`
+	Weights       []int             `json:"weights"`
+	StripPrefix   bool              `json:"strip_prefix"`
+	ReplacePrefix string            `json:"replace_prefix"`
+	Priority      int               `json:"priority"`
+	Compress      bool              `json:"compress"`
+	HeaderName    string            `json:"header_name"`
+	HeaderValue   string            `json:"header_value"`
+	ProxyProtocol string            `json:"proxy_protocol"`
+	ClientCAFile  string            `json:"client_ca_file"`
+	Labels        map[string]string `json:"labels"`
+
+	ResponseHeaders map[string]string `json:"response_headers"`
+
+	RateLimit         float64 `json:"rate_limit"`
+	RateBurst         int     `json:"rate_burst"`
+	RateLimitByClient bool    `json:"rate_limit_by_client"`
+
+	BasicAuthUser string `json:"basic_auth_user"`
+	BasicAuthHash string `json:"basic_auth_hash"`
+}
+
+// SetRoutesToken sets the bearer token required by the /routes API and the
+// other protected admin endpoints. With no token they are disabled.
+func (s *Server) SetRoutesToken(token string) {
+	s.routesToken = token
+}
+
+// requireToken wraps h so it only runs for requests carrying the admin
+// bearer token. It guards the /routes API and the other endpoints that
+// change how traffic is served.
+func (s *Server) requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.routesToken == "" {
+			writeText(w, http.StatusForbidden, "admin API disabled: "+RoutesTokenEnv+" is not set")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.routesToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gateway-admin"`)
+			writeText(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleListRoutes lists all static routes, optionally filtered by a
+// ?selector= label selector.
+func (s *Server) handleListRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := s.router.ListRoutes()
+	if sel := r.URL.Query().Get("selector"); sel != "" {
+		selector, err := router.ParseLabelSelector(sel)
+		if err != nil {
+			writeText(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		routes = s.router.ListRoutesByLabel(selector)
+	}
+	infos := make([]routeInfo, 0, len(routes))
+	for _, route := range routes {
+		infos = append(infos, describeRoute(route))
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleAddRoute registers or updates a static route from a JSON body.
+func (s *Server) handleAddRoute(w http.ResponseWriter, r *http.Request) {
+	var req routeRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRouteBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeText(w, http.StatusBadRequest, "invalid route: "+err.Error())
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	err := s.router.RegisterStaticRoute(router.StaticRoute{
+		Host:          req.Host,
+		PathPrefix:    req.Path,
+		MatchType:     req.Match,
+		Target:        req.Target,
+		Weights:       req.Weights,
+		StripPrefix:   req.StripPrefix,
+		ReplacePrefix: req.ReplacePrefix,
+		Priority:      req.Priority,
+		Compress:      req.Compress,
+		HeaderName:    req.HeaderName,
+		HeaderValue:   req.HeaderValue,
+		ProxyProtocol: req.ProxyProtocol,
+		ClientCAFile:  req.ClientCAFile,
+		Labels:        req.Labels,
+
+		ResponseHeaders: req.ResponseHeaders,
+
+		RateLimit:         req.RateLimit,
+		RateBurst:         req.RateBurst,
+		RateLimitByClient: req.RateLimitByClient,
+
+		BasicAuthUser: req.BasicAuthUser,
+		BasicAuthHash: req.BasicAuthHash,
+	})
+	switch {
+	case errors.Is(err, router.ErrInvalidRoute):
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, route := range s.router.ListRoutes() {
+		if strings.EqualFold(route.Host, req.Host) && route.PathPrefix == req.Path &&
+			route.HeaderName == req.HeaderName && route.HeaderValue == req.HeaderValue {
+			writeJSON(w, http.StatusCreated, describeRoute(route))
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// weightsRequest is the body of PUT /routes/weights.
+type weightsRequest struct {
+	Host    string `json:"host"`
+	Path    string `json:"path"`
+	Weights []int  `json:"weights"`
+}
+
+// handleSetWeights changes the target weights of an existing route. The
+// route table is swapped in place, so open connections are not dropped.
+func (s *Server) handleSetWeights(w http.ResponseWriter, r *http.Request) {
+	var req weightsRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRouteBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeText(w, http.StatusBadRequest, "invalid weights: "+err.Error())
+		return
+	}
+	if req.Host == "" {
+		writeText(w, http.StatusBadRequest, "host is required")
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+
+	err := s.router.SetRouteWeights(req.Host, req.Path, req.Weights)
+	switch {
+	case errors.Is(err, router.ErrNoRoute):
+		writeText(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, router.ErrInvalidWeights):
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, route := range s.router.ListRoutes() {
+		if strings.EqualFold(route.Host, req.Host) && route.PathPrefix == req.Path && route.HeaderName == "" {
+			writeJSON(w, http.StatusOK, describeRoute(route))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteRoute removes the static route given by ?host= and ?path=,
+// plus ?header_name= and ?header_value= for a route with a header condition,
+// or every route matching a ?selector= label selector.
+func (s *Server) handleDeleteRoute(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	host := query.Get("host")
+	path := query.Get("path")
+	if query.Has("selector") {
+		if host != "" {
+			writeText(w, http.StatusBadRequest, "host and selector cannot be combined")
+			return
+		}
+		s.deleteRoutesBySelector(w, r)
+		return
+	}
+	if host == "" {
+		writeText(w, http.StatusBadRequest, "host is required")
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	err := s.router.UnregisterConditionalRoute(host, path, query.Get("header_name"), query.Get("header_value"))
+	switch {
+	case errors.Is(err, router.ErrNoRoute):
+		writeText(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// routeSelector parses the ?selector= of a bulk route operation. An empty
+// selector would match every route, so it is refused like an invalid one.
+// On failure it writes a 400 and returns false.
+func routeSelector(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	selector, err := router.ParseLabelSelector(r.URL.Query().Get("selector"))
+	if err == nil && len(selector) == 0 {
+		err = router.ErrEmptySelector
+	}
+	if err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return selector, true
+}
+
+// deleteRoutesBySelector removes every static route matching ?selector=.
+func (s *Server) deleteRoutesBySelector(w http.ResponseWriter, r *http.Request) {
+	selector, ok := routeSelector(w, r)
+	if !ok {
+		return
+	}
+	n, err := s.router.UnregisterRoutesByLabel(selector)
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": n})
+}
+
+// handleDrainRoutes marks every static route matching ?selector= as
+// draining, or clears the flag with ?draining=false.
+func (s *Server) handleDrainRoutes(w http.ResponseWriter, r *http.Request) {
+	selector, ok := routeSelector(w, r)
+	if !ok {
+		return
+	}
+	draining := true
+	if v := r.URL.Query().Get("draining"); v != "" {
+		var err error
+		if draining, err = strconv.ParseBool(v); err != nil {
+			writeText(w, http.StatusBadRequest, "invalid draining value "+strconv.Quote(v))
+			return
+		}
+	}
+	n, err := s.router.DrainRoutesByLabel(selector, draining)
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"routes": n, "draining": draining})
+}
@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+const testToken = "secret"
+
+// request sends an authorized admin request and returns the status code.
+func request(s *Server, method, target string) int {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestBulkRouteEndpointsValidateSelector(t *testing.T) {
+	s := New(&router.Router{}, nil)
+	s.SetRoutesToken(testToken)
+
+	tests := []struct {
+		method, target string
+	}{
+		{http.MethodPost, "/routes/drain"},
+		{http.MethodPost, "/routes/drain?selector="},
+		{http.MethodPost, "/routes/drain?selector=team"},
+		{http.MethodPost, "/routes/drain?selector=team=payments&draining=maybe"},
+		{http.MethodDelete, "/routes?selector="},
+		{http.MethodDelete, "/routes?selector=team=pay%20ments"},
+		{http.MethodDelete, "/routes?selector=team=payments&host=app.example"},
+	}
+	for _, tt := range tests {
+		if code := request(s, tt.method, tt.target); code != http.StatusBadRequest {
+			t.Errorf("%s %s = %d, want 400", tt.method, tt.target, code)
+		}
+	}
+}
+
+func TestBulkRouteEndpointsRequireToken(t *testing.T) {
+	s := New(&router.Router{}, nil)
+	s.SetRoutesToken(testToken)
+
+	req := httptest.NewRequest(http.MethodPost, "/routes/drain?selector=team=payments", nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /routes/drain without token = %d, want 401", rec.Code)
+	}
+}
+
+func TestListRoutesShowsPriority(t *testing.T) {
+	s := New(router.NewStatic([]router.StaticRoute{{Host: "app.example", PathPrefix: "/api", Target: "a:80", Priority: 42}}), nil)
+	s.SetRoutesToken(testToken)
+
+	req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	var routes []routeInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("GET /routes = %d %q: %v", rec.Code, rec.Body, err)
+	}
+	if len(routes) != 1 || routes[0].Priority != 42 {
+		t.Errorf("GET /routes = %+v, want one route with priority 42", routes)
+	}
+}
+
+func TestMaintenanceActionRequiresToken(t *testing.T) {
+	s := New(&router.Router{}, nil)
+	s.SetRoutesToken(testToken)
+
+	req := httptest.NewRequest(http.MethodPost, "/maintenance/enable", nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /maintenance/enable without token = %d, want 401", rec.Code)
+	}
+}
+
+func TestCanaryActionRequiresToken(t *testing.T) {
+	s := New(&router.Router{}, nil)
+	s.SetRoutesToken(testToken)
+
+	for _, action := range []string{"pause", "resume", "abort"} {
+		req := httptest.NewRequest(http.MethodPost, "/canaries/"+action+"?host=app.example", nil)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST /canaries/%s without token = %d, want 401", action, rec.Code)
+		}
+	}
+}
+
+func TestAddRouteRejectsInvalidRoute(t *testing.T) {
+	s := New(router.NewStatic([]router.StaticRoute{
+		{Host: "secure.example", PathPrefix: "/admin", Target: "a:80", ClientCAFile: "/etc/ca/admin.pem"},
+	}), nil)
+	s.SetRoutesToken(testToken)
+
+	for _, body := range []string{
+		`{"path": "/", "target": "a:80"}`,
+		`{"host": "app.example", "path": "api", "target": "a:80"}`,
+		`{"host": "app.example", "target": "not a target"}`,
+		`{"host": "app.example", "target": "a:80", "proxy_protocol": "v9"}`,
+		`{"host": "secure.example", "path": "/ops", "target": "a:80", "client_ca_file": "/etc/ca/ops.pem"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST /routes %s = %d %q, want 400", body, rec.Code, rec.Body)
+		}
+	}
+}
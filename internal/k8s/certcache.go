@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultCertCacheSecret is the Secret holding ACME account keys and certificates.
+const DefaultCertCacheSecret = "gateway-acme-certs"
+
+// SecretCache is an autocert.Cache that keeps every entry as a field of a
+// single Secret, so certificates survive restarts and are shared by replicas.
+type SecretCache struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	mu        sync.Mutex // serializes read-modify-write updates of the Secret
+}
+
+// NewSecretCache returns a cache backed by the named Secret in
+// SecretNamespace, created on first write.
+func NewSecretCache(name string) (*SecretCache, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return &SecretCache{clientset: clientset, namespace: SecretNamespace, name: name}, nil
+}
+
+// secretKey maps an autocert cache key to a valid Secret data key. Cache keys
+// are hostnames with an optional "+rsa" suffix, or "acme_account+key".
+func secretKey(key string) string {
+	return strings.ReplaceAll(key, "+", "_")
+}
+
+// Get returns the cached entry for key, or autocert.ErrCacheMiss.
+func (c *SecretCache) Get(ctx context.Context, key string) ([]byte, error) {
+	secret, err := c.clientset.CoreV1().Secrets(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	data, ok := secret.Data[secretKey(key)]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+// Put stores data under key, creating the Secret if needed.
+func (c *SecretCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.update(ctx, func(fields map[string][]byte) {
+		fields[secretKey(key)] = data
+	})
+}
+
+// Delete removes key from the cache.
+func (c *SecretCache) Delete(ctx context.Context, key string) error {
+	return c.update(ctx, func(fields map[string][]byte) {
+		delete(fields, secretKey(key))
+	})
+}
+
+// update applies fn to the Secret's data and writes it back.
+func (c *SecretCache) update(ctx context.Context, fn func(map[string][]byte)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	secrets := c.clientset.CoreV1().Secrets(c.namespace)
+	secret, err := secrets.Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.name,
+				Namespace: c.namespace,
+				Labels: map[string]string{
+					"app": "gateway",
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: make(map[string][]byte),
+		}
+		fn(secret.Data)
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	fn(secret.Data)
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret: %w", err)
+	}
+	return nil
+}
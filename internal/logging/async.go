@@ -0,0 +1,110 @@
+// Package logging provides slog plumbing that keeps the proxy hot path
+// independent of the remote log service.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBufferSize is how many log records may wait for the log service
+// before new ones are dropped.
+const DefaultBufferSize = 4096
+
+// AsyncHandler hands records to a wrapped handler on a background goroutine
+// through a bounded queue. Handle never blocks: when the queue is full the
+// record is dropped and counted. Handlers derived with WithAttrs or
+// WithGroup share the queue.
+type AsyncHandler struct {
+	inner slog.Handler
+	q     *queue
+}
+
+type entry struct {
+	h   slog.Handler
+	ctx context.Context
+	r   slog.Record
+}
+
+type queue struct {
+	entries   chan entry
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+	stop      chan struct{} // closed by Close
+	done      chan struct{} // closed once the queue is drained after stop
+}
+
+// NewAsyncHandler wraps inner with a queue of size records. Non-positive
+// sizes use DefaultBufferSize.
+func NewAsyncHandler(inner slog.Handler, size int) *AsyncHandler {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	q := &queue{
+		entries: make(chan entry, size),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return &AsyncHandler{inner: inner, q: q}
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case e := <-q.entries:
+			e.h.Handle(e.ctx, e.r)
+		case <-q.stop:
+			for {
+				select {
+				case e := <-q.entries:
+					e.h.Handle(e.ctx, e.r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Enabled reports whether the wrapped handler handles records at level.
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle queues r for the wrapped handler, dropping it if the queue is full.
+func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	// The caller's context may be cancelled before the record is written
+	e := entry{h: h.inner, ctx: context.WithoutCancel(ctx), r: r.Clone()}
+	select {
+	case h.q.entries <- e:
+	default:
+		h.q.dropped.Add(1)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{inner: h.inner.WithAttrs(attrs), q: h.q}
+}
+
+// WithGroup returns a handler that nests later attributes under name.
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{inner: h.inner.WithGroup(name), q: h.q}
+}
+
+// Dropped returns how many records were discarded because the queue was full.
+func (h *AsyncHandler) Dropped() uint64 {
+	return h.q.dropped.Load()
+}
+
+// Close writes the records queued so far and stops the background
+// goroutine. Records logged afterwards are never written.
+func (h *AsyncHandler) Close() {
+	h.q.closeOnce.Do(func() { close(h.q.stop) })
+	<-h.q.done
+}
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultErrorBufferSize is how many recent error records are kept.
+const DefaultErrorBufferSize = 100
+
+// ErrorEntry is one captured error-level log record.
+type ErrorEntry struct {
+	Time    time.Time      `json:"time"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// ErrorRing is a slog.Handler that keeps the most recent error-level records
+// in a fixed-size ring buffer, for inspection without log aggregation.
+type ErrorRing struct {
+	ring   *errorRing
+	attrs  []slog.Attr // from WithAttrs, already prefixed with their groups
+	prefix string      // group path from WithGroup, e.g. "req."
+}
+
+type errorRing struct {
+	mu      sync.Mutex
+	entries []ErrorEntry
+	next    int  // slot for the next entry
+	full    bool // whether entries has wrapped
+}
+
+// NewErrorRing keeps the last size error records. Non-positive sizes use
+// DefaultErrorBufferSize.
+func NewErrorRing(size int) *ErrorRing {
+	if size <= 0 {
+		size = DefaultErrorBufferSize
+	}
+	return &ErrorRing{ring: &errorRing{entries: make([]ErrorEntry, size)}}
+}
+
+// Enabled reports whether level is error or above.
+func (h *ErrorRing) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelError
+}
+
+// Handle stores r, evicting the oldest entry when the buffer is full.
+func (h *ErrorRing) Handle(_ context.Context, r slog.Record) error {
+	entry := ErrorEntry{Time: r.Time, Message: r.Message}
+	if len(h.attrs) > 0 || r.NumAttrs() > 0 {
+		entry.Fields = make(map[string]any, len(h.attrs)+r.NumAttrs())
+		for _, a := range h.attrs {
+			addField(entry.Fields, "", a)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			addField(entry.Fields, h.prefix, a)
+			return true
+		})
+	}
+
+	h.ring.mu.Lock()
+	defer h.ring.mu.Unlock()
+	h.ring.entries[h.ring.next] = entry
+	h.ring.next = (h.ring.next + 1) % len(h.ring.entries)
+	if h.ring.next == 0 {
+		h.ring.full = true
+	}
+	return nil
+}
+
+// addField flattens a into fields, joining group names with dots.
+func addField(fields map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for _, ga := range v.Group() {
+			addField(fields, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	if v.Kind() == slog.KindAny {
+		// Errors and other values often have no useful JSON form
+		fields[prefix+a.Key] = v.String()
+		return
+	}
+	fields[prefix+a.Key] = v.Any()
+}
+
+// WithAttrs returns a handler that adds attrs to every captured record.
+func (h *ErrorRing) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+	return &h2
+}
+
+// WithGroup returns a handler that nests later attributes under name.
+func (h *ErrorRing) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// Recent returns the captured records, newest first.
+func (h *ErrorRing) Recent() []ErrorEntry {
+	h.ring.mu.Lock()
+	defer h.ring.mu.Unlock()
+
+	n := h.ring.next
+	if h.ring.full {
+		n = len(h.ring.entries)
+	}
+	recent := make([]ErrorEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (h.ring.next - i + len(h.ring.entries)) % len(h.ring.entries)
+		recent = append(recent, h.ring.entries[idx])
+	}
+	return recent
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// teeHandler sends each record to every handler that accepts its level.
+type teeHandler []slog.Handler
+
+// Tee returns a handler that forwards records to all of handlers.
+func Tee(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := make(teeHandler, len(t))
+	for i, h := range t {
+		derived[i] = h.WithAttrs(attrs)
+	}
+	return derived
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	derived := make(teeHandler, len(t))
+	for i, h := range t {
+		derived[i] = h.WithGroup(name)
+	}
+	return derived
+}
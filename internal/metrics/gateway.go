@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Proxy byte directions.
+const (
+	DirectionUpstream   = "upstream"   // client to backend
+	DirectionDownstream = "downstream" // backend to client
+)
+
+var (
+	// ConnectionsTotal counts accepted client connections by detected protocol.
+	ConnectionsTotal = NewCounterVec("gateway_connections_total",
+		"Client connections accepted, by protocol.", "protocol")
+
+	// ActiveConnections tracks connections currently being handled. Connections
+	// on multi-protocol ports move from "multi" to their detected protocol.
+	ActiveConnections = NewGaugeVec("gateway_active_connections",
+		"Connections currently being handled, by protocol.", "protocol")
+
+	// AcceptRate is the per-second accept rate over the last sampling
+	// interval, for autoscalers that cannot compute rate() themselves.
+	AcceptRate = NewGaugeVec("gateway_accept_rate_per_second",
+		"Connections accepted per second over the last sampling interval, by protocol.", "protocol")
+
+	// ProxyBytesTotal counts bytes relayed between clients and backends.
+	ProxyBytesTotal = NewCounterVec("gateway_proxy_bytes_total",
+		"Bytes proxied between clients and backends, by direction.", "direction")
+
+	// BackendDialErrorsTotal counts failed backend connection attempts by target address.
+	BackendDialErrorsTotal = NewCounterVec("gateway_backend_dial_errors_total",
+		"Failed backend dials, by target address.", "target")
+
+	// BackendResponsesTotal counts final responses from HTTP backends by
+	// status class, read from the status line before the body is relayed.
+	BackendResponsesTotal = NewCounterVec("gateway_backend_responses_total",
+		"Final HTTP responses received from backends, by status class.", "code")
+
+	// BackendDialDuration observes how long backend dials take, including
+	// the TLS handshake for re-encrypted upstreams.
+	BackendDialDuration = NewHistogramVec("gateway_backend_dial_duration_seconds",
+		"Backend dial latency in seconds, by protocol.", DefaultBuckets, "protocol")
+
+	// HostActiveConnections counts client connections per destination host
+	// that has a connection limit. A host's series is removed when its count
+	// reaches zero.
+	HostActiveConnections = NewGaugeVec("gateway_host_active_connections",
+		"Client connections currently held against a host's connection limit.", "host")
+
+	// HostConnectionsRejected counts connections turned away because their
+	// destination host was at its connection limit. Hosts capped only by the
+	// default limit share the "*" label.
+	HostConnectionsRejected = NewCounterVec("gateway_host_connections_rejected_total",
+		"Connections rejected because the destination host was at its connection limit.", "host")
+
+	// PortInflight counts detected connections per protocol on multi-protocol
+	// ports that have protocol reservations.
+	PortInflight = NewGaugeVec("gateway_port_inflight_connections",
+		"Connections in flight on a reserved multi-protocol port, by port and protocol.", "port", "protocol")
+
+	// PortReservationRejected counts connections turned away because their
+	// protocol had no slot left on a reserved port.
+	PortReservationRejected = NewCounterVec("gateway_port_reservation_rejected_total",
+		"Connections rejected by multi-protocol port reservations, by port and protocol.", "port", "protocol")
+
+	// CanaryPercent is the share of a route's requests currently sent to its
+	// canary target.
+	CanaryPercent = NewGaugeVec("gateway_canary_percent",
+		"Percentage of requests routed to the canary target, by route.", "host", "path")
+
+	// TLSCertExpiryDays is the remaining lifetime of each loaded TLS
+	// certificate, negative once expired.
+	TLSCertExpiryDays = NewGaugeVec("gateway_tls_cert_expiry_days",
+		"Days until each loaded TLS certificate expires, by certificate name.", "cert")
+
+	// TLSCertExpirySeconds is the remaining lifetime of each TLS certificate
+	// in use, loaded or obtained through ACME, negative once expired.
+	TLSCertExpirySeconds = NewGaugeVec("gateway_cert_expiry_seconds",
+		"Seconds until each TLS certificate in use expires, by common name.", "cn")
+)
+
+// AddProxyBytes adds n bytes to the proxied byte count for direction.
+func AddProxyBytes(direction string, n int64) {
+	if n > 0 {
+		ProxyBytesTotal.WithLabelValues(direction).Add(uint64(n))
+	}
+}
+
+// ObserveBackendStatus counts a backend response under its status class,
+// e.g. "5xx" for 503.
+func ObserveBackendStatus(status int) {
+	class := "other"
+	if status >= 100 && status < 600 {
+		class = strconv.Itoa(status/100) + "xx"
+	}
+	BackendResponsesTotal.WithLabelValues(class).Inc()
+}
+
+// ObserveDial records the outcome of a backend dial that took elapsed.
+func ObserveDial(protocol, target string, elapsed time.Duration, err error) {
+	BackendDialDuration.WithLabelValues(protocol).Observe(elapsed.Seconds())
+	if err != nil {
+		BackendDialErrorsTotal.WithLabelValues(target).Inc()
+	}
+}
@@ -0,0 +1,384 @@
+// Package metrics implements a minimal Prometheus-compatible metrics registry
+// and text exposition endpoint for the gateway.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector writes its samples in Prometheus text format.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]collector)
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[c.name()]; exists {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry[c.name()] = c
+}
+
+// Handler serves all registered metrics in Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.Lock()
+		collectors := make([]collector, 0, len(registry))
+		for _, c := range registry {
+			collectors = append(collectors, c)
+		}
+		registryMu.Unlock()
+
+		sort.Slice(collectors, func(i, j int) bool {
+			return collectors[i].name() < collectors[j].name()
+		})
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+// desc holds the metadata shared by all metric types.
+type desc struct {
+	metricName string
+	help       string
+	kind       string // counter, gauge, histogram
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, d.help, d.metricName, d.kind)
+}
+
+// labelString formats label pairs as {a="x",b="y"}, or "" when there are none.
+func labelString(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n.
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the value.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Add adds delta, which may be negative.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Inc adds one.
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec subtracts one.
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+// vec holds labelled children of one metric.
+type vec[T any] struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+	newChild func() *T
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = append([]string(nil), values...)
+	return child
+}
+
+// delete removes the child with the given label values.
+func (v *vec[T]) delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	delete(v.children, key)
+	delete(v.values, key)
+	v.mu.Unlock()
+}
+
+// each calls fn for every child in label order.
+func (v *vec[T]) each(fn func(labels string, child *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labels string
+		child  *T
+	}
+	entries := make([]entry, len(keys))
+	for i, key := range keys {
+		entries[i] = entry{labelString(v.labels, v.values[key]), v.children[key]}
+	}
+	v.mu.RUnlock()
+
+	for _, e := range entries {
+		fn(e.labels, e.child)
+	}
+}
+
+func newVec[T any](name, help, kind string, labels []string, newChild func() *T) *vec[T] {
+	return &vec[T]{
+		desc:     desc{metricName: name, help: help, kind: kind, labels: labels},
+		children: make(map[string]*T),
+		values:   make(map[string][]string),
+		newChild: newChild,
+	}
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec registers a labelled counter. With no labels it has a single child.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	register(v)
+	return v
+}
+
+// WithLabelValues returns the counter for the given label values, creating it if needed.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter { return v.with(values...) }
+
+// DeleteLabelValues removes the counter for the given label values.
+func (v *CounterVec) DeleteLabelValues(values ...string) { v.delete(values...) }
+
+// Snapshot returns the current value of every child, keyed by its label
+// values joined with ",".
+func (v *CounterVec) Snapshot() map[string]uint64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	out := make(map[string]uint64, len(v.children))
+	for key, c := range v.children {
+		out[strings.Join(v.values[key], ",")] = c.Value()
+	}
+	return out
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %d\n", v.metricName, labels, c.Value())
+	})
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// NewGaugeVec registers a labelled gauge.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	register(v)
+	return v
+}
+
+// WithLabelValues returns the gauge for the given label values, creating it if needed.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge { return v.with(values...) }
+
+// DeleteLabelValues removes the gauge for the given label values.
+func (v *GaugeVec) DeleteLabelValues(values ...string) { v.delete(values...) }
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, labels, formatFloat(g.Value()))
+	})
+}
+
+// GaugeFunc is a gauge whose value is computed at scrape time.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls fn on every scrape.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{metricName: name, help: help, kind: "gauge"}, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// CounterFunc is a counter whose value is read at scrape time.
+type CounterFunc struct {
+	desc
+	fn func() uint64
+}
+
+// NewCounterFunc registers a counter that calls fn on every scrape.
+func NewCounterFunc(name, help string, fn func() uint64) *CounterFunc {
+	c := &CounterFunc{desc: desc{metricName: name, help: help, kind: "counter"}, fn: fn}
+	register(c)
+	return c
+}
+
+func (c *CounterFunc) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	fmt.Fprintf(w, "%s %d\n", c.metricName, c.fn())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // per bucket, non-cumulative
+	count       atomic.Uint64
+	sumBits     atomic.Uint64
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// DefaultBuckets suit latencies in seconds from 1ms to 10s.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewHistogramVec registers a labelled histogram with the given bucket upper bounds.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	v := &HistogramVec{newVec(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{upperBounds: bounds, counts: make([]atomic.Uint64, len(bounds))}
+	})}
+	register(v)
+	return v
+}
+
+// WithLabelValues returns the histogram for the given label values, creating it if needed.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram { return v.with(values...) }
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, h *Histogram) {
+		// Bucket lines need the "le" label merged into the child's labels
+		prefix := "{"
+		if labels != "" {
+			prefix = labels[:len(labels)-1] + ","
+		}
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += h.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%sle=\"%s\"} %d\n", v.metricName, prefix, formatFloat(bound), cumulative)
+		}
+		count := h.count.Load()
+		fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n", v.metricName, prefix, count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.metricName, labels, formatFloat(math.Float64frombits(h.sumBits.Load())))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.metricName, labels, count)
+	})
+}
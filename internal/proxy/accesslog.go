@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects how per-request access log entries are written.
+type AccessLogFormat string
+
+const (
+	AccessLogOff      AccessLogFormat = "off"      // no access logging
+	AccessLogJSON     AccessLogFormat = "json"     // structured slog record
+	AccessLogCombined AccessLogFormat = "combined" // Apache combined log format
+	AccessLogCommon   AccessLogFormat = "common"   // Apache common log format
+)
+
+// ParseAccessLogFormat validates an access log format name.
+func ParseAccessLogFormat(s string) (AccessLogFormat, error) {
+	switch f := AccessLogFormat(strings.ToLower(s)); f {
+	case AccessLogOff, AccessLogJSON, AccessLogCombined, AccessLogCommon:
+		return f, nil
+	case "":
+		return AccessLogOff, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q (want off, json, combined or common)", s)
+}
+
+// accessLogger writes access log entries in the configured format.
+type accessLogger struct {
+	format AccessLogFormat
+	mu     sync.Mutex   // serializes writes to out
+	out    io.Writer    // destination for Apache formats
+	json   *slog.Logger // destination for JSON entries
+}
+
+// accessLogEntry holds the fields recorded for one proxied HTTP request.
+type accessLogEntry struct {
+	clientAddr  string
+	user        string
+	time        time.Time // when the request was received
+	duration    time.Duration
+	requestLine string
+	method      string
+	path        string
+	host        string
+	target      string // backend the request was proxied to
+	requestID   string
+	status      int
+	bytes       int64 // response body bytes sent to the client
+	referer     string
+	userAgent   string
+}
+
+// SetAccessLog enables access logging in the given format, written to w.
+// JSON entries are written to w one object per line, or go through the
+// default slog logger when w is nil.
+func (s *Server) SetAccessLog(format AccessLogFormat, w io.Writer) {
+	if format == AccessLogOff || format == "" {
+		s.accessLog = nil
+		return
+	}
+	l := &accessLogger{format: format, out: w, json: slog.Default()}
+	if format == AccessLogJSON && w != nil {
+		l.json = slog.New(slog.NewJSONHandler(w, nil))
+	}
+	s.accessLog = l
+}
+
+// newAccessLogEntry fills the request-side fields of an access log entry.
+func newAccessLogEntry(clientAddr string, req *httpRequest) *accessLogEntry {
+	headers := string(req.header)
+	return &accessLogEntry{
+		clientAddr:  clientAddr,
+		user:        extractBasicAuthUser(headers),
+		time:        req.received,
+		requestLine: extractRequestLine(headers),
+		method:      req.method,
+		path:        req.path,
+		host:        req.host,
+		requestID:   req.id,
+		referer:     headerValue(headers, "Referer"),
+		userAgent:   headerValue(headers, "User-Agent"),
+	}
+}
+
+// log writes an entry.
+func (l *accessLogger) log(e *accessLogEntry) {
+	if l.format == AccessLogJSON {
+		l.json.Info("access",
+			"client", clientIP(e.clientAddr),
+			"user", e.user,
+			"method", e.method,
+			"host", e.host,
+			"path", e.path,
+			"request_line", e.requestLine,
+			"target", e.target,
+			"status", e.status,
+			"bytes", e.bytes,
+			"duration_ms", float64(e.duration.Microseconds())/1000,
+			"request_id", e.requestID,
+			"referer", e.referer,
+			"user_agent", e.userAgent,
+		)
+		return
+	}
+
+	var line string
+	if l.format == AccessLogCombined {
+		line = e.combined()
+	} else {
+		line = e.common()
+	}
+
+	l.mu.Lock()
+	io.WriteString(l.out, line+"\n")
+	l.mu.Unlock()
+}
+
+// common formats the entry in Apache common log format:
+// host ident authuser [date] "request" status bytes
+func (e *accessLogEntry) common() string {
+	size := "-"
+	if e.bytes > 0 {
+		size = strconv.FormatInt(e.bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s",
+		clientIP(e.clientAddr),
+		orDash(e.user),
+		e.time.Format("02/Jan/2006:15:04:05 -0700"),
+		quoteLogField(e.requestLine),
+		e.status,
+		size,
+	)
+}
+
+// combined formats the entry in Apache combined log format, which appends
+// the quoted Referer and User-Agent to the common format.
+func (e *accessLogEntry) combined() string {
+	return e.common() + " " + quoteLogField(orDash(e.referer)) + " " + quoteLogField(orDash(e.userAgent))
+}
+
+// quoteLogField wraps a value in double quotes, escaping quotes, backslashes
+// and control characters so a client cannot forge log lines.
+func quoteLogField(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// extractBasicAuthUser returns the username from a Basic Authorization header, or "".
+func extractBasicAuthUser(headers string) string {
+	user, _, _ := basicAuthCredentials(headerValue(headers, "Authorization"))
+	return user
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// EnableACME obtains and renews certificates from Let's Encrypt on demand for
+// any host with a static route, keeping them in cache. Certificates loaded
+// with LoadTLSCert still take precedence for the hosts they cover. HTTP-01
+// challenges are answered on the plain HTTP listener.
+func (s *Server) EnableACME(email string, cache autocert.Cache) {
+	s.acme = &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Email:      email,
+		Cache:      cache,
+		HostPolicy: s.acmeHostPolicy,
+	}
+	s.ensureTLSConfig()
+	slog.Info("ACME certificate provisioning enabled", "email", email)
+}
+
+// acmeCertificate gets the certificate for hello from the ACME manager and
+// remembers it per host, so expiry checks and the admin API cover ACME
+// certificates too. A certificate not seen before, such as a renewal, has
+// its expiry inspected right away.
+func (s *Server) acmeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := s.acme.GetCertificate(hello)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := certLeaf(*cert)
+	if err != nil {
+		return cert, nil
+	}
+	host := normalizeHost(hello.ServerName)
+
+	s.acmeMu.Lock()
+	old := s.acmeCerts[host]
+	seen := old != nil && old.Leaf == leaf
+	if !seen {
+		if s.acmeCerts == nil {
+			s.acmeCerts = make(map[string]*tls.Certificate)
+		}
+		s.acmeCerts[host] = &tls.Certificate{Certificate: cert.Certificate, Leaf: leaf}
+	}
+	s.acmeMu.Unlock()
+
+	if !seen {
+		s.inspectCert(leaf)
+	}
+	return cert, nil
+}
+
+// acmeCertificates returns the ACME certificates served so far, ordered by
+// host. They hold no private key.
+func (s *Server) acmeCertificates() []*tls.Certificate {
+	s.acmeMu.Lock()
+	defer s.acmeMu.Unlock()
+	hosts := make([]string, 0, len(s.acmeCerts))
+	for host := range s.acmeCerts {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	certs := make([]*tls.Certificate, len(hosts))
+	for i, host := range hosts {
+		certs[i] = s.acmeCerts[host]
+	}
+	return certs
+}
+
+// acmeHostPolicy only allows certificates for hosts with a static route, on
+// any path, so arbitrary SNI values cannot make the gateway request
+// certificates.
+func (s *Server) acmeHostPolicy(ctx context.Context, host string) error {
+	if !s.router.HasStaticRoute(host) {
+		return fmt.Errorf("acme: no static route for host %q", host)
+	}
+	return nil
+}
+
+// serveACMEChallenge answers an HTTP-01 challenge for a token the ACME
+// manager is waiting on. Other requests, including challenges for tokens it
+// does not know, are left to be proxied. Reports whether it responded.
+func (s *Server) serveACMEChallenge(conn net.Conn, req *httpRequest) bool {
+	if s.acme == nil || !strings.HasPrefix(req.path, acmeChallengePrefix) {
+		return false
+	}
+	httpReq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(req.header)))
+	if err != nil {
+		return false
+	}
+	httpReq.Host = req.host
+
+	resp := &bufferedResponse{header: make(http.Header)}
+	s.acme.HTTPHandler(nil).ServeHTTP(resp, httpReq)
+	if resp.status != http.StatusOK {
+		return false
+	}
+
+	req.logger().Info("answered ACME HTTP-01 challenge", "host", req.host, "path", req.path)
+	s.writeResponse(conn, req, gatewayResponse{
+		status:      http.StatusOK,
+		body:        resp.body.String(),
+		contentType: "text/plain",
+	})
+	return true
+}
+
+// bufferedResponse captures an http.Handler's response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header { return r.header }
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestACMEHostPolicy(t *testing.T) {
+	s := NewServer(router.NewStatic([]router.StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "a:80"},
+		{Host: "api.example", PathPrefix: "/api", Target: "b:80"},
+		{Host: "re.example", PathPrefix: "^/v[0-9]+/", MatchType: router.MatchRegex, Target: "c:80"},
+	}), "")
+
+	for host, allowed := range map[string]bool{
+		"app.example":   true,
+		"api.example":   true, // only sub-path routes
+		"re.example":    true,
+		"other.example": false,
+	} {
+		err := s.acmeHostPolicy(context.Background(), host)
+		if (err == nil) != allowed {
+			t.Errorf("acmeHostPolicy(%q) = %v, want allowed=%v", host, err, allowed)
+		}
+	}
+}
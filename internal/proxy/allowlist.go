@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// SetPortAllowlist restricts a listener port to clients whose address falls
+// in one of prefixes. Connections from other sources are closed right after
+// accept. An empty list removes the restriction.
+func (s *Server) SetPortAllowlist(port int, prefixes []netip.Prefix) {
+	if len(prefixes) == 0 {
+		delete(s.portAllowlists, port)
+		return
+	}
+	s.portAllowlists[port] = prefixes
+}
+
+// sourceAllowed reports whether a client at addr may connect to port.
+func (s *Server) sourceAllowed(port int, addr net.Addr) bool {
+	prefixes, ok := s.portAllowlists[port]
+	if !ok {
+		return true
+	}
+	return prefixesContain(prefixes, addr)
+}
+
+// prefixesContain reports whether the IP address of addr falls in one of
+// prefixes. Addresses that are not IP addresses are in none.
+func prefixesContain(prefixes []netip.Prefix, addr net.Addr) bool {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	default:
+		ip, _ = netip.ParseAddr(clientIP(addr.String()))
+	}
+	if !ip.IsValid() {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectDisallowedSource closes conn if its source may not use port.
+func (s *Server) rejectDisallowedSource(port int, conn net.Conn) bool {
+	if s.sourceAllowed(port, conn.RemoteAddr()) {
+		return false
+	}
+	slog.Warn("rejecting connection from source outside port allowlist", "port", port, "client", conn.RemoteAddr().String())
+	conn.Close()
+	return true
+}
+
+// ParsePortAllowlists parses a comma-separated list of port=sources entries,
+// where the port may be a range and sources is a "|"-separated list of CIDRs
+// or addresses: "8500-8599=10.0.0.0/8|192.168.1.5,8022=10.0.0.0/8".
+func ParsePortAllowlists(s string) (map[int][]netip.Prefix, error) {
+	allowlists := make(map[int][]netip.Prefix)
+	if strings.TrimSpace(s) == "" {
+		return allowlists, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		ports, sources, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || sources == "" {
+			return nil, fmt.Errorf("invalid port allowlist %q: want port=cidr|cidr", entry)
+		}
+
+		var prefixes []netip.Prefix
+		for _, src := range strings.Split(sources, "|") {
+			prefix, err := parseSourcePrefix(strings.TrimSpace(src))
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+
+		lo, hi, err := parsePortRange(ports)
+		if err != nil {
+			return nil, err
+		}
+		for port := lo; port <= hi; port++ {
+			allowlists[port] = append(allowlists[port], prefixes...)
+		}
+	}
+	return allowlists, nil
+}
+
+// parseSourcePrefix parses a CIDR, or a single address as a full-length prefix.
+func parseSourcePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestParsePortAllowlists(t *testing.T) {
+	got, err := ParsePortAllowlists("8500-8502=10.0.0.0/8|192.168.1.5, 8022=10.1.2.3/16,8500=::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.5/32")}
+	want := map[int][]netip.Prefix{
+		8500: append(append([]netip.Prefix(nil), internal...), netip.MustParsePrefix("::1/128")),
+		8501: internal,
+		8502: internal,
+		8022: {netip.MustParsePrefix("10.1.0.0/16")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePortAllowlists() = %v, want %v", got, want)
+	}
+
+	if got, err := ParsePortAllowlists(" "); err != nil || len(got) != 0 {
+		t.Errorf("ParsePortAllowlists(\"\") = %v, %v; want no allowlists", got, err)
+	}
+	for _, bad := range []string{"8500", "8500=", "8500=10.0.0.0/33", "8500=host.example", "x=10.0.0.0/8", "8600-8500=10.0.0.0/8"} {
+		if _, err := ParsePortAllowlists(bad); err == nil {
+			t.Errorf("ParsePortAllowlists(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSourceAllowed(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	s.SetPortAllowlist(8500, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	tests := []struct {
+		port int
+		addr net.Addr
+		want bool
+	}{
+		{8500, &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5000}, true},
+		{8500, &net.TCPAddr{IP: net.ParseIP("::ffff:10.1.2.3"), Port: 5000}, true},
+		{8500, &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}, false},
+		{8500, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 5000}, false},
+		{8501, &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}, true}, // no allowlist
+	}
+	for _, tt := range tests {
+		if got := s.sourceAllowed(tt.port, tt.addr); got != tt.want {
+			t.Errorf("sourceAllowed(%d, %s) = %v, want %v", tt.port, tt.addr, got, tt.want)
+		}
+	}
+
+	s.SetPortAllowlist(8500, nil)
+	if !s.sourceAllowed(8500, &net.TCPAddr{IP: net.ParseIP("192.168.1.1")}) {
+		t.Error("source rejected after the allowlist was removed")
+	}
+}
+
+func TestPortAllowlistOnAccept(t *testing.T) {
+	for name, tt := range map[string]struct {
+		prefix  string
+		allowed bool
+	}{
+		"allowed source": {"127.0.0.0/8", true},
+		"denied source":  {"10.0.0.0/8", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			port := ln.Addr().(*net.TCPAddr).Port
+
+			s := NewServer(&router.Router{}, "")
+			s.SetPortAllowlist(port, []netip.Prefix{netip.MustParsePrefix(tt.prefix)})
+			handled := make(chan struct{}, 1)
+			go s.serve(ln, port, ProtocolHTTP, func(conn net.Conn) {
+				handled <- struct{}{}
+				io.WriteString(conn, "ok")
+				conn.Close()
+			})
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			got, _ := io.ReadAll(conn)
+
+			if tt.allowed && string(got) != "ok" {
+				t.Errorf("allowed source got %q, want the handler's reply", got)
+			}
+			if !tt.allowed {
+				select {
+				case <-handled:
+					t.Error("denied source reached the handler")
+				default:
+				}
+				if len(got) != 0 {
+					t.Errorf("denied source got %q, want the connection closed", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+)
+
+// ParsePassthroughALPN parses a comma-separated list of ALPN protocol IDs,
+// such as "h2,h3".
+func ParsePassthroughALPN(s string) ([]string, error) {
+	var protocols []string
+	for _, proto := range strings.Split(s, ",") {
+		proto = strings.TrimSpace(proto)
+		if proto == "" {
+			continue
+		}
+		if len(proto) > 255 {
+			return nil, errors.New("ALPN protocol ID longer than 255 bytes")
+		}
+		protocols = append(protocols, proto)
+	}
+	return protocols, nil
+}
+
+// SetPassthroughALPN sets the ALPN protocols whose connections are passed
+// through to the fallback upstream instead of being terminated. Only the
+// client's most preferred protocol counts, so with "h2" set a client
+// offering h2 and http/1.1 is passed through while one offering only
+// http/1.1 is terminated. Clients sending no ALPN are terminated as before.
+//
+// A passed-through connection never reaches the HTTP layer, so none of its
+// routes' per-request settings apply to it: maintenance mode, rate limits,
+// header rules and the rest are the fallback's job. Hosts whose routes
+// require a client certificate or basic auth are always terminated.
+func (s *Server) SetPassthroughALPN(protocols []string) {
+	if len(protocols) == 0 {
+		s.passthroughALPN = nil
+		return
+	}
+	s.passthroughALPN = make(map[string]bool, len(protocols))
+	for _, proto := range protocols {
+		s.passthroughALPN[proto] = true
+	}
+}
+
+// terminateALPN reports whether a connection to host offering the ALPN
+// protocols alpn, in the client's order of preference, must be terminated
+// rather than passed through.
+func (s *Server) terminateALPN(host string, alpn []string) bool {
+	if len(alpn) == 0 || !s.passthroughALPN[alpn[0]] {
+		return true
+	}
+	return s.router.RequiresTermination(host)
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eddisonso.com/edd-gateway/internal/router"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxVerifiedCredentials caps the cache of credentials that passed a bcrypt
+// check. bcrypt is deliberately slow, so without the cache every request
+// to a protected route would cost tens of milliseconds of CPU.
+const maxVerifiedCredentials = 1024
+
+// credentialCache remembers credentials that matched a route's bcrypt hash,
+// keyed by a digest of the hash, username and password so no plaintext is
+// kept. Changing a route's hash changes every key.
+type credentialCache struct {
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+func newCredentialCache() *credentialCache {
+	return &credentialCache{verified: make(map[[sha256.Size]byte]bool)}
+}
+
+func credentialKey(hash, user, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(hash + "\x00" + user + "\x00" + password))
+}
+
+// check reports whether user and password match the route's credentials,
+// comparing in constant time.
+func (c *credentialCache) check(route *router.StaticRoute, user, password string) bool {
+	key := credentialKey(route.BasicAuthHash, user, password)
+	c.mu.Lock()
+	ok := c.verified[key]
+	c.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	// The password is checked even for a wrong user so both cost the same
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(route.BasicAuthUser)) == 1
+	passOK := bcrypt.CompareHashAndPassword([]byte(route.BasicAuthHash), []byte(password)) == nil
+	if !userOK || !passOK {
+		return false
+	}
+
+	c.mu.Lock()
+	if len(c.verified) >= maxVerifiedCredentials {
+		clear(c.verified)
+	}
+	c.verified[key] = true
+	c.mu.Unlock()
+	return true
+}
+
+// basicAuthCredentials decodes the Basic credentials of an Authorization
+// header value.
+func basicAuthCredentials(auth string) (user, password string, ok bool) {
+	if len(auth) < 6 || !strings.EqualFold(auth[:6], "basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(auth[6:]))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// authorizeRequest enforces a route's basic auth. Requests without valid
+// credentials are challenged with 401 and the connection is closed, since
+// any request body is left unread. The Authorization header is removed
+// before the request is forwarded so the password never reaches the
+// backend. Routes without credentials pass unchanged.
+func (s *Server) authorizeRequest(conn net.Conn, req *httpRequest, target *httpTarget) bool {
+	route := target.route
+	if route == nil || route.BasicAuthUser == "" {
+		return true
+	}
+	user, password, ok := basicAuthCredentials(req.Get("Authorization"))
+	if ok && s.credentials.check(route, user, password) {
+		target.header = removeHeader(target.header, "Authorization")
+		return true
+	}
+	if ok {
+		req.logger().Warn("basic auth failed", "host", req.host, "path", route.PathPrefix, "user", user, "client", clientIP(conn.RemoteAddr().String()))
+	}
+	challenge := "WWW-Authenticate: Basic realm=" + strconv.Quote(req.host) + `, charset="UTF-8"` + "\r\n"
+	s.writeError(conn, req, http.StatusUnauthorized, challenge, "Authentication required")
+	return false
+}
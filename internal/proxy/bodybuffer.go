@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// DefaultMaxBufferedBody caps request bodies buffered for routes with
+// BufferBody when the route sets no limit of its own.
+const DefaultMaxBufferedBody = 10 << 20
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// SetMaxBufferedBody sets the default cap on buffered request bodies. Routes
+// may override it. Non-positive values keep the default.
+func (s *Server) SetMaxBufferedBody(n int64) {
+	if n > 0 {
+		s.maxBufferedBody = n
+	}
+}
+
+// routeMaxBufferedBody returns the buffered body cap for route.
+func (s *Server) routeMaxBufferedBody(route *router.StaticRoute) int64 {
+	if route.MaxBodyBytes > 0 {
+		return route.MaxBodyBytes
+	}
+	return s.maxBufferedBody
+}
+
+// bufferRequestBody reads the complete request body from the client before
+// any backend is dialed, so slow uploads never reach backends that cannot
+// cope with them. The body is kept in its original framing. Clients waiting
+// on "Expect: 100-continue" are answered here and the expectation is removed
+// from the forwarded header. On failure it writes an error response if the
+// client is still there and returns false.
+func (s *Server) bufferRequestBody(conn net.Conn, reader *bufio.Reader, req *httpRequest, target *httpTarget, framing bodyFraming, length int64) ([]byte, bool) {
+	limit := s.routeMaxBufferedBody(target.route)
+	if framing == bodyLength && length > limit {
+		s.writeBodyTooLarge(conn, req, length, limit)
+		return nil, false
+	}
+
+	if headerHasToken(string(target.header), "Expect", "100-continue") {
+		if _, err := conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n")); err != nil {
+			return nil, false
+		}
+		target.header = removeHeader(target.header, "Expect")
+	}
+
+	var body bytes.Buffer
+	if _, err := copyBody(&cappedWriter{w: &body, n: limit}, reader, framing, length); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			s.writeBodyTooLarge(conn, req, -1, limit)
+		} else {
+			req.logger().Debug("failed to buffer request body", "host", req.host, "error", err, "client", conn.RemoteAddr().String())
+		}
+		return nil, false
+	}
+	return body.Bytes(), true
+}
+
+// writeBodyTooLarge rejects a request whose body exceeds limit. length is
+// the declared Content-Length, or -1 for chunked bodies.
+func (s *Server) writeBodyTooLarge(conn net.Conn, req *httpRequest, length, limit int64) {
+	req.logger().Warn("request body too large to buffer", "host", req.host, "path", req.path, "length", length, "limit", limit, "client", conn.RemoteAddr().String())
+	s.writeError(conn, req, http.StatusRequestEntityTooLarge, "", "Request body too large")
+}
+
+// cappedWriter fails with errBodyTooLarge once more than n bytes are written.
+type cappedWriter struct {
+	w *bytes.Buffer
+	n int64
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > c.n {
+		return 0, errBodyTooLarge
+	}
+	c.n -= int64(len(p))
+	return c.w.Write(p)
+}
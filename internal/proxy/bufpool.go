@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultCopyBufferSize is the size of the buffers used to relay proxied
+// connections, matching what io.Copy would allocate.
+const DefaultCopyBufferSize = 32 << 10
+
+// bufferPool recycles fixed-size copy buffers across connections.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() any {
+		buf := make([]byte, p.size)
+		return &buf
+	}
+	return p
+}
+
+// copy relays src to dst through a pooled buffer. Connections that can
+// splice directly (e.g. two *net.TCPConn) never touch the buffer.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// SetCopyBufferSize sets the size of the pooled buffers used to relay
+// proxied connections. Larger buffers mean fewer syscalls per byte on fast
+// links at the cost of memory per active connection.
+func (s *Server) SetCopyBufferSize(n int) {
+	if n <= 0 {
+		n = DefaultCopyBufferSize
+	}
+	s.copyBuffers = newBufferPool(n)
+}
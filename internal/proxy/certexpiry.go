@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+const (
+	// DefaultCertExpiryWindow is how far ahead of NotAfter an expiring
+	// certificate starts logging warnings.
+	DefaultCertExpiryWindow = 14 * 24 * time.Hour
+	// DefaultCertCheckInterval is how often loaded certificates are inspected.
+	DefaultCertCheckInterval = time.Hour
+)
+
+// SetCertExpiryWindow sets how far ahead of expiry a certificate starts
+// logging warnings, both when it is loaded and on periodic checks.
+func (s *Server) SetCertExpiryWindow(window time.Duration) {
+	s.certExpiryWindow = window
+}
+
+// StartCertExpiryChecks inspects every TLS certificate in use, loaded from
+// files or obtained through ACME, each interval until the server shuts
+// down, updating the expiry gauges and warning once a certificate is within
+// the expiry window.
+func (s *Server) StartCertExpiryChecks(interval time.Duration) {
+	slog.Info("certificate expiry checks enabled", "interval", interval, "window", s.certExpiryWindow)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.checkCertExpiry()
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkCertExpiry reports the remaining lifetime of each certificate in use
+// and drops the gauges of certificates no longer in use, e.g. after a
+// reload replaced them.
+func (s *Server) checkCertExpiry() {
+	current := make(map[string]bool)
+	for _, cert := range s.loadedCerts().certs {
+		current[s.inspectCert(cert.Leaf)] = true
+	}
+	for _, cert := range s.acmeCertificates() {
+		if leaf, err := certLeaf(*cert); err == nil {
+			current[s.inspectCert(leaf)] = true
+		}
+	}
+
+	s.certExpiryMu.Lock()
+	defer s.certExpiryMu.Unlock()
+	for name := range s.reportedCerts {
+		if !current[name] {
+			metrics.TLSCertExpiryDays.DeleteLabelValues(name)
+			metrics.TLSCertExpirySeconds.DeleteLabelValues(name)
+		}
+	}
+	s.reportedCerts = current
+}
+
+// inspectCert updates the expiry gauges of a certificate and logs it if it
+// has expired or is within the expiry window. It returns the certificate's
+// metric name.
+func (s *Server) inspectCert(leaf *x509.Certificate) string {
+	name := certName(leaf)
+	remaining := time.Until(leaf.NotAfter)
+	metrics.TLSCertExpiryDays.WithLabelValues(name).Set(remaining.Hours() / 24)
+	metrics.TLSCertExpirySeconds.WithLabelValues(name).Set(remaining.Seconds())
+
+	s.certExpiryMu.Lock()
+	if s.reportedCerts == nil {
+		s.reportedCerts = make(map[string]bool)
+	}
+	s.reportedCerts[name] = true
+	s.certExpiryMu.Unlock()
+
+	switch {
+	case remaining <= 0:
+		slog.Error("TLS certificate expired", "cert", name, "not_after", leaf.NotAfter)
+	case remaining <= s.certExpiryWindow:
+		slog.Warn("TLS certificate expiring soon", "cert", name, "not_after", leaf.NotAfter, "remaining", remaining.Round(time.Minute))
+	}
+	return name
+}
+
+// certLeaf returns the parsed leaf of cert.
+func certLeaf(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// certName identifies a certificate in logs and metrics by its common name,
+// or its first DNS name when the subject has none.
+func certName(leaf *x509.Certificate) string {
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return leaf.SerialNumber.String()
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// CertificateInfo describes a loaded TLS certificate.
+type CertificateInfo struct {
+	Names       []string  `json:"names"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"sha256_fingerprint"` // of the leaf, as printed by openssl x509 -fingerprint -sha256
+	Source      string    `json:"source"`             // CertSourceFile or CertSourceACME
+}
+
+// Where a certificate in use came from.
+const (
+	CertSourceFile = "file" // loaded with LoadTLSCert
+	CertSourceACME = "acme" // obtained on demand from Let's Encrypt
+)
+
+// DescribeCertificate summarizes a loaded certificate.
+func DescribeCertificate(cert *tls.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Names:       certNames(cert),
+		Subject:     cert.Leaf.Subject.String(),
+		Issuer:      cert.Leaf.Issuer.String(),
+		NotAfter:    cert.Leaf.NotAfter,
+		Fingerprint: certFingerprint(cert.Leaf.Raw),
+		Source:      CertSourceFile,
+	}
+}
+
+// certFingerprint formats the SHA-256 digest of a DER certificate as
+// colon-separated uppercase hex.
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// certFiles is the on-disk source of a loaded certificate, for reloading.
+type certFiles struct {
+	cert, key string // both empty for a generated certificate
+}
+
+// certSet is an immutable snapshot of the loaded certificates. Loading or
+// reloading builds a new set and swaps it in, so handshakes in progress keep
+// using the set they started with.
+type certSet struct {
+	certs  []*tls.Certificate          // in load order; the first is the default
+	files  []certFiles                 // files[i] produced certs[i]
+	byName map[string]*tls.Certificate // by lowercased DNS name, including "*.example.com" wildcards
+}
+
+func newCertSet(certs []*tls.Certificate, files []certFiles) *certSet {
+	set := &certSet{certs: certs, files: files, byName: make(map[string]*tls.Certificate)}
+	for _, cert := range certs {
+		for _, name := range certNames(cert) {
+			if _, ok := set.byName[name]; !ok {
+				set.byName[name] = cert
+			}
+		}
+	}
+	return set
+}
+
+// loadedCerts returns the current certificate set, which may be empty.
+func (s *Server) loadedCerts() *certSet {
+	if set := s.certs.Load(); set != nil {
+		return set
+	}
+	return &certSet{}
+}
+
+// loadCertFiles reads and parses a certificate/key pair.
+func loadCertFiles(files certFiles) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(files.cert, files.key)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS cert: %w", err)
+	}
+	leaf, err := certLeaf(cert)
+	if err != nil {
+		return nil, fmt.Errorf("parse TLS cert: %w", err)
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// LoadTLSCert loads a TLS certificate for TLS termination. It may be called
+// repeatedly: handshakes get the certificate whose DNS names match the SNI
+// hostname, or the first loaded certificate if none do.
+func (s *Server) LoadTLSCert(certFile, keyFile string) error {
+	files := certFiles{cert: certFile, key: keyFile}
+	cert, err := loadCertFiles(files)
+	if err != nil {
+		return err
+	}
+
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	s.ensureTLSConfig()
+	old := s.loadedCerts()
+	s.certs.Store(newCertSet(append(old.certs[:len(old.certs):len(old.certs)], cert), append(old.files[:len(old.files):len(old.files)], files)))
+
+	slog.Info("loaded TLS certificate", "cert", certFile, "names", certNames(cert), "not_after", cert.Leaf.NotAfter)
+	s.inspectCert(cert.Leaf)
+	return nil
+}
+
+// ReloadTLSCert re-reads every loaded certificate and key from disk and swaps
+// them in for new handshakes. Every pair must load before anything is
+// swapped, so a half-written file leaves the current certificates in place.
+func (s *Server) ReloadTLSCert() error {
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+
+	old := s.loadedCerts()
+	if len(old.files) == 0 {
+		return errors.New("no TLS certificates loaded")
+	}
+	certs := make([]*tls.Certificate, len(old.files))
+	for i, files := range old.files {
+		if files.cert == "" {
+			// Generated in memory, so there is nothing to re-read
+			certs[i] = old.certs[i]
+			continue
+		}
+		cert, err := loadCertFiles(files)
+		if err != nil {
+			return fmt.Errorf("%s: %w", files.cert, err)
+		}
+		certs[i] = cert
+	}
+	s.certs.Store(newCertSet(certs, old.files))
+
+	for i, cert := range certs {
+		if old.files[i].cert == "" {
+			continue
+		}
+		slog.Info("reloaded TLS certificate", "cert", old.files[i].cert, "names", certNames(cert), "not_after", cert.Leaf.NotAfter)
+	}
+	s.checkCertExpiry()
+	return nil
+}
+
+// ensureTLSConfig creates the termination config on first use, with the
+// policy from SetTLSPolicy. Certificates are always chosen by
+// getCertificate, never from tls.Config.Certificates, so they can be
+// swapped without touching the config.
+func (s *Server) ensureTLSConfig() {
+	if s.tlsConfig != nil {
+		return
+	}
+	s.tlsConfig = &tls.Config{
+		GetCertificate: s.getCertificate,
+		MinVersion:     s.tlsMinVersion,
+		CipherSuites:   s.tlsCiphers,
+	}
+	logTLSPolicy(s.tlsConfig)
+}
+
+// certNames returns the lowercased DNS names a certificate is valid for,
+// falling back to its common name when it has no SANs.
+func certNames(cert *tls.Certificate) []string {
+	names := cert.Leaf.DNSNames
+	if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+		names = []string{cert.Leaf.Subject.CommonName}
+	}
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// CertificateForHost returns the loaded certificate valid for host, matching
+// exact names first and then a wildcard for host's parent domain, or nil if
+// no loaded certificate covers it.
+func (s *Server) CertificateForHost(host string) *tls.Certificate {
+	set := s.loadedCerts()
+	host = normalizeHost(host)
+	if cert, ok := set.byName[host]; ok {
+		return cert
+	}
+	if _, parent, ok := strings.Cut(host, "."); ok {
+		if cert, ok := set.byName["*."+parent]; ok {
+			return cert
+		}
+	}
+	return nil
+}
+
+// Certificates describes every loaded certificate in load order, followed
+// by the ACME certificates served so far.
+func (s *Server) Certificates() []CertificateInfo {
+	set := s.loadedCerts()
+	acme := s.acmeCertificates()
+	infos := make([]CertificateInfo, 0, len(set.certs)+len(acme))
+	for _, cert := range set.certs {
+		infos = append(infos, DescribeCertificate(cert))
+	}
+	for _, cert := range acme {
+		info := DescribeCertificate(cert)
+		info.Source = CertSourceACME
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// getCertificate picks the loaded certificate covering the SNI hostname.
+// Uncovered hosts get an ACME certificate when ACME is enabled, and the
+// first loaded certificate otherwise.
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := hello.ServerName
+	if name == "" {
+		name = s.defaultSNIHost
+	}
+	if cert := s.CertificateForHost(name); cert != nil {
+		return cert, nil
+	}
+	if s.acme != nil && hello.ServerName != "" {
+		return s.acmeCertificate(hello)
+	}
+	if set := s.loadedCerts(); len(set.certs) > 0 {
+		return set.certs[0], nil
+	}
+	return nil, fmt.Errorf("no certificate for host %q", hello.ServerName)
+}
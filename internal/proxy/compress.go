@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content codings the gateway compresses responses with, in order of
+// preference.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// minCompressBytes is the smallest declared response body worth
+// compressing; below it the coding overhead outweighs the savings.
+const minCompressBytes = 256
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(nil) }}
+)
+
+// responseEncoding picks the content coding for compressing a response to
+// req, or "" to relay it unchanged. Only HTTP/1.1 clients qualify, since the
+// compressed body is sent chunked, and only uncoded responses whose content
+// type compresses well.
+func responseEncoding(req *httpRequest, status int, respHeaders string) string {
+	if extractProto(extractRequestLine(string(req.header))) != "HTTP/1.1" {
+		return ""
+	}
+	framing, length := responseBodyFraming(req.method, status, respHeaders)
+	if framing == bodyNone || (framing == bodyLength && length < minCompressBytes) || status == 206 {
+		return ""
+	}
+	if headerValue(respHeaders, "Content-Encoding") != "" || headerHasToken(respHeaders, "Cache-Control", "no-transform") {
+		return ""
+	}
+	if !compressibleType(headerValue(respHeaders, "Content-Type")) {
+		return ""
+	}
+	return acceptedEncoding(string(req.header))
+}
+
+// compressibleType reports whether a media type is text-like. Images, video,
+// archives and other already compressed formats gain nothing, and event
+// streams must not be held back in the compressor.
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-javascript", "application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// acceptedEncoding returns the preferred coding the client accepts in its
+// Accept-Encoding header, honouring q=0 exclusions, or "".
+func acceptedEncoding(headers string) string {
+	accepted := make(map[string]bool)
+	wildcard := false
+	for _, value := range headerValues(headers, "Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(item, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			ok := true
+			for _, param := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(k, "q") {
+					q, err := strconv.ParseFloat(v, 64)
+					ok = err == nil && q > 0
+				}
+			}
+			if name == "*" {
+				wildcard = ok
+				continue
+			}
+			accepted[name] = ok
+		}
+	}
+	for _, coding := range []string{encodingGzip, encodingDeflate} {
+		if ok, listed := accepted[coding]; ok || (!listed && wildcard) {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressedHeader rewrites a response header block for a body compressed
+// with encoding and sent chunked. A strong ETag is weakened, since the
+// compressed representation is not byte-for-byte the backend's.
+func compressedHeader(header []byte, encoding string) []byte {
+	header = removeHeader(header, "Content-Length")
+	header = removeHeader(header, "Transfer-Encoding")
+	if etag := headerValue(string(header), "ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header = removeHeader(header, "ETag")
+		header = addHeader(header, "ETag", "W/"+etag)
+	}
+	header = addHeader(header, "Content-Encoding", encoding)
+	header = addHeader(header, "Transfer-Encoding", "chunked")
+	return appendHeaderValue(header, "Vary", "Accept-Encoding")
+}
+
+// bodyCounter counts the bytes of a response body written through it.
+type bodyCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *bodyCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// copyCompressed reads a response body from src according to its framing
+// and writes it to dst compressed with encoding, chunked. Trailers of a
+// chunked body are relayed after the last chunk. It returns the bytes
+// written to dst.
+func copyCompressed(dst io.Writer, src *bufio.Reader, framing bodyFraming, length int64, encoding string) (int64, error) {
+	out := &bodyCounter{w: dst}
+	chunked := httputil.NewChunkedWriter(out)
+
+	var zw io.WriteCloser
+	if encoding == encodingGzip {
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(chunked)
+		defer func() { gw.Reset(io.Discard); gzipWriters.Put(gw) }()
+		zw = gw
+	} else {
+		fw := zlibWriters.Get().(*zlib.Writer)
+		fw.Reset(chunked)
+		defer func() { fw.Reset(io.Discard); zlibWriters.Put(fw) }()
+		zw = fw
+	}
+
+	var body io.Reader = src
+	switch framing {
+	case bodyLength:
+		body = io.LimitReader(src, length)
+	case bodyChunked:
+		body = httputil.NewChunkedReader(src)
+	}
+	n, err := io.Copy(zw, body)
+	if err == nil && framing == bodyLength && n < length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return out.n, err
+	}
+	if err := zw.Close(); err != nil {
+		return out.n, err
+	}
+	// The last chunk is followed by the trailer section and a blank line
+	if err := chunked.Close(); err != nil {
+		return out.n, err
+	}
+	if framing == bodyChunked {
+		_, err = copyTrailers(out, src)
+	} else {
+		_, err = io.WriteString(out, "\r\n")
+	}
+	return out.n, err
+}
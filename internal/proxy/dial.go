@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// DefaultDialTimeout bounds how long a backend dial may take when the route
+// does not set its own timeout.
+const DefaultDialTimeout = 5 * time.Second
+
+// SetDialTimeout sets the default backend dial timeout. Routes may override
+// it. Non-positive values keep the default.
+func (s *Server) SetDialTimeout(d time.Duration) {
+	if d > 0 {
+		s.dialTimeout = d
+	}
+}
+
+// routeDialTimeout returns the dial timeout for route, which may be nil.
+func (s *Server) routeDialTimeout(route *router.StaticRoute) time.Duration {
+	if route != nil && route.DialTimeout > 0 {
+		return route.DialTimeout
+	}
+	return s.dialTimeout
+}
+
+// SetSlowDialThreshold sets how long a backend dial may take before it is
+// logged as a warning. Routes may override it. Zero disables the warning.
+func (s *Server) SetSlowDialThreshold(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.slowDialThreshold = d
+}
+
+// observeDial records a backend dial started at start for metrics and
+// passive ejection; dials cut short by a request timeout are not held
+// against the backend. Successful dials slower than the route's threshold (or
+// the server default) are logged at warn, others at debug; failures are
+// logged by the caller.
+func (s *Server) observeDial(protocol, target string, route *router.StaticRoute, start time.Time, err error) {
+	elapsed := time.Since(start)
+	metrics.ObserveDial(protocol, target, elapsed, err)
+	if !errors.Is(err, errRequestTimeout) {
+		s.ejector.record(target, err)
+	}
+	if err != nil {
+		return
+	}
+
+	threshold := s.slowDialThreshold
+	if route != nil && route.SlowDialThreshold > 0 {
+		threshold = route.SlowDialThreshold
+	}
+	if threshold > 0 && elapsed > threshold {
+		slog.Warn("slow backend dial", "protocol", protocol, "target", target, "latency", elapsed, "threshold", threshold)
+		return
+	}
+	slog.Debug("backend dial", "protocol", protocol, "target", target, "latency", elapsed)
+}
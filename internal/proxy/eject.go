@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEjectThreshold is how many consecutive dial failures eject a backend.
+	DefaultEjectThreshold = 5
+	// DefaultEjectCooldown is how long an ejected backend stays out of rotation.
+	DefaultEjectCooldown = 30 * time.Second
+)
+
+// BackendStatus is the health of one backend address as seen by the proxy.
+type BackendStatus struct {
+	Addr                string    `json:"addr"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Ejected             bool      `json:"ejected"`
+	EjectedUntil        time.Time `json:"ejected_until,omitempty"`
+}
+
+// ejector tracks consecutive dial failures per backend address and ejects
+// backends that keep failing. After the cooldown the next dial is a re-probe:
+// success reinstates the backend, failure ejects it for another cooldown.
+type ejector struct {
+	mu        sync.Mutex
+	threshold int // 0 disables ejection
+	cooldown  time.Duration
+	backends  map[string]*ejectState
+}
+
+type ejectState struct {
+	failures     int
+	ejectedUntil time.Time // zero when in rotation
+}
+
+func newEjector(threshold int, cooldown time.Duration) *ejector {
+	return &ejector{
+		threshold: threshold,
+		cooldown:  cooldown,
+		backends:  make(map[string]*ejectState),
+	}
+}
+
+// SetPassiveEjection ejects a backend address from multi-target rotation for
+// cooldown after threshold consecutive dial failures. Zero threshold disables it.
+func (s *Server) SetPassiveEjection(threshold int, cooldown time.Duration) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	s.ejector.mu.Lock()
+	defer s.ejector.mu.Unlock()
+	s.ejector.threshold = threshold
+	if cooldown > 0 {
+		s.ejector.cooldown = cooldown
+	}
+}
+
+// BackendHealth returns the tracked state of every backend address that has
+// failed since it was last healthy, sorted by address.
+func (s *Server) BackendHealth() []BackendStatus {
+	s.ejector.mu.Lock()
+	defer s.ejector.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]BackendStatus, 0, len(s.ejector.backends))
+	for addr, st := range s.ejector.backends {
+		status := BackendStatus{Addr: addr, ConsecutiveFailures: st.failures}
+		if now.Before(st.ejectedUntil) {
+			status.Ejected = true
+			status.EjectedUntil = st.ejectedUntil
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Addr < statuses[j].Addr })
+	return statuses
+}
+
+// backendAvailable reports whether addr may be picked from a multi-target
+// route: it is neither ejected nor failing active health checks.
+func (s *Server) backendAvailable(addr string) bool {
+	return !s.ejector.ejected(addr) && s.health.healthy(addr)
+}
+
+// ejected reports whether addr is currently out of rotation.
+func (e *ejector) ejected(addr string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st, ok := e.backends[addr]
+	return ok && time.Now().Before(st.ejectedUntil)
+}
+
+// record updates addr's state with the outcome of a dial.
+func (e *ejector) record(addr string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.threshold == 0 {
+		return
+	}
+
+	st, ok := e.backends[addr]
+	if err == nil {
+		if ok {
+			if !st.ejectedUntil.IsZero() {
+				slog.Info("backend reinstated", "addr", addr)
+			}
+			delete(e.backends, addr)
+		}
+		return
+	}
+
+	if !ok {
+		st = &ejectState{}
+		e.backends[addr] = st
+	}
+	st.failures++
+	if st.failures < e.threshold {
+		return
+	}
+
+	// Either the threshold was just reached or a post-cooldown re-probe failed
+	now := time.Now()
+	if now.Before(st.ejectedUntil) {
+		return
+	}
+	st.ejectedUntil = now.Add(e.cooldown)
+	slog.Warn("backend ejected", "addr", addr, "consecutive_failures", st.failures, "cooldown", e.cooldown)
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// errorPageDefault names the page used for statuses without their own.
+const errorPageDefault = "default"
+
+// errorPage renders the body of a gateway error response.
+type errorPage interface {
+	Execute(w io.Writer, data any) error
+}
+
+// errorPageData is what error page templates are rendered with.
+type errorPageData struct {
+	Status     int
+	StatusText string
+	Message    string // short explanation, e.g. "Backend connection failed"
+	Detail     string // backend and error category with -debug-errors, otherwise empty
+	RequestID  string // empty when request IDs are disabled
+	Host       string
+}
+
+// errorPages holds the operator's error page templates by status code, or
+// errorPageDefault, and content type.
+type errorPages struct {
+	html map[string]errorPage
+	json map[string]errorPage
+}
+
+// LoadErrorPages loads error page templates from dir: files named after a
+// status code or "default", with an .html or .json extension, such as
+// 502.html or default.json. HTML pages are html/template templates, JSON
+// pages text/template templates with a json function for quoting strings.
+// Both are rendered with .Status, .StatusText, .Message, .Detail,
+// .RequestID and .Host. Any template that fails to parse is an error.
+func (s *Server) LoadErrorPages(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error pages: %w", err)
+	}
+	pages := &errorPages{html: make(map[string]errorPage), json: make(map[string]errorPage)}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if entry.IsDir() || (ext != ".html" && ext != ".json") {
+			continue
+		}
+		if code, err := strconv.Atoi(name); name != errorPageDefault && (err != nil || code < 400 || code > 599) {
+			return fmt.Errorf("error pages: %s: want a 4xx or 5xx status code or %q as the name", entry.Name(), errorPageDefault)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error pages: %w", err)
+		}
+		if ext == ".html" {
+			page, err := htmltemplate.New(entry.Name()).Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("error pages: %w", err)
+			}
+			pages.html[name] = page
+		} else {
+			page, err := texttemplate.New(entry.Name()).Funcs(texttemplate.FuncMap{"json": jsonString}).Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("error pages: %w", err)
+			}
+			pages.json[name] = page
+		}
+		slog.Info("loaded error page", "file", entry.Name())
+	}
+	if len(pages.html)+len(pages.json) == 0 {
+		return fmt.Errorf("error pages: no .html or .json pages in %s", dir)
+	}
+	s.errorPages = pages
+	return nil
+}
+
+// jsonString quotes s as a JSON string.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// render returns the body and content type of the operator's page for an
+// error response, or ok false when there is none. A client that asks for
+// JSON and not HTML gets the JSON page when there is one.
+func (p *errorPages) render(req *httpRequest, data errorPageData) (body []byte, contentType string, ok bool) {
+	if p == nil {
+		return nil, "", false
+	}
+	code := strconv.Itoa(data.Status)
+	html := lookupErrorPage(p.html, code)
+	jsonPage := lookupErrorPage(p.json, code)
+
+	page, contentType := html, "text/html; charset=utf-8"
+	if jsonPage != nil && (html == nil || prefersJSON(req)) {
+		page, contentType = jsonPage, "application/json"
+	}
+	if page == nil {
+		return nil, "", false
+	}
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		slog.Error("failed to render error page", "status", data.Status, "error", err)
+		return nil, "", false
+	}
+	return buf.Bytes(), contentType, true
+}
+
+func lookupErrorPage(pages map[string]errorPage, code string) errorPage {
+	if page, ok := pages[code]; ok {
+		return page
+	}
+	return pages[errorPageDefault]
+}
+
+// prefersJSON reports whether req accepts JSON but not HTML.
+func prefersJSON(req *httpRequest) bool {
+	if req == nil {
+		return false
+	}
+	accept := strings.ToLower(req.Get("Accept"))
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
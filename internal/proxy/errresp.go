@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Causes of 503 and 429 responses, each with its own Retry-After delay.
+const (
+	RetryOverload    = "overload"     // a connection limit or reservation is exhausted
+	RetryDraining    = "draining"     // the gateway is shutting down
+	RetryNotReady    = "not_ready"    // routes have not been loaded yet
+	RetryCircuitOpen = "circuit_open" // the backend is ejected after repeated dial failures
+	RetryRateLimited = "rate_limited" // the client exceeded a request rate (429)
+	RetryMaintenance = "maintenance"  // the host was put in maintenance
+)
+
+// DefaultRetryAfter returns the default Retry-After delay per cause.
+// Overload clears quickly; a draining gateway is going away for good.
+func DefaultRetryAfter() map[string]time.Duration {
+	return map[string]time.Duration{
+		RetryOverload:    time.Second,
+		RetryDraining:    30 * time.Second,
+		RetryNotReady:    5 * time.Second,
+		RetryCircuitOpen: 10 * time.Second,
+		RetryRateLimited: time.Second,
+		RetryMaintenance: time.Minute,
+	}
+}
+
+// SetRetryAfter overrides the Retry-After delay for the given causes.
+func (s *Server) SetRetryAfter(delays map[string]time.Duration) {
+	for cause, d := range delays {
+		s.retryAfter[cause] = d
+	}
+}
+
+// ParseRetryAfter parses comma-separated cause=duration pairs, e.g.
+// "overload=2s,draining=1m".
+func ParseRetryAfter(s string) (map[string]time.Duration, error) {
+	delays := make(map[string]time.Duration)
+	if strings.TrimSpace(s) == "" {
+		return delays, nil
+	}
+	known := DefaultRetryAfter()
+	for _, entry := range strings.Split(s, ",") {
+		cause, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("retry-after entry %q: want cause=duration", entry)
+		}
+		cause = strings.TrimSpace(cause)
+		if _, ok := known[cause]; !ok {
+			return nil, fmt.Errorf("retry-after entry %q: unknown cause %q", entry, cause)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("retry-after entry %q: %w", entry, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("retry-after entry %q: negative delay", entry)
+		}
+		delays[cause] = d
+	}
+	return delays, nil
+}
+
+// retryAfterHeader returns the Retry-After header line for cause, in whole
+// seconds rounded up.
+func (s *Server) retryAfterHeader(cause string) string {
+	secs := int64(math.Ceil(s.retryAfter[cause].Seconds()))
+	return fmt.Sprintf("Retry-After: %d\r\n", secs)
+}
+
+// gatewayResponse is a response the gateway writes itself rather than
+// relaying one from a backend.
+type gatewayResponse struct {
+	status  int
+	headers string // extra CRLF-terminated header lines
+	message string // one-line explanation, the body unless an error page applies
+	detail  string // CRLF-terminated debug lines appended to the plain body
+
+	// A body sent as it is, bypassing error pages
+	body        string
+	contentType string
+}
+
+// writeResponse writes a gateway-generated response for req, which is nil
+// when the request could not be parsed, and ends the connection: the rest
+// of the request may still be unread, so it cannot be reused. Every such
+// response gets a Content-Length, Connection: close and, once the request
+// has one, its request ID in the request ID header and the body. Error
+// statuses use the operator's error page when one applies and plain text
+// otherwise. Redirects stay cacheable; every other response reflects a
+// passing state and is marked not to be stored.
+func (s *Server) writeResponse(conn net.Conn, req *httpRequest, resp gatewayResponse) {
+	var id, host string
+	if req != nil {
+		id, host = req.id, req.host
+	}
+
+	body, contentType := []byte(resp.body), resp.contentType
+	if resp.body == "" && resp.status >= 400 {
+		data := errorPageData{
+			Status:     resp.status,
+			StatusText: http.StatusText(resp.status),
+			Message:    resp.message,
+			Detail:     strings.TrimSpace(resp.detail),
+			RequestID:  id,
+			Host:       host,
+		}
+		var ok bool
+		if body, contentType, ok = s.errorPages.render(req, data); !ok {
+			body, contentType = plainErrorBody(data, resp.detail), "text/plain; charset=utf-8"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", resp.status, http.StatusText(resp.status))
+	b.WriteString(resp.headers)
+	if contentType != "" {
+		b.WriteString("Content-Type: " + contentType + "\r\n")
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	if resp.status < 300 || resp.status >= 400 {
+		b.WriteString("Cache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n")
+	}
+	if id != "" && s.requestIDHeader != "" {
+		b.WriteString(s.requestIDHeader + ": " + id + "\r\n")
+	}
+	b.WriteString("Connection: close\r\n\r\n")
+	if req == nil || req.method != http.MethodHead {
+		b.Write(body)
+	}
+	if _, err := conn.Write([]byte(b.String())); err == nil {
+		lingerClose(conn)
+	}
+}
+
+// lingerTimeout bounds how long lingerClose waits for the client to finish
+// sending, and lingerMaxBytes how much it reads meanwhile.
+const (
+	lingerTimeout  = 500 * time.Millisecond
+	lingerMaxBytes = 256 << 10
+)
+
+// closeWriter is a connection that can be half-closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// lingerClose ends the sending side of conn after a gateway response and
+// discards what the client is still sending, for a short while. Closing
+// with unread data makes the kernel reset the connection, and the reset can
+// destroy the response before the client has read it. The caller still
+// closes conn.
+func lingerClose(conn net.Conn) {
+	cw, ok := conn.(closeWriter)
+	if !ok || cw.CloseWrite() != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.Copy(io.Discard, io.LimitReader(conn, lingerMaxBytes))
+}
+
+// plainErrorBody is the body of an error response without an error page.
+func plainErrorBody(data errorPageData, detail string) []byte {
+	var b strings.Builder
+	if data.Message != "" {
+		b.WriteString(data.Message + "\r\n")
+	}
+	b.WriteString(detail)
+	if data.RequestID != "" {
+		b.WriteString("request_id: " + data.RequestID + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// writeError writes a gateway error response with msg as its explanation.
+// headers holds extra CRLF-terminated header lines.
+func (s *Server) writeError(conn net.Conn, req *httpRequest, status int, headers, msg string) {
+	s.writeResponse(conn, req, gatewayResponse{status: status, headers: headers, message: msg})
+}
+
+// writeUnavailable writes a 503 carrying the Retry-After delay for cause.
+func (s *Server) writeUnavailable(conn net.Conn, req *httpRequest, cause, msg string) {
+	s.writeError(conn, req, http.StatusServiceUnavailable, s.retryAfterHeader(cause), msg)
+}
+
+// writeTooManyRequests writes a 429 carrying the rate-limit Retry-After delay.
+func (s *Server) writeTooManyRequests(conn net.Conn, req *httpRequest, msg string) {
+	s.writeError(conn, req, http.StatusTooManyRequests, s.retryAfterHeader(RetryRateLimited), msg)
+}
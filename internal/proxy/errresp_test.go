@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// readGatewayResponse has s write resp for req over a pipe and parses what
+// arrives as the client would. It fails the test if anything follows the
+// response or the connection is left open.
+func readGatewayResponse(t *testing.T, s *Server, req *httpRequest, resp gatewayResponse) (*http.Response, string) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		s.writeResponse(server, req, resp)
+		server.Close()
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	method := http.MethodGet
+	if req != nil {
+		method = req.method
+	}
+	br := bufio.NewReader(client)
+	got, err := http.ReadResponse(br, &http.Request{Method: method})
+	if err != nil {
+		t.Fatalf("response is not well-formed HTTP: %v", err)
+	}
+	body, err := io.ReadAll(got.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if b, err := br.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("after the response: read %q, %v; want the connection closed", b, err)
+	}
+	return got, string(body)
+}
+
+func testRequest(method string) *httpRequest {
+	return &httpRequest{
+		header: []byte(method + " / HTTP/1.1\r\nHost: app.example\r\n\r\n"),
+		method: method,
+		path:   "/",
+		host:   "app.example",
+		id:     "req-1",
+	}
+}
+
+func TestGatewayResponsesWellFormed(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	tests := []struct {
+		name     string
+		req      *httpRequest
+		resp     gatewayResponse
+		wantBody string // substring; "" for an empty body
+	}{
+		{"bad gateway", testRequest("GET"), gatewayResponse{status: http.StatusBadGateway, message: "backend unavailable"}, "backend unavailable"},
+		{"unparsed request", nil, gatewayResponse{status: http.StatusBadRequest, message: "malformed request"}, "malformed request"},
+		{"with detail", testRequest("GET"), gatewayResponse{status: http.StatusNotFound, message: "no route", detail: "host: app.example\r\n"}, "host: app.example"},
+		{"retry after", testRequest("GET"), gatewayResponse{status: http.StatusServiceUnavailable, headers: s.retryAfterHeader(RetryOverload), message: "overloaded"}, "overloaded"},
+		{"head error", testRequest("HEAD"), gatewayResponse{status: http.StatusBadGateway, message: "backend unavailable"}, ""},
+		{"own body", testRequest("GET"), gatewayResponse{status: http.StatusOK, body: `{"ok":true}`, contentType: "application/json"}, `{"ok":true}`},
+		{"redirect", testRequest("GET"), gatewayResponse{status: http.StatusMovedPermanently, headers: "Location: https://app.example/\r\n"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := readGatewayResponse(t, s, tt.req, tt.resp)
+			if resp.StatusCode != tt.resp.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.resp.status)
+			}
+			if !resp.Close {
+				t.Error("response does not carry Connection: close")
+			}
+			if tt.wantBody == "" && body != "" || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantBody)
+			}
+			cl, err := strconv.Atoi(resp.Header.Get("Content-Length"))
+			if err != nil {
+				t.Fatalf("Content-Length %q: %v", resp.Header.Get("Content-Length"), err)
+			}
+			if tt.req == nil || tt.req.method != http.MethodHead {
+				if cl != len(body) {
+					t.Errorf("Content-Length = %d, body has %d bytes", cl, len(body))
+				}
+			} else if cl == 0 {
+				t.Error("HEAD response has Content-Length 0, want the length a GET would get")
+			}
+			if tt.req != nil {
+				if id := resp.Header.Get(DefaultRequestIDHeader); id != tt.req.id {
+					t.Errorf("%s = %q, want %q", DefaultRequestIDHeader, id, tt.req.id)
+				}
+			}
+		})
+	}
+}
+
+func TestGatewayResponseErrorPage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "502.html"), []byte("<h1>{{.Status}} {{.Message}}</h1>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&router.Router{}, "")
+	if err := s.LoadErrorPages(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := readGatewayResponse(t, s, testRequest("GET"), gatewayResponse{status: http.StatusBadGateway, message: "backend unavailable"})
+	if want := "<h1>502 backend unavailable</h1>\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("Content-Length = %d, body has %d bytes", resp.ContentLength, len(body))
+	}
+}
+
+// A client still sending a body the gateway never reads must get the whole
+// response, not a connection reset.
+func TestGatewayResponseWithUnreadBody(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := NewServer(&router.Router{}, "")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleHTTP(conn)
+		}
+	}()
+
+	const bodyLen = 200 << 10
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		go func() {
+			io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: app.example\r\nContent-Length: "+strconv.Itoa(bodyLen)+"\r\n\r\n")
+			conn.Write(make([]byte, bodyLen))
+		}()
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			conn.Close()
+			t.Fatalf("attempt %d: reading response: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || int64(len(body)) != resp.ContentLength {
+			t.Errorf("attempt %d: read %d of %d body bytes: %v", i, len(body), resp.ContentLength, err)
+		}
+		if !resp.Close {
+			t.Errorf("attempt %d: response does not carry Connection: close", i)
+		}
+		conn.Close()
+	}
+}
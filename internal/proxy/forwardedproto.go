@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or addresses
+// of proxies whose X-Forwarded-Proto header is believed.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, src := range strings.Split(s, ",") {
+		if src = strings.TrimSpace(src); src == "" {
+			continue
+		}
+		prefix, err := parseSourcePrefix(src)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxies: %w", err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// SetTrustedProxies sets the peers allowed to tell the gateway, with
+// X-Forwarded-Proto, that a plain HTTP request reached them over HTTPS.
+func (s *Server) SetTrustedProxies(prefixes []netip.Prefix) {
+	s.trustedProxies = prefixes
+}
+
+// trustedProxy reports whether the peer at addr is a trusted proxy.
+func (s *Server) trustedProxy(addr net.Addr) bool {
+	return prefixesContain(s.trustedProxies, addr)
+}
+
+// applyForwardedProto decides the scheme of a plain HTTP request. A trusted
+// proxy's X-Forwarded-Proto is believed, so a request it received over
+// HTTPS counts as secure and is not redirected back to HTTPS; anyone else's
+// is replaced with "http" so backends cannot be fooled either.
+func (s *Server) applyForwardedProto(conn net.Conn, req *httpRequest) {
+	if s.trustedProxy(conn.RemoteAddr()) {
+		// A chain of proxies lists the outermost scheme first
+		proto, _, _ := strings.Cut(req.Get("X-Forwarded-Proto"), ",")
+		req.secure = strings.EqualFold(strings.TrimSpace(proto), "https")
+		return
+	}
+	if len(headerValues(string(req.header), "X-Forwarded-Proto")) > 0 {
+		req.header = removeHeader(req.header, "X-Forwarded-Proto")
+	}
+	req.header = addHeader(req.header, "X-Forwarded-Proto", "http")
+}
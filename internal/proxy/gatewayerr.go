@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Error categories reported by debug error responses.
+const (
+	errCategoryNoRoute       = "no_route"
+	errCategoryDNS           = "dns"
+	errCategoryTimeout       = "timeout"
+	errCategoryRefused       = "connection_refused"
+	errCategoryTLS           = "tls"
+	errCategoryBackendClosed = "backend_closed"
+	errCategoryBadResponse   = "bad_response"
+	errCategoryBackend       = "backend_error"
+)
+
+// SetDebugErrors makes 502 responses name the attempted backend and the
+// failure category, in the body and an X-Gateway-Error header. This exposes
+// internal addresses and must not be enabled in production.
+func (s *Server) SetDebugErrors(enabled bool) {
+	s.debugErrors = enabled
+}
+
+// classifyBackendError maps a backend dial or exchange error to a category.
+func classifyBackendError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	switch {
+	case errors.As(err, &dnsErr):
+		return errCategoryDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownAuth), errors.As(err, &hostErr),
+		errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return errCategoryTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errCategoryTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errCategoryRefused
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return errCategoryBackendClosed
+	case errors.Is(err, errBadStatusLine), errors.Is(err, errHeaderTooLarge), errors.Is(err, errHeaderLineTooLong):
+		return errCategoryBadResponse
+	}
+	return errCategoryBackend
+}
+
+// writeGatewayTimeout writes a 504 for a request whose route timeout ran
+// out before the backend answered.
+func (s *Server) writeGatewayTimeout(conn net.Conn, req *httpRequest, backend string) {
+	resp := gatewayResponse{status: http.StatusGatewayTimeout, message: "Backend timed out"}
+	if s.debugErrors {
+		resp.headers = "X-Gateway-Error: " + errCategoryTimeout + "; backend=" + orDash(backend) + "\r\n"
+		resp.detail = "backend: " + orDash(backend) + "\r\nerror: " + errCategoryTimeout + "\r\n"
+	}
+	s.writeResponse(conn, req, resp)
+}
+
+// writeBadGateway writes a 502 response with msg as the body. In debug mode
+// the backend address and error category are appended and sent in an
+// X-Gateway-Error header.
+func (s *Server) writeBadGateway(conn net.Conn, req *httpRequest, msg, backend, category string) {
+	resp := gatewayResponse{status: http.StatusBadGateway, message: msg}
+	if s.debugErrors {
+		detail := category
+		if backend != "" {
+			detail += "; backend=" + backend
+		}
+		resp.headers = "X-Gateway-Error: " + detail + "\r\n"
+		resp.detail = "backend: " + orDash(backend) + "\r\nerror: " + category + "\r\n"
+	}
+	s.writeResponse(conn, req, resp)
+}
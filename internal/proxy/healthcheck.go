@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// DefaultHealthCheckTimeout bounds a single active health probe.
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// TargetHealth is the result of the latest active probe of a route target.
+type TargetHealth struct {
+	Addr        string    `json:"addr"`
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// healthChecker periodically probes static route targets.
+type healthChecker struct {
+	mu      sync.Mutex
+	path    string // HTTP GET path; empty probes with a TCP connect
+	timeout time.Duration
+	targets map[string]*TargetHealth
+}
+
+// SetHealthCheckProbe configures active health probes: a GET of path
+// (expecting 2xx or 3xx), or a plain TCP connect when path is empty.
+// Non-positive timeouts keep the default.
+func (s *Server) SetHealthCheckProbe(path string, timeout time.Duration) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	s.health.path = path
+	if timeout > 0 {
+		s.health.timeout = timeout
+	}
+}
+
+// StartHealthChecks probes every static route target each interval until the
+// server shuts down. Targets failing their latest probe are skipped by
+// multi-target routes.
+func (s *Server) StartHealthChecks(interval time.Duration) {
+	s.health.mu.Lock()
+	path, timeout := s.health.path, s.health.timeout
+	s.health.mu.Unlock()
+	slog.Info("active health checks enabled", "interval", interval, "timeout", timeout, "path", path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.runHealthChecks()
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// TargetHealth returns the latest probe result for every checked target,
+// sorted by address.
+func (s *Server) TargetHealth() []TargetHealth {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	statuses := make([]TargetHealth, 0, len(s.health.targets))
+	for _, th := range s.health.targets {
+		statuses = append(statuses, *th)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Addr < statuses[j].Addr })
+	return statuses
+}
+
+// healthy reports whether addr passed its latest probe. Unprobed addresses
+// count as healthy.
+func (h *healthChecker) healthy(addr string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th, ok := h.targets[addr]
+	return !ok || th.Healthy
+}
+
+// runHealthChecks probes each distinct target once, in parallel.
+func (s *Server) runHealthChecks() {
+	probes := make(map[string]*router.StaticRoute)
+	for _, route := range s.router.ListRoutes() {
+		if route.Draining {
+			continue
+		}
+		for _, addr := range router.SplitTargets(route.Target) {
+			if _, ok := probes[addr]; !ok {
+				probes[addr] = &route
+			}
+		}
+	}
+
+	s.health.mu.Lock()
+	path, timeout := s.health.path, s.health.timeout
+	for addr := range s.health.targets {
+		if _, ok := probes[addr]; !ok {
+			delete(s.health.targets, addr)
+		}
+	}
+	s.health.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for addr, route := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.probeTarget(addr, route, path, timeout)
+			s.health.record(addr, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// probeTarget checks one target with a TCP connect or an HTTP GET of path.
+func (s *Server) probeTarget(addr string, route *router.StaticRoute, path string, timeout time.Duration) error {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if path != "" && route.UpstreamTLS {
+		cfg, cfgErr := s.upstreamTLSConfig(route, route.Host)
+		if cfgErr != nil {
+			return cfgErr
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if path == "" {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	req := "GET " + path + " HTTP/1.1\r\nHost: " + route.Host + "\r\nUser-Agent: edd-gateway-healthcheck\r\nConnection: close\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return err
+	}
+	statusLine, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	status, err := parseStatusCode(strings.TrimRight(statusLine, "\r\n"))
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 400 {
+		return fmt.Errorf("health check returned status %d", status)
+	}
+	return nil
+}
+
+// record stores a probe result, logging health transitions.
+func (h *healthChecker) record(addr string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th, seen := h.targets[addr]
+	if !seen {
+		th = &TargetHealth{Addr: addr, Healthy: true}
+		h.targets[addr] = th
+	}
+	wasHealthy := th.Healthy
+	th.LastChecked = time.Now()
+	th.Healthy = err == nil
+	th.Error = ""
+	if err != nil {
+		th.Error = err.Error()
+	}
+
+	switch {
+	case wasHealthy && !th.Healthy:
+		slog.Warn("backend failed health check", "addr", addr, "error", err)
+	case !wasHealthy && th.Healthy:
+		slog.Info("backend passed health check", "addr", addr)
+	}
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// hostLimiter caps concurrent client connections per destination host.
+// Only hosts with a limit are counted.
+type hostLimiter struct {
+	mu           sync.Mutex
+	defaultLimit int            // applies to hosts without their own limit; 0 for unlimited
+	limits       map[string]int // by lowercase host
+	active       map[string]int // connections holding a slot, by lowercase host
+}
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{limits: make(map[string]int), active: make(map[string]int)}
+}
+
+// limit returns the connection cap for host, 0 for unlimited. Guarded by mu.
+func (l *hostLimiter) limit(host string) int {
+	if n, ok := l.limits[host]; ok {
+		return n
+	}
+	return l.defaultLimit
+}
+
+// defaultLimitLabel is the rejection metric label for hosts capped only by
+// the default limit. Those hosts come from client-supplied names, so giving
+// each its own counter would let clients grow the series without bound.
+const defaultLimitLabel = "*"
+
+// rejectLabel returns the rejection metric label for host. Guarded by mu.
+func (l *hostLimiter) rejectLabel(host string) string {
+	if _, ok := l.limits[host]; ok {
+		return host
+	}
+	return defaultLimitLabel
+}
+
+// acquire takes a connection slot for host, reporting false if the host is
+// at its limit. Every successful acquire must be paired with a release.
+func (l *hostLimiter) acquire(host string) bool {
+	if host == "" {
+		return true
+	}
+	host = strings.ToLower(host)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	max := l.limit(host)
+	if max <= 0 {
+		return true
+	}
+	if l.active[host] >= max {
+		metrics.HostConnectionsRejected.WithLabelValues(l.rejectLabel(host)).Inc()
+		return false
+	}
+	l.active[host]++
+	metrics.HostActiveConnections.WithLabelValues(host).Set(float64(l.active[host]))
+	return true
+}
+
+// release returns a slot taken by acquire. Hosts that were not counted,
+// including "", are ignored. A host's active connection series is removed
+// once its last slot is released.
+func (l *hostLimiter) release(host string) {
+	host = strings.ToLower(host)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.active[host]
+	if !ok {
+		return
+	}
+	if n <= 1 {
+		delete(l.active, host)
+		metrics.HostActiveConnections.DeleteLabelValues(host)
+		return
+	}
+	l.active[host] = n - 1
+	metrics.HostActiveConnections.WithLabelValues(host).Set(float64(n - 1))
+}
+
+// SetHostConnectionLimit caps concurrent client connections to host. Zero
+// removes the cap even when a default is set; negative values fall back to
+// the default.
+func (s *Server) SetHostConnectionLimit(host string, n int) {
+	host = strings.ToLower(host)
+	s.hostLimits.mu.Lock()
+	defer s.hostLimits.mu.Unlock()
+	if n < 0 {
+		delete(s.hostLimits.limits, host)
+		return
+	}
+	s.hostLimits.limits[host] = n
+}
+
+// SetDefaultHostConnectionLimit caps concurrent client connections to every
+// host without its own limit. Zero disables the default cap.
+func (s *Server) SetDefaultHostConnectionLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.hostLimits.mu.Lock()
+	s.hostLimits.defaultLimit = n
+	s.hostLimits.mu.Unlock()
+}
+
+// ParseHostConnectionLimits parses a comma-separated list of host=limit
+// entries: "api.example.com=200,static.example.com=50".
+func ParseHostConnectionLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if strings.TrimSpace(s) == "" {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		host, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		host = strings.TrimSpace(host)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid host connection limit %q: want host=limit", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid connection limit %q for host %s", value, host)
+		}
+		limits[strings.ToLower(host)] = n
+	}
+	return limits, nil
+}
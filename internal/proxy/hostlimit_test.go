@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// scrapeMetrics returns the metrics endpoint's text output.
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestHostLimiterDeletesIdleSeries(t *testing.T) {
+	l := newHostLimiter()
+	l.limits["idle.example.com"] = 2
+	series := `gateway_host_active_connections{host="idle.example.com"}`
+
+	if !l.acquire("Idle.Example.com") || !l.acquire("idle.example.com") {
+		t.Fatal("acquire() = false under the limit")
+	}
+	if got := scrapeMetrics(t); !strings.Contains(got, series+" 2") {
+		t.Fatalf("metrics missing %s 2:\n%s", series, got)
+	}
+	l.release("idle.example.com")
+	l.release("IDLE.example.com")
+	if got := scrapeMetrics(t); strings.Contains(got, series) {
+		t.Errorf("metrics still report %s after the last release", series)
+	}
+}
+
+func TestHostLimiterRejectLabels(t *testing.T) {
+	l := newHostLimiter()
+	l.defaultLimit = 1
+	l.limits["capped.example.com"] = 1
+
+	for _, host := range []string{"capped.example.com", "a.random.example", "b.random.example"} {
+		if !l.acquire(host) {
+			t.Fatalf("acquire(%q) = false under the limit", host)
+		}
+		defer l.release(host)
+	}
+	before := metrics.HostConnectionsRejected.Snapshot()
+	for _, host := range []string{"capped.example.com", "a.random.example", "b.random.example"} {
+		if l.acquire(host) {
+			t.Fatalf("acquire(%q) = true at the limit", host)
+		}
+	}
+
+	after := metrics.HostConnectionsRejected.Snapshot()
+	if got := after["capped.example.com"] - before["capped.example.com"]; got != 1 {
+		t.Errorf("rejections for capped.example.com = %d, want 1", got)
+	}
+	if got := after[defaultLimitLabel] - before[defaultLimitLabel]; got != 2 {
+		t.Errorf("rejections for %q = %d, want 2", defaultLimitLabel, got)
+	}
+	for _, host := range []string{"a.random.example", "b.random.example"} {
+		if _, ok := after[host]; ok {
+			t.Errorf("rejection series created for default-limited host %q", host)
+		}
+	}
+}
@@ -3,129 +3,549 @@ package proxy
 import (
 	"bufio"
 	"bytes"
-	"fmt"
+	"crypto/tls"
+	"errors"
+	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"strings"
 	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+	"eddisonso.com/edd-gateway/internal/router"
 )
 
+// httpRequest holds a single parsed HTTP request header block.
+type httpRequest struct {
+	header []byte // request line and header fields, including the blank line
+	method string
+	path   string
+	host   string // hostname without port
+
+	received time.Time    // when the header block was read
+	upgrade  string       // requested protocol for "Connection: Upgrade" requests, e.g. "websocket"
+	secure   bool         // client used HTTPS, terminated by the gateway or a trusted proxy in front of it
+	id       string       // correlation ID; empty when request IDs are disabled
+	log      *slog.Logger // tags records with the request ID; nil uses the default logger
+}
+
+// logger returns the logger for records about this request.
+func (r *httpRequest) logger() *slog.Logger {
+	if r.log == nil {
+		return slog.Default()
+	}
+	return r.log
+}
+
+// Get returns the first value of the named header field, so requests can
+// be matched against routes with a header condition.
+func (r *httpRequest) Get(name string) string {
+	return headerValue(string(r.header), name)
+}
+
+// httpTarget is the resolved destination for a single HTTP request.
+type httpTarget struct {
+	addr      string
+	header    []byte              // header block to forward, after any rewriting
+	route     *router.StaticRoute // nil for container and fallback targets
+	tlsConfig *tls.Config         // non-nil to re-encrypt to the backend
+
+	proxyHeader []byte // PROXY protocol header sent first on new backend connections
+	client      string // client address, keeping PROXY protocol connections per client
+}
+
+// key identifies backend connections that can serve this target. A
+// connection that announced one client via PROXY protocol cannot be reused
+// for another.
+func (t *httpTarget) key() string {
+	key := t.addr
+	if t.tlsConfig != nil {
+		key = "tls://" + t.tlsConfig.ServerName + "@" + t.addr
+	}
+	if t.proxyHeader != nil {
+		key += "#proxy=" + t.client
+	}
+	return key
+}
+
+// backendConn is an HTTP backend connection that may be reused across requests.
+type backendConn struct {
+	net.Conn
+	key       string
+	reader    *bufio.Reader
+	idle      *idleConn // the underlying connection, for adjusting its idle timeout
+	idleSince time.Time // when the connection was returned to the pool
+}
+
 // handleHTTP handles HTTP connections by extracting the Host header
 // and routing to the appropriate container.
 func (s *Server) handleHTTP(conn net.Conn) {
-	clientAddr := conn.RemoteAddr().String()
+	metrics.ConnectionsTotal.WithLabelValues(ProtocolHTTP).Inc()
+	s.serveHTTP(conn, "")
+}
 
-	// Read HTTP request line and headers
+// serveHTTP serves HTTP/1.x requests on conn one at a time, resolving the route
+// for each request and reusing pooled backend connections while both sides keep them alive.
+// A non-empty sni means TLS was terminated for that host and only static routes apply.
+func (s *Server) serveHTTP(conn net.Conn, sni string) {
+	clientAddr := conn.RemoteAddr().String()
 	reader := bufio.NewReader(conn)
 
-	// Read until we have the complete headers (ends with \r\n\r\n)
-	var headerBuf bytes.Buffer
-	for {
-		line, err := reader.ReadString('\n')
+	defer conn.Close()
+
+	// Get the ingress port from the connection's local address
+	ingressPort := 80
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		ingressPort = addr.Port
+	}
+	// Normalize internal ports to external ports
+	if ingressPort == 8080 {
+		ingressPort = 80
+	}
+
+	// Slot held against the per-host connection limit, released on close
+	var limitedHost string
+	defer func() { s.hostLimits.release(limitedHost) }()
+
+	for first := true; ; first = false {
+		// The first request must arrive within the first-read timeout;
+		// later ones reap kept-alive connections that stay silent
+		if d := s.firstReadTimeout(conn, ProtocolHTTP); first && d > 0 {
+			conn.SetReadDeadline(time.Now().Add(d))
+		} else {
+			conn.SetReadDeadline(time.Now().Add(s.httpIdleTimeout))
+		}
+
+		// Between requests the connection is idle and may be closed by Shutdown
+		if !first && reader.Buffered() == 0 && !s.setConnIdle(conn, true) {
+			return
+		}
+		header, err := readHeaderBlock(reader, maxHeaderBytes, s.maxHeaderLineBytes)
+		if !first {
+			s.setConnIdle(conn, false)
+		}
 		if err != nil {
-			slog.Debug("failed to read HTTP header", "error", err, "client", clientAddr)
-			conn.Close()
+			if errors.Is(err, errHeaderTooLarge) || errors.Is(err, errHeaderLineTooLong) {
+				slog.Warn("HTTP headers too large", "error", err, "client", clientAddr)
+				s.writeError(conn, nil, http.StatusRequestHeaderFieldsTooLarge, "", "Request header fields too large")
+			} else if !errors.Is(err, io.EOF) {
+				slog.Debug("failed to read HTTP header", "error", err, "client", clientAddr)
+			}
 			return
 		}
-		headerBuf.WriteString(line)
+		conn.SetReadDeadline(time.Time{})
 
-		// End of headers
-		if line == "\r\n" || line == "\n" {
-			break
+		req := &httpRequest{
+			header:   header,
+			method:   extractRequestMethod(string(header)),
+			path:     extractRequestPath(string(header)),
+			received: time.Now(),
+		}
+		// Ambiguous headers are refused before anything reads them
+		if err := checkRequestAmbiguity(string(header)); err != nil {
+			slog.Warn("rejecting ambiguous HTTP request", "error", err, "client", clientAddr)
+			s.writeError(conn, req, http.StatusBadRequest, "", "Ambiguous request headers")
+			return
+		}
+		req.upgrade = extractUpgrade(string(header))
+		s.assignRequestID(req)
+
+		if s.shuttingDown() {
+			s.writeUnavailable(conn, req, RetryDraining, "Gateway shutting down")
+			return
+		}
+		if !s.router.Loaded() {
+			s.writeUnavailable(conn, req, RetryNotReady, "Routes not loaded")
+			return
 		}
 
-		// Safety limit
-		if headerBuf.Len() > 16384 {
-			slog.Warn("HTTP headers too large", "client", clientAddr)
-			conn.Write([]byte("HTTP/1.1 431 Request Header Fields Too Large\r\n\r\n"))
-			conn.Close()
+		var target *httpTarget
+		var ok bool
+		if sni != "" {
+			req.host = sni
+			req.secure = true
+			target, ok = s.resolveTerminatedRoute(conn, req)
+		} else {
+			target, ok = s.resolveHTTPRoute(conn, req, ingressPort)
+		}
+		if !ok {
+			return
+		}
+		if s.throttleRequest(conn, req, target.route) {
+			return
+		}
+		if !s.authorizeRequest(conn, req, target) {
+			return
+		}
+		if req.host != limitedHost {
+			if !s.hostLimits.acquire(req.host) {
+				req.logger().Warn("host connection limit reached", "host", req.host, "client", clientAddr)
+				s.writeUnavailable(conn, req, RetryOverload, "Too many connections to host")
+				return
+			}
+			s.hostLimits.release(limitedHost)
+			limitedHost = req.host
+		}
+		target.header = addForwardedFor(target.header, clientAddr)
+		target.header = setClientCertHeader(conn, target.header)
+
+		if !s.forwardHTTP(conn, reader, req, target) {
 			return
 		}
 	}
+}
+
+// resolveHTTPRoute picks the backend for a plain HTTP request.
+// On failure it writes an error response and returns false.
+func (s *Server) resolveHTTPRoute(conn net.Conn, req *httpRequest, ingressPort int) (*httpTarget, bool) {
+	clientAddr := conn.RemoteAddr().String()
 
 	// Parse Host header
-	host := extractHostHeader(headerBuf.String())
+	host := extractHostHeader(string(req.header))
 	if host == "" {
-		slog.Warn("no Host header in HTTP request", "client", clientAddr)
-		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\nMissing Host header\r\n"))
-		conn.Close()
-		return
+		req.logger().Warn("no Host header in HTTP request", "client", clientAddr)
+		s.writeError(conn, req, http.StatusBadRequest, "", "Missing Host header")
+		return nil, false
 	}
 
-	// Remove port from host if present
-	hostname := host
-	if idx := strings.LastIndex(host, ":"); idx != -1 {
-		hostname = host[:idx]
-	}
+	hostname := normalizeHost(host)
+	req.host = hostname
+	path := req.path
+	s.applyForwardedProto(conn, req)
 
-	// Get the ingress port from the connection's local address
-	ingressPort := 80
-	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
-		ingressPort = addr.Port
+	if s.serveACMEChallenge(conn, req) {
+		return nil, false
 	}
-	// Normalize internal ports to external ports
-	if ingressPort == 8080 {
-		ingressPort = 80
+	if s.serveMaintenance(conn, req) {
+		return nil, false
 	}
 
-	// Extract path from request line
-	path := extractRequestPath(headerBuf.String())
-
-	slog.Info("HTTP connection", "host", hostname, "path", path, "port", ingressPort, "client", clientAddr)
+	req.logger().Info("HTTP request", "host", hostname, "path", path, "port", ingressPort, "client", clientAddr)
 
 	// Try to resolve in order: static routes -> container -> fallback
-	var backendAddr string
-	var modifiedHeaders []byte
+	headers := req.header
 
 	// 1. Check static routes first
-	if route, targetPath, err := s.router.ResolveStaticRoute(hostname, path); err == nil {
-		backendAddr = route.Target
-		slog.Info("routing HTTP via static route", "host", hostname, "path", path, "target", route.Target, "targetPath", targetPath)
+	if route, targetPath, err := s.router.ResolveStaticRoute(hostname, path, req); err == nil {
+		if s.redirectToHTTPS(conn, req) {
+			return nil, false
+		}
+		req.logger().Info("routing HTTP via static route", "host", hostname, "path", path, "target", route.Target, "targetPath", targetPath)
 
 		// If strip_prefix is enabled, rewrite the request path
 		if route.StripPrefix && path != targetPath {
-			modifiedHeaders = rewriteRequestPath(headerBuf.Bytes(), path, targetPath)
+			headers = rewriteRequestPath(headers, path, targetPath)
 		}
-	} else if container, targetPort, err := s.router.ResolveHTTP(hostname, ingressPort); err == nil {
-		// 2. Try container routing
-		backendAddr = fmt.Sprintf("lb.%s.svc.cluster.local:%d", container.Namespace, targetPort)
-		slog.Info("routing HTTP to container", "host", hostname, "container", container.ID, "port", ingressPort, "target", targetPort, "backend", backendAddr)
-	} else {
-		// 3. Fall back to default upstream
-		if s.fallbackAddr == "" {
-			slog.Warn("no route found", "host", hostname, "path", path, "port", ingressPort)
-			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\nNo backend available\r\n"))
-			conn.Close()
-			return
+		return s.staticTarget(conn, req, route, headers)
+	}
+
+	// 2. Try container routing
+	if container, targetPort, err := s.router.ResolveHTTP(hostname, ingressPort); routable(err, hostname) {
+		if !container.AllowsMethod(req.method) {
+			allow := strings.Join(container.AllowedMethods, ", ")
+			req.logger().Warn("HTTP method not allowed for container", "host", hostname, "container", container.ID, "method", req.method, "allow", allow)
+			s.writeError(conn, req, http.StatusMethodNotAllowed, "Allow: "+allow+"\r\n", "Method not allowed")
+			return nil, false
+		}
+		backendAddr := serviceAddr(container.Namespace, targetPort)
+		req.logger().Info("routing HTTP to container", "host", hostname, "container", container.ID, "port", ingressPort, "target", targetPort, "backend", backendAddr)
+		return &httpTarget{addr: backendAddr, header: headers}, true
+	}
+
+	// 3. Fall back to default upstream
+	if s.fallbackAddr == "" {
+		req.logger().Warn("no route found", "host", hostname, "path", path, "port", ingressPort)
+		s.writeBadGateway(conn, req, "No backend available", "", errCategoryNoRoute)
+		return nil, false
+	}
+	req.logger().Debug("routing HTTP to fallback upstream", "host", hostname, "fallback", s.fallbackAddr)
+	return &httpTarget{addr: hostPort(s.fallbackAddr, ingressPort), header: headers}, true
+}
+
+// staticTarget builds the target for a matched static route, preparing the
+// upstream TLS config when the route re-encrypts to its backend.
+func (s *Server) staticTarget(conn net.Conn, req *httpRequest, route *router.StaticRoute, headers []byte) (*httpTarget, bool) {
+	if route.HashKey != "" {
+		if t := s.router.TargetForKey(route, requestHashKey(req, route.HashKey)); t != "" {
+			chosen := *route
+			chosen.Target = t
+			route = &chosen
+		}
+	}
+	// Every target of a multi-target route is ejected: fail fast until the
+	// cooldown lets one be re-probed
+	if route.MultiTarget() && s.ejector.ejected(route.Target) {
+		req.logger().Warn("all route targets ejected", "host", req.host, "path", route.PathPrefix, "target", route.Target)
+		s.writeUnavailable(conn, req, RetryCircuitOpen, "Backend unavailable")
+		return nil, false
+	}
+	target := &httpTarget{addr: route.Target, header: headers, route: route}
+	if route.ProxyProtocol != "" {
+		target.proxyHeader = proxyProtocolHeader(route.ProxyProtocol, conn.RemoteAddr(), conn.LocalAddr())
+		target.client = conn.RemoteAddr().String()
+	}
+	if route.UpstreamTLS {
+		cfg, err := s.upstreamTLSConfig(route, req.host)
+		if err != nil {
+			req.logger().Error("failed to prepare upstream TLS", "host", req.host, "target", route.Target, "error", err)
+			s.writeBadGateway(conn, req, "Backend connection failed", route.Target, errCategoryTLS)
+			return nil, false
+		}
+		target.tlsConfig = cfg
+	}
+	return target, true
+}
+
+// forwardHTTP sends one request to the backend and relays the response, using
+// an idle pooled connection to the target when one is available and returning
+// it to the pool after a clean exchange. Returns whether the client connection
+// should stay open.
+func (s *Server) forwardHTTP(conn net.Conn, reader *bufio.Reader, req *httpRequest, target *httpTarget) bool {
+	clientAddr := conn.RemoteAddr().String()
+	backendAddr := target.addr
+
+	reqFraming, reqLen, err := requestBodyFraming(string(req.header))
+	if err != nil {
+		req.logger().Warn("invalid HTTP request framing", "host", req.host, "error", err, "client", clientAddr)
+		s.writeError(conn, req, http.StatusBadRequest, "", "Invalid request body framing")
+		return false
+	}
+
+	var body []byte
+	buffered := target.route != nil && target.route.BufferBody && reqFraming != bodyNone
+	if buffered {
+		var ok bool
+		if body, ok = s.bufferRequestBody(conn, reader, req, target, reqFraming, reqLen); !ok {
+			return false
 		}
-		slog.Debug("routing HTTP to fallback upstream", "host", hostname, "fallback", s.fallbackAddr)
-		backendAddr = fmt.Sprintf("%s:%d", s.fallbackAddr, ingressPort)
 	}
-	backend, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
+
+	// The request timeout starts once the request is fully received, so a
+	// slow client cannot use up the backend's budget
+	policy := s.routePolicy(target.route, time.Now())
+	backend := s.backends.get(target.key())
+	reused := backend != nil
+
+	// Send the request header and read the response header, forwarding any
+	// interim 1xx responses. The body is streamed concurrently so that
+	// "Expect: 100-continue" and early backend responses work.
+	var bodyDone chan error
+	var resp backendResponse
+	for {
+		bodyDone = make(chan error, 1)
+		if backend == nil {
+			backend, err = s.dialWithPolicy(target, policy)
+			if errors.Is(err, errRequestTimeout) {
+				req.logger().Error("request timeout exceeded connecting to backend", "host", req.host, "addr", backendAddr, "timeout", policy.RequestTimeout, "error", err)
+				s.writeGatewayTimeout(conn, req, backendAddr)
+				return false
+			}
+			if err != nil {
+				req.logger().Error("failed to connect to backend", "host", req.host, "addr", backendAddr, "error", err)
+				s.writeBadGateway(conn, req, "Backend connection failed", backendAddr, classifyBackendError(err))
+				return false
+			}
+			req.logger().Debug("proxying HTTP to backend", "host", req.host, "backend", backendAddr)
+		}
+		backend.idle.setTimeout(s.routeIdleTimeout(target.route))
+		backend.idle.setLimit(policy.deadline)
+
+		bodySrc := reader
+		if buffered {
+			bodySrc = bufio.NewReader(bytes.NewReader(body))
+		}
+		resp, err = exchangeHTTP(conn, bodySrc, backend, target.header, reqFraming, reqLen, bodyDone)
+		if err == nil {
+			// Only the wait for the response header is bounded
+			backend.idle.setLimit(time.Time{})
+			break
+		}
+		backend.Close()
+		backend = nil
+		err = budgetError(err, !policy.deadline.IsZero() && !time.Now().Before(policy.deadline))
+		if errors.Is(err, errRequestTimeout) {
+			req.logger().Error("request timeout exceeded waiting for backend response", "host", req.host, "addr", backendAddr, "timeout", policy.RequestTimeout)
+			s.writeGatewayTimeout(conn, req, backendAddr)
+			return false
+		}
+
+		// A reused connection may have been closed by the backend while idle;
+		// retry once on a fresh connection if no body was consumed.
+		if reused && reqFraming == bodyNone {
+			req.logger().Debug("reused backend connection failed, redialing", "addr", backendAddr, "error", err)
+			reused = false
+			continue
+		}
+		req.logger().Error("failed to read backend response", "host", req.host, "addr", backendAddr, "error", err)
+		s.writeBadGateway(conn, req, "Backend connection failed", backendAddr, classifyBackendError(err))
+		return false
+	}
+
+	status := resp.status
+	metrics.ObserveBackendStatus(status)
+	if status == 101 && req.upgrade == "" {
+		req.logger().Warn("backend switched protocols without an upgrade request", "host", req.host, "backend", backendAddr)
+		backend.Close()
+		s.writeBadGateway(conn, req, "Invalid backend response", backendAddr, errCategoryBadResponse)
+		return false
+	}
+
+	if req.secure && status != 101 {
+		resp.header = addResponseHeaders(resp.header, s.responseHeaders(target.route))
+	}
+	respStr := string(resp.header)
+	var encoding string
+	if status != 101 && target.route != nil && target.route.Compress {
+		if encoding = responseEncoding(req, status, respStr); encoding != "" {
+			resp.header = compressedHeader(resp.header, encoding)
+		}
+	}
+
+	if _, err := conn.Write(resp.header); err != nil {
+		backend.Close()
+		return false
+	}
+	metrics.AddProxyBytes(metrics.DirectionDownstream, int64(len(resp.header)))
+
+	if status == 101 {
+		// Protocol switched (e.g. WebSocket): relay raw bytes in both
+		// directions from here on and never parse HTTP again
+		req.logger().Info("HTTP upgrade accepted", "host", req.host, "protocol", req.upgrade, "backend", backendAddr)
+		s.logAccess(clientAddr, req, backendAddr, status, 0)
+		<-bodyDone
+		if n := backend.reader.Buffered(); n > 0 {
+			pending, _ := backend.reader.Peek(n)
+			if _, err := conn.Write(pending); err != nil {
+				backend.Close()
+				return false
+			}
+		}
+		buffered := make([]byte, reader.Buffered())
+		reader.Read(buffered)
+		s.proxy(conn, backend.Conn, buffered)
+		return false
+	}
+
+	respFraming, respLen := responseBodyFraming(req.method, status, respStr)
+	if trailer := headerValue(respStr, "Trailer"); trailer != "" && respFraming == bodyChunked {
+		req.logger().Debug("relaying response trailers", "host", req.host, "trailer", trailer)
+	}
+	var written int64
+	if encoding != "" {
+		written, err = copyCompressed(conn, backend.reader, respFraming, respLen, encoding)
+	} else {
+		written, err = copyBody(conn, backend.reader, respFraming, respLen)
+	}
+	metrics.AddProxyBytes(metrics.DirectionDownstream, written)
+	s.logAccess(clientAddr, req, backendAddr, status, written)
 	if err != nil {
-		slog.Error("failed to connect to backend", "host", hostname, "addr", backendAddr, "error", err)
-		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\nBackend connection failed\r\n"))
-		conn.Close()
+		req.logger().Debug("failed to relay HTTP response body", "host", req.host, "backend", backendAddr, "error", err)
+		backend.Close()
+		return false
+	}
+
+	// The request body must be fully forwarded before either side is reused
+	select {
+	case err := <-bodyDone:
+		if err != nil {
+			req.logger().Debug("failed to forward HTTP request body", "host", req.host, "backend", backendAddr, "error", err)
+			backend.Close()
+			return false
+		}
+	case <-time.After(time.Second):
+		backend.Close()
+		return false
+	}
+
+	if !wantsKeepAlive(string(req.header)) || !wantsKeepAlive(respStr) || respFraming == bodyUntilClose {
+		backend.Close()
+		return false
+	}
+	s.backends.put(backend)
+	return true
+}
+
+// logAccess records a proxied request in the access log, if enabled. The
+// status is the one from the backend's response line.
+func (s *Server) logAccess(clientAddr string, req *httpRequest, target string, status int, bytes int64) {
+	if s.accessLog == nil {
 		return
 	}
+	entry := newAccessLogEntry(clientAddr, req)
+	entry.duration = time.Since(req.received)
+	entry.target = target
+	entry.status = status
+	entry.bytes = bytes
+	s.accessLog.log(entry)
+}
 
-	slog.Debug("proxying HTTP to backend", "host", hostname, "backend", backendAddr)
+// backendResponse is the final response header read from a backend, before
+// its body is streamed on to the client.
+type backendResponse struct {
+	header []byte // status line and header fields, including the blank line
+	status int    // status code from the status line
+}
 
-	// Get any buffered data from the reader
-	buffered := make([]byte, reader.Buffered())
-	reader.Read(buffered)
+// exchangeHTTP writes the request header to the backend, starts streaming the
+// request body, and reads the final (non-1xx, or 101) response header.
+func exchangeHTTP(conn net.Conn, reader *bufio.Reader, backend *backendConn, header []byte, reqFraming bodyFraming, reqLen int64, bodyDone chan<- error) (backendResponse, error) {
+	if _, err := backend.Write(header); err != nil {
+		return backendResponse{}, err
+	}
+	metrics.AddProxyBytes(metrics.DirectionUpstream, int64(len(header)))
 
-	// Use modified headers if path was rewritten, otherwise use original
-	headers := headerBuf.Bytes()
-	if modifiedHeaders != nil {
-		headers = modifiedHeaders
+	if reqFraming == bodyNone {
+		bodyDone <- nil
+	} else {
+		go func() {
+			n, err := copyBody(backend, reader, reqFraming, reqLen)
+			metrics.AddProxyBytes(metrics.DirectionUpstream, n)
+			bodyDone <- err
+		}()
 	}
 
-	// Combine headers with any buffered body data
-	initialData := append(headers, buffered...)
+	for {
+		respHeader, err := readHeaderBlock(backend.reader, maxResponseHeaderBytes, maxResponseHeaderBytes)
+		if err != nil {
+			return backendResponse{}, err
+		}
+		status, err := parseStatusCode(extractRequestLine(string(respHeader)))
+		if err != nil {
+			return backendResponse{}, err
+		}
+		if status >= 100 && status < 200 && status != 101 {
+			if _, err := conn.Write(respHeader); err != nil {
+				return backendResponse{}, err
+			}
+			continue
+		}
+		return backendResponse{header: respHeader, status: status}, nil
+	}
+}
 
-	// Proxy the connection
-	proxy(conn, backend, initialData)
+// dialHTTPBackend opens a new connection to an HTTP backend, performing the
+// TLS handshake first when the target re-encrypts.
+func (s *Server) dialHTTPBackend(target *httpTarget, timeout time.Duration, capped bool) (*backendConn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	start := time.Now()
+	switch {
+	case target.proxyHeader != nil:
+		conn, err = dialWithProxyHeader(dialer, target)
+	case target.tlsConfig != nil:
+		conn, err = tls.DialWithDialer(dialer, "tcp", target.addr, target.tlsConfig)
+	default:
+		conn, err = dialer.Dial("tcp", target.addr)
+	}
+	err = budgetError(err, capped)
+	s.observeDial(ProtocolHTTP, target.addr, target.route, start, err)
+	if err != nil {
+		return nil, err
+	}
+	idle := &idleConn{Conn: conn}
+	return &backendConn{Conn: idle, key: target.key(), reader: bufio.NewReader(idle), idle: idle}, nil
 }
 
 // extractHostHeader finds the Host header value in HTTP headers.
@@ -150,6 +570,26 @@ func extractRequestLine(headers string) string {
 	return strings.TrimSpace(headers[:idx])
 }
 
+// extractUpgrade returns the protocol requested via "Connection: Upgrade" and
+// the Upgrade header, or "" if the request is not an upgrade. Matching is
+// case-insensitive and accepts list forms like "Connection: keep-alive, Upgrade".
+func extractUpgrade(headers string) string {
+	if !headerHasToken(headers, "Connection", "upgrade") {
+		return ""
+	}
+	return strings.ToLower(headerValue(headers, "Upgrade"))
+}
+
+// extractRequestMethod extracts the method from the HTTP request line.
+// "GET /foo/bar HTTP/1.1" -> "GET"
+func extractRequestMethod(headers string) string {
+	requestLine := extractRequestLine(headers)
+	if idx := strings.Index(requestLine, " "); idx != -1 {
+		return requestLine[:idx]
+	}
+	return requestLine
+}
+
 // extractRequestPath extracts the path from the HTTP request line.
 // "GET /foo/bar HTTP/1.1" -> "/foo/bar"
 func extractRequestPath(headers string) string {
@@ -160,25 +600,55 @@ func extractRequestPath(headers string) string {
 	}
 	requestLine := strings.TrimSpace(headers[:idx])
 
-	// Parse: METHOD PATH HTTP/VERSION
+	// Parse: METHOD TARGET HTTP/VERSION
 	parts := strings.SplitN(requestLine, " ", 3)
 	if len(parts) < 2 {
 		return "/"
 	}
 
-	path := parts[1]
-	// Remove query string if present
-	if qIdx := strings.Index(path, "?"); qIdx != -1 {
-		path = path[:qIdx]
+	// OPTIONS * asks about the server as a whole; route it like the root
+	if parts[1] == "*" {
+		return "/"
 	}
+	_, path, _ := parseRequestTarget(parts[1])
+	return path
+}
 
+// parseRequestTarget splits a request target into the origin of an
+// absolute-form target, the path, and the query string including its "?".
+// An empty path is "/". The parts are returned as sent, still
+// percent-encoded, so origin+path+query reproduces the target.
+func parseRequestTarget(target string) (origin, path, query string) {
+	origin, path = splitRequestTarget(target)
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path, query = path[:i], path[i:]
+	}
 	if path == "" {
-		return "/"
+		path = "/"
 	}
-	return path
+	return origin, path, query
+}
+
+// splitRequestTarget splits an absolute-form request target such as
+// "http://example.com/a?b" into its scheme and authority,
+// "http://example.com", and the path and query, "/a?b". Origin-form targets
+// have no origin.
+func splitRequestTarget(target string) (origin, pathQuery string) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !(strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https")) {
+		return "", target
+	}
+	slash := strings.IndexAny(rest, "/?")
+	if slash == -1 {
+		return target, ""
+	}
+	return scheme + "://" + rest[:slash], rest[slash:]
 }
 
-// rewriteRequestPath replaces the path in the HTTP request line.
+// rewriteRequestPath replaces the path in the HTTP request line, keeping the
+// query string byte for byte and, for absolute-form targets, the scheme and
+// authority. oldPath is the path extractRequestPath returned; a request line
+// whose path differs is left alone.
 func rewriteRequestPath(headers []byte, oldPath, newPath string) []byte {
 	headerStr := string(headers)
 
@@ -188,15 +658,20 @@ func rewriteRequestPath(headers []byte, oldPath, newPath string) []byte {
 		return headers
 	}
 
-	requestLine := headerStr[:idx]
-	rest := headerStr[idx:]
-
-	// Replace the path in the request line
-	newRequestLine := strings.Replace(requestLine, " "+oldPath+" ", " "+newPath+" ", 1)
-	// Also handle case where path might have query string
-	newRequestLine = strings.Replace(newRequestLine, " "+oldPath+"?", " "+newPath+"?", 1)
+	parts := strings.SplitN(headerStr[:idx], " ", 3)
+	if len(parts) < 3 {
+		return headers
+	}
+	if parts[1] == "*" {
+		return headers
+	}
+	origin, path, query := parseRequestTarget(parts[1])
+	if path != oldPath {
+		return headers
+	}
+	parts[1] = origin + newPath + query
 
-	return []byte(newRequestLine + rest)
+	return []byte(strings.Join(parts, " ") + headerStr[idx:])
 }
 
 // addHeader inserts an HTTP header before the final CRLF.
@@ -214,3 +689,66 @@ func addHeader(headers []byte, name, value string) []byte {
 	}
 	return []byte(headerStr[:idx] + "\r\n" + name + ": " + value + "\r\n\r\n")
 }
+
+// appendHeaderValue appends value to the last occurrence of the named header
+// as a comma-separated list element, or adds the header if it is absent.
+func appendHeaderValue(headers []byte, name, value string) []byte {
+	headerStr := string(headers)
+	lines := strings.SplitAfter(headerStr, "\n")
+
+	last := -1
+	for i, line := range lines[1:] {
+		colon := strings.IndexByte(line, ':')
+		if colon > 0 && strings.EqualFold(strings.TrimSpace(line[:colon]), name) {
+			last = i + 1
+		}
+	}
+	if last == -1 {
+		return addHeader(headers, name, value)
+	}
+
+	line := lines[last]
+	eol := "\n"
+	if strings.HasSuffix(line, "\r\n") {
+		eol = "\r\n"
+	}
+	existing := strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(existing[strings.IndexByte(existing, ':')+1:]) == "" {
+		lines[last] = existing + " " + value + eol
+	} else {
+		lines[last] = existing + ", " + value + eol
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// removeHeader deletes every occurrence of the named header.
+func removeHeader(headers []byte, name string) []byte {
+	lines := strings.SplitAfter(string(headers), "\n")
+	kept := lines[:1]
+	for _, line := range lines[1:] {
+		colon := strings.IndexByte(line, ':')
+		if colon > 0 && strings.EqualFold(strings.TrimSpace(line[:colon]), name) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return []byte(strings.Join(kept, ""))
+}
+
+// addForwardedFor records the immediate peer in X-Forwarded-For (appending to
+// any existing chain) and sets X-Real-IP, replacing any client-supplied value.
+func addForwardedFor(headers []byte, remoteAddr string) []byte {
+	ip := clientIP(remoteAddr)
+	headers = appendHeaderValue(headers, "X-Forwarded-For", ip)
+	headers = removeHeader(headers, "X-Real-IP")
+	return addHeader(headers, "X-Real-IP", ip)
+}
+
+// clientIP strips the port from a remote address, including the brackets
+// around IPv6 literals: "[fd00::1]:5000" -> "fd00::1".
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
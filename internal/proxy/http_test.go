@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// gatewayConn returns the client end of a connection served by s.
+func gatewayConn(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go s.handleHTTP(server)
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+	return client, bufio.NewReader(client)
+}
+
+// backendAddr returns the host:port of a test HTTP server.
+func backendAddr(ts *httptest.Server) string {
+	return strings.TrimPrefix(ts.URL, "http://")
+}
+
+func TestRelayResponseTrailers(t *testing.T) {
+	long := strings.Repeat("x", 2<<10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status, X-Checksum")
+		io.WriteString(w, "streamed body")
+		w.(http.Flusher).Flush()
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("X-Checksum", long)
+	}))
+	defer backend.Close()
+
+	s := NewServer(router.NewStatic([]router.StaticRoute{{Host: "app.example", PathPrefix: "/", Target: backendAddr(backend)}}), "")
+	conn, br := gatewayConn(t, s)
+
+	// Two requests on one connection: the first response must end exactly
+	// after its trailers for the second to parse
+	for i := 0; i < 2; i++ {
+		io.WriteString(conn, "GET /stream HTTP/1.1\r\nHost: app.example\r\n\r\n")
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("request %d: reading response: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("request %d: reading body: %v", i, err)
+		}
+		if string(body) != "streamed body" {
+			t.Errorf("request %d: body = %q", i, body)
+		}
+		if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+			t.Errorf("request %d: Grpc-Status trailer = %q, want 0", i, got)
+		}
+		if got := resp.Trailer.Get("X-Checksum"); got != long {
+			t.Errorf("request %d: X-Checksum trailer has %d bytes, want %d", i, len(got), len(long))
+		}
+	}
+}
+
+func TestCopyChunkedTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{"no trailers", "5\r\nhello\r\n0\r\n\r\n", nil},
+		{"trailers", "5\r\nhello\r\n0\r\nGrpc-Status: 0\r\nGrpc-Message: ok\r\n\r\n", nil},
+		{"long trailer", "0\r\nX-Long: " + strings.Repeat("y", 100) + "\r\n\r\n", nil},
+		{"oversized trailers", "0\r\nX-Long: " + strings.Repeat("y", maxHeaderBytes) + "\r\n\r\n", errHeaderTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A reader buffer smaller than the trailer lines
+			src := bufio.NewReaderSize(strings.NewReader(tt.body+"NEXT"), 16)
+			var dst strings.Builder
+			n, err := copyChunked(&dst, src)
+			if err != tt.wantErr {
+				t.Fatalf("copyChunked() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if dst.String() != tt.body || n != int64(len(tt.body)) {
+				t.Errorf("copied %d bytes %q, want %q", n, dst.String(), tt.body)
+			}
+			if rest, _ := io.ReadAll(src); string(rest) != "NEXT" {
+				t.Errorf("left %q unread, want the next message", rest)
+			}
+		})
+	}
+}
+
+func TestExtractRequestPath(t *testing.T) {
+	for line, want := range map[string]string{
+		"GET /api/users HTTP/1.1":                      "/api/users",
+		"GET /api/users?id=1 HTTP/1.1":                 "/api/users",
+		"GET http://app.example/api/users HTTP/1.1":    "/api/users",
+		"GET HTTP://App.Example:8080/api?x=1 HTTP/1.1": "/api",
+		"GET https://app.example HTTP/1.1":             "/",
+		"GET http://app.example?x=1 HTTP/1.1":          "/",
+		"OPTIONS * HTTP/1.1":                           "/",
+		"GET":                                          "/",
+	} {
+		if got := extractRequestPath(line + "\r\nHost: app.example\r\n\r\n"); got != want {
+			t.Errorf("extractRequestPath(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestRewriteRequestPathForms(t *testing.T) {
+	tests := []struct {
+		line, oldPath, newPath, want string
+	}{
+		{"GET /api/users HTTP/1.1", "/api/users", "/users", "GET /users HTTP/1.1"},
+		{"GET http://app.example/api/users HTTP/1.1", "/api/users", "/users", "GET http://app.example/users HTTP/1.1"},
+		{"GET https://app.example:8443/api/users?x=1 HTTP/1.1", "/api/users", "/users", "GET https://app.example:8443/users?x=1 HTTP/1.1"},
+		{"GET http://app.example HTTP/1.1", "/", "/v1/", "GET http://app.example/v1/ HTTP/1.1"},
+		{"OPTIONS * HTTP/1.1", "/", "/other", "OPTIONS * HTTP/1.1"},
+		// A path that is not the one routed on is left alone
+		{"GET /api/users HTTP/1.1", "/api/other", "/other", "GET /api/users HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		got := string(rewriteRequestPath([]byte(tt.line+"\r\nHost: app.example\r\n\r\n"), tt.oldPath, tt.newPath))
+		if want := tt.want + "\r\nHost: app.example\r\n\r\n"; got != want {
+			t.Errorf("rewriteRequestPath(%q, %q, %q) = %q, want %q", tt.line, tt.oldPath, tt.newPath, got, want)
+		}
+	}
+}
+
+// stripPrefixBackend starts a backend that answers with the request target
+// it received, and a gateway routing app.example/api to it with the prefix
+// stripped.
+func stripPrefixBackend(t *testing.T) *Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RequestURI)
+	}))
+	t.Cleanup(backend.Close)
+	return NewServer(router.NewStatic([]router.StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: backendAddr(backend)},
+		{Host: "app.example", PathPrefix: "/api", Target: backendAddr(backend), StripPrefix: true},
+	}), "")
+}
+
+// forwardedTarget sends line to s and returns the request target the
+// backend saw.
+func forwardedTarget(t *testing.T, s *Server, line string) string {
+	t.Helper()
+	conn, br := gatewayConn(t, s)
+	io.WriteString(conn, line+"\r\nHost: app.example\r\n\r\n")
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: status %d", line, resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestStripPrefixRequestForms(t *testing.T) {
+	s := stripPrefixBackend(t)
+	for line, want := range map[string]string{
+		"GET /api/users HTTP/1.1":                   "/users",
+		"GET http://app.example/api/users HTTP/1.1": "http://app.example/users",
+	} {
+		if got := forwardedTarget(t, s, line); got != want {
+			t.Errorf("%s reached the backend as %q, want %q", line, got, want)
+		}
+	}
+	// net/http answers OPTIONS * itself, so reaching it is all there is to see
+	forwardedTarget(t, s, "OPTIONS * HTTP/1.1")
+}
+
+func TestRewriteRequestPathKeepsQuery(t *testing.T) {
+	for _, query := range []string{
+		"?foo=bar",
+		"?foo=bar&baz=qux&foo=again",
+		"?q=a%20b%26c&next=%2Fhome%3Fx%3D1",
+		"?redirect=/api/users&empty=&flag",
+		"?",
+	} {
+		line := "GET /api/users" + query + " HTTP/1.1\r\nHost: app.example\r\n\r\n"
+		want := "GET /users" + query + " HTTP/1.1\r\nHost: app.example\r\n\r\n"
+		if got := string(rewriteRequestPath([]byte(line), "/api/users", "/users")); got != want {
+			t.Errorf("rewriteRequestPath() = %q, want %q", got, want)
+		}
+	}
+	// An encoded path is matched and rewritten as sent
+	line := "GET /api/a%2Fb?x=%41 HTTP/1.1\r\n\r\n"
+	if got := string(rewriteRequestPath([]byte(line), "/api/a%2Fb", "/a%2Fb")); got != "GET /a%2Fb?x=%41 HTTP/1.1\r\n\r\n" {
+		t.Errorf("rewriteRequestPath() = %q", got)
+	}
+}
+
+func TestStripPrefixKeepsQuery(t *testing.T) {
+	s := stripPrefixBackend(t)
+	for _, query := range []string{"?foo=bar", "?a=1&b=2&a=3", "?q=caf%C3%A9&path=%2Fapi%2Fx"} {
+		if got, want := forwardedTarget(t, s, "GET /api/x"+query+" HTTP/1.1"), "/x"+query; got != want {
+			t.Errorf("/api/x%s reached the backend as %q, want %q", query, got, want)
+		}
+	}
+	if got := forwardedTarget(t, s, "GET /api?only=query HTTP/1.1"); got != "/?only=query" {
+		t.Errorf("/api?only=query reached the backend as %q, want /?only=query", got)
+	}
+}
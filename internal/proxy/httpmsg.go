@@ -0,0 +1,445 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+const (
+	// maxHeaderBytes caps the size of a request header block.
+	maxHeaderBytes = 16384
+	// maxResponseHeaderBytes caps the size of a backend response header block.
+	maxResponseHeaderBytes = 65536
+
+	// DefaultMaxHeaderLineBytes caps a single request line or header field.
+	DefaultMaxHeaderLineBytes = 8192
+)
+
+var (
+	errHeaderTooLarge    = errors.New("header too large")
+	errHeaderLineTooLong = errors.New("header line too long")
+	errBadContentLength  = errors.New("invalid Content-Length")
+	errBadChunk          = errors.New("malformed chunked encoding")
+	errBadEncoding       = errors.New("unsupported Transfer-Encoding")
+	errBadStatusLine     = errors.New("malformed status line")
+	errDuplicateHost     = errors.New("multiple Host headers")
+	errAmbiguousFraming  = errors.New("both Content-Length and Transfer-Encoding present")
+	errBadFieldLine      = errors.New("malformed header field line")
+)
+
+// bodyFraming describes how the end of an HTTP message body is determined.
+type bodyFraming int
+
+const (
+	bodyNone       bodyFraming = iota // no body
+	bodyLength                        // Content-Length bytes
+	bodyChunked                       // chunked transfer coding
+	bodyUntilClose                    // body ends when the sender closes
+)
+
+// readHeaderBlock reads an HTTP start line and header fields up to and
+// including the terminating blank line. The block may not exceed limit
+// bytes, and no single line may exceed lineLimit bytes.
+func readHeaderBlock(r *bufio.Reader, limit, lineLimit int) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := readLine(r, lineLimit)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+
+		// End of headers
+		if l := string(line); l == "\r\n" || l == "\n" {
+			// Tolerate stray blank lines before a request (RFC 7230 3.5)
+			if buf.Len() == len(line) {
+				buf.Reset()
+				continue
+			}
+			return buf.Bytes(), nil
+		}
+
+		// Safety limit
+		if buf.Len() > limit {
+			return nil, errHeaderTooLarge
+		}
+	}
+}
+
+// readLine reads one line including its terminating newline, failing with
+// errHeaderLineTooLong once it grows past limit instead of buffering it all.
+func readLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > limit {
+			return nil, errHeaderLineTooLong
+		}
+		if err == nil {
+			return line, nil
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+}
+
+// normalizeHost reduces a Host header value or SNI name to the form routes
+// and container hostnames are keyed by: lowercase, without a port and
+// without a single trailing dot. "EX.com.:443" becomes "ex.com".
+func normalizeHost(raw string) string {
+	host := strings.TrimSpace(raw)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
+
+// headerValues returns the values of every header field with the given name.
+// The start line is skipped; name matching is case-insensitive.
+func headerValues(headers, name string) []string {
+	var values []string
+	lines := strings.Split(headers, "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		if strings.EqualFold(line[:colon], name) {
+			values = append(values, strings.TrimSpace(line[colon+1:]))
+		}
+	}
+	return values
+}
+
+// headerValue returns the first value of the named header field, or "".
+func headerValue(headers, name string) string {
+	if values := headerValues(headers, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// headerHasToken reports whether a comma-separated header field contains
+// the given token, compared case-insensitively.
+// "Connection: keep-alive, Upgrade" has token "upgrade".
+func headerHasToken(headers, name, token string) bool {
+	for _, value := range headerValues(headers, name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractProto extracts the HTTP version from a request or status line.
+// "GET / HTTP/1.1" -> "HTTP/1.1", "HTTP/1.0 200 OK" -> "HTTP/1.0"
+func extractProto(startLine string) string {
+	if strings.HasPrefix(startLine, "HTTP/") {
+		if idx := strings.IndexByte(startLine, ' '); idx != -1 {
+			return startLine[:idx]
+		}
+		return startLine
+	}
+	if idx := strings.LastIndexByte(startLine, ' '); idx != -1 {
+		return startLine[idx+1:]
+	}
+	return ""
+}
+
+// parseStatusCode extracts the status code from a response status line.
+// "HTTP/1.1 404 Not Found" -> 404
+func parseStatusCode(statusLine string) (int, error) {
+	parts := strings.SplitN(statusLine, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") || len(parts[1]) != 3 {
+		return 0, errBadStatusLine
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errBadStatusLine
+	}
+	return code, nil
+}
+
+// wantsKeepAlive reports whether the sender of a message wants the
+// connection kept open, based on its HTTP version and Connection header.
+func wantsKeepAlive(headers string) bool {
+	if headerHasToken(headers, "Connection", "close") {
+		return false
+	}
+	if extractProto(extractRequestLine(headers)) == "HTTP/1.0" {
+		return headerHasToken(headers, "Connection", "keep-alive")
+	}
+	return true
+}
+
+// checkRequestAmbiguity rejects requests that intermediaries and backends
+// could interpret differently, the basis of request smuggling: a field line
+// that is not a plain "name: value", more than one Host header,
+// Content-Length combined with Transfer-Encoding, or a Content-Length that
+// is not a single plain decimal number.
+func checkRequestAmbiguity(headers string) error {
+	if err := checkFieldLines(headers); err != nil {
+		return err
+	}
+	if len(headerValues(headers, "Host")) > 1 {
+		return errDuplicateHost
+	}
+	if len(headerValues(headers, "Transfer-Encoding")) > 0 && len(headerValues(headers, "Content-Length")) > 0 {
+		return errAmbiguousFraming
+	}
+	return checkContentLength(headers)
+}
+
+// checkFieldLines rejects a header block with a field line whose name is
+// not a token immediately followed by a colon. headerValues would not see
+// "Transfer-Encoding : chunked" or a field folded onto the previous line,
+// but a lenient backend might, so they must not be forwarded (RFC 9112 5.1).
+func checkFieldLines(headers string) error {
+	lines := strings.Split(headers, "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || router.ValidateHeaderName(name) != nil {
+			return errBadFieldLine
+		}
+	}
+	return nil
+}
+
+// checkContentLength validates Content-Length strictly: at most one field,
+// whose value is digits only with no sign or leading zeros. Lenient parsers
+// disagree on "+5", "005", "5, 5" and "5 5". Field names have already been
+// checked by checkFieldLines, so a Content-Length hidden by whitespace or
+// folding never gets here.
+func checkContentLength(headers string) error {
+	values := headerValues(headers, "Content-Length")
+	if len(values) == 0 {
+		return nil
+	}
+	if len(values) > 1 {
+		return errBadContentLength
+	}
+	v := values[0]
+	if v == "" || len(v) > 18 || (len(v) > 1 && v[0] == '0') {
+		return errBadContentLength
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return errBadContentLength
+		}
+	}
+	return nil
+}
+
+// requestBodyFraming determines how the request body is delimited.
+func requestBodyFraming(headers string) (bodyFraming, int64, error) {
+	if te := headerValues(headers, "Transfer-Encoding"); len(te) > 0 {
+		if !isChunkedLast(te) {
+			return bodyNone, 0, errBadEncoding
+		}
+		return bodyChunked, 0, nil
+	}
+	if cl := headerValue(headers, "Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return bodyNone, 0, errBadContentLength
+		}
+		if n == 0 {
+			return bodyNone, 0, nil
+		}
+		return bodyLength, n, nil
+	}
+	return bodyNone, 0, nil
+}
+
+// responseBodyFraming determines how the response body is delimited.
+func responseBodyFraming(method string, status int, headers string) (bodyFraming, int64) {
+	if method == "HEAD" || (status >= 100 && status < 200) || status == 204 || status == 304 {
+		return bodyNone, 0
+	}
+	if te := headerValues(headers, "Transfer-Encoding"); len(te) > 0 {
+		if isChunkedLast(te) {
+			return bodyChunked, 0
+		}
+		return bodyUntilClose, 0
+	}
+	if cl := headerValue(headers, "Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return bodyUntilClose, 0
+		}
+		return bodyLength, n
+	}
+	return bodyUntilClose, 0
+}
+
+// isChunkedLast reports whether chunked is the final transfer coding.
+func isChunkedLast(values []string) bool {
+	codings := strings.Split(values[len(values)-1], ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+}
+
+// copyBody copies a message body from src to dst verbatim according to its framing.
+func copyBody(dst io.Writer, src *bufio.Reader, framing bodyFraming, length int64) (int64, error) {
+	switch framing {
+	case bodyLength:
+		return io.CopyN(dst, src, length)
+	case bodyChunked:
+		return copyChunked(dst, src)
+	case bodyUntilClose:
+		return io.Copy(dst, src)
+	}
+	return 0, nil
+}
+
+// copyChunked copies a chunked body verbatim, including chunk extensions
+// and any trailer fields, stopping after the terminating blank line so the
+// connection can be reused.
+func copyChunked(dst io.Writer, src *bufio.Reader) (int64, error) {
+	var written int64
+	write := func(b []byte) error {
+		n, err := dst.Write(b)
+		written += int64(n)
+		return err
+	}
+
+	for {
+		// Chunk size line: 1*HEXDIG [ chunk-ext ] CRLF
+		line, err := src.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				return written, errBadChunk
+			}
+			return written, err
+		}
+		size, err := parseChunkSize(line)
+		if err != nil {
+			return written, err
+		}
+		if err := write(line); err != nil {
+			return written, err
+		}
+
+		if size == 0 {
+			n, err := copyTrailers(dst, src)
+			written += n
+			return written, err
+		}
+
+		n, err := io.CopyN(dst, src, size)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		// Chunk data is followed by CRLF
+		line, err = src.ReadSlice('\n')
+		if err != nil {
+			return written, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) != 0 {
+			return written, errBadChunk
+		}
+		if err := write(line); err != nil {
+			return written, err
+		}
+	}
+}
+
+// copyTrailers copies the trailer section that follows the last chunk,
+// up to and including the terminating empty line. Fields announced by a
+// Trailer header arrive here; they are relayed verbatim like any other
+// header field, and the section is capped at maxHeaderBytes.
+func copyTrailers(dst io.Writer, src *bufio.Reader) (int64, error) {
+	var written int64
+	for {
+		// Trailer fields may be longer than the reader's buffer
+		var line []byte
+		for {
+			frag, err := src.ReadSlice('\n')
+			line = append(line, frag...)
+			if written+int64(len(line)) > maxHeaderBytes {
+				return written, errHeaderTooLarge
+			}
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, bufio.ErrBufferFull) {
+				return written, err
+			}
+		}
+
+		n, err := dst.Write(line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return written, nil
+		}
+	}
+}
+
+// parseChunkSize parses the hex size from a chunk size line, ignoring extensions.
+func parseChunkSize(line []byte) (int64, error) {
+	s := strings.TrimRight(string(line), "\r\n")
+	if idx := strings.IndexByte(s, ';'); idx != -1 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > 16 {
+		return 0, errBadChunk
+	}
+	size, err := strconv.ParseInt(s, 16, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%w: size %q", errBadChunk, s)
+	}
+	return size, nil
+}
+
+// requestHashKey extracts the consistent-hashing key named by a route's
+// HashKey from req: its path, a header value or a cookie value.
+func requestHashKey(req *httpRequest, hashKey string) string {
+	headers := string(req.header)
+	switch {
+	case hashKey == router.HashKeyPath:
+		return req.path
+	case strings.HasPrefix(hashKey, router.HashKeyHeader):
+		return headerValue(headers, strings.TrimPrefix(hashKey, router.HashKeyHeader))
+	case strings.HasPrefix(hashKey, router.HashKeyCookie):
+		return cookieValue(headers, strings.TrimPrefix(hashKey, router.HashKeyCookie))
+	}
+	return ""
+}
+
+// cookieValue returns the value of the named cookie from the Cookie headers.
+func cookieValue(headers, name string) string {
+	for _, value := range headerValues(headers, "Cookie") {
+		for _, pair := range strings.Split(value, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && k == name {
+				return strings.Trim(v, `"`)
+			}
+		}
+	}
+	return ""
+}
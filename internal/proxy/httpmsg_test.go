@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestCheckRequestAmbiguity(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		want    error
+	}{
+		{"plain", "GET / HTTP/1.1\r\nHost: a.example\r\n\r\n", nil},
+		{"chunked", "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding: chunked\r\n\r\n", nil},
+		{"content length", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\n\r\n", nil},
+		{"empty value", "GET / HTTP/1.1\r\nHost: a.example\r\nX-Empty:\r\n\r\n", nil},
+		{"duplicate host", "GET / HTTP/1.1\r\nHost: a.example\r\nHost: b.example\r\n\r\n", errDuplicateHost},
+		{"duplicate host case", "GET / HTTP/1.1\r\nHost: a.example\r\nhOST: b.example\r\n\r\n", errDuplicateHost},
+		{"te and cl", "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n", errAmbiguousFraming},
+		{"cl and te", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n", errAmbiguousFraming},
+		{"space before colon te", "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding : chunked\r\nContent-Length: 5\r\n\r\n", errBadFieldLine},
+		{"tab before colon te", "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding\t: chunked\r\nContent-Length: 5\r\n\r\n", errBadFieldLine},
+		{"space before colon host", "GET / HTTP/1.1\r\nHost: a.example\r\nHost : b.example\r\n\r\n", errBadFieldLine},
+		{"leading space", "GET / HTTP/1.1\r\nHost: a.example\r\n Host: b.example\r\n\r\n", errBadFieldLine},
+		{"folded value", "POST / HTTP/1.1\r\nHost: a.example\r\nX-Long: a\r\n\tTransfer-Encoding: chunked\r\n\r\n", errBadFieldLine},
+		{"no colon", "GET / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding\r\n\r\n", errBadFieldLine},
+		{"empty name", "GET / HTTP/1.1\r\nHost: a.example\r\n: value\r\n\r\n", errBadFieldLine},
+		{"separator in name", "GET / HTTP/1.1\r\nHost: a.example\r\nX(y): value\r\n\r\n", errBadFieldLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRequestAmbiguity(tt.headers); !errors.Is(err, tt.want) {
+				t.Errorf("checkRequestAmbiguity() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckContentLength(t *testing.T) {
+	valid := []string{"0", "5", "1024", "  5  ", "999999999999999999"}
+	for _, v := range valid {
+		headers := "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: " + v + "\r\n\r\n"
+		if err := checkRequestAmbiguity(headers); err != nil {
+			t.Errorf("Content-Length %q rejected: %v", v, err)
+		}
+	}
+
+	malformed := []string{"", "+5", "-5", "005", "00", "5, 5", "5,5", "5 5", "0x10", "5a", "1e3", "1000000000000000000"}
+	for _, v := range malformed {
+		headers := "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: " + v + "\r\n\r\n"
+		if err := checkRequestAmbiguity(headers); !errors.Is(err, errBadContentLength) {
+			t.Errorf("Content-Length %q: got %v, want %v", v, err, errBadContentLength)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		headers string
+		want    error
+	}{
+		{"repeated equal", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\n", errBadContentLength},
+		{"repeated different", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\ncontent-length: 6\r\n\r\n", errBadContentLength},
+		{"space before colon", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length : 5\r\n\r\n", errBadFieldLine},
+		{"leading whitespace", "POST / HTTP/1.1\r\nHost: a.example\r\n Content-Length: 5\r\n\r\n", errBadFieldLine},
+		{"folded onto previous", "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\n 6\r\n\r\n", errBadFieldLine},
+		{"hidden te with cl", "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding : chunked\r\nContent-Length: 5\r\n\r\n", errBadFieldLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRequestAmbiguity(tt.headers); !errors.Is(err, tt.want) {
+				t.Errorf("checkRequestAmbiguity() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// serveRequest writes raw to a fresh connection served by a gateway with no
+// routes loaded and returns the response it gets and whether the gateway
+// closed the connection afterwards.
+func serveRequest(t *testing.T, raw string) (*http.Response, bool) {
+	t.Helper()
+	s := NewServer(&router.Router{}, "")
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.handleHTTP(server)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go io.WriteString(client, raw)
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	_, err = br.ReadByte()
+	return resp, errors.Is(err, io.EOF)
+}
+
+func TestSmugglingRequestsRejected(t *testing.T) {
+	requests := map[string]string{
+		"duplicate host":          "GET / HTTP/1.1\r\nHost: a.example\r\nHost: b.example\r\n\r\n",
+		"te and cl":               "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"space before colon te":   "POST / HTTP/1.1\r\nHost: a.example\r\nTransfer-Encoding : chunked\r\nContent-Length: 5\r\n\r\n0\r\n\r\n",
+		"space before colon host": "GET / HTTP/1.1\r\nHost: a.example\r\nHost : b.example\r\n\r\n",
+		"repeated content length": "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello",
+		"signed content length":   "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: +5\r\n\r\nhello",
+		"list content length":     "POST / HTTP/1.1\r\nHost: a.example\r\nContent-Length: 5, 5\r\n\r\nhello",
+	}
+	for name, raw := range requests {
+		t.Run(name, func(t *testing.T) {
+			resp, closed := serveRequest(t, raw)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+			if !closed {
+				t.Error("connection left open after rejecting the request")
+			}
+		})
+	}
+}
+
+func TestReadHeaderBlockLineLimit(t *testing.T) {
+	const lineLimit = 64
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"short lines", "GET / HTTP/1.1\r\nHost: a.example\r\n\r\n", nil},
+		{"line at limit", "GET / HTTP/1.1\r\nX-A: " + strings.Repeat("a", lineLimit-7) + "\r\n\r\n", nil},
+		{"line over limit", "GET / HTTP/1.1\r\nX-A: " + strings.Repeat("a", lineLimit-6) + "\r\n\r\n", errHeaderLineTooLong},
+		{"long request line", "GET /" + strings.Repeat("a", lineLimit) + " HTTP/1.1\r\n\r\n", errHeaderLineTooLong},
+		// Many lines under the cap still hit the total
+		{"total over limit", "GET / HTTP/1.1\r\n" + strings.Repeat("X-A: "+strings.Repeat("a", 50)+"\r\n", 10) + "\r\n", errHeaderTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A reader buffer smaller than the lines, so they arrive in fragments
+			r := bufio.NewReaderSize(strings.NewReader(tt.raw), 16)
+			header, err := readHeaderBlock(r, 256, lineLimit)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("readHeaderBlock() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && string(header) != tt.raw {
+				t.Errorf("header = %q, want %q", header, tt.raw)
+			}
+		})
+	}
+}
+
+func TestGiantHeaderLineRejected(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nHost: a.example\r\nX-Giant: " + strings.Repeat("g", DefaultMaxHeaderLineBytes) + "\r\n\r\n"
+	if len(raw) > maxHeaderBytes {
+		t.Fatalf("request of %d bytes would hit the total header cap instead", len(raw))
+	}
+	resp, closed := serveRequest(t, raw)
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %d, want 431", resp.StatusCode)
+	}
+	if !closed {
+		t.Error("connection left open after rejecting the request")
+	}
+}
+
+func TestRequestHashKey(t *testing.T) {
+	req := &httpRequest{
+		header: []byte("GET /objects/7?v=2 HTTP/1.1\r\nHost: a.example\r\nX-User: alice\r\nCookie: theme=dark; session=\"s-42\"\r\nCookie: other=1\r\n\r\n"),
+		path:   "/objects/7?v=2",
+	}
+	for hashKey, want := range map[string]string{
+		router.HashKeyPath:               "/objects/7?v=2",
+		router.HashKeyHeader + "x-user":  "alice",
+		router.HashKeyHeader + "X-None":  "",
+		router.HashKeyCookie + "session": "s-42",
+		router.HashKeyCookie + "other":   "1",
+		router.HashKeyCookie + "Session": "",
+	} {
+		if got := requestHashKey(req, hashKey); got != want {
+			t.Errorf("requestHashKey(%q) = %q, want %q", hashKey, got, want)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	for raw, want := range map[string]string{
+		"app.example":          "app.example",
+		"API.Example.com":      "api.example.com",
+		"API.Example.com:8080": "api.example.com",
+		"API.Example.com.":     "api.example.com",
+		"API.Example.com.:443": "api.example.com",
+		" App.Example ":        "app.example",
+		"[2001:DB8::1]:443":    "2001:db8::1",
+		"[2001:DB8::1]":        "2001:db8::1",
+		"":                     "",
+	} {
+		if got := normalizeHost(raw); got != want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+// Mixed-case Host headers reach routes registered in lowercase, and routes
+// registered in mixed case are reached by lowercase hosts, while the path
+// keeps its case on the way to the backend.
+func TestMixedCaseHostRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer backend.Close()
+
+	s := NewServer(router.NewStatic([]router.StaticRoute{
+		{Host: "api.example.com", PathPrefix: "/", Target: backendAddr(backend)},
+		{Host: "Mixed.Example.com", PathPrefix: "/", Target: backendAddr(backend)},
+	}), "")
+	conn, br := gatewayConn(t, s)
+	for _, host := range []string{"API.Example.com", "api.EXAMPLE.com:80", "mixed.example.com", "MIXED.example.COM."} {
+		io.WriteString(conn, "GET /Users/Alice HTTP/1.1\r\nHost: "+host+"\r\n\r\n")
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Host %s: %v", host, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "/Users/Alice" {
+			t.Errorf("Host %s: %d %q, want 200 with the path unchanged", host, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestExtractHostHeader(t *testing.T) {
+	for headers, want := range map[string]string{
+		"GET / HTTP/1.1\r\nHost: EX.com.:443\r\n\r\n":           "ex.com",
+		"GET / HTTP/1.1\r\nhost:ex.com\r\n\r\n":                 "ex.com",
+		"GET / HTTP/1.1\r\nX-A: 1\r\nHOST:  Ex.Com:80 \r\n\r\n": "ex.com",
+		"GET / HTTP/1.1\r\nX-Host: other.com\r\n\r\n":           "",
+	} {
+		if got := normalizeHost(extractHostHeader(headers)); got != want {
+			t.Errorf("host of %q = %q, want %q", headers, got, want)
+		}
+	}
+}
+
+func TestFullyQualifiedHostRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	s := NewServer(router.NewStatic([]router.StaticRoute{{Host: "ex.com", PathPrefix: "/", Target: backendAddr(backend)}}), "")
+	conn, br := gatewayConn(t, s)
+	for _, host := range []string{"EX.com.:443", "ex.com.", "ex.com:8080"} {
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+host+"\r\n\r\n")
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Host %s: %v", host, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Host %s: status %d, want the route for ex.com", host, resp.StatusCode)
+		}
+	}
+}
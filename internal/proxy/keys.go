@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"eddisonso.com/edd-gateway/internal/k8s"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHKeyInfo identifies an SSH key by type and fingerprint.
+type SSHKeyInfo struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"sha256_fingerprint"`
+	Source      string `json:"source"`
+}
+
+// KeyInventory lists the public halves of all key material the gateway is
+// using. It never includes private keys.
+type KeyInventory struct {
+	SSHHostKeys     []SSHKeyInfo      `json:"ssh_host_keys"`
+	SSHClientKey    *SSHKeyInfo       `json:"ssh_client_key"` // nil until loaded from the Secret
+	TLSCertificates []CertificateInfo `json:"tls_certificates"`
+}
+
+// Keys returns the fingerprints of the SSH host key presented to clients,
+// the SSH client key used to log in to containers, and the loaded TLS
+// certificates. Certificates obtained through ACME are not listed.
+func (s *Server) Keys() KeyInventory {
+	inv := KeyInventory{
+		SSHHostKeys:     []SSHKeyInfo{},
+		TLSCertificates: s.Certificates(),
+	}
+	if signer := getHostKey(); signer != nil {
+		inv.SSHHostKeys = append(inv.SSHHostKeys, describeSSHKey(signer.PublicKey(), "generated at startup"))
+	}
+	if signer := k8s.GetClientKey(); signer != nil {
+		info := describeSSHKey(signer.PublicKey(), "secret "+k8s.SecretNamespace+"/"+k8s.SecretName)
+		inv.SSHClientKey = &info
+	}
+	return inv
+}
+
+func describeSSHKey(key ssh.PublicKey, source string) SSHKeyInfo {
+	return SSHKeyInfo{Type: key.Type(), Fingerprint: ssh.FingerprintSHA256(key), Source: source}
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Multi-protocol listener modes.
+const (
+	MultiPortsAll     = "all"     // bind every port in the range at startup
+	MultiPortsIngress = "ingress" // bind only the ports containers have ingress rules for
+)
+
+// DefaultMultiPortRange is the range of multi-protocol listener ports.
+const DefaultMultiPortRange = "8000-8999"
+
+// listenerDrainGrace is how long a dropped listener keeps accepting
+// connections the kernel already queued for it. Without it, clients whose
+// handshake completed just before the drop would be reset.
+const listenerDrainGrace = 2 * time.Second
+
+// deadliner is a listener whose Accept can be bounded by a deadline.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// ParseMultiPortRange parses a multi-protocol port range such as
+// "8000-8999" or a single port.
+func ParseMultiPortRange(s string) (lo, hi int, err error) {
+	lo, hi, err = parsePortRange(strings.TrimSpace(s))
+	if err != nil {
+		return 0, 0, fmt.Errorf("multi-protocol ports: %w", err)
+	}
+	return lo, hi, nil
+}
+
+// ValidateMultiPortMode checks a multi-protocol listener mode.
+func ValidateMultiPortMode(mode string) error {
+	switch mode {
+	case MultiPortsAll, MultiPortsIngress:
+		return nil
+	}
+	return fmt.Errorf("invalid multi-protocol port mode %q: want %s or %s", mode, MultiPortsAll, MultiPortsIngress)
+}
+
+// bindMulti opens the multi-protocol listener for port and registers it so
+// DropListener and Shutdown can close it.
+func (s *Server) bindMulti(port int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", formatAddr(port))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		ln.Close()
+		return nil, net.ErrClosed
+	}
+	if _, ok := s.multiPorts[port]; ok {
+		ln.Close()
+		return nil, fmt.Errorf("port %d already has a multi-protocol listener", port)
+	}
+	s.multiPorts[port] = ln
+	s.listeners = append(s.listeners, ln)
+	return ln, nil
+}
+
+// EnsureListener starts a multi-protocol listener on port unless one is
+// already running. The port is bound before it returns; connections are
+// accepted in the background.
+func (s *Server) EnsureListener(port int) error {
+	s.mu.Lock()
+	_, ok := s.multiPorts[port]
+	if !ok {
+		// A port that comes back while its old listener is still draining
+		// takes that listener back instead of racing it for the address
+		if ln, draining := s.drainingPorts[port]; draining {
+			delete(s.drainingPorts, port)
+			s.multiPorts[port] = ln
+			ln.(deadliner).SetDeadline(time.Time{})
+			ok = true
+			slog.Info("resumed listening", "port", port)
+		}
+	}
+	s.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	ln, err := s.bindMulti(port)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.serve(ln, port, ProtocolMulti, s.handleMulti); err != nil {
+			slog.Error("multi listener failed", "port", port, "error", err)
+		}
+	}()
+	return nil
+}
+
+// DropListener stops accepting connections on port's multi-protocol
+// listener. Connections already accepted, including ones still in protocol
+// detection or a TLS handshake, run to completion, and connections queued
+// by the kernel are accepted for a short grace period before the listener
+// closes. It reports whether a listener was running.
+func (s *Server) DropListener(port int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ln, ok := s.multiPorts[port]
+	if !ok {
+		return false
+	}
+	delete(s.multiPorts, port)
+
+	if d, ok := ln.(deadliner); ok {
+		s.drainingPorts[port] = ln
+		d.SetDeadline(time.Now().Add(listenerDrainGrace))
+		slog.Info("draining listener", "port", port, "grace", listenerDrainGrace)
+		return true
+	}
+	s.closeListenerLocked(port, ln)
+	return true
+}
+
+// finishDrain closes ln once its drain grace period has run out. It reports
+// false when ln is not draining, e.g. because EnsureListener took it back.
+func (s *Server) finishDrain(port int, ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drainingPorts[port] != ln {
+		return false
+	}
+	delete(s.drainingPorts, port)
+	s.closeListenerLocked(port, ln)
+	return true
+}
+
+// closeListenerLocked closes a multi-protocol listener and forgets it. The
+// caller holds mu, so the address is free before another bind can run.
+func (s *Server) closeListenerLocked(port int, ln net.Listener) {
+	if i := slices.Index(s.listeners, ln); i >= 0 {
+		s.listeners = slices.Delete(s.listeners, i, i+1)
+	}
+	ln.Close()
+	slog.Info("stopped listening", "port", port)
+}
+
+// SyncListeners runs multi-protocol listeners on exactly the given ports,
+// starting missing ones and dropping the rest. A port that fails to bind
+// is logged and retried on the next call.
+func (s *Server) SyncListeners(ports []int) {
+	want := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		want[port] = true
+		if err := s.EnsureListener(port); err != nil {
+			slog.Error("multi listener failed", "port", port, "error", err)
+		}
+	}
+
+	s.mu.Lock()
+	var stale []int
+	for port := range s.multiPorts {
+		if !want[port] {
+			stale = append(stale, port)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, port := range stale {
+		s.DropListener(port)
+	}
+}
+
+// StartIngressListeners keeps multi-protocol listeners open on exactly the
+// ingress ports within lo-hi that some cached container uses, until the
+// server shuts down. Listeners are reconciled whenever a router sync changes
+// the containers, and every interval to retry ports that failed to bind. A
+// listener opens once a port gains its first container and closes when the
+// last one goes away.
+func (s *Server) StartIngressListeners(lo, hi int, interval time.Duration) {
+	slog.Info("ingress listener sync enabled", "ports", fmt.Sprintf("%d-%d", lo, hi), "interval", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var ports []int
+			for _, port := range s.router.GetAllIngressPorts() {
+				if port >= lo && port <= hi {
+					ports = append(ports, port)
+				}
+			}
+			s.SyncListeners(ports)
+			select {
+			case <-s.done:
+				return
+			case <-s.router.ContainersChanged():
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// MultiPorts returns the ports with a running multi-protocol listener, in
+// ascending order.
+func (s *Server) MultiPorts() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ports := make([]int, 0, len(s.multiPorts))
+	for port := range s.multiPorts {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
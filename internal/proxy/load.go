@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// acceptRateInterval is how often the accept rate gauge is recomputed.
+const acceptRateInterval = 10 * time.Second
+
+// SetMaxConnections caps the number of connections handled concurrently
+// across all listeners. Connections beyond the cap are closed on accept.
+// Zero means unlimited.
+func (s *Server) SetMaxConnections(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.mu.Lock()
+	s.maxConns = n
+	s.mu.Unlock()
+}
+
+// SetMaxConnectionsPerIP caps the connections handled concurrently from a
+// single client address, so one source cannot take the whole
+// -max-connections budget. Connections beyond the cap are closed as soon as
+// the client address is known. Zero means unlimited.
+func (s *Server) SetMaxConnectionsPerIP(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.mu.Lock()
+	s.maxConnsPerIP = n
+	s.mu.Unlock()
+}
+
+// ConnectionStats is a snapshot of connection counts and limits.
+type ConnectionStats struct {
+	Active   int `json:"active"`
+	Peak     int `json:"peak"`           // highest Active since start
+	Max      int `json:"max"`            // 0 for unlimited
+	MaxPerIP int `json:"max_per_ip"`     // 0 for unlimited
+	Sources  int `json:"sources"`        // distinct client addresses with a connection
+	Busiest  int `json:"busiest_source"` // connections from the busiest client address
+}
+
+// ConnectionStats returns current and peak connection counts.
+func (s *Server) ConnectionStats() ConnectionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := ConnectionStats{
+		Active:   len(s.active),
+		Peak:     s.peakConns,
+		Max:      s.maxConns,
+		MaxPerIP: s.maxConnsPerIP,
+		Sources:  len(s.connsByIP),
+	}
+	for _, n := range s.connsByIP {
+		stats.Busiest = max(stats.Busiest, n)
+	}
+	return stats
+}
+
+// acquireSource counts a connection against its client address's cap,
+// reporting false if the cap is reached. Connections without an IP address
+// are not limited.
+func (s *Server) acquireSource(conn net.Conn) (netip.Addr, bool) {
+	ip, ok := peerIP(conn.RemoteAddr())
+	if !ok {
+		return netip.Addr{}, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxConnsPerIP > 0 && s.connsByIP[ip] >= s.maxConnsPerIP {
+		return ip, false
+	}
+	s.connsByIP[ip]++
+	return ip, true
+}
+
+// releaseSource undoes acquireSource.
+func (s *Server) releaseSource(ip netip.Addr) {
+	if !ip.IsValid() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connsByIP[ip] <= 1 {
+		delete(s.connsByIP, ip)
+		return
+	}
+	s.connsByIP[ip]--
+}
+
+// peerIP extracts the unmapped IP address of a TCP peer.
+func peerIP(addr net.Addr) (netip.Addr, bool) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	return ip.Unmap(), ok
+}
+
+// ActiveConnections returns the number of connections currently being handled.
+func (s *Server) ActiveConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.active)
+}
+
+// Saturation returns active connections as a fraction of the configured
+// maximum, or 0 when connections are unlimited.
+func (s *Server) Saturation() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxConns == 0 {
+		return 0
+	}
+	return float64(len(s.active)) / float64(s.maxConns)
+}
+
+// atCapacity reports whether a new connection would exceed the maximum.
+func (s *Server) atCapacity() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxConns > 0 && len(s.active) >= s.maxConns
+}
+
+// setConnProtocol records the protocol detected on a multi-protocol port.
+func (s *Server) setConnProtocol(conn net.Conn, protocol string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.active[conn]; ok && st.protocol != protocol {
+		metrics.ActiveConnections.WithLabelValues(st.protocol).Dec()
+		metrics.ActiveConnections.WithLabelValues(protocol).Inc()
+		st.protocol = protocol
+	}
+}
+
+// sampleAcceptRate recomputes the per-protocol accept rate gauge from the
+// connection counters until done is closed.
+func sampleAcceptRate(done <-chan struct{}) {
+	ticker := time.NewTicker(acceptRateInterval)
+	defer ticker.Stop()
+
+	last := metrics.ConnectionsTotal.Snapshot()
+	lastAt := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			current := metrics.ConnectionsTotal.Snapshot()
+			elapsed := now.Sub(lastAt).Seconds()
+			for protocol, total := range current {
+				metrics.AcceptRate.WithLabelValues(protocol).Set(float64(total-last[protocol]) / elapsed)
+			}
+			last, lastAt = current, now
+		}
+	}
+}
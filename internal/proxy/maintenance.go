@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceAllHosts puts every host in maintenance at once.
+const MaintenanceAllHosts = "*"
+
+// defaultMaintenancePage is served to hosts in maintenance unless
+// SetMaintenancePage replaced it.
+const defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Down for maintenance</title></head>
+<body>
+<h1>Down for maintenance</h1>
+<p>This site is being updated and will be back shortly.</p>
+</body>
+</html>
+`
+
+// MaintenanceStatus describes a host in maintenance.
+type MaintenanceStatus struct {
+	Host  string    `json:"host"` // MaintenanceAllHosts for every host
+	Since time.Time `json:"since"`
+}
+
+// maintenanceHosts tracks which hosts answer with the maintenance page.
+type maintenanceHosts struct {
+	mu    sync.RWMutex
+	hosts map[string]time.Time // by normalized host, since when
+	page  string
+}
+
+func newMaintenanceHosts() *maintenanceHosts {
+	return &maintenanceHosts{hosts: make(map[string]time.Time), page: defaultMaintenancePage}
+}
+
+// SetMaintenancePage sets the HTML body of maintenance responses.
+func (s *Server) SetMaintenancePage(html string) {
+	s.maintenance.mu.Lock()
+	s.maintenance.page = html
+	s.maintenance.mu.Unlock()
+}
+
+// SetMaintenance puts host, or every host with MaintenanceAllHosts, in or
+// out of maintenance. It applies to the next request on any connection;
+// requests already forwarded, including upgraded connections, carry on.
+// It reports whether the state changed.
+func (s *Server) SetMaintenance(host string, enabled bool) bool {
+	if host != MaintenanceAllHosts {
+		host = normalizeHost(host)
+	}
+	m := s.maintenance
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, was := m.hosts[host]
+	if enabled == was {
+		return false
+	}
+	if enabled {
+		m.hosts[host] = time.Now()
+		slog.Warn("maintenance mode enabled", "host", host)
+	} else {
+		delete(m.hosts, host)
+		slog.Info("maintenance mode disabled", "host", host)
+	}
+	return true
+}
+
+// Maintenance lists the hosts in maintenance, ordered by host.
+func (s *Server) Maintenance() []MaintenanceStatus {
+	m := s.maintenance
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]MaintenanceStatus, 0, len(m.hosts))
+	for host, since := range m.hosts {
+		list = append(list, MaintenanceStatus{Host: host, Since: since})
+	}
+	slices.SortFunc(list, func(a, b MaintenanceStatus) int { return strings.Compare(a.Host, b.Host) })
+	return list
+}
+
+// serveMaintenance answers req with the maintenance page when its host is
+// in maintenance, without dialing the backend. Reports whether it responded.
+func (s *Server) serveMaintenance(conn net.Conn, req *httpRequest) bool {
+	m := s.maintenance
+	m.mu.RLock()
+	_, all := m.hosts[MaintenanceAllHosts]
+	_, host := m.hosts[req.host]
+	page := m.page
+	m.mu.RUnlock()
+	if !all && !host {
+		return false
+	}
+
+	req.logger().Debug("host in maintenance", "host", req.host, "path", req.path)
+	s.writeResponse(conn, req, gatewayResponse{
+		status:      http.StatusServiceUnavailable,
+		headers:     s.retryAfterHeader(RetryMaintenance),
+		body:        page,
+		contentType: "text/html; charset=utf-8",
+	})
+	return true
+}
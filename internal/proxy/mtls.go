@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+)
+
+// ClientCertSubjectHeader carries the subject of the verified client
+// certificate to backends of mTLS routes.
+const ClientCertSubjectHeader = "X-Client-Cert-Subject"
+
+// terminationConfig returns the TLS config for terminating a connection to
+// sni. Hosts with a route requiring client certificates get a copy of the
+// termination config that demands one signed by the route's CA bundle;
+// every other host keeps the shared config.
+func (s *Server) terminationConfig(sni string) (*tls.Config, error) {
+	caFile := s.router.ClientCAFile(sni)
+	if caFile == "" {
+		return s.tlsConfig, nil
+	}
+	pool, err := s.caPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.caPoolsMu.Lock()
+	defer s.caPoolsMu.Unlock()
+	if cfg, ok := s.mtlsConfigs[caFile]; ok {
+		return cfg, nil
+	}
+	cfg := s.tlsConfig.Clone()
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = pool
+	if s.mtlsConfigs == nil {
+		s.mtlsConfigs = make(map[string]*tls.Config)
+	}
+	s.mtlsConfigs[caFile] = cfg
+	return cfg, nil
+}
+
+// LoadClientCAs reads the client CA bundles of the current static routes so
+// a missing or malformed bundle is reported at startup rather than on the
+// first handshake. Bundles that fail to load are logged; handshakes to their
+// hosts are refused until the file is fixed.
+func (s *Server) LoadClientCAs() {
+	for _, route := range s.router.ListRoutes() {
+		if route.ClientCAFile == "" {
+			continue
+		}
+		if _, err := s.caPool(route.ClientCAFile); err != nil {
+			slog.Error("failed to load client CA bundle", "host", route.Host, "path", route.PathPrefix, "error", err)
+		}
+	}
+}
+
+// setClientCertHeader replaces any client-supplied client certificate
+// subject header with the subject of the certificate verified on conn, so
+// backends can trust it. Connections without one forward no header.
+func setClientCertHeader(conn net.Conn, headers []byte) []byte {
+	headers = removeHeader(headers, ClientCertSubjectHeader)
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return headers
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return headers
+	}
+	return addHeader(headers, ClientCertSubjectHeader, state.VerifiedChains[0][0].Subject.String())
+}
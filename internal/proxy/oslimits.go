@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// DefaultExpectedConnections is the connection volume assumed by the
+	// startup limit check when -max-connections is unlimited.
+	DefaultExpectedConnections = 1024
+
+	// fdReserve covers descriptors outside the proxy path: stdio, the
+	// PostgreSQL pool, the metrics and admin listeners, and log shipping.
+	fdReserve = 64
+)
+
+// LimitCheck is the outcome of comparing the gateway's expected resource
+// needs against the process and kernel limits.
+type LimitCheck struct {
+	RequiredFDs    uint64 // one per listener plus a client and a backend descriptor per connection
+	FDLimit        uint64 // soft RLIMIT_NOFILE
+	FDHardLimit    uint64 // hard RLIMIT_NOFILE
+	EphemeralPorts int    // size of net.ipv4.ip_local_port_range; 0 if unknown
+	Connections    int    // expected concurrent connections
+}
+
+// CheckOSLimits estimates the descriptors needed for the given number of
+// listening sockets and concurrent proxied connections, and compares them
+// with RLIMIT_NOFILE and the ephemeral port range used for backend dials.
+// The returned error explains every shortfall and how to raise the limit.
+// The Go runtime already raises the soft limit to the hard limit at startup,
+// so only the hard limit can be raised further.
+func CheckOSLimits(listeners, connections int) (LimitCheck, error) {
+	if connections <= 0 {
+		connections = DefaultExpectedConnections
+	}
+	check := LimitCheck{
+		RequiredFDs: uint64(listeners) + 2*uint64(connections) + fdReserve,
+		Connections: connections,
+	}
+
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return check, fmt.Errorf("read RLIMIT_NOFILE: %w", err)
+	}
+	check.FDLimit = rlim.Cur
+	check.FDHardLimit = rlim.Max
+	check.EphemeralPorts = ephemeralPortCount()
+
+	var problems []string
+	if check.FDLimit < check.RequiredFDs {
+		problems = append(problems, fmt.Sprintf(
+			"open file limit %d is below the %d descriptors needed for %d listeners and %d connections; "+
+				"raise it with `ulimit -n %d`, LimitNOFILE= in the systemd unit, or the container runtime's nofile ulimit",
+			check.FDLimit, check.RequiredFDs, listeners, connections, check.RequiredFDs))
+	}
+	if check.EphemeralPorts > 0 && check.EphemeralPorts < connections {
+		problems = append(problems, fmt.Sprintf(
+			"ephemeral port range has %d ports, fewer than %d expected backend connections; "+
+				"widen net.ipv4.ip_local_port_range",
+			check.EphemeralPorts, connections))
+	}
+	if len(problems) > 0 {
+		return check, fmt.Errorf("insufficient OS limits: %s", strings.Join(problems, "; "))
+	}
+	return check, nil
+}
+
+// ephemeralPortCount returns the size of the local port range used for
+// outgoing connections, or 0 if it cannot be read.
+func ephemeralPortCount() int {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0
+	}
+	lo, err1 := strconv.Atoi(fields[0])
+	hi, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || hi < lo {
+		return 0
+	}
+	return hi - lo + 1
+}
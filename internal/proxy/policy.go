@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// errRequestTimeout marks failures caused by a route's request timeout
+// running out rather than by the backend. They are answered with 504 and
+// kept out of passive ejection, since a short budget says nothing about the
+// backend's health.
+var errRequestTimeout = errors.New("request timeout exceeded")
+
+// RoutePolicy coordinates the timeouts and retries of one HTTP request so
+// they cannot work against each other: the request timeout bounds every
+// dial attempt, retry and the wait for the response header together, and
+// an attempt cut short by it does not count as a backend failure.
+type RoutePolicy struct {
+	RequestTimeout time.Duration // total budget up to the response header; 0 is unbounded
+	DialTimeout    time.Duration // per dial attempt, shortened to the remaining budget
+	DialRetries    int           // extra dial attempts after a failed one
+
+	deadline time.Time // zero when RequestTimeout is unbounded
+}
+
+// routePolicy returns the policy for a request to route, which may be nil,
+// starting its request timeout at now.
+func (s *Server) routePolicy(route *router.StaticRoute, now time.Time) *RoutePolicy {
+	p := &RoutePolicy{DialTimeout: s.routeDialTimeout(route)}
+	if route != nil {
+		p.RequestTimeout = route.RequestTimeout
+		p.DialRetries = route.DialRetries
+	}
+	if p.RequestTimeout > 0 {
+		p.deadline = now.Add(p.RequestTimeout)
+	}
+	return p
+}
+
+// dialTimeout returns the timeout for a dial attempt starting at now and
+// whether it was shortened to fit the remaining budget. It fails with
+// errRequestTimeout once the budget is spent.
+func (p *RoutePolicy) dialTimeout(now time.Time) (time.Duration, bool, error) {
+	if p.deadline.IsZero() {
+		return p.DialTimeout, false, nil
+	}
+	remaining := p.deadline.Sub(now)
+	if remaining <= 0 {
+		return 0, false, errRequestTimeout
+	}
+	if p.DialTimeout > 0 && p.DialTimeout <= remaining {
+		return p.DialTimeout, false, nil
+	}
+	return remaining, true, nil
+}
+
+// budgetError attributes err to the request timeout when the attempt that
+// produced it was bounded by the remaining budget and timed out.
+func budgetError(err error, capped bool) error {
+	var netErr net.Error
+	if capped && errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", errRequestTimeout, err)
+	}
+	return err
+}
+
+// dial connects to target, retrying failed attempts while the policy
+// allows and budget remains.
+func (s *Server) dialWithPolicy(target *httpTarget, p *RoutePolicy) (*backendConn, error) {
+	for attempt := 0; ; attempt++ {
+		timeout, capped, err := p.dialTimeout(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		backend, err := s.dialHTTPBackend(target, timeout, capped)
+		if err == nil || attempt >= p.DialRetries || errors.Is(err, errRequestTimeout) {
+			return backend, err
+		}
+		slog.Debug("retrying backend dial", "addr", target.addr, "attempt", attempt+1, "retries", p.DialRetries, "error", err)
+	}
+}
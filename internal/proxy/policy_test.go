@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestRoutePolicyDialTimeout(t *testing.T) {
+	start := time.Now()
+	s := NewServer(&router.Router{}, "")
+	p := s.routePolicy(&router.StaticRoute{RequestTimeout: time.Second, DialTimeout: 300 * time.Millisecond, DialRetries: 3}, start)
+
+	tests := []struct {
+		at         time.Duration // since the request started
+		want       time.Duration
+		wantCapped bool
+		wantErr    error
+	}{
+		{0, 300 * time.Millisecond, false, nil},
+		{600 * time.Millisecond, 300 * time.Millisecond, false, nil},
+		// A retry late in the budget only gets what is left of it
+		{800 * time.Millisecond, 200 * time.Millisecond, true, nil},
+		{time.Second, 0, false, errRequestTimeout},
+		{2 * time.Second, 0, false, errRequestTimeout},
+	}
+	for _, tt := range tests {
+		got, capped, err := p.dialTimeout(start.Add(tt.at))
+		if got != tt.want || capped != tt.wantCapped || !errors.Is(err, tt.wantErr) {
+			t.Errorf("dialTimeout(+%v) = %v, %v, %v; want %v, %v, %v", tt.at, got, capped, err, tt.want, tt.wantCapped, tt.wantErr)
+		}
+	}
+
+	unbounded := s.routePolicy(&router.StaticRoute{DialTimeout: 300 * time.Millisecond}, start)
+	if got, capped, err := unbounded.dialTimeout(start.Add(time.Hour)); got != 300*time.Millisecond || capped || err != nil {
+		t.Errorf("dialTimeout() without a request timeout = %v, %v, %v", got, capped, err)
+	}
+}
+
+// timeoutError is a dial error that timed out.
+var timeoutError = &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+func TestBudgetError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		err    error
+		capped bool
+		want   bool // attributed to the request timeout
+	}{
+		{timeoutError, true, true},
+		{timeoutError, false, false},
+		{refused, true, false},
+		{nil, true, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(budgetError(tt.err, tt.capped), errRequestTimeout); got != tt.want {
+			t.Errorf("budgetError(%v, %v) is a request timeout: %v, want %v", tt.err, tt.capped, got, tt.want)
+		}
+	}
+}
+
+// Only failures of the backend count toward ejecting it, not dials cut
+// short by a request's own budget.
+func TestBudgetTimeoutNotCountedAsFailure(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	s.SetPassiveEjection(1, time.Minute)
+
+	s.observeDial(ProtocolHTTP, "10.0.0.1:80", nil, time.Now(), budgetError(timeoutError, true))
+	if health := s.BackendHealth(); len(health) != 0 {
+		t.Errorf("budget timeout counted against the backend: %+v", health)
+	}
+	s.observeDial(ProtocolHTTP, "10.0.0.1:80", nil, time.Now(), budgetError(timeoutError, false))
+	if health := s.BackendHealth(); len(health) != 1 || !health[0].Ejected {
+		t.Errorf("dial timeout within the budget not counted: %+v", health)
+	}
+}
+
+// closedAddr returns a loopback address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestDialRetries(t *testing.T) {
+	addr := closedAddr(t)
+	s := NewServer(router.NewStatic([]router.StaticRoute{{Host: "app.example", PathPrefix: "/", Target: addr, DialRetries: 2, RequestTimeout: 5 * time.Second}}), "")
+	s.SetPassiveEjection(100, time.Minute)
+
+	conn, br := gatewayConn(t, s)
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: app.example\r\n\r\n")
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	health := s.BackendHealth()
+	if len(health) != 1 || health[0].ConsecutiveFailures != 3 {
+		t.Errorf("backend health = %+v, want 3 failed dials", health)
+	}
+}
+
+// A backend that accepts and never answers runs the request out of budget:
+// the client gets a 504 once the request timeout is spent, not whenever
+// some other timeout fires.
+func TestRequestTimeoutWaitingForResponse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	const timeout = 200 * time.Millisecond
+	s := NewServer(router.NewStatic([]router.StaticRoute{{Host: "app.example", PathPrefix: "/", Target: ln.Addr().String(), DialRetries: 2, RequestTimeout: timeout}}), "")
+	s.SetPassiveEjection(1, time.Minute)
+
+	conn, br := gatewayConn(t, s)
+	start := time.Now()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: app.example\r\n\r\n")
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", resp.StatusCode)
+	}
+	if elapsed < timeout || elapsed > timeout+2*time.Second {
+		t.Errorf("answered after %v, want soon after the %v request timeout", elapsed, timeout)
+	}
+	if health := s.BackendHealth(); len(health) != 0 {
+		t.Errorf("request timeout counted against the backend: %+v", health)
+	}
+}
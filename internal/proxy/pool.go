@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBackendPoolSize is the default number of idle connections kept per backend target.
+	DefaultBackendPoolSize = 8
+	// DefaultBackendIdleTimeout is how long an idle pooled backend connection is kept.
+	DefaultBackendIdleTimeout = 90 * time.Second
+)
+
+// backendPool keeps idle keep-alive connections to HTTP backends, keyed by
+// target, so requests to the same target skip the TCP (and TLS) handshake.
+type backendPool struct {
+	mu          sync.Mutex
+	maxIdle     int // per target; 0 disables pooling
+	idleTimeout time.Duration
+	idle        map[string][]*backendConn // most recently used last
+}
+
+func newBackendPool(maxIdle int, idleTimeout time.Duration) *backendPool {
+	return &backendPool{
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		idle:        make(map[string][]*backendConn),
+	}
+}
+
+// get returns an idle connection for key, or nil if none is available.
+func (p *backendPool) get(key string) *backendConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		c := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if time.Since(c.idleSince) < p.idleTimeout {
+			p.setIdle(key, conns)
+			return c
+		}
+		c.Close()
+	}
+	p.setIdle(key, conns)
+	return nil
+}
+
+// put returns a connection after a clean request/response cycle. It is
+// closed instead if the pool for its target is full.
+func (p *backendPool) put(c *backendConn) {
+	// Unexpected bytes mean the exchange was not clean
+	if c.reader.Buffered() > 0 {
+		c.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.idle[c.key]
+	if len(conns) >= p.maxIdle {
+		c.Close()
+		return
+	}
+	c.idleSince = time.Now()
+	c.idle.setTimeout(0)
+	p.idle[c.key] = append(conns, c)
+}
+
+// setSize changes the per-target idle cap, closing connections over it.
+func (p *backendPool) setSize(maxIdle int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxIdle = maxIdle
+	for key, conns := range p.idle {
+		for len(conns) > maxIdle {
+			conns[0].Close()
+			conns = conns[1:]
+		}
+		p.setIdle(key, conns)
+	}
+}
+
+// setIdleTimeout changes how long idle connections are kept.
+func (p *backendPool) setIdleTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.idleTimeout = d
+	p.mu.Unlock()
+}
+
+// evictLoop periodically closes connections idle beyond the timeout until done is closed.
+func (p *backendPool) evictLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			p.closeAll()
+			return
+		case <-ticker.C:
+			p.evictExpired()
+		}
+	}
+}
+
+// evictExpired closes connections idle beyond the timeout.
+func (p *backendPool) evictExpired() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		kept := conns[:0]
+		for _, c := range conns {
+			if time.Since(c.idleSince) >= p.idleTimeout {
+				c.Close()
+				continue
+			}
+			kept = append(kept, c)
+		}
+		p.setIdle(key, kept)
+	}
+}
+
+// closeAll closes every idle connection.
+func (p *backendPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(p.idle, key)
+	}
+}
+
+// setIdle stores conns for key, dropping the entry when empty. Caller holds mu.
+func (p *backendPool) setIdle(key string, conns []*backendConn) {
+	if len(conns) == 0 {
+		delete(p.idle, key)
+		return
+	}
+	p.idle[key] = conns
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxProxyV1Header is the longest valid PROXY protocol v1 line.
+const maxProxyV1Header = 107
+
+// errNoProxyHeader is returned when a connection on a PROXY protocol port
+// does not start with a PROXY header.
+var errNoProxyHeader = errors.New("missing PROXY protocol header")
+
+// proxyConn is an accepted connection whose PROXY protocol header has been
+// read. RemoteAddr reports the client address the header carried.
+type proxyConn struct {
+	net.Conn
+	r   *bufio.Reader // holds any bytes read past the header
+	src net.Addr      // nil for LOCAL and UNKNOWN headers
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the decoded client address, or the peer's own address
+// when the header did not carry one.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// SetPortProxyProtocol makes connections accepted on port start with a
+// PROXY protocol v1 or v2 header, as sent by L4 load balancers.
+func (s *Server) SetPortProxyProtocol(port int, enabled bool) {
+	if !enabled {
+		delete(s.portProxyProtocol, port)
+		return
+	}
+	s.portProxyProtocol[port] = true
+}
+
+// ParseProxyProtocolTrusted parses a comma-separated list of CIDRs or
+// addresses of the load balancers allowed to send PROXY headers.
+func ParseProxyProtocolTrusted(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, src := range strings.Split(s, ",") {
+		if src = strings.TrimSpace(src); src == "" {
+			continue
+		}
+		prefix, err := parseSourcePrefix(src)
+		if err != nil {
+			return nil, fmt.Errorf("PROXY protocol trusted sources: %w", err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// SetProxyProtocolTrusted sets the peers allowed to send a PROXY header on
+// PROXY protocol ports. A header lets its sender claim any client address,
+// so connections from other peers are closed before their header is read.
+// With no peers set, every connection on a PROXY protocol port is refused.
+func (s *Server) SetProxyProtocolTrusted(prefixes []netip.Prefix) {
+	s.proxyProtocolTrusted = prefixes
+}
+
+// rejectUntrustedProxyPeer closes conn, accepted on a PROXY protocol port,
+// unless its socket peer may send a PROXY header.
+func (s *Server) rejectUntrustedProxyPeer(port int, conn net.Conn) bool {
+	if prefixesContain(s.proxyProtocolTrusted, conn.RemoteAddr()) {
+		return false
+	}
+	slog.Warn("rejecting connection from peer not trusted to send PROXY headers", "port", port, "peer", conn.RemoteAddr().String())
+	conn.Close()
+	return true
+}
+
+// ParseProxyProtocolPorts parses a comma-separated list of ports and port
+// ranges: "80,443,8000-8099".
+func ParseProxyProtocolPorts(s string) ([]int, error) {
+	var ports []int
+	if strings.TrimSpace(s) == "" {
+		return ports, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		lo, hi, err := parsePortRange(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		for port := lo; port <= hi; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// acceptProxyHeader reads the PROXY header from a connection accepted on a
+// PROXY protocol port, within the port's first-read timeout.
+func (s *Server) acceptProxyHeader(conn net.Conn, protocol string) (*proxyConn, error) {
+	s.setFirstReadDeadline(conn, protocol)
+	pc, err := readProxyHeader(conn)
+	conn.SetReadDeadline(time.Time{})
+	return pc, err
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header from conn.
+func readProxyHeader(conn net.Conn) (*proxyConn, error) {
+	r := bufio.NewReader(conn)
+	pc := &proxyConn{Conn: conn, r: r}
+
+	// Every valid header is at least as long as the v2 signature
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("read PROXY header: %w", err)
+	}
+	if bytes.Equal(start, proxyV2Signature) {
+		pc.src, err = readProxyV2(r)
+		return pc, err
+	}
+	if !bytes.HasPrefix(start, []byte("PROXY ")) {
+		return nil, errNoProxyHeader
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read PROXY v1 header: %w", err)
+	}
+	if len(line) > maxProxyV1Header || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+	pc.src, err = parseProxyV1(string(line[:len(line)-2]))
+	return pc, err
+}
+
+// parseProxyV1 decodes the source address of a v1 header line without its
+// CRLF: "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443".
+func parseProxyV1(line string) (net.Addr, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("PROXY v1 source address: %w", err)
+	}
+	if _, err := netip.ParseAddr(fields[3]); err != nil {
+		return nil, fmt.Errorf("PROXY v1 destination address: %w", err)
+	}
+	if src.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("PROXY v1 source %s does not match %s", src, fields[1])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("PROXY v1 source port: %w", err)
+	}
+	if _, err := strconv.ParseUint(fields[5], 10, 16); err != nil {
+		return nil, fmt.Errorf("PROXY v1 destination port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, uint16(port))), nil
+}
+
+// readProxyV2 consumes a v2 header and decodes its source address. LOCAL
+// headers and address families other than TCP carry no usable source.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, fmt.Errorf("read PROXY v2 header: %w", err)
+	}
+	verCmd, family := fixed[12], fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:]))
+	if verCmd>>4 != 2 || verCmd&0x0f > 1 {
+		return nil, fmt.Errorf("unsupported PROXY v2 version/command 0x%02x", verCmd)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("read PROXY v2 addresses: %w", err)
+	}
+	if verCmd&0x0f == 0 { // LOCAL
+		return nil, nil
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = 4
+	case 0x21: // TCP over IPv6
+		ipLen = 16
+	default:
+		return nil, nil
+	}
+	if length < 2*ipLen+4 {
+		return nil, fmt.Errorf("PROXY v2 address block too short: %d bytes", length)
+	}
+	src, _ := netip.AddrFromSlice(body[:ipLen])
+	port := binary.BigEndian.Uint16(body[2*ipLen:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src.Unmap(), port)), nil
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// serveProxied runs s on a loopback listener marked as a PROXY protocol
+// port and returns its address and a channel receiving the client address
+// of every connection that reaches the handler.
+func serveProxied(t *testing.T, s *Server) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	port := ln.Addr().(*net.TCPAddr).Port
+	s.SetPortProxyProtocol(port, true)
+
+	seen := make(chan string, 1)
+	go s.serve(ln, port, ProtocolHTTP, func(conn net.Conn) {
+		seen <- conn.RemoteAddr().String()
+		conn.Close()
+	})
+	return ln.Addr().String(), seen
+}
+
+func TestProxyHeaderFromTrustedPeer(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	s.SetProxyProtocolTrusted([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	addr, seen := serveProxied(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 80\r\n")
+
+	select {
+	case client := <-seen:
+		if client != "203.0.113.7:51234" {
+			t.Errorf("client address = %s, want the one from the PROXY header", client)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection from trusted peer never reached the handler")
+	}
+}
+
+func TestProxyHeaderFromUntrustedPeer(t *testing.T) {
+	for name, trusted := range map[string][]netip.Prefix{
+		"other peer": {netip.MustParsePrefix("10.0.0.0/8")},
+		"none set":   nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewServer(&router.Router{}, "")
+			s.SetProxyProtocolTrusted(trusted)
+			addr, seen := serveProxied(t, s)
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			io.WriteString(conn, "PROXY TCP4 10.1.2.3 10.0.0.1 51234 80\r\n")
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err != io.EOF && !isConnReset(err) {
+				t.Errorf("read from rejected connection = %v, want it closed", err)
+			}
+			select {
+			case client := <-seen:
+				t.Errorf("untrusted peer reached the handler as %s", client)
+			default:
+			}
+		})
+	}
+}
+
+// isConnReset reports whether err is the reset a closed peer may leave
+// behind in place of a clean EOF.
+func isConnReset(err error) bool {
+	var opErr *net.OpError
+	return err != nil && errors.As(err, &opErr) && !opErr.Timeout()
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolHeader encodes a PROXY protocol header of the given version
+// telling the backend that the connection came from src to dst. Addresses
+// that are not TCP are sent as UNKNOWN (v1) or LOCAL (v2), which backends
+// treat as "use the connection's own addresses".
+func proxyProtocolHeader(version string, src, dst net.Addr) []byte {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	known := ok1 && ok2
+	if known {
+		// A mixed pair is sent as IPv6, mapping the IPv4 side
+		srcIP, dstIP := srcTCP.IP.To4(), dstTCP.IP.To4()
+		if srcIP == nil || dstIP == nil {
+			srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+		}
+		if version == router.ProxyProtocolV2 {
+			return proxyV2Header(srcIP, dstIP, srcTCP.Port, dstTCP.Port)
+		}
+		family, srcText, dstText := "TCP4", srcIP.String(), dstIP.String()
+		if len(srcIP) == net.IPv6len {
+			// net.IP prints IPv4-mapped addresses in dotted form
+			family = "TCP6"
+			srcText = netip.AddrFrom16([16]byte(srcIP)).String()
+			dstText = netip.AddrFrom16([16]byte(dstIP)).String()
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcText, dstText, srcTCP.Port, dstTCP.Port)
+	}
+	if version == router.ProxyProtocolV2 {
+		return proxyV2Header(nil, nil, 0, 0)
+	}
+	return []byte("PROXY UNKNOWN\r\n")
+}
+
+// proxyV2Header encodes a v2 header for a TCP connection between the given
+// IPv4 or IPv6 addresses, or a LOCAL header when they are nil.
+func proxyV2Header(src, dst net.IP, srcPort, dstPort int) []byte {
+	b := append([]byte(nil), proxyV2Signature...)
+	if src == nil {
+		return append(b, 0x20, 0x00, 0, 0) // version 2, LOCAL, unspecified family
+	}
+	family := byte(0x11) // TCP over IPv4
+	if len(src) == net.IPv6len {
+		family = 0x21 // TCP over IPv6
+	}
+	b = append(b, 0x21, family) // version 2, PROXY
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(src)+4))
+	b = append(b, src...)
+	b = append(b, dst...)
+	b = binary.BigEndian.AppendUint16(b, uint16(srcPort))
+	return binary.BigEndian.AppendUint16(b, uint16(dstPort))
+}
+
+// SetPassthroughProxyProtocol makes TLS passthrough to containers start with
+// a PROXY protocol header of the given version; empty disables it.
+func (s *Server) SetPassthroughProxyProtocol(version string) error {
+	if err := router.ValidateProxyProtocol(version); err != nil {
+		return err
+	}
+	s.passthroughProxyProtocol = version
+	return nil
+}
+
+// dialWithProxyHeader connects to target and sends its PROXY protocol
+// header, then starts upstream TLS if the target re-encrypts. The header
+// goes ahead of the TLS handshake, as backends expect.
+func dialWithProxyHeader(dialer *net.Dialer, target *httpTarget) (net.Conn, error) {
+	// Like tls.DialWithDialer, the timeout covers the handshake too
+	var deadline time.Time
+	if dialer.Timeout > 0 {
+		deadline = time.Now().Add(dialer.Timeout)
+	}
+	conn, err := dialer.Dial("tcp", target.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(target.proxyHeader); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if target.tlsConfig != nil {
+		tlsConn := tls.Client(conn, target.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiterIdleTTL is how long a source's bucket is kept after its last
+// request. A bucket idle this long has refilled, so dropping it loses nothing.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// maxRateBuckets caps the buckets one limiter keeps, so a flood of distinct
+// source addresses cannot grow it without bound.
+const maxRateBuckets = 65536
+
+// ipRateLimiter is a token bucket per client IP. Each source may make burst
+// requests at once, refilled at rate per second.
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	denied  atomic.Uint64 // total requests denied
+}
+
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time // last refill
+	throttled bool      // last request was denied
+}
+
+func newIPRateLimiter(rate float64, burst int) *ipRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &ipRateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token for ip. first reports whether this is the first denial
+// since the source was last allowed, so callers can log once per episode.
+func (l *ipRateLimiter) allow(ip string, now time.Time) (ok, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[ip]
+	if b == nil {
+		if len(l.buckets) >= maxRateBuckets {
+			l.makeRoomLocked(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = false
+		return true, false
+	}
+	l.denied.Add(1)
+	first = !b.throttled
+	b.throttled = true
+	return false, first
+}
+
+// evictIdle drops buckets unused for longer than the idle TTL and returns
+// how many remain.
+func (l *ipRateLimiter) evictIdle(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) > rateLimiterIdleTTL {
+			delete(l.buckets, ip)
+		}
+	}
+	return len(l.buckets)
+}
+
+// makeRoomLocked frees space in a full limiter. Buckets that have refilled
+// are dropped first, since a new bucket starts full anyway; failing that, an
+// arbitrary bucket goes, which at worst hands one source a fresh burst.
+func (l *ipRateLimiter) makeRoomLocked(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, ip)
+		}
+	}
+	for ip := range l.buckets {
+		if len(l.buckets) < maxRateBuckets {
+			break
+		}
+		delete(l.buckets, ip)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// acmeChallengePrefix is where ACME HTTP-01 challenges are served; these
+// requests must reach the backend over plain HTTP.
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// SetHTTPSRedirect makes plain HTTP requests for hosts with a static route and
+// a loaded certificate get a 301 to the same URL over HTTPS instead of being
+// proxied.
+func (s *Server) SetHTTPSRedirect(enabled bool) {
+	s.httpsRedirect = enabled
+}
+
+// redirectToHTTPS writes a 301 to the HTTPS URL of req when redirects are
+// enabled and host can be served over TLS. Requests a trusted proxy already
+// received over HTTPS are left alone, since redirecting them would loop.
+// Reports whether it responded.
+func (s *Server) redirectToHTTPS(conn net.Conn, req *httpRequest) bool {
+	if !s.httpsRedirect || req.secure || strings.HasPrefix(req.path, acmeChallengePrefix) || !s.hasCertFor(req.host) {
+		return false
+	}
+
+	// Keep the raw request target so the query string is preserved
+	target := "/"
+	if parts := strings.SplitN(extractRequestLine(string(req.header)), " ", 3); len(parts) >= 2 {
+		if _, pathQuery := splitRequestTarget(parts[1]); strings.HasPrefix(pathQuery, "/") {
+			target = pathQuery
+		}
+	}
+	location := "https://" + req.host + target
+	req.logger().Info("redirecting HTTP to HTTPS", "host", req.host, "location", location, "client", conn.RemoteAddr().String())
+	s.writeResponse(conn, req, gatewayResponse{
+		status:  http.StatusMovedPermanently,
+		headers: "Location: " + location + "\r\n",
+	})
+	return true
+}
+
+// hasCertFor reports whether a loaded certificate is valid for host, or
+// ACME can obtain one.
+func (s *Server) hasCertFor(host string) bool {
+	if s.tlsConfig == nil {
+		return false
+	}
+	if s.acme != nil && s.acmeHostPolicy(context.Background(), host) == nil {
+		return true
+	}
+	return s.CertificateForHost(host) != nil
+}
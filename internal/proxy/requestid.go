@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/textproto"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// DefaultRequestIDHeader is the header carrying a request's correlation ID.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps a client-supplied request ID; longer ones are
+// replaced rather than forwarded.
+const maxRequestIDLength = 200
+
+// SetRequestIDHeader sets the header that carries each HTTP request's
+// correlation ID, e.g. X-Correlation-ID. An empty name disables request IDs.
+func (s *Server) SetRequestIDHeader(name string) error {
+	if name == "" {
+		s.requestIDHeader = ""
+		return nil
+	}
+	if err := router.ValidateHeaderName(name); err != nil {
+		return err
+	}
+	s.requestIDHeader = textproto.CanonicalMIMEHeaderKey(name)
+	return nil
+}
+
+// assignRequestID gives req the correlation ID the client sent, or a new
+// one when it sent none or an unusable one, and a logger that tags every
+// record with it.
+func (s *Server) assignRequestID(req *httpRequest) {
+	if s.requestIDHeader == "" {
+		return
+	}
+	req.id = req.Get(s.requestIDHeader)
+	if !validRequestID(req.id) {
+		if req.id != "" {
+			req.header = removeHeader(req.header, s.requestIDHeader)
+		}
+		req.id = newRequestID()
+		req.header = addHeader(req.header, s.requestIDHeader, req.id)
+	}
+	req.log = slog.With("request_id", req.id)
+}
+
+// validRequestID reports whether a client-supplied ID may be forwarded:
+// printable ASCII without spaces, so it cannot break a header or log line.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random version 4 UUID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// PortReservation caps concurrent connections on a multi-protocol port and
+// reserves part of that capacity per detected protocol, so a flood of one
+// protocol cannot take every slot.
+type PortReservation struct {
+	Capacity int            // concurrent connections allowed on the port once detected
+	Reserved map[string]int // minimum slots kept for each protocol
+}
+
+// portBudget accounts in-flight connections on one port against its
+// reservation.
+type portBudget struct {
+	port     string
+	mu       sync.Mutex
+	res      PortReservation
+	inflight map[string]int
+}
+
+// acquire takes a slot for protocol. A protocol within its reservation is
+// always admitted while the port has room; beyond it, it may only use slots
+// not still held back for other protocols' unmet reservations.
+func (b *portBudget) acquire(protocol string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	for _, n := range b.inflight {
+		total += n
+	}
+	if total >= b.res.Capacity {
+		return false
+	}
+	if b.inflight[protocol] >= b.res.Reserved[protocol] {
+		heldBack := 0
+		for p, reserve := range b.res.Reserved {
+			if p != protocol && b.inflight[p] < reserve {
+				heldBack += reserve - b.inflight[p]
+			}
+		}
+		if b.res.Capacity-total <= heldBack {
+			return false
+		}
+	}
+	b.inflight[protocol]++
+	metrics.PortInflight.WithLabelValues(b.port, protocol).Set(float64(b.inflight[protocol]))
+	return true
+}
+
+func (b *portBudget) release(protocol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight[protocol]--
+	metrics.PortInflight.WithLabelValues(b.port, protocol).Set(float64(b.inflight[protocol]))
+}
+
+// SetPortReservation applies res to a multi-protocol port. The reservations
+// may not add up to more than the capacity.
+func (s *Server) SetPortReservation(port int, res PortReservation) error {
+	if res.Capacity <= 0 {
+		return fmt.Errorf("port %d: capacity must be positive", port)
+	}
+	sum := 0
+	for protocol, n := range res.Reserved {
+		if protocol != ProtocolSSH && protocol != ProtocolHTTP && protocol != ProtocolTLS {
+			return fmt.Errorf("port %d: unknown protocol %q", port, protocol)
+		}
+		if n < 0 {
+			return fmt.Errorf("port %d: negative reservation for %s", port, protocol)
+		}
+		sum += n
+	}
+	if sum > res.Capacity {
+		return fmt.Errorf("port %d: reservations total %d exceed capacity %d", port, sum, res.Capacity)
+	}
+	s.portBudgets[port] = &portBudget{port: strconv.Itoa(port), res: res, inflight: make(map[string]int)}
+	return nil
+}
+
+// acquirePortSlot admits a connection whose protocol was just detected on a
+// multi-protocol port. Ports without a reservation always admit. The
+// returned release func must be called when the connection ends.
+func (s *Server) acquirePortSlot(conn net.Conn, protocol string) (release func(), ok bool) {
+	addr, isTCP := conn.LocalAddr().(*net.TCPAddr)
+	if !isTCP {
+		return func() {}, true
+	}
+	budget, exists := s.portBudgets[addr.Port]
+	if !exists {
+		return func() {}, true
+	}
+	if !budget.acquire(protocol) {
+		metrics.PortReservationRejected.WithLabelValues(budget.port, protocol).Inc()
+		slog.Warn("port protocol budget exhausted, rejecting connection", "port", addr.Port, "protocol", protocol, "client", conn.RemoteAddr().String())
+		return nil, false
+	}
+	return func() { budget.release(protocol) }, true
+}
+
+// ParsePortReservations parses a comma-separated list of
+// port=capacity|protocol:min entries, where the port may be a range and each
+// port in it gets its own budget: "8000-8999=200|ssh:50|http:100".
+func ParsePortReservations(s string) (map[int]PortReservation, error) {
+	reservations := make(map[int]PortReservation)
+	if strings.TrimSpace(s) == "" {
+		return reservations, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		ports, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || spec == "" {
+			return nil, fmt.Errorf("invalid port reservation %q: want port=capacity|protocol:min", entry)
+		}
+		parts := strings.Split(spec, "|")
+		capacity, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("invalid capacity %q in port reservation %q", parts[0], entry)
+		}
+		reserved := make(map[string]int)
+		for _, part := range parts[1:] {
+			protocol, slots, ok := strings.Cut(strings.TrimSpace(part), ":")
+			reserve, err := strconv.Atoi(slots)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("invalid protocol reservation %q: want protocol:min", part)
+			}
+			reserved[strings.ToLower(protocol)] = reserve
+		}
+
+		lo, hi, err := parsePortRange(ports)
+		if err != nil {
+			return nil, err
+		}
+		for port := lo; port <= hi; port++ {
+			reservations[port] = PortReservation{Capacity: capacity, Reserved: reserved}
+		}
+	}
+	return reservations, nil
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// routeLimiter is the request rate limit of one static route, with a single
+// bucket for the whole route or one per client IP.
+type routeLimiter struct {
+	rate     float64
+	burst    int
+	byClient bool
+	buckets  *ipRateLimiter
+}
+
+// routeLimiters holds the rate limiters of static routes by route ID. A
+// route whose limit changes gets a fresh limiter; limiters of routes that
+// went away are dropped once their buckets have been idle long enough.
+type routeLimiters struct {
+	mu       sync.Mutex
+	limiters map[int]*routeLimiter
+}
+
+func newRouteLimiters() *routeLimiters {
+	return &routeLimiters{limiters: make(map[int]*routeLimiter)}
+}
+
+// get returns the limiter for route, or nil when the route is unlimited.
+func (rl *routeLimiters) get(route *router.StaticRoute) *routeLimiter {
+	if route.RateLimit <= 0 {
+		return nil
+	}
+	burst := route.RateBurst
+	if burst < 1 {
+		burst = max(1, int(route.RateLimit))
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	l := rl.limiters[route.ID]
+	if l == nil || l.rate != route.RateLimit || l.burst != burst || l.byClient != route.RateLimitByClient {
+		l = &routeLimiter{
+			rate:     route.RateLimit,
+			burst:    burst,
+			byClient: route.RateLimitByClient,
+			buckets:  newIPRateLimiter(route.RateLimit, burst),
+		}
+		rl.limiters[route.ID] = l
+	}
+	return l
+}
+
+// evictLoop periodically drops idle buckets, and limiters left without
+// any, until done is closed.
+func (rl *routeLimiters) evictLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			rl.mu.Lock()
+			for id, l := range rl.limiters {
+				if l.buckets.evictIdle(now) == 0 {
+					delete(rl.limiters, id)
+				}
+			}
+			rl.mu.Unlock()
+		}
+	}
+}
+
+// throttleRequest answers 429 when the request to route is over the route's
+// rate limit and reports whether it did.
+func (s *Server) throttleRequest(conn net.Conn, req *httpRequest, route *router.StaticRoute) bool {
+	if route == nil {
+		return false
+	}
+	l := s.routeLimits.get(route)
+	if l == nil {
+		return false
+	}
+	key := ""
+	if l.byClient {
+		key = clientIP(conn.RemoteAddr().String())
+	}
+	ok, first := l.buckets.allow(key, time.Now())
+	if ok {
+		return false
+	}
+	if first {
+		req.logger().Warn("rate limiting route", "host", req.host, "path", route.PathPrefix, "client", key, "rate", l.rate, "burst", l.burst)
+	} else {
+		req.logger().Debug("request rate limited", "host", req.host, "path", route.PathPrefix, "client", key)
+	}
+	s.writeTooManyRequests(conn, req, "Rate limit exceeded")
+	return true
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// ResponseHeader is a header field the gateway adds to responses of
+// TLS-terminated requests.
+type ResponseHeader struct {
+	Name  string
+	Value string
+}
+
+// ParseResponseHeaders parses a "|"-separated list of name=value header
+// fields, e.g. "X-Frame-Options=DENY|Referrer-Policy=no-referrer". Values may
+// contain "=" and ",".
+func ParseResponseHeaders(s string) ([]ResponseHeader, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var headers []ResponseHeader
+	for _, entry := range strings.Split(s, "|") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid response header %q: want name=value", entry)
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if err := router.ValidateHeaderField(name, value); err != nil {
+			return nil, err
+		}
+		headers = append(headers, ResponseHeader{Name: textproto.CanonicalMIMEHeaderKey(name), Value: value})
+	}
+	return headers, nil
+}
+
+// SetSecurityHeaders sets the headers added to every response of a
+// TLS-terminated request, such as Strict-Transport-Security. Routes may
+// override or suppress them with their own response headers.
+func (s *Server) SetSecurityHeaders(headers []ResponseHeader) {
+	s.securityHeaders = headers
+}
+
+// responseHeaders returns the headers to add to responses for route: the
+// global set with the route's own headers replacing those of the same name.
+// A route header with an empty value only removes the global one.
+func (s *Server) responseHeaders(route *router.StaticRoute) []ResponseHeader {
+	if route == nil || len(route.ResponseHeaders) == 0 {
+		return s.securityHeaders
+	}
+	overrides := make(map[string]string, len(route.ResponseHeaders))
+	for name, value := range route.ResponseHeaders {
+		overrides[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+
+	headers := make([]ResponseHeader, 0, len(s.securityHeaders)+len(overrides))
+	for _, h := range s.securityHeaders {
+		if _, ok := overrides[h.Name]; !ok {
+			headers = append(headers, h)
+		}
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if value := overrides[name]; value != "" {
+			headers = append(headers, ResponseHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// addResponseHeaders splices headers into a backend's response header
+// block. A header the backend already sent is left as it is, so backends
+// can still choose their own policy.
+func addResponseHeaders(header []byte, headers []ResponseHeader) []byte {
+	for _, h := range headers {
+		if len(headerValues(string(header), h.Name)) == 0 {
+			header = addHeader(header, h.Name, h.Value)
+		}
+	}
+	return header
+}
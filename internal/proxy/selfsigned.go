@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultSelfSignedHosts are the names a self-signed certificate covers
+// unless others are given.
+const DefaultSelfSignedHosts = "localhost,127.0.0.1,::1"
+
+// selfSignedValidity is how long a generated certificate is valid. It only
+// lives as long as the process, so this just has to outlast a dev session.
+const selfSignedValidity = 30 * 24 * time.Hour
+
+// ParseSelfSignedHosts parses a comma-separated list of hostnames and IP
+// addresses for a self-signed certificate.
+func ParseSelfSignedHosts(s string) ([]string, error) {
+	var hosts []string
+	for _, host := range strings.Split(s, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("self-signed certificate needs at least one hostname")
+	}
+	return hosts, nil
+}
+
+// UseSelfSignedCert generates an in-memory ed25519 certificate for hosts,
+// signed by its own key, and serves it for TLS termination. It is meant for
+// local development only: clients cannot verify it without being told to
+// trust it. The certificate is lost on exit and is not reloaded by
+// ReloadTLSCert.
+func (s *Server) UseSelfSignedCert(hosts []string) error {
+	cert, err := selfSignedCert(hosts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	s.ensureTLSConfig()
+	old := s.loadedCerts()
+	s.certs.Store(newCertSet(append(old.certs[:len(old.certs):len(old.certs)], cert), append(old.files[:len(old.files):len(old.files)], certFiles{})))
+
+	slog.Warn("serving a self-signed TLS certificate; clients cannot verify it, do not use in production",
+		"names", hosts, "not_after", cert.Leaf.NotAfter, "sha256_fingerprint", certFingerprint(cert.Leaf.Raw))
+	return nil
+}
+
+// selfSignedCert generates a certificate for hosts valid from now.
+func selfSignedCert(hosts []string, now time.Time) (*tls.Certificate, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"edd-gateway self-signed"}},
+		NotBefore:             now.Add(-time.Hour), // tolerate clock skew
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}, nil
+}
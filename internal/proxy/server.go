@@ -1,118 +1,351 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"runtime/debug"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"eddisonso.com/edd-gateway/internal/metrics"
 	"eddisonso.com/edd-gateway/internal/router"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Server handles TCP proxying with protocol detection.
 type Server struct {
-	router       *router.Router
-	fallbackAddr string // fallback upstream for non-container traffic (e.g., "192.168.3.150")
-	listeners    []net.Listener
-	mu           sync.Mutex
-	closed       bool
-	tlsConfig    *tls.Config // TLS config for termination
+	router        *router.Router
+	fallbackAddr  string // fallback upstream for non-container traffic (e.g., "192.168.3.150")
+	listeners     []net.Listener
+	multiPorts    map[int]net.Listener // multi-protocol listeners by port; guarded by mu
+	drainingPorts map[int]net.Listener // dropped multi-protocol listeners still in their grace period; guarded by mu
+	mu            sync.Mutex
+	closed        bool
+	tlsConfig     *tls.Config             // TLS config for termination
+	tlsMinVersion uint16                  // lowest TLS version accepted on termination
+	tlsCiphers    []uint16                // TLS 1.2 cipher suites accepted on termination; nil for Go's defaults
+	certs         atomic.Pointer[certSet] // certificates served on termination
+	certMu        sync.Mutex              // serializes certificate loads and reloads
+
+	httpsRedirect bool                        // redirect plain HTTP to HTTPS for static route hosts with a certificate
+	acme          *autocert.Manager           // on-demand certificates; nil unless EnableACME was called
+	acmeCerts     map[string]*tls.Certificate // ACME certificates served so far, by host, without keys
+	acmeMu        sync.Mutex
+
+	certExpiryWindow time.Duration   // warn about certificates expiring within this window
+	reportedCerts    map[string]bool // certificate names with expiry gauges set
+	certExpiryMu     sync.Mutex
+
+	missingSNI        MissingSNIPolicy // what to do with TLS connections lacking SNI
+	missingSNIBackend string           // passthrough target for MissingSNIBackend
+	defaultSNIHost    string           // host assumed for ClientHellos without SNI
+	passthroughALPN   map[string]bool  // ALPN protocols never terminated
+	portProxyProtocol map[int]bool     // listener ports whose connections start with a PROXY header
+
+	passthroughProxyProtocol string // PROXY protocol version sent on container TLS passthrough; "" for none
+
+	httpIdleTimeout       time.Duration            // how long a kept-alive HTTP connection may sit idle
+	maxHeaderLineBytes    int                      // cap on a single HTTP request header line
+	firstReadTimeouts     map[string]time.Duration // by protocol
+	portFirstReadTimeouts map[int]time.Duration    // by listener port, overriding protocol
+	portAllowlists        map[int][]netip.Prefix   // allowed client sources by listener port; unrestricted if absent
+	trustedProxies        []netip.Prefix           // peers whose X-Forwarded-Proto is believed
+	proxyProtocolTrusted  []netip.Prefix           // peers allowed to send PROXY headers
+	portBudgets           map[int]*portBudget      // per-protocol reservations by multi-protocol port; unlimited if absent
+
+	accessLog       *accessLogger     // nil when access logging is disabled
+	requestIDHeader string            // header carrying request correlation IDs; "" disables them
+	securityHeaders []ResponseHeader  // added to responses of TLS-terminated requests
+	maintenance     *maintenanceHosts // hosts answering with the maintenance page
+	errorPages      *errorPages       // operator error page templates; nil for plain text
+
+	caPools     map[string]*x509.CertPool // upstream and client CA bundles by file path
+	mtlsConfigs map[string]*tls.Config    // termination configs requiring client certificates, by CA bundle path
+	caPoolsMu   sync.Mutex
+
+	backends    *backendPool // idle keep-alive connections to HTTP backends
+	copyBuffers *bufferPool  // relay buffers for proxied connections
+
+	shedder *memoryShedder // nil when memory shedding is disabled
+
+	dialTimeout       time.Duration // default backend dial timeout, overridable per route
+	proxyIdleTimeout  time.Duration // default idle timeout for in-use HTTP backend connections; 0 disables
+	maxBufferedBody   int64         // default cap on request bodies buffered for BufferBody routes
+	slowDialThreshold time.Duration // warn on backend dials slower than this; 0 disables
+	debugErrors       bool          // include backend details in 502 responses
+
+	retryAfter map[string]time.Duration // Retry-After delay on 503 and 429 responses by cause
+
+	ejector *ejector       // passive health: consecutive dial failures per backend
+	health  *healthChecker // active health: latest probe result per route target
+
+	hostLimits  *hostLimiter                  // concurrent connection caps by destination host
+	sshLimiter  atomic.Pointer[ipRateLimiter] // SSH connection rate per source IP; nil when unlimited
+	routeLimits *routeLimiters                // HTTP request rate per static route
+	credentials *credentialCache              // basic auth credentials that passed a bcrypt check
+	sshAudit    SSHAuditSinks                 // where SSH session audit records go; 0 disables
+
+	shutdownTimeout time.Duration           // grace period used by Close
+	active          map[net.Conn]*connState // accepted connections, guarded by mu
+	maxConns        int                     // cap on len(active), 0 for unlimited; guarded by mu
+	peakConns       int                     // highest len(active) seen; guarded by mu
+	maxConnsPerIP   int                     // cap on connections per client address, 0 for unlimited; guarded by mu
+	connsByIP       map[netip.Addr]int      // connections per client address; guarded by mu
+	handlers        sync.WaitGroup          // running connection handlers
+	done            chan struct{}           // closed on shutdown to stop background goroutines
 }
 
+// DefaultHTTPIdleTimeout is how long a kept-alive HTTP client connection may
+// wait between requests before it is closed.
+const DefaultHTTPIdleTimeout = 60 * time.Second
+
 // NewServer creates a new proxy server.
 func NewServer(r *router.Router, fallbackAddr string) *Server {
-	return &Server{
-		router:       r,
-		fallbackAddr: fallbackAddr,
+	s := &Server{
+		router:                r,
+		fallbackAddr:          fallbackAddr,
+		missingSNI:            MissingSNIClose,
+		httpIdleTimeout:       DefaultHTTPIdleTimeout,
+		maxHeaderLineBytes:    DefaultMaxHeaderLineBytes,
+		firstReadTimeouts:     make(map[string]time.Duration),
+		portFirstReadTimeouts: make(map[int]time.Duration),
+		portAllowlists:        make(map[int][]netip.Prefix),
+		portProxyProtocol:     make(map[int]bool),
+		multiPorts:            make(map[int]net.Listener),
+		drainingPorts:         make(map[int]net.Listener),
+		portBudgets:           make(map[int]*portBudget),
+		dialTimeout:           DefaultDialTimeout,
+		proxyIdleTimeout:      DefaultProxyIdleTimeout,
+		maxBufferedBody:       DefaultMaxBufferedBody,
+		copyBuffers:           newBufferPool(DefaultCopyBufferSize),
+		backends:              newBackendPool(DefaultBackendPoolSize, DefaultBackendIdleTimeout),
+		shutdownTimeout:       DefaultShutdownTimeout,
+		active:                make(map[net.Conn]*connState),
+		connsByIP:             make(map[netip.Addr]int),
+		done:                  make(chan struct{}),
+		ejector:               newEjector(DefaultEjectThreshold, DefaultEjectCooldown),
+		hostLimits:            newHostLimiter(),
+		routeLimits:           newRouteLimiters(),
+		credentials:           newCredentialCache(),
+		maintenance:           newMaintenanceHosts(),
+		health:                &healthChecker{timeout: DefaultHealthCheckTimeout, targets: make(map[string]*TargetHealth)},
+		retryAfter:            DefaultRetryAfter(),
+		requestIDHeader:       DefaultRequestIDHeader,
+		tlsMinVersion:         tls.VersionTLS12,
+		certExpiryWindow:      DefaultCertExpiryWindow,
+	}
+	for protocol, d := range defaultFirstReadTimeouts {
+		s.firstReadTimeouts[protocol] = d
 	}
+	r.SetTargetFilter(s.backendAvailable)
+	go s.backends.evictLoop(s.done)
+	go s.routeLimits.evictLoop(s.done)
+	go s.sshEvictLoop(s.done)
+	go sampleAcceptRate(s.done)
+	return s
 }
 
-// LoadTLSCert loads a TLS certificate for TLS termination.
-func (s *Server) LoadTLSCert(certFile, keyFile string) error {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return fmt.Errorf("load TLS cert: %w", err)
+// SetBackendPoolSize sets how many idle keep-alive connections are kept per
+// HTTP backend target. Zero disables pooling.
+func (s *Server) SetBackendPoolSize(n int) {
+	if n < 0 {
+		n = 0
 	}
+	s.backends.setSize(n)
+}
 
-	s.tlsConfig = &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+// SetBackendIdleTimeout sets how long a pooled backend connection may stay
+// idle before it is closed. Non-positive values keep the default.
+func (s *Server) SetBackendIdleTimeout(d time.Duration) {
+	if d > 0 {
+		s.backends.setIdleTimeout(d)
 	}
+}
 
-	slog.Info("loaded TLS certificate", "cert", certFile)
-	return nil
+// SetHTTPIdleTimeout sets how long a kept-alive HTTP connection may stay idle
+// between requests. Non-positive values keep the default.
+func (s *Server) SetHTTPIdleTimeout(d time.Duration) {
+	if d > 0 {
+		s.httpIdleTimeout = d
+	}
+}
+
+// SetMaxHeaderLineBytes caps the length of a single HTTP request line or
+// header field; longer lines are rejected with 431. The cap applies on top
+// of the total header size limit. Non-positive values keep the default.
+func (s *Server) SetMaxHeaderLineBytes(n int) {
+	if n > 0 {
+		s.maxHeaderLineBytes = n
+	}
 }
 
 // ListenSSH starts the SSH proxy listener.
 func (s *Server) ListenSSH(port int) error {
-	return s.listen(port, s.handleSSH)
+	return s.listen(port, ProtocolSSH, s.handleSSH)
 }
 
 // ListenHTTP starts the HTTP proxy listener.
 func (s *Server) ListenHTTP(port int) error {
-	return s.listen(port, s.handleHTTP)
+	return s.listen(port, ProtocolHTTP, s.handleHTTP)
 }
 
 // ListenTLS starts the TLS/HTTPS proxy listener.
 func (s *Server) ListenTLS(port int) error {
-	return s.listen(port, s.handleTLS)
+	return s.listen(port, ProtocolTLS, s.handleTLS)
 }
 
 // ListenMulti starts a multi-protocol listener that auto-detects SSH/HTTP/TLS.
 func (s *Server) ListenMulti(port int) error {
-	return s.listen(port, s.handleMulti)
+	ln, err := s.bindMulti(port)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln, port, ProtocolMulti, s.handleMulti)
 }
 
 // handleMulti detects the protocol from the first bytes and routes accordingly.
 func (s *Server) handleMulti(conn net.Conn) {
 	// Read first few bytes to detect protocol
-	buf := make([]byte, 8)
-	n, err := conn.Read(buf)
-	if err != nil || n == 0 {
+	s.setFirstReadDeadline(conn, ProtocolMulti)
+	buf, err := readDetectionBytes(conn)
+	if len(buf) == 0 {
 		slog.Debug("failed to read protocol detection bytes", "error", err)
 		conn.Close()
 		return
 	}
-	buf = buf[:n]
+	n := len(buf)
+	conn.SetReadDeadline(time.Time{})
 
 	// Wrap connection to replay the peeked bytes
 	peekedConn := &peekedConn{Conn: conn, peeked: buf}
 
 	// Detect protocol
+	var protocol string
 	switch {
 	case n >= 4 && string(buf[:4]) == "SSH-":
-		slog.Debug("detected SSH protocol")
-		s.handleSSH(peekedConn)
+		protocol = ProtocolSSH
 	case n >= 1 && buf[0] == 0x16:
-		slog.Debug("detected TLS protocol")
-		s.handleTLSWithPeek(peekedConn, buf)
+		protocol = ProtocolTLS
 	case isHTTPMethod(buf):
-		slog.Debug("detected HTTP protocol")
-		s.handleHTTPWithPeek(peekedConn, buf)
+		protocol = ProtocolHTTP
+	case nearMissHTTP(buf):
+		// Tell a client that almost spoke HTTP what it got wrong instead
+		// of resetting it
+		slog.Debug("rejecting malformed HTTP request", "client", conn.RemoteAddr().String(), "bytes", hex.EncodeToString(buf))
+		metrics.ConnectionsTotal.WithLabelValues("unknown").Inc()
+		s.writeError(conn, nil, http.StatusBadRequest, "", "Malformed HTTP request line")
+		return
 	default:
-		slog.Warn("unknown protocol", "bytes", buf)
+		slog.Debug("unknown protocol", "client", conn.RemoteAddr().String(), "bytes", hex.EncodeToString(buf))
+		metrics.ConnectionsTotal.WithLabelValues("unknown").Inc()
 		conn.Close()
+		return
 	}
+	slog.Debug("detected protocol", "protocol", protocol)
+	s.setConnProtocol(conn, protocol)
+
+	release, ok := s.acquirePortSlot(conn, protocol)
+	if !ok {
+		if protocol == ProtocolHTTP {
+			s.writeUnavailable(conn, nil, RetryOverload, "Port at capacity")
+		}
+		conn.Close()
+		return
+	}
+	defer release()
+
+	switch protocol {
+	case ProtocolSSH:
+		s.handleSSH(peekedConn)
+	case ProtocolTLS:
+		s.handleTLSWithPeek(peekedConn, buf)
+	case ProtocolHTTP:
+		s.handleHTTPWithPeek(peekedConn, buf)
+	}
+}
+
+// Protocol detection reads up to detectionPeekSize bytes. Fewer than
+// detectionMinBytes cannot tell SSH from HTTP, so after a short first read
+// detection waits up to detectionReadWait for the rest.
+const (
+	detectionPeekSize = 8
+	detectionMinBytes = 4
+	detectionReadWait = time.Second
+)
+
+// readDetectionBytes reads the first bytes of a connection, looping until
+// there are enough to detect the protocol. A TLS record is recognizable
+// from its first byte alone. Whatever arrived is returned, together with
+// the error that ended reading early, if any; a peer that sends too little
+// before detectionReadWait is classified from the bytes it did send.
+func readDetectionBytes(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, 0, detectionPeekSize)
+	for len(buf) < detectionMinBytes && (len(buf) == 0 || buf[0] != 0x16) {
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			return buf, err
+		}
+		if n > 0 {
+			conn.SetReadDeadline(time.Now().Add(detectionReadWait))
+		}
+	}
+	return buf, nil
 }
 
-// isHTTPMethod checks if the bytes start with an HTTP method.
+// httpMethods are the request methods protocol detection recognizes, each
+// with the space that ends it.
+var httpMethods = []string{"GET ", "POST ", "PUT ", "HEAD ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// isHTTPMethod checks if the bytes start with an HTTP method and the space
+// after it. At least 4 bytes are needed; when fewer than the method and
+// space arrived, the bytes must be a prefix of them.
 func isHTTPMethod(buf []byte) bool {
-	methods := []string{"GET ", "POST", "PUT ", "HEAD", "DELE", "OPTI", "PATC", "CONN", "TRAC"}
 	if len(buf) < 4 {
 		return false
 	}
-	prefix := string(buf[:4])
-	for _, m := range methods {
-		if prefix == m {
+	for _, m := range httpMethods {
+		if len(buf) >= len(m) && string(buf[:len(m)]) == m {
+			return true
+		}
+		if len(buf) < len(m) && m[:len(buf)] == string(buf) {
 			return true
 		}
 	}
 	return false
 }
 
+// nearMissHTTP reports whether bytes that isHTTPMethod rejected still look
+// like an HTTP request: a known method in the wrong case, as in
+// "get / HTTP/1.1", or a token of letters followed by " /".
+func nearMissHTTP(buf []byte) bool {
+	if isHTTPMethod(bytes.ToUpper(buf)) {
+		return true
+	}
+	sp := bytes.IndexByte(buf, ' ')
+	if sp < 1 || sp+1 >= len(buf) || buf[sp+1] != '/' {
+		return false
+	}
+	for _, c := range buf[:sp] {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
 // peekedConn wraps a net.Conn to replay peeked bytes on first read.
 type peekedConn struct {
 	net.Conn
@@ -141,7 +374,7 @@ func (s *Server) handleHTTPWithPeek(conn net.Conn, peeked []byte) {
 	s.handleHTTP(conn)
 }
 
-func (s *Server) listen(port int, handler func(net.Conn)) error {
+func (s *Server) listen(port int, protocol string, handler func(net.Conn)) error {
 	ln, err := net.Listen("tcp", formatAddr(port))
 	if err != nil {
 		return err
@@ -151,6 +384,12 @@ func (s *Server) listen(port int, handler func(net.Conn)) error {
 	s.listeners = append(s.listeners, ln)
 	s.mu.Unlock()
 
+	return s.serve(ln, port, protocol, handler)
+}
+
+// serve accepts connections on ln until the server shuts down or the
+// listener is dropped.
+func (s *Server) serve(ln net.Listener, port int, protocol string, handler func(net.Conn)) error {
 	slog.Info("listening", "port", port)
 
 	for {
@@ -159,29 +398,96 @@ func (s *Server) listen(port int, handler func(net.Conn)) error {
 			s.mu.Lock()
 			closed := s.closed
 			s.mu.Unlock()
-			if closed {
+			if closed || errors.Is(err, net.ErrClosed) {
 				return nil
 			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				if s.finishDrain(port, ln) {
+					return nil
+				}
+				continue
+			}
 			slog.Error("accept failed", "error", err)
 			continue
 		}
 
-		go handler(conn)
+		// Behind a PROXY protocol load balancer the allowlist applies to the
+		// client address from the header, checked once it has been read.
+		// Only the load balancer itself may send that header.
+		proxied := s.portProxyProtocol[port]
+		if proxied && s.rejectUntrustedProxyPeer(port, conn) {
+			continue
+		}
+		if !proxied && s.rejectDisallowedSource(port, conn) {
+			continue
+		}
+
+		if s.shedder != nil && s.shedder.shouldShed(port) {
+			slog.Debug("shedding connection under memory pressure", "port", port, "client", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+
+		if s.atCapacity() {
+			slog.Warn("connection limit reached, rejecting connection", "port", port, "client", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+
+		if !s.trackConn(conn, protocol) {
+			conn.Close()
+			return nil
+		}
+		go func() {
+			if proxied {
+				pc, err := s.acceptProxyHeader(conn, protocol)
+				if err != nil {
+					slog.Warn("dropping connection with malformed PROXY protocol header", "port", port, "peer", conn.RemoteAddr().String(), "error", err)
+					conn.Close()
+					s.untrackConn(conn)
+					return
+				}
+				s.retrackConn(conn, pc)
+				conn = pc
+				if s.rejectDisallowedSource(port, conn) {
+					s.untrackConn(conn)
+					return
+				}
+			}
+			defer s.untrackConn(conn)
+			ip, ok := s.acquireSource(conn)
+			if !ok {
+				slog.Warn("per-source connection limit reached, rejecting connection", "port", port, "client", conn.RemoteAddr().String())
+				conn.Close()
+				return
+			}
+			defer s.releaseSource(ip)
+			defer s.recoverConn(conn, protocol)
+			handler(conn)
+		}()
+	}
+}
+
+// recoverConn is deferred around each connection handler so that a panic,
+// e.g. from a parser fed hostile input, costs only that connection: it is
+// logged with its stack and the connection is closed.
+func (s *Server) recoverConn(conn net.Conn, protocol string) {
+	if err := recover(); err != nil {
+		slog.Error("connection handler panicked", "protocol", protocol, "client", conn.RemoteAddr().String(), "error", err, "stack", string(debug.Stack()))
+		conn.Close()
 	}
 }
 
-// Close shuts down all listeners.
+// Close stops accepting connections and waits up to the shutdown timeout for
+// in-flight connections to finish before force-closing them.
 func (s *Server) Close() {
-	s.mu.Lock()
-	s.closed = true
-	for _, ln := range s.listeners {
-		ln.Close()
-	}
-	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	s.Shutdown(ctx)
 }
 
 // proxy copies data bidirectionally between client and backend.
-func proxy(client, backend net.Conn, initialData []byte) {
+func (s *Server) proxy(client, backend net.Conn, initialData []byte) {
 	defer client.Close()
 	defer backend.Close()
 
@@ -191,24 +497,23 @@ func proxy(client, backend net.Conn, initialData []byte) {
 			slog.Error("failed to write initial data", "error", err)
 			return
 		}
+		metrics.AddProxyBytes(metrics.DirectionUpstream, int64(len(initialData)))
 	}
 
 	// Bidirectional copy
 	done := make(chan struct{}, 2)
 
 	go func() {
-		io.Copy(backend, client)
-		if tc, ok := backend.(*net.TCPConn); ok {
-			tc.CloseWrite()
-		}
+		n, _ := s.copyBuffers.copy(backend, client)
+		metrics.AddProxyBytes(metrics.DirectionUpstream, n)
+		closeWrite(backend)
 		done <- struct{}{}
 	}()
 
 	go func() {
-		io.Copy(client, backend)
-		if tc, ok := client.(*net.TCPConn); ok {
-			tc.CloseWrite()
-		}
+		n, _ := s.copyBuffers.copy(client, backend)
+		metrics.AddProxyBytes(metrics.DirectionDownstream, n)
+		closeWrite(client)
 		done <- struct{}{}
 	}()
 
@@ -217,16 +522,58 @@ func proxy(client, backend net.Conn, initialData []byte) {
 	<-done
 }
 
+// closeWrite half-closes conn if it supports it, signalling EOF to the peer
+// while still allowing reads. Wrapped connections are unwrapped first.
+func closeWrite(conn net.Conn) {
+	switch c := conn.(type) {
+	case *peekedConn:
+		closeWrite(c.Conn)
+	case *proxyConn:
+		closeWrite(c.Conn)
+	case *replayConn:
+		closeWrite(c.Conn)
+	case *idleConn:
+		closeWrite(c.Conn)
+	case interface{ CloseWrite() error }:
+		c.CloseWrite()
+	}
+}
+
 // dialBackend connects to the container's backend service.
 func (s *Server) dialBackend(ip string, port int) (net.Conn, error) {
 	addr := net.JoinHostPort(ip, formatPort(port))
+	start := time.Now()
 	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	s.observeDial(ProtocolMulti, addr, nil, start, err)
 	if err != nil {
 		return nil, err
 	}
 	return conn, nil
 }
 
+// routable reports whether a container lookup that returned err may still
+// be routed. Stale cache entries are routed, but logged loudly since the
+// database has not confirmed them for a long time.
+func routable(err error, container string) bool {
+	if errors.Is(err, router.ErrStale) {
+		slog.Error("routing with stale container data", "container", container, "error", err)
+		return true
+	}
+	return err == nil
+}
+
+// hostPort joins a backend host and port, bracketing IPv6 literals:
+// "fd00::1" and 22 give "[fd00::1]:22".
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// serviceAddr is the in-cluster load balancer address of a container's
+// namespace.
+func serviceAddr(namespace string, port int) string {
+	return hostPort("lb."+namespace+".svc.cluster.local", port)
+}
+
 func formatAddr(port int) string {
 	return fmt.Sprintf(":%d", port)
 }
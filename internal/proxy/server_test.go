@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestHostPortIPv6(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		port int
+		want string
+	}{
+		{"fd00::1", 22, "[fd00::1]:22"},
+		{"10.0.0.1", 22, "10.0.0.1:22"},
+		{"backend.example", 8080, "backend.example:8080"},
+	} {
+		if got := hostPort(tt.host, tt.port); got != tt.want {
+			t.Errorf("hostPort(%q, %d) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+	if got := serviceAddr("team-abc", 22); got != "lb.team-abc.svc.cluster.local:22" {
+		t.Errorf("serviceAddr() = %q", got)
+	}
+}
+
+func TestDialBackendIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable:", err)
+	}
+	defer ln.Close()
+
+	s := NewServer(&router.Router{}, "")
+	conn, err := s.dialBackend("::1", ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("dialBackend(::1) error = %v", err)
+	}
+	conn.Close()
+}
+
+func TestProtocolDetection(t *testing.T) {
+	for _, tt := range []struct {
+		buf      string
+		http     bool
+		nearMiss bool
+	}{
+		{"GET / HT", true, false},
+		{"POST /ap", true, false},
+		{"PUT /x H", true, false},
+		{"HEAD / H", true, false},
+		{"DELETE /", true, false},
+		{"OPTIONS ", true, false},
+		{"PATCH /x", true, false},
+		{"CONNECT ", true, false},
+		{"TRACE / ", true, false},
+		{"PATC", true, false},
+		{"OPTI", true, false},
+		{"GET", false, false},
+		{"GETS /x ", false, true},
+		{"get / HT", false, true},
+		{"Post /ap", false, true},
+		{"FOO /x H", false, true},
+		{"FOO x HT", false, false},
+		{"SSH-2.0-", false, false},
+		{"\x16\x03\x01\x02\x00", false, false},
+		{"\x00\x01\x02\x03", false, false},
+		{"12 /abcd", false, false},
+	} {
+		buf := []byte(tt.buf)
+		if got := isHTTPMethod(buf); got != tt.http {
+			t.Errorf("isHTTPMethod(%q) = %v, want %v", tt.buf, got, tt.http)
+		}
+		if tt.http {
+			continue
+		}
+		if got := nearMissHTTP(buf); got != tt.nearMiss {
+			t.Errorf("nearMissHTTP(%q) = %v, want %v", tt.buf, got, tt.nearMiss)
+		}
+	}
+}
+
+func TestHandleMultiRejectsNearMissHTTP(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		s.handleMulti(server)
+		server.Close()
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte("get / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHandleMultiClosesUnknownProtocol(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		s.handleMulti(server)
+		server.Close()
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte{0x00, 0x01, 0x02, 0x03, 0xff, 0xfe, 0xfd, 0xfc})
+	if b, err := io.ReadAll(client); err != nil || len(b) != 0 {
+		t.Errorf("read %q, %v; want the connection closed without a response", b, err)
+	}
+}
+
+func TestReadDetectionBytesOneAtATime(t *testing.T) {
+	for _, tt := range []struct {
+		stream string
+		want   string
+	}{
+		{"SSH-2.0-OpenSSH_9.6\r\n", "SSH-"},
+		{"GET / HTTP/1.1\r\n\r\n", "GET "},
+		{"\x16\x03\x01\x00\x05hello", "\x16"},
+	} {
+		client, server := net.Pipe()
+		go func() {
+			for i := range len(tt.stream) {
+				if _, err := client.Write([]byte{tt.stream[i]}); err != nil {
+					return
+				}
+			}
+			client.Close()
+		}()
+
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf, err := readDetectionBytes(server)
+		if err != nil {
+			t.Fatalf("readDetectionBytes(%q) error = %v", tt.stream, err)
+		}
+		if string(buf) != tt.want {
+			t.Errorf("readDetectionBytes(%q) = %q, want %q", tt.stream, buf, tt.want)
+		}
+
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		replayed, err := io.ReadAll(&peekedConn{Conn: server, peeked: buf})
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if string(replayed) != tt.stream {
+			t.Errorf("peekedConn replayed %q, want %q", replayed, tt.stream)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PortPriority classifies a listener port for load shedding under memory pressure.
+type PortPriority int
+
+const (
+	PriorityCritical PortPriority = iota // never shed (e.g. SSH)
+	PriorityNormal                       // shed with probability proportional to pressure
+	PriorityLow                          // shed as soon as pressure exceeds the threshold
+)
+
+func (p PortPriority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "critical"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// MemoryShedConfig configures shedding of new connections under memory pressure.
+type MemoryShedConfig struct {
+	// Threshold is the fraction of the memory limit (0-1) above which
+	// non-critical connections start being shed.
+	Threshold float64
+	// Limit is the memory limit in bytes. Zero detects the cgroup limit.
+	Limit uint64
+	// Interval is how often memory usage is sampled.
+	Interval time.Duration
+	// Priorities maps listener ports to their priority. Unlisted ports use DefaultPriority.
+	Priorities      map[int]PortPriority
+	DefaultPriority PortPriority
+}
+
+// memoryShedder samples memory usage and decides whether to shed new connections.
+type memoryShedder struct {
+	cfg      MemoryShedConfig
+	limit    uint64
+	cgroup   bool          // usage read from the cgroup rather than the Go runtime
+	pressure atomic.Uint64 // math.Float64bits of the pressure level in [0,1]
+	shed     atomic.Uint64 // total connections shed
+}
+
+// SetMemoryShedding starts a background monitor that sheds new connections on
+// non-critical ports when memory usage approaches the limit.
+func (s *Server) SetMemoryShedding(cfg MemoryShedConfig) error {
+	if cfg.Threshold <= 0 || cfg.Threshold >= 1 {
+		return fmt.Errorf("memory shed threshold must be between 0 and 1, got %v", cfg.Threshold)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	m := &memoryShedder{cfg: cfg, limit: cfg.Limit}
+	if m.limit == 0 {
+		limit, ok := cgroupMemoryLimit()
+		if !ok {
+			return errors.New("no memory limit configured and no cgroup limit detected")
+		}
+		m.limit = limit
+		m.cgroup = true
+	}
+
+	s.shedder = m
+	go m.run(s.done)
+
+	slog.Info("memory shedding enabled", "limit_bytes", m.limit, "threshold", cfg.Threshold, "cgroup", m.cgroup)
+	return nil
+}
+
+// ShedCount returns the total number of connections shed under memory pressure.
+func (s *Server) ShedCount() uint64 {
+	if s.shedder == nil {
+		return 0
+	}
+	return s.shedder.shed.Load()
+}
+
+// run samples memory usage until done is closed.
+func (m *memoryShedder) run(done <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	var lastShed uint64
+	shedding := false
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		usage := m.usage()
+		ratio := float64(usage) / float64(m.limit)
+		level := 0.0
+		if ratio > m.cfg.Threshold {
+			level = math.Min(1, (ratio-m.cfg.Threshold)/(1-m.cfg.Threshold))
+		}
+		m.pressure.Store(math.Float64bits(level))
+
+		if level > 0 && !shedding {
+			slog.Warn("memory pressure: shedding non-critical connections", "usage_bytes", usage, "limit_bytes", m.limit, "ratio", ratio)
+		} else if level == 0 && shedding {
+			slog.Info("memory pressure relieved", "usage_bytes", usage, "limit_bytes", m.limit, "ratio", ratio)
+		}
+		shedding = level > 0
+
+		if total := m.shed.Load(); total != lastShed {
+			slog.Warn("shed connections under memory pressure", "count", total-lastShed, "total", total, "pressure", level)
+			lastShed = total
+		}
+	}
+}
+
+// shouldShed reports whether a new connection on port should be rejected,
+// counting it if so.
+func (m *memoryShedder) shouldShed(port int) bool {
+	level := math.Float64frombits(m.pressure.Load())
+	if level <= 0 {
+		return false
+	}
+
+	priority, ok := m.cfg.Priorities[port]
+	if !ok {
+		priority = m.cfg.DefaultPriority
+	}
+
+	var shed bool
+	switch priority {
+	case PriorityCritical:
+		shed = false
+	case PriorityLow:
+		shed = true
+	default:
+		shed = rand.Float64() < level
+	}
+	if shed {
+		m.shed.Add(1)
+	}
+	return shed
+}
+
+// usage returns current memory usage in bytes.
+func (m *memoryShedder) usage() uint64 {
+	if m.cgroup {
+		if usage, ok := cgroupMemoryUsage(); ok {
+			return usage
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
+
+// cgroupMemoryLimit reads the cgroup (v2, then v1) memory limit.
+func cgroupMemoryLimit() (uint64, bool) {
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.max",
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+	} {
+		if v, ok := readUintFile(path); ok && v > 0 && v < 1<<60 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// cgroupMemoryUsage reads the cgroup (v2, then v1) memory usage.
+func cgroupMemoryUsage() (uint64, bool) {
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.current",
+		"/sys/fs/cgroup/memory/memory.usage_in_bytes",
+	} {
+		if v, ok := readUintFile(path); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// readUintFile parses a file containing a single unsigned integer ("max" is not a number).
+func readUintFile(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// ParsePortPriorities parses a comma-separated list of port=priority entries,
+// where the port may be a range: "2222=critical,8080=normal,8000-8999=low".
+func ParsePortPriorities(s string) (map[int]PortPriority, error) {
+	priorities := make(map[int]PortPriority)
+	if strings.TrimSpace(s) == "" {
+		return priorities, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		ports, name, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid port priority %q: want port=priority", entry)
+		}
+
+		var priority PortPriority
+		switch strings.ToLower(name) {
+		case "critical":
+			priority = PriorityCritical
+		case "normal":
+			priority = PriorityNormal
+		case "low":
+			priority = PriorityLow
+		default:
+			return nil, fmt.Errorf("invalid priority %q: want critical, normal or low", name)
+		}
+
+		lo, hi, err := parsePortRange(ports)
+		if err != nil {
+			return nil, err
+		}
+		for port := lo; port <= hi; port++ {
+			priorities[port] = priority
+		}
+	}
+	return priorities, nil
+}
+
+// parsePortRange parses "8000" or "8000-8999".
+func parsePortRange(s string) (int, int, error) {
+	loStr, hiStr, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(loStr)
+	if err != nil || lo < 1 || lo > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", loStr)
+	}
+	if !isRange {
+		return lo, lo, nil
+	}
+	hi, err := strconv.Atoi(hiStr)
+	if err != nil || hi < lo || hi > 65535 {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return lo, hi, nil
+}
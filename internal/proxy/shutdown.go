@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// DefaultShutdownTimeout is how long Close waits for in-flight connections.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// connState tracks an accepted client connection for draining.
+type connState struct {
+	protocol string    // listener protocol, or the detected one on multi-protocol ports
+	since    time.Time // accept time
+	idle     bool      // kept-alive HTTP connection waiting for its next request
+}
+
+// SetShutdownTimeout sets the grace period Close waits for in-flight
+// connections. Non-positive values keep the default.
+func (s *Server) SetShutdownTimeout(d time.Duration) {
+	if d > 0 {
+		s.shutdownTimeout = d
+	}
+}
+
+// Shutdown stops accepting new connections, closes idle kept-alive HTTP
+// connections, and waits for in-flight connections to finish. When ctx is done
+// first, remaining connections are force-closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	draining := len(s.active)
+	for conn, st := range s.active {
+		if st.idle {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	slog.Info("draining connections", "active", draining)
+
+	finished := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		slog.Info("all connections drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	for conn, st := range s.active {
+		slog.Warn("force-closing connection after shutdown deadline",
+			"protocol", st.protocol,
+			"client", conn.RemoteAddr().String(),
+			"duration", time.Since(st.since).Round(time.Second))
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	// Handlers return promptly once their connections are closed
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		slog.Warn("connection handlers still running after force-close")
+	}
+	return ctx.Err()
+}
+
+// trackConn registers an accepted connection. It returns false if the
+// server is shutting down and the connection should be rejected.
+func (s *Server) trackConn(conn net.Conn, protocol string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.active[conn] = &connState{protocol: protocol, since: time.Now()}
+	s.peakConns = max(s.peakConns, len(s.active))
+	s.handlers.Add(1)
+	metrics.ActiveConnections.WithLabelValues(protocol).Inc()
+	return true
+}
+
+// retrackConn moves the tracking of an accepted connection to the wrapper
+// that replaces it, such as a proxyConn.
+func (s *Server) retrackConn(conn, wrapper net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.active[conn]; ok {
+		delete(s.active, conn)
+		s.active[wrapper] = st
+	}
+}
+
+// untrackConn removes a connection once its handler returns.
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	if st, ok := s.active[conn]; ok {
+		metrics.ActiveConnections.WithLabelValues(st.protocol).Dec()
+		delete(s.active, conn)
+	}
+	s.mu.Unlock()
+	s.handlers.Done()
+}
+
+// shuttingDown reports whether Shutdown has been called. Requests that
+// arrive while draining are refused.
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConnIdle marks a kept-alive HTTP connection as waiting for its next
+// request (idle) or busy. It returns false if the connection is becoming idle
+// while the server is draining, in which case it should be closed.
+func (s *Server) setConnIdle(conn net.Conn, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idle && s.closed {
+		return false
+	}
+	if st, ok := s.active[baseConn(conn)]; ok {
+		st.idle = idle
+	}
+	return true
+}
+
+// baseConn unwraps protocol-detection and TLS wrappers to the accepted
+// connection, or to its proxyConn when a PROXY header was read.
+func baseConn(conn net.Conn) net.Conn {
+	for {
+		switch c := conn.(type) {
+		case *peekedConn:
+			conn = c.Conn
+		case *replayConn:
+			conn = c.Conn
+		case *tls.Conn:
+			conn = c.NetConn()
+		default:
+			return conn
+		}
+	}
+}
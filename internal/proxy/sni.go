@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// MissingSNIPolicy selects what happens to a TLS connection whose ClientHello
+// carries no usable SNI hostname, e.g. a client connecting by IP address.
+type MissingSNIPolicy string
+
+const (
+	MissingSNIClose    MissingSNIPolicy = "close"    // drop the connection
+	MissingSNIFallback MissingSNIPolicy = "fallback" // pass through to the fallback upstream
+	MissingSNIBackend  MissingSNIPolicy = "backend"  // pass through to a configured backend
+)
+
+// ParseMissingSNIPolicy validates a missing-SNI policy name.
+func ParseMissingSNIPolicy(s string) (MissingSNIPolicy, error) {
+	switch p := MissingSNIPolicy(strings.ToLower(s)); p {
+	case MissingSNIClose, MissingSNIFallback, MissingSNIBackend:
+		return p, nil
+	case "":
+		return MissingSNIClose, nil
+	}
+	return "", fmt.Errorf("unknown missing-SNI policy %q (want close, fallback or backend)", s)
+}
+
+// SetMissingSNIPolicy sets how TLS connections without SNI are handled.
+// backend is the host:port to pass them through to under MissingSNIBackend
+// and is ignored otherwise.
+func (s *Server) SetMissingSNIPolicy(policy MissingSNIPolicy, backend string) error {
+	switch policy {
+	case MissingSNIBackend:
+		if _, _, err := net.SplitHostPort(backend); err != nil {
+			return fmt.Errorf("missing-SNI backend %q: %w", backend, err)
+		}
+	case MissingSNIFallback:
+		if s.fallbackAddr == "" {
+			return fmt.Errorf("missing-SNI policy %q requires a fallback upstream", policy)
+		}
+	}
+	s.missingSNI = policy
+	s.missingSNIBackend = backend
+	return nil
+}
+
+// missingSNITarget returns the passthrough address for a connection without
+// SNI on ingressPort, or false when the connection should be closed.
+func (s *Server) missingSNITarget(ingressPort int) (string, bool) {
+	switch s.missingSNI {
+	case MissingSNIFallback:
+		if s.fallbackAddr == "" {
+			return "", false
+		}
+		return net.JoinHostPort(s.fallbackAddr, strconv.Itoa(ingressPort)), true
+	case MissingSNIBackend:
+		return s.missingSNIBackend, s.missingSNIBackend != ""
+	}
+	return "", false
+}
+
+// SetDefaultSNIHost sets the hostname TLS connections whose ClientHello
+// carries no SNI are routed as, e.g. "example.com". Such connections are
+// then terminated or passed through like any other connection to that host,
+// taking precedence over the missing-SNI policy. Malformed ClientHellos are
+// still handled by the policy. An empty host disables the default.
+func (s *Server) SetDefaultSNIHost(host string) error {
+	if host == "" {
+		s.defaultSNIHost = ""
+		return nil
+	}
+	if !isValidHostname(host) {
+		return fmt.Errorf("invalid default SNI host %q", host)
+	}
+	s.defaultSNIHost = normalizeHost(host)
+	return nil
+}
@@ -1,9 +1,10 @@
 package proxy
 
 import (
+	"bytes"
 	"crypto/ed25519"
 	"crypto/rand"
-	"fmt"
+	"errors"
 	"io"
 	"log/slog"
 	"net"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"eddisonso.com/edd-gateway/internal/k8s"
+	"eddisonso.com/edd-gateway/internal/metrics"
+	"eddisonso.com/edd-gateway/internal/router"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -39,11 +42,130 @@ func getHostKey() ssh.Signer {
 	return hostKey
 }
 
+// DefaultSSHBurst is how many SSH connections a source IP may open at once
+// before -ssh-rate applies.
+const DefaultSSHBurst = 10
+
+// SetSSHRateLimit limits each client IP to rate SSH connections per second
+// with bursts of up to burst, checked before the handshake. A non-positive
+// rate disables the limit.
+func (s *Server) SetSSHRateLimit(rate float64, burst int) {
+	if rate <= 0 {
+		s.sshLimiter.Store(nil)
+		return
+	}
+	s.sshLimiter.Store(newIPRateLimiter(rate, burst))
+}
+
+// sshEvictLoop periodically drops idle buckets from the current SSH rate
+// limiter until done is closed.
+func (s *Server) sshEvictLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if l := s.sshLimiter.Load(); l != nil {
+				l.evictIdle(now)
+			}
+		}
+	}
+}
+
+// SSHThrottledCount returns the total number of SSH connections rejected by
+// the per-IP rate limit.
+func (s *Server) SSHThrottledCount() uint64 {
+	l := s.sshLimiter.Load()
+	if l == nil {
+		return 0
+	}
+	return l.denied.Load()
+}
+
+// throttleSSH closes conn if its source IP is over the SSH rate limit.
+func (s *Server) throttleSSH(conn net.Conn) bool {
+	l := s.sshLimiter.Load()
+	if l == nil {
+		return false
+	}
+	ip := clientIP(conn.RemoteAddr().String())
+	ok, first := l.allow(ip, time.Now())
+	if ok {
+		return false
+	}
+	if first {
+		slog.Warn("throttling SSH connections from source", "client", ip)
+	} else {
+		slog.Debug("SSH connection throttled", "client", ip)
+	}
+	conn.Close()
+	return true
+}
+
+var errKeyNotAuthorized = errors.New("public key not authorized for container")
+
+// parseSSHUser extracts the target user and container ID from an SSH username.
+// Supports formats:
+//   - "containerid" -> user=root, container=containerid
+//   - "user.containerid" -> user=user, container=containerid
+func parseSSHUser(username string) (targetUser, containerID string) {
+	if idx := strings.LastIndex(username, "."); idx != -1 {
+		return username[:idx], username[idx+1:]
+	}
+	return "root", username
+}
+
+// containerKeys returns the authorized keys of a container and whether
+// they could be determined. Unknown containers have none and are left to
+// fail resolution after the handshake; any other lookup error must refuse
+// the login rather than skip the key check.
+func (s *Server) containerKeys(containerID string) ([]ssh.PublicKey, bool) {
+	keys, err := s.router.AuthorizedKeys(containerID)
+	if err != nil && !errors.Is(err, router.ErrNotFound) {
+		slog.Warn("cannot determine SSH keys for container, refusing login", "container", containerID, "error", err)
+		return nil, false
+	}
+	return keys, true
+}
+
+// requiresKey reports whether a container has authorized keys registered,
+// which rules out password and keyboard-interactive authentication. It
+// also reports true when the keys cannot be determined.
+func (s *Server) requiresKey(containerID string) bool {
+	keys, ok := s.containerKeys(containerID)
+	return !ok || len(keys) > 0
+}
+
+// keyAuthorized reports whether pubKey may connect to a container.
+func (s *Server) keyAuthorized(containerID string, pubKey ssh.PublicKey) bool {
+	keys, ok := s.containerKeys(containerID)
+	if !ok {
+		return false
+	}
+	if len(keys) == 0 {
+		return true
+	}
+	presented := pubKey.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), presented) {
+			return true
+		}
+	}
+	return false
+}
 
 // handleSSH handles SSH connections by extracting the username (container ID)
 // and proxying to the appropriate container.
 func (s *Server) handleSSH(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
+	metrics.ConnectionsTotal.WithLabelValues(ProtocolSSH).Inc()
+
+	if s.throttleSSH(conn) {
+		return
+	}
 
 	// Get or generate host key
 	hostSigner := getHostKey()
@@ -65,7 +187,13 @@ func (s *Server) handleSSH(conn net.Conn) {
 	config := &ssh.ServerConfig{
 		NoClientAuth: false,
 		PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
-			// Accept any public key - we verify the user owns the container
+			// Containers with registered keys only accept those; others
+			// accept any key and rely on container resolution below
+			_, containerID := parseSSHUser(c.User())
+			if !s.keyAuthorized(containerID, pubKey) {
+				slog.Warn("SSH key not authorized for container", "container", containerID, "fingerprint", ssh.FingerprintSHA256(pubKey), "client", clientAddr)
+				return nil, errKeyNotAuthorized
+			}
 			return &ssh.Permissions{
 				Extensions: map[string]string{
 					"pubkey-fp": ssh.FingerprintSHA256(pubKey),
@@ -73,50 +201,71 @@ func (s *Server) handleSSH(conn net.Conn) {
 			}, nil
 		},
 		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			_, containerID := parseSSHUser(c.User())
+			if s.requiresKey(containerID) {
+				return nil, errKeyNotAuthorized
+			}
 			return &ssh.Permissions{}, nil
 		},
 		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			_, containerID := parseSSHUser(c.User())
+			if s.requiresKey(containerID) {
+				return nil, errKeyNotAuthorized
+			}
 			return &ssh.Permissions{}, nil
 		},
 	}
 	config.AddHostKey(hostSigner)
 
 	// Perform SSH handshake with client
+	s.setFirstReadDeadline(conn, ProtocolSSH)
 	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
 	if err != nil {
 		slog.Debug("SSH handshake failed", "error", err, "client", clientAddr)
 		return
 	}
 	defer sshConn.Close()
+	conn.SetReadDeadline(time.Time{})
 
-	// Extract container ID and target user from username
-	// Supports formats:
-	//   - "containerid" -> user=root, container=containerid
-	//   - "user.containerid" -> user=user, container=containerid
-	username := sshConn.User()
-	targetUser := "root"
-	containerID := username
+	targetUser, containerID := parseSSHUser(sshConn.User())
 
-	if idx := strings.LastIndex(username, "."); idx != -1 {
-		targetUser = username[:idx]
-		containerID = username[idx+1:]
+	session := router.SSHSession{
+		Client:      clientIP(clientAddr),
+		ContainerID: containerID,
+		User:        targetUser,
+		Result:      sshResultOK,
+		Start:       time.Now(),
+	}
+	if sshConn.Permissions != nil {
+		session.Fingerprint = sshConn.Permissions.Extensions["pubkey-fp"]
 	}
+	var sessionBytes sshSessionBytes
+	defer func() {
+		session.End = time.Now()
+		session.BytesUp = sessionBytes.up.Load()
+		session.BytesDown = sessionBytes.down.Load()
+		s.auditSSHSession(session)
+	}()
 
 	slog.Info("SSH connection", "container", containerID, "user", targetUser, "client", clientAddr)
 
 	// Resolve container (checks SSH access is enabled)
 	container, err := s.router.ResolveSSH(containerID)
-	if err != nil {
+	if !routable(err, containerID) {
 		slog.Warn("container not found or SSH blocked", "container", containerID, "error", err)
+		session.Result = sshResultUnavailable
 		return
 	}
 
 	// Connect to backend container using Kubernetes service DNS
 	// Use internal service name instead of external IP for in-cluster routing
-	backendAddr := fmt.Sprintf("lb.%s.svc.cluster.local:22", container.Namespace)
-	backendConn, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
+	backendAddr := serviceAddr(container.Namespace, 22)
+	start := time.Now()
+	backendConn, err := net.DialTimeout("tcp", backendAddr, s.dialTimeout)
+	s.observeDial(ProtocolSSH, backendAddr, nil, start, err)
 	if err != nil {
 		slog.Error("failed to connect to backend", "container", containerID, "addr", backendAddr, "error", err)
+		session.Result = sshResultBackendUnreachable
 		return
 	}
 
@@ -135,6 +284,7 @@ func (s *Server) handleSSH(conn net.Conn) {
 	if err != nil {
 		slog.Error("failed SSH auth to backend", "container", containerID, "error", err)
 		backendConn.Close()
+		session.Result = sshResultBackendAuth
 		return
 	}
 	defer backendSSH.Close()
@@ -163,8 +313,8 @@ func (s *Server) handleSSH(conn net.Conn) {
 	}()
 
 	// Proxy channels between client and backend
-	go proxyChannels(chans, backendSSH, sshConn, "client->backend")
-	go proxyChannels(backendChans, sshConn, backendSSH, "backend->client")
+	go proxyChannels(chans, backendSSH, sshConn, "client->backend", &sessionBytes)
+	go proxyChannels(backendChans, sshConn, backendSSH, "backend->client", &sessionBytes)
 
 	// Wait for either connection to close
 	<-done
@@ -175,14 +325,23 @@ func (s *Server) handleSSH(conn net.Conn) {
 
 // proxyChannels forwards SSH channels from source to destination.
 // Returns when all channels are processed.
-func proxyChannels(chans <-chan ssh.NewChannel, dst ssh.Conn, src ssh.Conn, direction string) {
+func proxyChannels(chans <-chan ssh.NewChannel, dst ssh.Conn, src ssh.Conn, direction string, stats *sshSessionBytes) {
 	for newChan := range chans {
-		handleChannel(newChan, dst, src, direction)
+		handleChannel(newChan, dst, src, direction, stats)
+	}
+}
+
+// channelDirection maps a channel copy to a proxy byte direction. Channels
+// opened by the client copy src->dst upstream; reverse copies go the other way.
+func channelDirection(direction string, reverse bool) string {
+	if (direction == "client->backend") != reverse {
+		return metrics.DirectionUpstream
 	}
+	return metrics.DirectionDownstream
 }
 
 // handleChannel proxies a single SSH channel and closes connections when done.
-func handleChannel(newChan ssh.NewChannel, dst ssh.Conn, src ssh.Conn, direction string) {
+func handleChannel(newChan ssh.NewChannel, dst ssh.Conn, src ssh.Conn, direction string, stats *sshSessionBytes) {
 	chanType := newChan.ChannelType()
 	extraData := newChan.ExtraData()
 
@@ -220,13 +379,13 @@ func handleChannel(newChan ssh.NewChannel, dst ssh.Conn, src ssh.Conn, direction
 	// Proxy data bidirectionally - don't close on copy completion
 	// For exec commands, client stdin may be empty but we need to wait for response
 	go func() {
-		io.Copy(dstChan, srcChan)
+		io.Copy(stats.writer(dstChan, direction, false), srcChan)
 		slog.Debug("client->backend copy done")
 		// Don't close here - wait for exit-status
 	}()
 
 	go func() {
-		io.Copy(srcChan, dstChan)
+		io.Copy(stats.writer(srcChan, direction, true), dstChan)
 		slog.Debug("backend->client copy done")
 		// Don't close here - wait for exit-status
 	}()
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+func TestSetSSHRateLimitReusesEvictLoop(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	defer close(s.done)
+
+	before := runtime.NumGoroutine()
+	for range 100 {
+		s.SetSSHRateLimit(5, 10)
+	}
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("goroutines grew from %d to %d after 100 SetSSHRateLimit calls", before, after)
+	}
+}
+
+func TestSetSSHRateLimitWhileThrottling(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	defer close(s.done)
+	s.SetSSHRateLimit(1, 1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			client, server := net.Pipe()
+			s.throttleSSH(server)
+			client.Close()
+			server.Close()
+		}
+	}()
+	for i := range 100 {
+		s.SetSSHRateLimit(float64(i%3), 1)
+	}
+	wg.Wait()
+	s.SSHThrottledCount()
+}
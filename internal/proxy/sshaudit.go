@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// SSHAuditSinks selects where SSH session audit records are written.
+type SSHAuditSinks int
+
+const (
+	SSHAuditLog SSHAuditSinks = 1 << iota // structured log record with event=ssh_audit
+	SSHAuditDB                            // row in the ssh_audit table
+)
+
+// SSH session audit results.
+const (
+	sshResultOK                 = "ok"
+	sshResultUnavailable        = "container_unavailable"
+	sshResultBackendUnreachable = "backend_unreachable"
+	sshResultBackendAuth        = "backend_auth_failed"
+)
+
+// sshAuditTimeout bounds writing one audit record to the database.
+const sshAuditTimeout = 5 * time.Second
+
+// ParseSSHAuditSinks parses a comma-separated list of audit sinks: "log",
+// "db", or "none" to disable auditing.
+func ParseSSHAuditSinks(s string) (SSHAuditSinks, error) {
+	var sinks SSHAuditSinks
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "log":
+			sinks |= SSHAuditLog
+		case "db":
+			sinks |= SSHAuditDB
+		case "none", "":
+		default:
+			return 0, fmt.Errorf("unknown SSH audit sink %q (want log, db or none)", name)
+		}
+	}
+	return sinks, nil
+}
+
+// SetSSHAudit sets where SSH session audit records are written. Zero
+// disables auditing.
+func (s *Server) SetSSHAudit(sinks SSHAuditSinks) {
+	s.sshAudit = sinks
+}
+
+// auditSSHSession writes the audit record of a finished SSH session to the
+// configured sinks.
+func (s *Server) auditSSHSession(session router.SSHSession) {
+	if s.sshAudit&SSHAuditLog != 0 {
+		slog.Info("SSH session audit",
+			"event", "ssh_audit",
+			"client", session.Client,
+			"fingerprint", session.Fingerprint,
+			"container", session.ContainerID,
+			"user", session.User,
+			"result", session.Result,
+			"start", session.Start,
+			"end", session.End,
+			"duration", session.End.Sub(session.Start),
+			"bytes_up", session.BytesUp,
+			"bytes_down", session.BytesDown)
+	}
+	if s.sshAudit&SSHAuditDB != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), sshAuditTimeout)
+		defer cancel()
+		if err := s.router.RecordSSHSession(ctx, session); err != nil {
+			slog.Error("failed to record SSH audit", "container", session.ContainerID, "client", session.Client, "error", err)
+		}
+	}
+}
+
+// sshSessionBytes counts the channel data relayed for one SSH session.
+type sshSessionBytes struct {
+	up, down atomic.Int64
+}
+
+// writer wraps w to count bytes copied in the given channel direction and
+// report them to the proxy byte metrics.
+func (b *sshSessionBytes) writer(w io.Writer, direction string, reverse bool) io.Writer {
+	dir := channelDirection(direction, reverse)
+	n := &b.down
+	if dir == metrics.DirectionUpstream {
+		n = &b.up
+	}
+	return &countingWriter{w: w, n: n, direction: dir}
+}
+
+// countingWriter adds every successful write to n as it happens, so totals
+// are current even while a copy is still running.
+type countingWriter struct {
+	w         io.Writer
+	n         *atomic.Int64
+	direction string
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	metrics.AddProxyBytes(c.direction, int64(n))
+	return n, err
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// Protocol names used for per-protocol first-read timeouts.
+const (
+	ProtocolSSH   = "ssh"
+	ProtocolHTTP  = "http"
+	ProtocolTLS   = "tls"
+	ProtocolMulti = "multi" // protocol detection on multi-protocol ports
+)
+
+// defaultFirstReadTimeouts bound how long a new connection may take to send
+// its first protocol message. SSH clients can be slow to send their version
+// string and multi-protocol ports may carry SSH, so both are lenient.
+var defaultFirstReadTimeouts = map[string]time.Duration{
+	ProtocolSSH:   30 * time.Second,
+	ProtocolHTTP:  10 * time.Second,
+	ProtocolTLS:   10 * time.Second,
+	ProtocolMulti: 30 * time.Second,
+}
+
+// SetFirstReadTimeout sets how long a new connection of the given protocol may
+// take to send its first message (SSH handshake, first HTTP request header,
+// TLS ClientHello, or protocol detection bytes). Zero disables the timeout.
+func (s *Server) SetFirstReadTimeout(protocol string, d time.Duration) {
+	s.firstReadTimeouts[protocol] = d
+}
+
+// SetPortFirstReadTimeout overrides the first-read timeout for every
+// protocol on a listener port. Zero disables the timeout on that port.
+func (s *Server) SetPortFirstReadTimeout(port int, d time.Duration) {
+	s.portFirstReadTimeouts[port] = d
+}
+
+// firstReadTimeout returns the first-read timeout for conn, preferring a
+// per-port override of its local port over the protocol default.
+func (s *Server) firstReadTimeout(conn net.Conn, protocol string) time.Duration {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		if d, ok := s.portFirstReadTimeouts[addr.Port]; ok {
+			return d
+		}
+	}
+	return s.firstReadTimeouts[protocol]
+}
+
+// setFirstReadDeadline applies the first-read timeout for protocol to conn.
+func (s *Server) setFirstReadDeadline(conn net.Conn, protocol string) {
+	if d := s.firstReadTimeout(conn, protocol); d > 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
+	}
+}
+
+// ParseFirstReadTimeouts parses a comma-separated list of key=duration
+// entries where each key is a protocol name (ssh, http, tls, multi) or a
+// port number: "http=5s,ssh=60s,8022=60s".
+func ParseFirstReadTimeouts(s string) (map[string]time.Duration, map[int]time.Duration, error) {
+	protocols := make(map[string]time.Duration)
+	ports := make(map[int]time.Duration)
+	if strings.TrimSpace(s) == "" {
+		return protocols, ports, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid first-read timeout %q: want key=duration", entry)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, nil, fmt.Errorf("invalid duration %q for %s", value, key)
+		}
+
+		if port, err := strconv.Atoi(key); err == nil {
+			if port < 1 || port > 65535 {
+				return nil, nil, fmt.Errorf("invalid port %q", key)
+			}
+			ports[port] = d
+			continue
+		}
+
+		switch key = strings.ToLower(key); key {
+		case ProtocolSSH, ProtocolHTTP, ProtocolTLS, ProtocolMulti:
+			protocols[key] = d
+		default:
+			return nil, nil, fmt.Errorf("unknown protocol %q: want ssh, http, tls, multi or a port", key)
+		}
+	}
+	return protocols, ports, nil
+}
+
+// DefaultProxyIdleTimeout is how long a proxied HTTP backend connection may
+// go without traffic in either direction before it is closed.
+const DefaultProxyIdleTimeout = 5 * time.Minute
+
+// SetProxyIdleTimeout sets how long an in-use HTTP backend connection may stay
+// silent before it is closed. Routes may override it. Zero disables the timeout.
+func (s *Server) SetProxyIdleTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.proxyIdleTimeout = d
+}
+
+// routeIdleTimeout returns the idle timeout for route, which may be nil.
+func (s *Server) routeIdleTimeout(route *router.StaticRoute) time.Duration {
+	if route != nil && route.IdleTimeout > 0 {
+		return route.IdleTimeout
+	}
+	return s.proxyIdleTimeout
+}
+
+// idleConn pushes its deadline forward on every read and write, so the
+// connection fails only after a full timeout without traffic.
+type idleConn struct {
+	net.Conn
+	timeout atomic.Int64 // time.Duration; 0 means no deadline
+	limit   atomic.Int64 // unix nanoseconds the deadline may not pass; 0 means none
+}
+
+// setTimeout changes the idle timeout, clearing the deadline when d is zero.
+func (c *idleConn) setTimeout(d time.Duration) {
+	c.timeout.Store(int64(d))
+	c.applyDeadline()
+}
+
+// setLimit caps the deadline at t however recent the traffic, e.g. for a
+// request that must get its response by then. A zero t removes the cap.
+func (c *idleConn) setLimit(t time.Time) {
+	var limit int64
+	if !t.IsZero() {
+		limit = t.UnixNano()
+	}
+	c.limit.Store(limit)
+	c.applyDeadline()
+}
+
+// applyDeadline sets the deadline from the idle timeout and limit.
+func (c *idleConn) applyDeadline() {
+	var deadline time.Time
+	if d := time.Duration(c.timeout.Load()); d > 0 {
+		deadline = time.Now().Add(d)
+	}
+	if limit := c.limit.Load(); limit != 0 && (deadline.IsZero() || deadline.UnixNano() > limit) {
+		deadline = time.Unix(0, limit)
+	}
+	c.Conn.SetDeadline(deadline)
+}
+
+func (c *idleConn) refresh() {
+	if c.timeout.Load() > 0 || c.limit.Load() != 0 {
+		c.applyDeadline()
+	}
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.refresh()
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.refresh()
+	return c.Conn.Write(b)
+}
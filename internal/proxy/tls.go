@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/tls"
 	"errors"
@@ -10,46 +9,28 @@ import (
 	"net"
 	"strings"
 	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
 )
 
 // handleTLS handles TLS connections by extracting SNI (Server Name Indication)
 // from the ClientHello and routing to the appropriate backend.
-// If TLS termination is configured, terminates TLS and uses static routes for HTTP.
+// If TLS termination is configured, terminates TLS and uses static routes for HTTP,
+// unless the client prefers an ALPN protocol set for passthrough.
 // Otherwise, passes through to backend (container or fallback).
 func (s *Server) handleTLS(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
+	metrics.ConnectionsTotal.WithLabelValues(ProtocolTLS).Inc()
 
 	// Read ClientHello to extract SNI
-	header := make([]byte, 5)
-	if _, err := readFull(conn, header); err != nil {
-		slog.Debug("failed to read TLS header", "error", err, "client", clientAddr)
-		conn.Close()
-		return
-	}
-
-	if header[0] != 0x16 {
-		slog.Warn("not a TLS handshake", "type", header[0], "client", clientAddr)
-		conn.Close()
-		return
-	}
-
-	length := int(header[3])<<8 | int(header[4])
-	if length > 16384 {
-		slog.Warn("TLS record too large", "length", length, "client", clientAddr)
-		conn.Close()
-		return
-	}
-
-	payload := make([]byte, length)
-	if _, err := readFull(conn, payload); err != nil {
-		slog.Debug("failed to read TLS payload", "error", err, "client", clientAddr)
-		conn.Close()
-		return
-	}
-
-	sni, err := extractSNI(payload)
+	s.setFirstReadDeadline(conn, ProtocolTLS)
+	records, hello, err := readClientHello(conn)
 	if err != nil {
-		slog.Debug("failed to extract SNI", "error", err, "client", clientAddr)
+		if errors.Is(err, errBadClientHello) {
+			slog.Warn("invalid TLS ClientHello", "error", err, "client", clientAddr)
+		} else {
+			slog.Debug("failed to read TLS ClientHello", "error", err, "client", clientAddr)
+		}
 		conn.Close()
 		return
 	}
@@ -62,29 +43,58 @@ func (s *Server) handleTLS(conn net.Conn) {
 		ingressPort = 443
 	}
 
-	slog.Info("TLS connection", "sni", sni, "port", ingressPort, "client", clientAddr)
+	info, err := parseClientHello(hello)
+	sni := info.sni
+	switch {
+	case err == nil && sni != "":
+	case err == nil && s.defaultSNIHost != "":
+		slog.Info("TLS ClientHello without SNI, using default host", "host", s.defaultSNIHost, "client", clientAddr)
+		sni = s.defaultSNIHost
+	default:
+		backendAddr, ok := s.missingSNITarget(ingressPort)
+		if !ok {
+			if err == nil {
+				slog.Debug("TLS ClientHello without SNI, closing", "policy", s.missingSNI, "client", clientAddr)
+			} else {
+				slog.Warn("malformed TLS ClientHello, closing", "error", err, "client", clientAddr)
+			}
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		slog.Info("TLS passthrough without SNI", "error", err, "policy", s.missingSNI, "target", backendAddr, "client", clientAddr)
+		s.passthroughTLS(conn, "", backendAddr, "", records)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	slog.Info("TLS connection", "sni", sni, "alpn", info.alpn, "port", ingressPort, "client", clientAddr)
 
 	// Check if we should terminate TLS (have cert + have static routes for this host)
 	if s.tlsConfig != nil && !strings.Contains(sni, ".compute.") {
 		// Check if we have static routes for this hostname
-		if _, _, err := s.router.ResolveStaticRoute(sni, "/"); err == nil {
-			// Terminate TLS and handle as HTTP
-			s.handleTLSTermination(conn, header, payload, sni, clientAddr)
-			return
+		if s.router.HasStaticRoute(sni) {
+			if s.terminateALPN(sni, info.alpn) {
+				// Terminate TLS and handle as HTTP
+				s.handleTLSTermination(conn, records, sni, clientAddr)
+				return
+			}
+			slog.Info("TLS passthrough for ALPN", "sni", sni, "alpn", info.alpn[0])
 		}
 	}
 
 	// TLS passthrough for containers or fallback
-	var backendAddr string
+	var backendAddr, proxyProtocol string
 
 	if strings.Contains(sni, ".compute.") {
 		container, targetPort, err := s.router.ResolveHTTP(sni, ingressPort)
-		if err != nil {
+		if !routable(err, sni) {
 			slog.Warn("no ingress rule for port", "sni", sni, "port", ingressPort, "error", err)
 			conn.Close()
 			return
 		}
-		backendAddr = fmt.Sprintf("lb.%s.svc.cluster.local:%d", container.Namespace, targetPort)
+		backendAddr = serviceAddr(container.Namespace, targetPort)
+		proxyProtocol = s.passthroughProxyProtocol
 		slog.Info("TLS passthrough to container", "sni", sni, "port", ingressPort, "target", targetPort)
 	} else {
 		if s.fallbackAddr == "" {
@@ -93,35 +103,68 @@ func (s *Server) handleTLS(conn net.Conn) {
 			return
 		}
 		slog.Debug("TLS passthrough to fallback", "sni", sni, "fallback", s.fallbackAddr)
-		backendAddr = fmt.Sprintf("%s:%d", s.fallbackAddr, ingressPort)
+		backendAddr = hostPort(s.fallbackAddr, ingressPort)
 	}
 
-	backend, err := net.DialTimeout("tcp", backendAddr, 5*time.Second)
+	s.passthroughTLS(conn, sni, backendAddr, proxyProtocol, records)
+}
+
+// passthroughTLS dials backendAddr and relays the connection without
+// terminating TLS, replaying the already-read ClientHello records first.
+// With a proxyProtocol version the ClientHello is preceded by a PROXY header
+// carrying the client's address.
+func (s *Server) passthroughTLS(conn net.Conn, sni, backendAddr, proxyProtocol string, records []byte) {
+	// The handshake is not ours to answer, so an over-limit connection can
+	// only be closed
+	if !s.hostLimits.acquire(sni) {
+		slog.Warn("host connection limit reached", "sni", sni, "client", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+	defer s.hostLimits.release(sni)
+
+	start := time.Now()
+	backend, err := net.DialTimeout("tcp", backendAddr, s.dialTimeout)
+	s.observeDial(ProtocolTLS, backendAddr, nil, start, err)
 	if err != nil {
 		slog.Error("failed to connect to backend", "sni", sni, "addr", backendAddr, "error", err)
 		conn.Close()
 		return
 	}
 
-	initialData := append(header, payload...)
-	proxy(conn, backend, initialData)
+	var initialData []byte
+	if proxyProtocol != "" {
+		initialData = proxyProtocolHeader(proxyProtocol, conn.RemoteAddr(), conn.LocalAddr())
+	}
+	initialData = append(initialData, records...)
+	s.proxy(conn, backend, initialData)
 }
 
 // handleTLSTermination terminates TLS and handles the decrypted HTTP traffic.
-func (s *Server) handleTLSTermination(rawConn net.Conn, header, payload []byte, sni, clientAddr string) {
+// records are the ClientHello records already read from rawConn.
+func (s *Server) handleTLSTermination(rawConn net.Conn, records []byte, sni, clientAddr string) {
 	// Create a connection that replays the already-read ClientHello
 	replayConn := &replayConn{
 		Conn:   rawConn,
-		replay: append(header, payload...),
+		replay: records,
+	}
+
+	cfg, err := s.terminationConfig(sni)
+	if err != nil {
+		slog.Error("failed to load client CA bundle", "sni", sni, "error", err)
+		rawConn.Close()
+		return
 	}
 
 	// Wrap with TLS server
-	tlsConn := tls.Server(replayConn, s.tlsConfig)
+	tlsConn := tls.Server(replayConn, cfg)
+	s.setFirstReadDeadline(rawConn, ProtocolTLS)
 	if err := tlsConn.Handshake(); err != nil {
 		slog.Warn("TLS handshake failed", "sni", sni, "error", err, "client", clientAddr)
 		rawConn.Close()
 		return
 	}
+	rawConn.SetReadDeadline(time.Time{})
 
 	slog.Info("TLS terminated", "sni", sni, "client", clientAddr)
 
@@ -131,69 +174,45 @@ func (s *Server) handleTLSTermination(rawConn net.Conn, header, payload []byte,
 
 // handleTerminatedHTTP handles HTTP traffic after TLS termination.
 func (s *Server) handleTerminatedHTTP(conn net.Conn, sni string) {
-	clientAddr := conn.RemoteAddr().String()
-	reader := bufio.NewReader(conn)
-
-	var headerBuf bytes.Buffer
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			slog.Debug("failed to read HTTP header after TLS termination", "error", err, "client", clientAddr)
-			conn.Close()
-			return
-		}
-		headerBuf.WriteString(line)
+	s.serveHTTP(conn, sni)
+}
 
-		if line == "\r\n" || line == "\n" {
-			break
-		}
-		if headerBuf.Len() > 16384 {
-			slog.Warn("HTTP headers too large", "client", clientAddr)
-			conn.Write([]byte("HTTP/1.1 431 Request Header Fields Too Large\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\n"))
-			conn.Close()
-			return
-		}
-	}
+// resolveTerminatedRoute picks the static route backend for a request received
+// over a TLS-terminated connection. On failure it writes an error response and returns false.
+func (s *Server) resolveTerminatedRoute(conn net.Conn, req *httpRequest) (*httpTarget, bool) {
+	clientAddr := conn.RemoteAddr().String()
+	sni := req.host
+	path := req.path
 
 	// Extract method and path for detailed logging
-	requestLine := extractRequestLine(headerBuf.String())
-	path := extractRequestPath(headerBuf.String())
-	slog.Info("HTTP after TLS termination", "host", sni, "path", path, "request_line", requestLine, "client", clientAddr)
+	requestLine := extractRequestLine(string(req.header))
+	req.logger().Info("HTTP after TLS termination", "host", sni, "path", path, "request_line", requestLine, "client", clientAddr)
+	if s.serveMaintenance(conn, req) {
+		return nil, false
+	}
 
 	// Use static routes for routing
-	route, targetPath, err := s.router.ResolveStaticRoute(sni, path)
+	route, targetPath, err := s.router.ResolveStaticRoute(sni, path, req)
 	if err != nil {
-		slog.Warn("no static route found", "host", sni, "path", path, "error", err)
-		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\nNo backend available\r\n"))
-		conn.Close()
-		return
+		req.logger().Warn("no static route found", "host", sni, "path", path, "error", err)
+		s.writeBadGateway(conn, req, "No backend available", "", errCategoryNoRoute)
+		return nil, false
 	}
 
-	slog.Info("routing via static route", "host", sni, "path", path, "target", route.Target, "targetPath", targetPath, "strip_prefix", route.StripPrefix, "route_path", route.PathPrefix)
-
-	backend, err := net.DialTimeout("tcp", route.Target, 5*time.Second)
-	if err != nil {
-		slog.Error("failed to connect to backend", "host", sni, "target", route.Target, "error", err)
-		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nCache-Control: no-store, no-cache, must-revalidate\r\nPragma: no-cache\r\n\r\nBackend connection failed\r\n"))
-		conn.Close()
-		return
-	}
+	req.logger().Info("routing via static route", "host", sni, "path", path, "target", route.Target, "targetPath", targetPath, "strip_prefix", route.StripPrefix, "route_path", route.PathPrefix)
 
 	// Rewrite path if strip_prefix is enabled
-	headers := headerBuf.Bytes()
+	headers := req.header
 	if route.StripPrefix && path != targetPath {
 		headers = rewriteRequestPath(headers, path, targetPath)
 	}
 
-	// Add X-Forwarded-Proto header for TLS-terminated requests
+	// Add X-Forwarded-Proto header for TLS-terminated requests, replacing
+	// any the client sent
+	headers = removeHeader(headers, "X-Forwarded-Proto")
 	headers = addHeader(headers, "X-Forwarded-Proto", "https")
 
-	// Get buffered data and proxy
-	buffered := make([]byte, reader.Buffered())
-	reader.Read(buffered)
-	initialData := append(headers, buffered...)
-
-	proxy(conn, backend, initialData)
+	return s.staticTarget(conn, req, route, headers)
 }
 
 // replayConn replays buffered data before reading from the underlying connection.
@@ -212,19 +231,85 @@ func (c *replayConn) Read(b []byte) (int, error) {
 	return c.Conn.Read(b)
 }
 
-// extractSNI parses a TLS ClientHello and extracts the SNI hostname.
-func extractSNI(payload []byte) (string, error) {
+// TLS record limits for reading a ClientHello.
+const (
+	tlsRecordHeaderLen = 5
+	maxTLSRecordLen    = 16384
+	// maxClientHelloLen bounds a ClientHello spread over several records;
+	// real ones, even with post-quantum key shares, are a few KiB
+	maxClientHelloLen = 64 << 10
+)
+
+// errBadClientHello marks a connection that does not start with a well-formed
+// TLS handshake, as opposed to one that failed or timed out while sending it.
+var errBadClientHello = errors.New("malformed TLS ClientHello")
+
+// readClientHello reads handshake records from conn until they hold a
+// complete first handshake message, which a large ClientHello may spread
+// over several records. It returns the raw records, to be replayed to
+// whoever completes the handshake, and the reassembled message.
+func readClientHello(conn net.Conn) (records, hello []byte, err error) {
+	header := make([]byte, tlsRecordHeaderLen)
+	for {
+		if _, err := readFull(conn, header); err != nil {
+			return records, hello, err
+		}
+		if header[0] != 0x16 {
+			return records, hello, fmt.Errorf("%w: record type %d, not a handshake", errBadClientHello, header[0])
+		}
+		length := int(header[3])<<8 | int(header[4])
+		if length == 0 || length > maxTLSRecordLen {
+			return records, hello, fmt.Errorf("%w: record length %d", errBadClientHello, length)
+		}
+		records = append(records, header...)
+		start := len(records)
+		records = append(records, make([]byte, length)...)
+		if _, err := readFull(conn, records[start:]); err != nil {
+			return records, hello, err
+		}
+		hello = append(hello, records[start:]...)
+
+		if len(hello) < 4 {
+			continue
+		}
+		need := 4 + (int(hello[1])<<16 | int(hello[2])<<8 | int(hello[3]))
+		if need > maxClientHelloLen {
+			return records, hello, fmt.Errorf("%w: handshake message of %d bytes", errBadClientHello, need)
+		}
+		if len(hello) >= need {
+			return records, hello[:need], nil
+		}
+	}
+}
+
+// clientHello is what routing needs from a TLS ClientHello.
+type clientHello struct {
+	sni  string   // requested hostname, "" when the client sent none
+	alpn []string // ALPN protocols in the client's order of preference
+}
+
+// parseClientHello parses a TLS ClientHello handshake message and extracts
+// the SNI hostname and ALPN protocols. A ClientHello without either
+// extension is not an error. The message comes straight from the client,
+// so every length field is checked against the bytes that remain before
+// anything is sliced, and a message whose lengths disagree is rejected.
+func parseClientHello(payload []byte) (clientHello, error) {
+	var info clientHello
+
 	// Handshake message format:
 	// - 1 byte: handshake type (1 = ClientHello)
 	// - 3 bytes: length
 	// - payload
 
 	if len(payload) < 4 {
-		return "", errors.New("payload too short")
+		return info, errors.New("payload too short")
 	}
 
 	if payload[0] != 0x01 { // ClientHello
-		return "", errors.New("not a ClientHello")
+		return info, errors.New("not a ClientHello")
+	}
+	if msgLen := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3]); msgLen != len(payload)-4 {
+		return info, errors.New("ClientHello length mismatch")
 	}
 
 	// Skip handshake header
@@ -243,7 +328,7 @@ func extractSNI(payload []byte) (string, error) {
 	// - extensions
 
 	if len(payload) < 34 {
-		return "", errors.New("ClientHello too short")
+		return info, errors.New("ClientHello too short")
 	}
 
 	// Skip version and random
@@ -251,68 +336,90 @@ func extractSNI(payload []byte) (string, error) {
 
 	// Skip session ID
 	if len(payload) < 1 {
-		return "", errors.New("missing session ID length")
+		return info, errors.New("missing session ID length")
 	}
 	sessionIDLen := int(payload[0])
 	payload = payload[1:]
 	if len(payload) < sessionIDLen {
-		return "", errors.New("truncated session ID")
+		return info, errors.New("truncated session ID")
 	}
 	payload = payload[sessionIDLen:]
 
 	// Skip cipher suites
 	if len(payload) < 2 {
-		return "", errors.New("missing cipher suites length")
+		return info, errors.New("missing cipher suites length")
 	}
 	cipherLen := int(payload[0])<<8 | int(payload[1])
 	payload = payload[2:]
 	if len(payload) < cipherLen {
-		return "", errors.New("truncated cipher suites")
+		return info, errors.New("truncated cipher suites")
 	}
 	payload = payload[cipherLen:]
 
 	// Skip compression methods
 	if len(payload) < 1 {
-		return "", errors.New("missing compression methods length")
+		return info, errors.New("missing compression methods length")
 	}
 	compLen := int(payload[0])
 	payload = payload[1:]
 	if len(payload) < compLen {
-		return "", errors.New("truncated compression methods")
+		return info, errors.New("truncated compression methods")
 	}
 	payload = payload[compLen:]
 
 	// Parse extensions
+	if len(payload) == 0 {
+		return info, nil
+	}
 	if len(payload) < 2 {
-		return "", errors.New("no extensions")
+		return info, errors.New("missing extensions length")
 	}
 	extLen := int(payload[0])<<8 | int(payload[1])
 	payload = payload[2:]
-	if len(payload) < extLen {
-		return "", errors.New("truncated extensions")
+	if len(payload) != extLen {
+		return info, errors.New("extensions length mismatch")
 	}
 
-	// Look for SNI extension (type 0x0000)
-	for len(payload) >= 4 {
+	var seenSNI, seenALPN bool
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return info, errors.New("truncated extension header")
+		}
 		extType := int(payload[0])<<8 | int(payload[1])
 		extDataLen := int(payload[2])<<8 | int(payload[3])
 		payload = payload[4:]
 
 		if len(payload) < extDataLen {
-			return "", errors.New("truncated extension data")
+			return info, errors.New("truncated extension data")
 		}
 
-		if extType == 0x0000 { // SNI
-			return parseSNIExtension(payload[:extDataLen])
+		var err error
+		switch extType {
+		case 0x0000: // SNI
+			if seenSNI {
+				return info, errors.New("duplicate SNI extension")
+			}
+			seenSNI = true
+			info.sni, err = parseSNIExtension(payload[:extDataLen])
+		case 0x0010: // ALPN
+			if seenALPN {
+				return info, errors.New("duplicate ALPN extension")
+			}
+			seenALPN = true
+			info.alpn, err = parseALPNExtension(payload[:extDataLen])
+		}
+		if err != nil {
+			return info, err
 		}
 
 		payload = payload[extDataLen:]
 	}
 
-	return "", errors.New("no SNI extension found")
+	return info, nil
 }
 
-// parseSNIExtension extracts the hostname from an SNI extension.
+// parseSNIExtension extracts the hostname from an SNI extension, or "" when
+// it lists none.
 func parseSNIExtension(data []byte) (string, error) {
 	// SNI extension format:
 	// - 2 bytes: SNI list length
@@ -328,11 +435,14 @@ func parseSNIExtension(data []byte) (string, error) {
 	listLen := int(data[0])<<8 | int(data[1])
 	data = data[2:]
 
-	if len(data) < listLen {
-		return "", errors.New("truncated SNI list")
+	if len(data) != listLen {
+		return "", errors.New("SNI list length mismatch")
 	}
 
-	for len(data) >= 3 {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return "", errors.New("truncated SNI entry")
+		}
 		nameType := data[0]
 		nameLen := int(data[1])<<8 | int(data[2])
 		data = data[3:]
@@ -347,13 +457,44 @@ func parseSNIExtension(data []byte) (string, error) {
 			if !isValidHostname(hostname) {
 				return "", errors.New("invalid hostname")
 			}
-			return hostname, nil
+			return normalizeHost(hostname), nil
 		}
 
 		data = data[nameLen:]
 	}
 
-	return "", errors.New("no hostname in SNI")
+	return "", nil
+}
+
+// parseALPNExtension extracts the protocol names from an ALPN extension.
+func parseALPNExtension(data []byte) ([]string, error) {
+	// ALPN extension format:
+	// - 2 bytes: protocol list length
+	// - list of protocols:
+	//   - 1 byte: name length
+	//   - name
+
+	if len(data) < 2 {
+		return nil, errors.New("ALPN extension too short")
+	}
+
+	listLen := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) != listLen {
+		return nil, errors.New("malformed ALPN list")
+	}
+
+	var protocols []string
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		data = data[1:]
+		if nameLen == 0 || len(data) < nameLen {
+			return nil, errors.New("malformed ALPN protocol name")
+		}
+		protocols = append(protocols, string(data[:nameLen]))
+		data = data[nameLen:]
+	}
+	return protocols, nil
 }
 
 // isValidHostname checks if a hostname is valid.
@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// recordClientHello returns the records and the reassembled handshake
+// message of the ClientHello crypto/tls sends for cfg.
+func recordClientHello(t testing.TB, cfg *tls.Config) (records, hello []byte) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go tls.Client(client, cfg).Handshake()
+
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	records, hello, err := readClientHello(server)
+	if err != nil {
+		t.Fatalf("reading ClientHello: %v", err)
+	}
+	return records, hello
+}
+
+func TestParseClientHelloALPN(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		alpn       []string
+		wantSNI    string
+	}{
+		{"h2 first", "app.example", []string{"h2", "http/1.1"}, "app.example"},
+		{"http/1.1 only", "app.example", []string{"http/1.1"}, "app.example"},
+		{"no alpn", "App.Example", nil, "app.example"},
+		{"alpn without sni", "", []string{"h2"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, hello := recordClientHello(t, &tls.Config{ServerName: tt.serverName, NextProtos: tt.alpn, InsecureSkipVerify: true})
+			info, err := parseClientHello(hello)
+			if err != nil {
+				t.Fatalf("parseClientHello() error = %v", err)
+			}
+			if info.sni != tt.wantSNI {
+				t.Errorf("sni = %q, want %q", info.sni, tt.wantSNI)
+			}
+			if !slices.Equal(info.alpn, tt.alpn) {
+				t.Errorf("alpn = %q, want %q", info.alpn, tt.alpn)
+			}
+		})
+	}
+}
+
+func TestTerminateALPN(t *testing.T) {
+	s := NewServer(router.NewStatic([]router.StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "a:80"},
+		{Host: "mtls.example", PathPrefix: "/", Target: "b:80", ClientCAFile: "/etc/ca.pem"},
+		{Host: "auth.example", PathPrefix: "/admin", Target: "c:80", BasicAuthUser: "admin"},
+		{Host: "auth.example", PathPrefix: "/", Target: "c:80"},
+	}), "")
+	s.SetPassthroughALPN([]string{"h2"})
+
+	tests := []struct {
+		host string
+		alpn []string
+		want bool
+	}{
+		{"app.example", nil, true},
+		{"app.example", []string{"http/1.1", "h2"}, true},
+		{"app.example", []string{"h2", "http/1.1"}, false},
+		// Client authentication only happens on terminated connections
+		{"mtls.example", []string{"h2"}, true},
+		{"auth.example", []string{"h2"}, true},
+	}
+	for _, tt := range tests {
+		if got := s.terminateALPN(tt.host, tt.alpn); got != tt.want {
+			t.Errorf("terminateALPN(%q, %q) = %v, want %v", tt.host, tt.alpn, got, tt.want)
+		}
+	}
+}
+
+// FuzzExtractSNI feeds arbitrary handshake messages to the ClientHello
+// parser, which sees them straight from the network, and checks it never
+// panics and never returns an SNI it would refuse as a hostname.
+func FuzzExtractSNI(f *testing.F) {
+	for _, cfg := range []*tls.Config{
+		{ServerName: "app.example"},
+		{ServerName: "app.example", NextProtos: []string{"h2", "http/1.1"}},
+		{NextProtos: []string{"http/1.1"}},
+		{ServerName: "a.very.long.subdomain.of.app.example", MaxVersion: tls.VersionTLS12},
+	} {
+		cfg.InsecureSkipVerify = true
+		_, hello := recordClientHello(f, cfg)
+		f.Add(hello)
+		f.Add(hello[:len(hello)/2])
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0x01, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, hello []byte) {
+		info, err := parseClientHello(hello)
+		if err == nil && info.sni != "" && !isValidHostname(info.sni) {
+			t.Errorf("parseClientHello() accepted SNI %q", info.sni)
+		}
+	})
+}
+
+// splitRecords wraps the handshake message hello in TLS handshake records
+// carrying at most size bytes each.
+func splitRecords(hello []byte, size int) []byte {
+	var records []byte
+	for len(hello) > 0 {
+		n := min(size, len(hello))
+		records = append(records, 0x16, 0x03, 0x01, byte(n>>8), byte(n))
+		records = append(records, hello[:n]...)
+		hello = hello[n:]
+	}
+	return records
+}
+
+// readRecords runs readClientHello on a connection that delivers raw.
+func readRecords(t *testing.T, raw []byte) (records, hello []byte, err error) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go client.Write(raw)
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	return readClientHello(server)
+}
+
+func TestReadClientHelloFragmented(t *testing.T) {
+	_, hello := recordClientHello(t, &tls.Config{ServerName: "app.example", NextProtos: []string{"h2"}, InsecureSkipVerify: true})
+
+	for name, size := range map[string]int{
+		"one record":  len(hello),
+		"two records": len(hello)/2 + 1,
+		"one byte":    1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := splitRecords(hello, size)
+			records, got, err := readRecords(t, raw)
+			if err != nil {
+				t.Fatalf("readClientHello() error = %v", err)
+			}
+			if !bytes.Equal(got, hello) {
+				t.Error("reassembled ClientHello differs from the one sent")
+			}
+			// Everything consumed must be replayed to whoever completes the
+			// handshake
+			if !bytes.Equal(records, raw) {
+				t.Errorf("returned %d bytes of records, want all %d read", len(records), len(raw))
+			}
+			info, err := parseClientHello(got)
+			if err != nil || info.sni != "app.example" {
+				t.Errorf("parseClientHello() = %q, %v; want app.example", info.sni, err)
+			}
+		})
+	}
+}
+
+func TestReadClientHelloLimits(t *testing.T) {
+	// A handshake header claiming one byte more than the cap is refused
+	// before the body is read
+	over := maxClientHelloLen - 4 + 1
+	_, _, err := readRecords(t, splitRecords([]byte{0x01, byte(over >> 16), byte(over >> 8), byte(over)}, 4))
+	if !errors.Is(err, errBadClientHello) {
+		t.Errorf("oversized ClientHello: error = %v, want %v", err, errBadClientHello)
+	}
+
+	// One exactly at the cap spread over full records is accepted
+	atCap := make([]byte, maxClientHelloLen)
+	atCap[0] = 0x01
+	n := maxClientHelloLen - 4
+	atCap[1], atCap[2], atCap[3] = byte(n>>16), byte(n>>8), byte(n)
+	if _, got, err := readRecords(t, splitRecords(atCap, maxTLSRecordLen)); err != nil || len(got) != maxClientHelloLen {
+		t.Errorf("ClientHello at the cap: read %d bytes, error = %v", len(got), err)
+	}
+
+	for name, raw := range map[string][]byte{
+		"not a handshake":  {0x17, 0x03, 0x01, 0x00, 0x01, 0x01},
+		"empty record":     {0x16, 0x03, 0x01, 0x00, 0x00},
+		"oversized record": {0x16, 0x03, 0x01, 0x40, 0x01},
+	} {
+		if _, _, err := readRecords(t, raw); !errors.Is(err, errBadClientHello) {
+			t.Errorf("%s: error = %v, want %v", name, err, errBadClientHello)
+		}
+	}
+}
+
+// buildClientHello returns a minimal ClientHello handshake message whose SNI
+// extension names sni verbatim, which crypto/tls would not send for names
+// such as "EX.com.".
+func buildClientHello(sni string) []byte {
+	name := []byte(sni)
+	ext := []byte{0x00, 0x00} // server_name
+	list := append([]byte{0x00, byte(len(name) >> 8), byte(len(name))}, name...)
+	data := append([]byte{byte(len(list) >> 8), byte(len(list))}, list...)
+	ext = append(ext, byte(len(data)>>8), byte(len(data)))
+	ext = append(ext, data...)
+
+	body := []byte{0x03, 0x03}                  // client version
+	body = append(body, make([]byte, 32)...)    // random
+	body = append(body, 0x00)                   // session ID
+	body = append(body, 0x00, 0x02, 0x13, 0x01) // cipher suites
+	body = append(body, 0x01, 0x00)             // compression methods
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+	return append([]byte{0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func TestParseClientHelloNormalizesSNI(t *testing.T) {
+	for sni, want := range map[string]string{
+		"ex.com":           "ex.com",
+		"EX.com":           "ex.com",
+		"EX.com.":          "ex.com",
+		"Api.Example.Com.": "api.example.com",
+	} {
+		info, err := parseClientHello(buildClientHello(sni))
+		if err != nil || info.sni != want {
+			t.Errorf("SNI %q parsed as %q, %v; want %q", sni, info.sni, err, want)
+		}
+	}
+}
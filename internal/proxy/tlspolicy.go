@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// DefaultTLSMinVersion is the lowest TLS version accepted for termination.
+const DefaultTLSMinVersion = "1.2"
+
+// ParseTLSMinVersion parses a minimum TLS version, "1.2" or "1.3".
+func ParseTLSMinVersion(s string) (uint16, error) {
+	switch strings.TrimSpace(s) {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS minimum version %q: want 1.2 or 1.3", s)
+}
+
+// ParseTLSCiphers parses a comma-separated list of TLS 1.2 cipher suite
+// names as printed by Go, e.g.
+// "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+// An empty list keeps Go's defaults. Insecure suites and TLS 1.3 suites,
+// which Go does not allow to be configured, are rejected.
+func ParseTLSCiphers(s string) ([]uint16, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	byName := make(map[string]*tls.CipherSuite)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		suite, ok := byName[name]
+		switch {
+		case insecure[name]:
+			return nil, fmt.Errorf("TLS cipher suite %s is insecure", name)
+		case !ok:
+			return nil, fmt.Errorf("unknown TLS cipher suite %q", name)
+		case !supportsVersion(suite, tls.VersionTLS12):
+			return nil, fmt.Errorf("TLS cipher suite %s is TLS 1.3 only; TLS 1.3 suites cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+func supportsVersion(suite *tls.CipherSuite, version uint16) bool {
+	for _, v := range suite.SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTLSPolicy sets the minimum version and the TLS 1.2 cipher suites
+// accepted on terminated connections; nil ciphers keep Go's defaults. It
+// must be called before certificates are loaded or ACME is enabled.
+func (s *Server) SetTLSPolicy(minVersion uint16, ciphers []uint16) error {
+	if minVersion == tls.VersionTLS13 && len(ciphers) > 0 {
+		return errors.New("TLS cipher suites only apply to TLS 1.2 and cannot be set with a TLS 1.3 minimum")
+	}
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	if s.tlsConfig != nil {
+		return errors.New("TLS policy must be set before TLS termination is enabled")
+	}
+	s.tlsMinVersion = minVersion
+	s.tlsCiphers = ciphers
+	return nil
+}
+
+// logTLSPolicy records the policy of a new termination config.
+func logTLSPolicy(cfg *tls.Config) {
+	ciphers := []string{"default"}
+	if len(cfg.CipherSuites) > 0 {
+		ciphers = ciphers[:0]
+		for _, id := range cfg.CipherSuites {
+			ciphers = append(ciphers, tls.CipherSuiteName(id))
+		}
+	}
+	slog.Info("TLS termination policy", "min_version", tls.VersionName(cfg.MinVersion), "tls12_ciphers", ciphers)
+}
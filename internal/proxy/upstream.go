@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// upstreamTLSConfig returns the client TLS config used to re-encrypt to a
+// route's backend. The backend certificate is verified against the route's
+// server name, which defaults to the public host the client requested, so the
+// dial address may be an internal service name.
+func (s *Server) upstreamTLSConfig(route *router.StaticRoute, host string) (*tls.Config, error) {
+	serverName := route.UpstreamServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if route.UpstreamCAFile != "" {
+		pool, err := s.caPool(route.UpstreamCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// caPool loads a PEM CA bundle, caching it by path for the life of the process.
+func (s *Server) caPool(path string) (*x509.CertPool, error) {
+	s.caPoolsMu.Lock()
+	defer s.caPoolsMu.Unlock()
+
+	if pool, ok := s.caPools[path]; ok {
+		return pool, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+
+	if s.caPools == nil {
+		s.caPools = make(map[string]*x509.CertPool)
+	}
+	s.caPools[path] = pool
+	return pool, nil
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/router"
+)
+
+// testCA creates a CA, writes its certificate to a PEM file and returns the
+// file's path and a certificate it issued for names.
+func testCA(t *testing.T, names ...string) (caFile string, leaf tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return caFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsBackend runs a TLS server presenting cert on loopback and returns its
+// address, which matches none of the certificate's names.
+func tlsBackend(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestUpstreamTLSServerName(t *testing.T) {
+	caFile, cert := testCA(t, "app.example", "backend.internal.example")
+	addr := tlsBackend(t, cert)
+
+	tests := []struct {
+		name       string
+		host       string // public host the client asked for
+		serverName string
+		caFile     string
+		wantErr    bool
+	}{
+		{"public host", "app.example", "", caFile, false},
+		{"configured name", "other.example", "backend.internal.example", caFile, false},
+		{"host not in cert", "other.example", "", caFile, true},
+		{"configured name not in cert", "app.example", "wrong.example", caFile, true},
+		{"system roots", "app.example", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(&router.Router{}, "")
+			route := &router.StaticRoute{Host: tt.host, PathPrefix: "/", Target: addr, UpstreamTLS: true, UpstreamServerName: tt.serverName, UpstreamCAFile: tt.caFile}
+			cfg, err := s.upstreamTLSConfig(route, tt.host)
+			if err != nil {
+				t.Fatalf("upstreamTLSConfig() error = %v", err)
+			}
+			conn, err := s.dialHTTPBackend(&httpTarget{addr: addr, route: route, tlsConfig: cfg}, 5*time.Second, false)
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dial error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpstreamTLSBadCAFile(t *testing.T) {
+	s := NewServer(&router.Router{}, "")
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, nil, 0o644)
+	for _, file := range []string{empty, filepath.Join(t.TempDir(), "missing.pem")} {
+		route := &router.StaticRoute{Host: "app.example", Target: "127.0.0.1:1", UpstreamTLS: true, UpstreamCAFile: file}
+		if _, err := s.upstreamTLSConfig(route, "app.example"); err == nil {
+			t.Errorf("upstreamTLSConfig() with CA file %s succeeded", filepath.Base(file))
+		}
+	}
+}
+
+// The backend connection pool must not hand a connection verified for one
+// server name to a request for another.
+func TestUpstreamTLSPoolKey(t *testing.T) {
+	a := &httpTarget{addr: "10.0.0.1:443", tlsConfig: &tls.Config{ServerName: "a.example"}}
+	b := &httpTarget{addr: "10.0.0.1:443", tlsConfig: &tls.Config{ServerName: "b.example"}}
+	plain := &httpTarget{addr: "10.0.0.1:443"}
+	if a.key() == b.key() || a.key() == plain.key() {
+		t.Errorf("pool keys %q, %q, %q are not distinct", a.key(), b.key(), plain.key())
+	}
+}
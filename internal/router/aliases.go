@@ -0,0 +1,87 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateAlias checks a container alias hostname: a bare DNS name without
+// a port, scheme or path.
+func ValidateAlias(hostname string) error {
+	if hostname == "" {
+		return fmt.Errorf("alias hostname must not be empty")
+	}
+	if strings.ContainsAny(hostname, ":/ \t") || strings.HasPrefix(hostname, ".") || strings.HasSuffix(hostname, ".") {
+		return fmt.Errorf("invalid alias hostname %q", hostname)
+	}
+	return nil
+}
+
+// RegisterAlias maps a hostname to a container, so ResolveByHostname finds
+// the container under a friendly name such as "myblog.cloud.eddisonso.com"
+// as well as under its ID subdomain. An existing alias is repointed.
+func (r *Router) RegisterAlias(hostname, containerID string) error {
+	hostname = strings.ToLower(hostname)
+	if err := ValidateAlias(hostname); err != nil {
+		return err
+	}
+	if containerID == "" {
+		return fmt.Errorf("alias %q: container ID must not be empty", hostname)
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO aliases (hostname, container_id) VALUES ($1, $2)
+		ON CONFLICT (hostname) DO UPDATE SET container_id = EXCLUDED.container_id
+	`, hostname, containerID)
+	if err != nil {
+		return fmt.Errorf("insert alias: %w", err)
+	}
+	return r.loadContainers()
+}
+
+// UnregisterAlias removes a hostname alias. It returns ErrNotFound if the
+// alias does not exist.
+func (r *Router) UnregisterAlias(hostname string) error {
+	result, err := r.db.Exec(`DELETE FROM aliases WHERE hostname = $1`, strings.ToLower(hostname))
+	if err != nil {
+		return fmt.Errorf("delete alias: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return r.loadContainers()
+}
+
+// loadAliases reads the aliases of the containers in cache. Aliases of
+// containers that are not cached, because they were removed or are not
+// running, are left out so they stop resolving.
+func (r *Router) loadAliases(cache map[string]*Container) (map[string]string, error) {
+	rows, err := r.db.Query(`SELECT hostname, container_id FROM aliases`)
+	if err != nil {
+		return nil, fmt.Errorf("query aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var hostname, containerID string
+		if err := rows.Scan(&hostname, &containerID); err != nil {
+			return nil, fmt.Errorf("scan alias: %w", err)
+		}
+		if _, exists := cache[containerID]; exists {
+			aliases[strings.ToLower(hostname)] = containerID
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// aliasTarget returns the container ID a hostname is an alias of, or "".
+func (r *Router) aliasTarget(hostname string) string {
+	aliases := r.aliases.Load()
+	if aliases == nil {
+		return ""
+	}
+	return (*aliases)[strings.ToLower(hostname)]
+}
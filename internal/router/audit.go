@@ -0,0 +1,34 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SSHSession is the audit record of one SSH connection through the gateway.
+type SSHSession struct {
+	Client      string    `json:"client"`      // client IP
+	Fingerprint string    `json:"fingerprint"` // SHA256 fingerprint of the presented key; empty for other auth methods
+	ContainerID string    `json:"container_id"`
+	User        string    `json:"user"` // user logged in to on the container
+	Result      string    `json:"result"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	BytesUp     int64     `json:"bytes_up"`   // client to container
+	BytesDown   int64     `json:"bytes_down"` // container to client
+}
+
+// RecordSSHSession appends a session to the ssh_audit table.
+func (r *Router) RecordSSHSession(ctx context.Context, s SSHSession) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO ssh_audit (client_ip, key_fingerprint, container_id, username, result,
+			started_at, ended_at, duration_ms, bytes_up, bytes_down)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, s.Client, s.Fingerprint, s.ContainerID, s.User, s.Result,
+		s.Start, s.End, s.End.Sub(s.Start).Milliseconds(), s.BytesUp, s.BytesDown)
+	if err != nil {
+		return fmt.Errorf("insert ssh audit record: %w", err)
+	}
+	return nil
+}
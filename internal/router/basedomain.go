@@ -0,0 +1,43 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithBaseDomain makes container hostnames end in domain, e.g.
+// "cloud.eddisonso.com": the container ID is everything before it, so
+// "team.abc123.cloud.eddisonso.com" names container "team.abc123", and
+// hostnames outside domain name no container. Without a base domain the
+// ID is the first label of any hostname with at least three.
+func WithBaseDomain(domain string) Option {
+	return func(r *Router) {
+		r.baseDomain = strings.ToLower(strings.Trim(domain, "."))
+	}
+}
+
+// ValidateBaseDomain checks a container base domain: a DNS name of at
+// least two labels without a port, scheme or path.
+func ValidateBaseDomain(domain string) error {
+	domain = strings.Trim(domain, ".")
+	if !strings.Contains(domain, ".") || strings.Contains(domain, "..") || strings.ContainsAny(domain, ":/ \t") {
+		return fmt.Errorf("invalid base domain %q: want a DNS name such as cloud.example.com", domain)
+	}
+	return nil
+}
+
+// containerIDFromHost returns the container ID a hostname names, or "".
+func (r *Router) containerIDFromHost(hostname string) string {
+	if r.baseDomain == "" {
+		return extractContainerID(hostname)
+	}
+	hostname = strings.TrimSuffix(hostname, ".")
+	if len(hostname) <= len(r.baseDomain)+1 {
+		return ""
+	}
+	split := len(hostname) - len(r.baseDomain) - 1
+	if hostname[split] != '.' || !strings.EqualFold(hostname[split+1:], r.baseDomain) {
+		return ""
+	}
+	return hostname[:split]
+}
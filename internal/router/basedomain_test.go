@@ -0,0 +1,70 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestContainerIDFromHost(t *testing.T) {
+	tests := []struct {
+		baseDomain, host, want string
+	}{
+		// Without a base domain the first label of a three-label name
+		{"", "abc123.cloud.eddisonso.com", "abc123"},
+		{"", "team.abc123.cloud.eddisonso.com", "team"},
+		{"", "eddisonso.com", ""},
+		{"", ".cloud.eddisonso.com", ""},
+
+		// Two-label base domain
+		{"eddisonso.com", "abc123.eddisonso.com", "abc123"},
+		{"eddisonso.com", "team.abc123.eddisonso.com", "team.abc123"},
+		{"eddisonso.com", "eddisonso.com", ""},
+		{"eddisonso.com", "abc123.example.com", ""},
+
+		// Three-label base domain
+		{"cloud.eddisonso.com", "abc123.cloud.eddisonso.com", "abc123"},
+		{"cloud.eddisonso.com", "team.abc123.cloud.eddisonso.com", "team.abc123"},
+		{"cloud.eddisonso.com", "ABC123.Cloud.Eddisonso.com", "ABC123"},
+		{"cloud.eddisonso.com", "abc123.cloud.eddisonso.com.", "abc123"},
+		{"cloud.eddisonso.com", "cloud.eddisonso.com", ""},
+		{"cloud.eddisonso.com", "abc123.xcloud.eddisonso.com", ""},
+		{"cloud.eddisonso.com", "abc123.eddisonso.com", ""},
+
+		// Four-label base domain
+		{"compute.us1.cloud.eddisonso.com", "a.b.c.compute.us1.cloud.eddisonso.com", "a.b.c"},
+		{"compute.us1.cloud.eddisonso.com", "abc123.cloud.eddisonso.com", ""},
+	}
+	for _, tt := range tests {
+		r := NewStatic(nil)
+		WithBaseDomain(tt.baseDomain)(r)
+		if got := r.containerIDFromHost(tt.host); got != tt.want {
+			t.Errorf("base domain %q: containerIDFromHost(%q) = %q, want %q", tt.baseDomain, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBaseDomain(t *testing.T) {
+	for _, domain := range []string{"eddisonso.com", "cloud.eddisonso.com", ".cloud.eddisonso.com."} {
+		if err := ValidateBaseDomain(domain); err != nil {
+			t.Errorf("ValidateBaseDomain(%q) = %v", domain, err)
+		}
+	}
+	for _, domain := range []string{"", "com", "cloud..eddisonso.com", "cloud.eddisonso.com:443", "https://cloud.eddisonso.com", "cloud.eddisonso.com/x"} {
+		if err := ValidateBaseDomain(domain); err == nil {
+			t.Errorf("ValidateBaseDomain(%q) succeeded", domain)
+		}
+	}
+}
+
+func TestResolveByHostnameWithBaseDomain(t *testing.T) {
+	r := NewStatic(nil)
+	WithBaseDomain("cloud.eddisonso.com")(r)
+	r.cache.Store("team.abc123", &Container{ID: "team.abc123", Status: "running", ExternalIP: "10.0.0.1"})
+
+	c, err := r.ResolveByHostname("team.abc123.cloud.eddisonso.com")
+	if err != nil || c.ID != "team.abc123" {
+		t.Errorf("ResolveByHostname() = %v, %v; want container team.abc123", c, err)
+	}
+	if _, err := r.ResolveByHostname("abc123.cloud.eddisonso.com"); err == nil {
+		t.Error("ResolveByHostname() found a container for a partial ID")
+	}
+}
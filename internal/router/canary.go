@@ -0,0 +1,213 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"eddisonso.com/edd-gateway/internal/metrics"
+)
+
+// ErrNoCanary is returned when a canary operation targets a route without a canary.
+var ErrNoCanary = errors.New("route has no canary")
+
+// Canary ramp states.
+const (
+	CanaryRamping  = "ramping"  // weight grows with elapsed time
+	CanaryComplete = "complete" // ramp reached 100%
+	CanaryPaused   = "paused"   // weight frozen until resumed
+	CanaryAborted  = "aborted"  // all traffic back on the stable target
+)
+
+// CanaryStatus is the current state of a route's canary ramp.
+type CanaryStatus struct {
+	Host       string    `json:"host"`
+	PathPrefix string    `json:"path_prefix"`
+	Target     string    `json:"canary_target"`
+	Percent    int       `json:"percent"`
+	State      string    `json:"state"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// canaryKey identifies a route's canary ramp. The start time is part of the
+// key so that registering a new canary discards pause or abort state left
+// over from the previous one.
+type canaryKey struct {
+	host, path string
+	startedAt  time.Time
+}
+
+// canaryControl is the in-memory pause/abort state of one ramp.
+type canaryControl struct {
+	pausedAt time.Time     // zero unless paused
+	paused   time.Duration // total time spent paused before pausedAt
+	aborted  bool
+}
+
+// validateCanary checks a route's canary ramp settings.
+func validateCanary(route StaticRoute) error {
+	if route.CanaryTarget == "" {
+		return nil
+	}
+	if err := validateAddr(route.CanaryTarget); err != nil {
+		return fmt.Errorf("canary: %w", err)
+	}
+	if route.CanaryStepPercent < 1 || route.CanaryStepPercent > 100 {
+		return fmt.Errorf("canary step must be between 1 and 100 percent, got %d", route.CanaryStepPercent)
+	}
+	if route.CanaryStepInterval <= 0 {
+		return errors.New("canary step interval must be positive")
+	}
+	return nil
+}
+
+func keyForCanary(route *StaticRoute) canaryKey {
+	return canaryKey{host: route.Host, path: route.PathPrefix, startedAt: route.CanaryStartedAt}
+}
+
+// canaryStatus computes the effective canary percentage of route at now:
+// CanaryStepPercent for every full CanaryStepInterval elapsed since the ramp
+// started, not counting time spent paused, capped at 100.
+func (r *Router) canaryStatus(route *StaticRoute, now time.Time) (int, string) {
+	r.canaryMu.Lock()
+	ctl := r.canaries[keyForCanary(route)]
+	var paused time.Duration
+	if ctl != nil {
+		if ctl.aborted {
+			r.canaryMu.Unlock()
+			return 0, CanaryAborted
+		}
+		paused = ctl.paused
+		if !ctl.pausedAt.IsZero() {
+			now = ctl.pausedAt
+		}
+	}
+	r.canaryMu.Unlock()
+
+	elapsed := now.Sub(route.CanaryStartedAt) - paused
+	percent := 0
+	if elapsed > 0 {
+		percent = int(elapsed/route.CanaryStepInterval) * route.CanaryStepPercent
+	}
+	state := CanaryRamping
+	if percent >= 100 {
+		percent = 100
+		state = CanaryComplete
+	}
+	if ctl != nil && !ctl.pausedAt.IsZero() {
+		state = CanaryPaused
+	}
+	return percent, state
+}
+
+// applyCanary returns route with its Target replaced by the canary target
+// for the current share of requests. Requests are counted per route so the
+// split is exact over every hundred requests. The split comes before any
+// consistent hashing: a request sent to the canary loses the hash ring, so
+// TargetForKey cannot move it back to a stable target, and the others are
+// hashed across the stable targets as usual.
+func (r *Router) applyCanary(route *StaticRoute) *StaticRoute {
+	percent, _ := r.canaryStatus(route, time.Now())
+	metrics.CanaryPercent.WithLabelValues(route.Host, route.PathPrefix).Set(float64(percent))
+	if percent == 0 || int(route.canaryCount.Add(1)%100) >= percent {
+		return route
+	}
+	chosen := *route
+	chosen.Target = route.CanaryTarget
+	chosen.ring = nil
+	return &chosen
+}
+
+// ListCanaries returns the ramp status of every route with a canary target.
+func (r *Router) ListCanaries() []CanaryStatus {
+	now := time.Now()
+	statuses := []CanaryStatus{}
+	for _, route := range r.ListRoutes() {
+		if route.CanaryTarget == "" {
+			continue
+		}
+		percent, state := r.canaryStatus(&route, now)
+		statuses = append(statuses, CanaryStatus{
+			Host:       route.Host,
+			PathPrefix: route.PathPrefix,
+			Target:     route.CanaryTarget,
+			Percent:    percent,
+			State:      state,
+			StartedAt:  route.CanaryStartedAt,
+		})
+	}
+	return statuses
+}
+
+// PauseCanary freezes the canary weight of the route at its current value.
+func (r *Router) PauseCanary(host, pathPrefix string) (CanaryStatus, error) {
+	return r.updateCanary(host, pathPrefix, func(ctl *canaryControl, now time.Time) {
+		if ctl.pausedAt.IsZero() {
+			ctl.pausedAt = now
+		}
+	})
+}
+
+// ResumeCanary continues a paused ramp from where it was paused.
+func (r *Router) ResumeCanary(host, pathPrefix string) (CanaryStatus, error) {
+	return r.updateCanary(host, pathPrefix, func(ctl *canaryControl, now time.Time) {
+		if !ctl.pausedAt.IsZero() {
+			ctl.paused += now.Sub(ctl.pausedAt)
+			ctl.pausedAt = time.Time{}
+		}
+	})
+}
+
+// AbortCanary sends all of the route's traffic back to its stable target.
+// The ramp stays aborted until a new canary is registered for the route.
+func (r *Router) AbortCanary(host, pathPrefix string) (CanaryStatus, error) {
+	return r.updateCanary(host, pathPrefix, func(ctl *canaryControl, now time.Time) {
+		ctl.aborted = true
+	})
+}
+
+// updateCanary applies fn to the control state of the route's current ramp.
+// Pause and abort state is kept in memory only and does not survive restarts.
+func (r *Router) updateCanary(host, pathPrefix string, fn func(*canaryControl, time.Time)) (CanaryStatus, error) {
+	var route *StaticRoute
+	for _, rt := range r.ListRoutes() {
+		if strings.EqualFold(rt.Host, host) && rt.PathPrefix == pathPrefix && rt.HeaderName == "" {
+			route = &rt
+			break
+		}
+	}
+	if route == nil {
+		return CanaryStatus{}, ErrNoRoute
+	}
+	if route.CanaryTarget == "" {
+		return CanaryStatus{}, ErrNoCanary
+	}
+
+	now := time.Now()
+	r.canaryMu.Lock()
+	if r.canaries == nil {
+		r.canaries = make(map[canaryKey]*canaryControl)
+	}
+	key := keyForCanary(route)
+	ctl := r.canaries[key]
+	if ctl == nil {
+		ctl = &canaryControl{}
+		r.canaries[key] = ctl
+	}
+	fn(ctl, now)
+	r.canaryMu.Unlock()
+
+	percent, state := r.canaryStatus(route, now)
+	metrics.CanaryPercent.WithLabelValues(route.Host, route.PathPrefix).Set(float64(percent))
+	slog.Info("canary updated", "host", host, "path", pathPrefix, "canary_target", route.CanaryTarget, "percent", percent, "state", state)
+	return CanaryStatus{
+		Host:       route.Host,
+		PathPrefix: route.PathPrefix,
+		Target:     route.CanaryTarget,
+		Percent:    percent,
+		State:      state,
+		StartedAt:  route.CanaryStartedAt,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+// canaryRoute returns a consistent-hash route over two stable targets whose
+// canary ramp has reached percent.
+func canaryRoute(percent int) StaticRoute {
+	return StaticRoute{
+		Host:               "app.example",
+		PathPrefix:         "/",
+		Target:             "a:80,b:80",
+		HashKey:            HashKeyPath,
+		CanaryTarget:       "canary:80",
+		CanaryStepPercent:  percent,
+		CanaryStepInterval: time.Hour,
+		CanaryStartedAt:    time.Now().Add(-90 * time.Minute),
+	}
+}
+
+func TestCanaryWithHashKey(t *testing.T) {
+	r := NewStatic([]StaticRoute{canaryRoute(25)})
+
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		route, _, err := r.ResolveStaticRoute("app.example", "/users/42", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// As the proxy does for hash_key routes
+		target := route.Target
+		if t := r.TargetForKey(route, "/users/42"); t != "" {
+			target = t
+		}
+		counts[target]++
+	}
+	if counts["canary:80"] != 25 {
+		t.Errorf("canary got %d of 100 requests, want 25 (%v)", counts["canary:80"], counts)
+	}
+	// The rest stay on the stable target the key hashes to
+	if len(counts) != 2 {
+		t.Errorf("requests spread over %v, want the canary and one stable target", counts)
+	}
+}
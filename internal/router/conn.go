@@ -0,0 +1,94 @@
+package router
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultConnectTimeout is how long New keeps retrying an unreachable
+	// database before giving up.
+	DefaultConnectTimeout = 30 * time.Second
+
+	minReconnectBackoff = 250 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// WithConnectTimeout sets how long New retries the initial database
+// connection, with exponential backoff, before failing. Zero tries once.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(r *Router) {
+		r.connectTimeout = d
+	}
+}
+
+// pingWithBackoff pings db until it answers or timeout has passed, doubling
+// the wait between attempts.
+func pingWithBackoff(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := minReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("ping database after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("database not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+}
+
+// Connected reports whether the last database sync or reconnection attempt
+// succeeded. While disconnected the router keeps serving its cached
+// containers and routes.
+func (r *Router) Connected() bool {
+	return r.connected.Load()
+}
+
+// lastSync returns when containers and routes were last loaded successfully.
+func (r *Router) lastSync() time.Time {
+	return time.Unix(0, r.lastSyncNanos.Load())
+}
+
+// syncFailed handles a failed sync. If the database no longer answers, the
+// router is marked disconnected and the returned delay schedules the first
+// reconnection attempt; otherwise the error is logged and zero returned.
+func (r *Router) syncFailed(what string, err error) time.Duration {
+	ctx, cancel := context.WithTimeout(r.ctx, minReconnectBackoff*4)
+	defer cancel()
+	if pingErr := r.db.PingContext(ctx); pingErr == nil {
+		slog.Error(what, "error", err)
+		return 0
+	}
+	r.connected.Store(false)
+	slog.Warn("lost database connection, serving cached routes", "error", err, "last_sync", r.lastSync())
+	return minReconnectBackoff
+}
+
+// reconnect pings the database after an outage. On success it reloads
+// everything and returns zero; otherwise it returns the next backoff.
+func (r *Router) reconnect(backoff time.Duration) time.Duration {
+	ctx, cancel := context.WithTimeout(r.ctx, minReconnectBackoff*4)
+	defer cancel()
+	if err := r.db.PingContext(ctx); err != nil {
+		next := min(2*backoff, maxReconnectBackoff)
+		slog.Warn("database still unreachable, serving stale routes", "stale_for", time.Since(r.lastSync()).Round(time.Second), "retry_in", next, "error", err)
+		return next
+	}
+	r.connected.Store(true)
+	slog.Info("database connection recovered", "stale_for", time.Since(r.lastSync()).Round(time.Second))
+	if err := r.loadAll(); err != nil {
+		slog.Error("failed to sync cache after reconnecting", "error", err)
+	}
+	return 0
+}
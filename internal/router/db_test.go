@@ -0,0 +1,101 @@
+package router
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that records the statements and
+// arguments it is asked to execute. Arguments reach it only after
+// database/sql has converted them, so a value lib/pq could not send fails
+// the same way here. Queries are answered by rows when it is set; otherwise
+// every query returns a single empty string, which change token queries
+// take to mean nothing changed since the last load.
+type recordingDriver struct {
+	mu      sync.Mutex
+	execs   []recordedExec
+	queries []string
+	rows    func(query string) *recordingRows
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.d, query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("recordingDriver: no transactions")
+}
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	s.d.execs = append(s.d.execs, recordedExec{s.query, args})
+	s.d.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	s.d.queries = append(s.d.queries, s.query)
+	rows := s.d.rows
+	s.d.mu.Unlock()
+	if rows != nil {
+		return rows(s.query), nil
+	}
+	return tokenRows(""), nil
+}
+
+// recordingRows is a query result of rows of values.
+type recordingRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+// tokenRows returns a change token query result.
+func tokenRows(token string) *recordingRows {
+	return &recordingRows{cols: []string{"token"}, rows: [][]driver.Value{{token}}}
+}
+
+func (r *recordingRows) Columns() []string { return r.cols }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newRecordingDB returns a database handle backed by a fresh recordingDriver.
+func newRecordingDB(t *testing.T) (*sql.DB, *recordingDriver) {
+	t.Helper()
+	d := &recordingDriver{}
+	db := sql.OpenDB(recordingConnector{d})
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+type recordingConnector struct{ d *recordingDriver }
+
+func (c recordingConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c recordingConnector) Driver() driver.Driver                        { return c.d }
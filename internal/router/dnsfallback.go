@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// dnsFallbackTimeout bounds one DNS lookup for a container address.
+	dnsFallbackTimeout = 2 * time.Second
+	// dnsFailureTTL is how long a failed lookup is remembered, so a container
+	// whose name does not resolve yet is not looked up on every connection.
+	dnsFailureTTL = 5 * time.Second
+)
+
+// WithDNSFallback resolves containers that have no external IP in the
+// database through DNS, using template with {id} and {namespace}
+// placeholders, e.g. "{id}.pods.cluster.local".
+func WithDNSFallback(template string) Option {
+	return func(r *Router) {
+		r.dnsTemplate = template
+	}
+}
+
+// ValidateDNSTemplate checks that a DNS fallback template names the container.
+func ValidateDNSTemplate(template string) error {
+	if !strings.Contains(template, "{id}") {
+		return fmt.Errorf("DNS fallback template %q must contain {id}", template)
+	}
+	return nil
+}
+
+// resolveViaDNS looks up the address of a container without an external IP.
+// A resolved address is stored in the cache until the container's row next
+// changes.
+func (r *Router) resolveViaDNS(c *Container) (*Container, bool) {
+	if r.dnsTemplate == "" {
+		return nil, false
+	}
+	if failedAt, ok := r.dnsFailures.Load(c.ID); ok && time.Since(failedAt.(time.Time)) < dnsFailureTTL {
+		return nil, false
+	}
+
+	name := strings.NewReplacer("{id}", c.ID, "{namespace}", c.Namespace).Replace(r.dnsTemplate)
+	ctx, cancel := context.WithTimeout(context.Background(), dnsFallbackTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err != nil || len(addrs) == 0 {
+		r.dnsFailures.Store(c.ID, time.Now())
+		slog.Debug("DNS fallback lookup failed", "container", c.ID, "name", name, "error", err)
+		return nil, false
+	}
+	r.dnsFailures.Delete(c.ID)
+
+	resolved := *c
+	resolved.ExternalIP = addrs[0]
+	r.cache.CompareAndSwap(c.ID, c, &resolved)
+	slog.Info("resolved container address via DNS", "container", c.ID, "name", name, "ip", resolved.ExternalIP)
+	return &resolved, true
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RouteSourceFile marks static routes registered from the routes file.
+// Routes registered any other way have an empty Source and are never
+// touched by SyncFileRoutes.
+const RouteSourceFile = "file"
+
+// routeKey identifies a static route.
+type routeKey struct {
+	host, path              string
+	headerName, headerValue string
+}
+
+// key returns the route's identity. Hosts compare case-insensitively.
+func (r *StaticRoute) key() routeKey {
+	return routeKey{strings.ToLower(r.Host), r.PathPrefix, r.HeaderName, r.HeaderValue}
+}
+
+// SyncFileRoutes makes the file-sourced static routes match cfg: new and
+// changed routes are registered, and file-sourced routes missing from cfg
+// are unregistered. Unchanged routes are left alone so canary ramps and
+// draining state carry over. A route that fails to register does not stop
+// the others; all failures are returned joined.
+func (r *Router) SyncFileRoutes(cfg []StaticRoute) error {
+	current := make(map[routeKey]StaticRoute)
+	for _, route := range r.ListRoutes() {
+		if route.Source == RouteSourceFile {
+			current[route.key()] = route
+		}
+	}
+
+	var errs []error
+	wanted := make(map[routeKey]bool, len(cfg))
+	for _, route := range cfg {
+		key := route.key()
+		if wanted[key] {
+			errs = append(errs, fmt.Errorf("route %s%s: listed more than once", route.Host, route.PathPrefix))
+			continue
+		}
+		wanted[key] = true
+		route.Source = RouteSourceFile
+		if route.Priority == 0 {
+			route.Priority = autoPriority(route.PathPrefix)
+		}
+		if old, ok := current[key]; ok && sameRouteConfig(old, route) {
+			continue
+		}
+		if err := r.RegisterStaticRoute(route); err != nil {
+			errs = append(errs, fmt.Errorf("route %s%s: %w", route.Host, route.PathPrefix, err))
+			continue
+		}
+		slog.Info("registered route", "host", route.Host, "path", route.PathPrefix, "target", route.Target)
+	}
+
+	for key := range current {
+		if wanted[key] {
+			continue
+		}
+		if err := r.UnregisterConditionalRoute(key.host, key.path, key.headerName, key.headerValue); err != nil && !errors.Is(err, ErrNoRoute) {
+			errs = append(errs, fmt.Errorf("route %s%s: %w", key.host, key.path, err))
+			continue
+		}
+		slog.Info("unregistered route removed from routes file", "host", key.host, "path", key.path)
+	}
+	return errors.Join(errs...)
+}
+
+// sameRouteConfig reports whether two routes have the same configuration,
+// ignoring database-assigned and runtime state.
+func sameRouteConfig(a, b StaticRoute) bool {
+	return reflect.DeepEqual(routeConfigOf(a), routeConfigOf(b))
+}
+
+// routeConfigOf strips a route down to the fields a routes file sets.
+func routeConfigOf(route StaticRoute) StaticRoute {
+	config := route
+	config.Host = strings.ToLower(config.Host)
+	config.ID = 0
+	config.Draining = false
+	config.CanaryStartedAt = time.Time{}
+	config.Hits, config.LastMatched = 0, time.Time{}
+	config.pattern, config.targets, config.next, config.ring, config.canaryCount, config.stats = nil, nil, nil, nil, nil, nil
+	if config.MatchType == "" {
+		config.MatchType = MatchPrefix
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = nil
+	}
+	if len(config.Weights) == 0 {
+		config.Weights = nil
+	}
+	return config
+}
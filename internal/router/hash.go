@@ -0,0 +1,108 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHashKey is returned when a route's hash key is not recognized.
+var ErrInvalidHashKey = errors.New("invalid hash key")
+
+// Hash key sources for consistent-hash routes.
+const (
+	HashKeyPath   = "path"    // the request path
+	HashKeyHeader = "header:" // prefix; the value of the named request header
+	HashKeyCookie = "cookie:" // prefix; the value of the named cookie
+)
+
+// ringReplicas is how many points each target gets on the hash ring. More
+// points spread keys more evenly across targets.
+const ringReplicas = 160
+
+// ValidateHashKey checks that key is empty (round-robin), "path",
+// "header:<name>" or "cookie:<name>".
+func ValidateHashKey(key string) error {
+	switch {
+	case key == "", key == HashKeyPath:
+		return nil
+	case strings.HasPrefix(key, HashKeyHeader) && len(key) > len(HashKeyHeader),
+		strings.HasPrefix(key, HashKeyCookie) && len(key) > len(HashKeyCookie):
+		return nil
+	}
+	return fmt.Errorf("%w: %q (want path, header:<name> or cookie:<name>)", ErrInvalidHashKey, key)
+}
+
+// hashRing maps keys to targets so that removing a target only remaps the
+// keys that were on it.
+type hashRing struct {
+	points []uint64 // sorted
+	owners []string // owners[i] is the target at points[i]
+}
+
+func newHashRing(targets []string) *hashRing {
+	type point struct {
+		hash  uint64
+		owner string
+	}
+	points := make([]point, 0, len(targets)*ringReplicas)
+	for _, t := range targets {
+		for i := 0; i < ringReplicas; i++ {
+			points = append(points, point{hashString(t + "#" + strconv.Itoa(i)), t})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	ring := &hashRing{
+		points: make([]uint64, len(points)),
+		owners: make([]string, len(points)),
+	}
+	for i, p := range points {
+		ring.points[i] = p.hash
+		ring.owners[i] = p.owner
+	}
+	return ring
+}
+
+// get returns the first target clockwise from key's hash that available
+// accepts, or the key's owner if none is accepted.
+func (h *hashRing) get(key string, available func(string) bool) string {
+	hash := hashString(key)
+	start := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= hash })
+	if available != nil {
+		for i := range h.points {
+			if owner := h.owners[(start+i)%len(h.points)]; available(owner) {
+				return owner
+			}
+		}
+	}
+	return h.owners[start%len(h.points)]
+}
+
+// hashString hashes s with FNV-1a, finalized with the splitmix64 mixer so
+// that similar strings like "a:80#1" and "a:80#2" land far apart.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// TargetForKey picks the target of a consistent-hash route for a request key,
+// skipping targets rejected by the target filter. It returns "" when route is
+// not a multi-target hash route or key is empty, in which case the target
+// chosen by ResolveStaticRoute should be kept.
+func (r *Router) TargetForKey(route *StaticRoute, key string) string {
+	if route.ring == nil || key == "" {
+		return ""
+	}
+	return route.ring.get(key, r.targetFilter)
+}
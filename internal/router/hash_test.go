@@ -0,0 +1,118 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestValidateHashKey(t *testing.T) {
+	for _, key := range []string{"", "path", "header:X-User", "cookie:session"} {
+		if err := ValidateHashKey(key); err != nil {
+			t.Errorf("ValidateHashKey(%q) = %v", key, err)
+		}
+	}
+	for _, key := range []string{"host", "header:", "cookie:", "Path", "query:id"} {
+		if err := ValidateHashKey(key); !errors.Is(err, ErrInvalidHashKey) {
+			t.Errorf("ValidateHashKey(%q) = %v, want %v", key, err, ErrInvalidHashKey)
+		}
+	}
+}
+
+// ringOwners maps each of n keys to its target on ring.
+func ringOwners(ring *hashRing, n int, available func(string) bool) map[string]string {
+	owners := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("/objects/%d", i)
+		owners[key] = ring.get(key, available)
+	}
+	return owners
+}
+
+func TestHashRingMinimalRemapping(t *testing.T) {
+	const keys = 10000
+	before := ringOwners(newHashRing([]string{"a:80", "b:80", "c:80", "d:80"}), keys, nil)
+
+	counts := make(map[string]int)
+	for _, owner := range before {
+		counts[owner]++
+	}
+	for target, n := range counts {
+		// Each of four targets should own roughly a quarter of the keys
+		if n < keys/8 || n > keys*3/8 {
+			t.Errorf("%s owns %d of %d keys", target, n, keys)
+		}
+	}
+
+	after := ringOwners(newHashRing([]string{"a:80", "c:80", "d:80"}), keys, nil)
+	moved := 0
+	for key, owner := range before {
+		if owner != "b:80" && after[key] != owner {
+			t.Fatalf("key %s moved from %s to %s though its target stayed", key, owner, after[key])
+		}
+		if after[key] != owner {
+			moved++
+		}
+	}
+	if moved != counts["b:80"] {
+		t.Errorf("%d keys moved, want only the %d that were on the removed target", moved, counts["b:80"])
+	}
+
+	// Adding a target only takes keys over, it never shuffles the others
+	grown := ringOwners(newHashRing([]string{"a:80", "b:80", "c:80", "d:80", "e:80"}), keys, nil)
+	for key, owner := range before {
+		if grown[key] != owner && grown[key] != "e:80" {
+			t.Fatalf("key %s moved from %s to %s, not to the new target", key, owner, grown[key])
+		}
+	}
+}
+
+// Skipping an unavailable target sends its keys where removing it from the
+// ring would, and the order targets are listed in does not matter.
+func TestHashRingUnavailableTarget(t *testing.T) {
+	const keys = 2000
+	full := newHashRing([]string{"d:80", "c:80", "b:80", "a:80"})
+	skipped := ringOwners(full, keys, func(target string) bool { return target != "b:80" })
+	removed := ringOwners(newHashRing([]string{"a:80", "c:80", "d:80"}), keys, nil)
+	for key, owner := range removed {
+		if skipped[key] != owner {
+			t.Fatalf("key %s went to %s with b:80 unavailable, %s with it removed", key, skipped[key], owner)
+		}
+	}
+
+	// With every target unavailable the key's owner is still returned
+	if got := full.get("/x", func(string) bool { return false }); got == "" {
+		t.Error("get() with no available target returned no target")
+	}
+}
+
+func TestTargetForKey(t *testing.T) {
+	r := NewStatic([]StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "a:80,b:80,c:80", HashKey: HashKeyPath},
+		{Host: "rr.example", PathPrefix: "/", Target: "a:80,b:80,c:80"},
+	})
+	hashed, _, err := r.ResolveStaticRoute("app.example", "/objects/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := r.TargetForKey(hashed, "/objects/1")
+	if first == "" {
+		t.Fatal("TargetForKey() on a hash route returned no target")
+	}
+	for i := 0; i < 10; i++ {
+		if got := r.TargetForKey(hashed, "/objects/1"); got != first {
+			t.Fatalf("TargetForKey() = %s, then %s for the same key", first, got)
+		}
+	}
+	if got := r.TargetForKey(hashed, ""); got != "" {
+		t.Errorf("TargetForKey() with an empty key = %q, want \"\"", got)
+	}
+
+	rr, _, err := r.ResolveStaticRoute("rr.example", "/objects/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.TargetForKey(rr, "/objects/1"); got != "" {
+		t.Errorf("TargetForKey() on a round-robin route = %q, want \"\"", got)
+	}
+}
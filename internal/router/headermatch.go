@@ -0,0 +1,90 @@
+package router
+
+import "fmt"
+
+// Headers gives access to a request's header fields by name. Name matching
+// is case-insensitive and Get returns "" for a missing field.
+type Headers interface {
+	Get(name string) string
+}
+
+// ValidateHeaderMatch checks a route's header condition. Both parts are
+// empty for a route without a condition; otherwise name must be a valid
+// field name and value must be set.
+func ValidateHeaderMatch(name, value string) error {
+	if name == "" {
+		if value != "" {
+			return fmt.Errorf("header value %q given without a header name", value)
+		}
+		return nil
+	}
+	if err := ValidateHeaderName(name); err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("header %s: value is required", name)
+	}
+	return nil
+}
+
+// ValidateHeaderName checks that name is a non-empty HTTP field name.
+func ValidateHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty header name")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenChar(name[i]) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	return nil
+}
+
+// isTokenChar reports whether c may appear in an HTTP field name.
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	switch c {
+	case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+		return true
+	}
+	return false
+}
+
+// matchesHeaders reports whether a request with headers satisfies the
+// route's header condition. Routes without a condition match any request;
+// conditioned routes never match when headers is nil.
+func (r *StaticRoute) matchesHeaders(headers Headers) bool {
+	if r.HeaderName == "" {
+		return true
+	}
+	return headers != nil && headers.Get(r.HeaderName) == r.HeaderValue
+}
+
+// ValidateHeaderField checks a header field a route adds to messages: name
+// must be a valid field name and value must not contain control characters
+// that would end the line.
+func ValidateHeaderField(name, value string) error {
+	if err := ValidateHeaderName(name); err != nil {
+		return err
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' && c != '\t' || c == 0x7f {
+			return fmt.Errorf("header %s: invalid character in value %q", name, value)
+		}
+	}
+	return nil
+}
+
+// ValidateResponseHeaders checks a route's response headers. An empty value
+// is allowed: it suppresses the gateway's global header of that name.
+func ValidateResponseHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if err := ValidateHeaderField(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrEmptySelector is returned by bulk operations given no label requirements,
+// which would otherwise match every route.
+var ErrEmptySelector = errors.New("empty label selector")
+
+var (
+	// labelNameRe matches a label name or value: up to 63 alphanumerics,
+	// '-', '_' or '.', beginning and ending with an alphanumeric.
+	labelNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?$`)
+	// labelPrefixRe matches an optional DNS subdomain key prefix ("example.com/").
+	labelPrefixRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// ValidateLabels checks that label keys are "[prefix/]name" and values are
+// empty or valid names, following Kubernetes label syntax.
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+		if value != "" && !labelNameRe.MatchString(value) {
+			return fmt.Errorf("invalid label value %q for key %q", value, key)
+		}
+	}
+	return nil
+}
+
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) > 253 || !labelPrefixRe.MatchString(prefix) {
+			return fmt.Errorf("invalid label key prefix in %q", key)
+		}
+		name = rest
+	}
+	if !labelNameRe.MatchString(name) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// ParseLabelSelector parses an equality selector such as "team=payments,env=preview".
+// A route matches when it has every listed label with the given value.
+func ParseLabelSelector(s string) (map[string]string, error) {
+	selector := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(term), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid selector term %q: want key=value", term)
+		}
+		selector[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := ValidateLabels(selector); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// matchesSelector reports whether labels contain every key/value in selector.
+func matchesSelector(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ListRoutesByLabel returns the static routes matching selector, sorted like ListRoutes.
+func (r *Router) ListRoutesByLabel(selector map[string]string) []StaticRoute {
+	var matched []StaticRoute
+	for _, route := range r.ListRoutes() {
+		if matchesSelector(route.Labels, selector) {
+			matched = append(matched, route)
+		}
+	}
+	return matched
+}
+
+// UnregisterRoutesByLabel deletes every static route matching selector and
+// returns how many were removed.
+func (r *Router) UnregisterRoutesByLabel(selector map[string]string) (int, error) {
+	if len(selector) == 0 {
+		return 0, ErrEmptySelector
+	}
+	sel, err := json.Marshal(selector)
+	if err != nil {
+		return 0, fmt.Errorf("encode selector: %w", err)
+	}
+
+	result, err := r.db.Exec(`DELETE FROM static_routes WHERE labels @> $1::jsonb`, sel)
+	if err != nil {
+		return 0, fmt.Errorf("delete static routes: %w", err)
+	}
+	n, _ := result.RowsAffected()
+
+	return int(n), r.loadStaticRoutes()
+}
+
+// DrainRoutesByLabel sets or clears the draining flag on every static route
+// matching selector. Draining routes stay registered but are skipped during
+// matching, so requests fall through to less specific routes.
+func (r *Router) DrainRoutesByLabel(selector map[string]string, draining bool) (int, error) {
+	if len(selector) == 0 {
+		return 0, ErrEmptySelector
+	}
+	sel, err := json.Marshal(selector)
+	if err != nil {
+		return 0, fmt.Errorf("encode selector: %w", err)
+	}
+
+	result, err := r.db.Exec(`UPDATE static_routes SET draining = $2 WHERE labels @> $1::jsonb`, sel, draining)
+	if err != nil {
+		return 0, fmt.Errorf("update static routes: %w", err)
+	}
+	n, _ := result.RowsAffected()
+
+	return int(n), r.loadStaticRoutes()
+}
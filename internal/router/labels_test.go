@@ -0,0 +1,66 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	selector, err := ParseLabelSelector(" team=payments , env=preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selector) != 2 || selector["team"] != "payments" || selector["env"] != "preview" {
+		t.Errorf("ParseLabelSelector() = %v", selector)
+	}
+	for _, bad := range []string{"team", "team=pay ments", "-team=x"} {
+		if _, err := ParseLabelSelector(bad); err == nil {
+			t.Errorf("ParseLabelSelector(%q) accepted", bad)
+		}
+	}
+}
+
+func TestBulkRouteOperationsBySelector(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	r := &Router{db: db}
+	selector := map[string]string{"team": "payments"}
+
+	if _, err := r.DrainRoutesByLabel(selector, true); err != nil {
+		t.Fatalf("DrainRoutesByLabel() error = %v", err)
+	}
+	if _, err := r.UnregisterRoutesByLabel(selector); err != nil {
+		t.Fatalf("UnregisterRoutesByLabel() error = %v", err)
+	}
+	if len(rec.execs) != 2 {
+		t.Fatalf("got %d statements executed, want 2", len(rec.execs))
+	}
+
+	drain, del := rec.execs[0], rec.execs[1]
+	if !strings.HasPrefix(strings.TrimSpace(drain.query), "UPDATE static_routes SET draining") {
+		t.Errorf("drain ran %q", drain.query)
+	}
+	if string(drain.args[0].([]byte)) != `{"team":"payments"}` || drain.args[1] != true {
+		t.Errorf("drain arguments = %q, %v", drain.args[0], drain.args[1])
+	}
+	if !strings.HasPrefix(strings.TrimSpace(del.query), "DELETE FROM static_routes") {
+		t.Errorf("delete ran %q", del.query)
+	}
+	if string(del.args[0].([]byte)) != `{"team":"payments"}` {
+		t.Errorf("delete argument = %q", del.args[0])
+	}
+}
+
+func TestBulkRouteOperationsRefuseEmptySelector(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	r := &Router{db: db}
+	if _, err := r.DrainRoutesByLabel(nil, true); !errors.Is(err, ErrEmptySelector) {
+		t.Errorf("DrainRoutesByLabel(nil) error = %v, want ErrEmptySelector", err)
+	}
+	if _, err := r.UnregisterRoutesByLabel(map[string]string{}); !errors.Is(err, ErrEmptySelector) {
+		t.Errorf("UnregisterRoutesByLabel(empty) error = %v, want ErrEmptySelector", err)
+	}
+	if len(rec.execs) != 0 {
+		t.Errorf("empty selector executed %d statements", len(rec.execs))
+	}
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Route match types. Exact routes win over regex routes, which win over
+// the longest matching prefix.
+const (
+	MatchPrefix = "prefix" // PathPrefix is a path prefix; the default
+	MatchExact  = "exact"  // PathPrefix must equal the whole path
+	MatchRegex  = "regex"  // PathPrefix is a regular expression matched against the path
+)
+
+// regexRoute is a regex route with its compiled pattern.
+type regexRoute struct {
+	pattern *regexp.Regexp
+	route   *StaticRoute
+}
+
+// ValidateMatch checks a route's match type and, for regex routes, that
+// the pattern compiles. An empty match type means prefix.
+func ValidateMatch(matchType, path string) error {
+	switch matchType {
+	case "", MatchPrefix, MatchExact:
+		return nil
+	case MatchRegex:
+		if _, err := regexp.Compile(path); err != nil {
+			return fmt.Errorf("invalid route pattern %q: %w", path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown match type %q: want %s, %s or %s", matchType, MatchPrefix, MatchExact, MatchRegex)
+}
+
+// ValidateReplacePrefix checks a route's replacement prefix: a path that only
+// applies when the matched prefix is stripped. Regex routes have no matched
+// prefix to replace.
+func ValidateReplacePrefix(replace string, stripPrefix bool, matchType string) error {
+	if replace == "" {
+		return nil
+	}
+	if !strings.HasPrefix(replace, "/") {
+		return fmt.Errorf("replace prefix %q must start with /", replace)
+	}
+	if strings.ContainsAny(replace, "?# \t\r\n") {
+		return fmt.Errorf("replace prefix %q must be a plain path", replace)
+	}
+	if !stripPrefix {
+		return fmt.Errorf("replace prefix %q requires strip_prefix", replace)
+	}
+	if matchType == MatchRegex {
+		return fmt.Errorf("replace prefix is not supported for regex routes")
+	}
+	return nil
+}
+
+// replacePathPrefix joins a replacement prefix and the path left after the
+// matched prefix with exactly one slash between them. Nothing left becomes
+// the replacement followed by "/".
+func replacePathPrefix(replace, remaining string) string {
+	base := strings.TrimSuffix(replace, "/")
+	remaining = strings.TrimPrefix(remaining, "/")
+	return base + "/" + remaining
+}
@@ -0,0 +1,124 @@
+package router
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ChangesChannel is the PostgreSQL NOTIFY channel the router listens on.
+	ChangesChannel = "gateway_changes"
+
+	// DefaultNotifyFallbackInterval is the safety-net full reload interval
+	// used when change notifications are enabled.
+	DefaultNotifyFallbackInterval = time.Minute
+
+	// notifyCoalesceWindow is how long to keep collecting notifications
+	// after the first one before reloading.
+	notifyCoalesceWindow = 100 * time.Millisecond
+)
+
+// Notification payloads on ChangesChannel select what to reload:
+//
+//	"containers" - containers and ingress rules only
+//	"routes"     - static routes only
+//	anything else, including an empty payload, reloads everything.
+const (
+	PayloadContainers = "containers"
+	PayloadRoutes     = "routes"
+)
+
+// reloadScope is a set of caches to reload.
+type reloadScope uint8
+
+const (
+	reloadContainers reloadScope = 1 << iota
+	reloadRoutes
+	reloadAll = reloadContainers | reloadRoutes
+)
+
+// scopeForPayload maps a notification payload to the caches it invalidates.
+func scopeForPayload(payload string) reloadScope {
+	switch payload {
+	case PayloadContainers:
+		return reloadContainers
+	case PayloadRoutes:
+		return reloadRoutes
+	}
+	return reloadAll
+}
+
+// WithChangeNotifications makes the router reload on NOTIFY events from
+// ChangesChannel, keeping a periodic full reload at fallback as a safety net.
+// Non-positive fallback uses DefaultNotifyFallbackInterval.
+func WithChangeNotifications(fallback time.Duration) Option {
+	return func(r *Router) {
+		if fallback <= 0 {
+			fallback = DefaultNotifyFallbackInterval
+		}
+		r.notify = true
+		r.syncInterval = fallback
+	}
+}
+
+// startListener subscribes to ChangesChannel. On failure the router keeps
+// polling at the default interval.
+func (r *Router) startListener(connStr string) {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnectionAttemptFailed, pq.ListenerEventDisconnected:
+			slog.Warn("change listener disconnected", "error", err)
+		case pq.ListenerEventReconnected:
+			slog.Info("change listener reconnected")
+		}
+	})
+	if err := listener.Listen(ChangesChannel); err != nil {
+		slog.Warn("failed to listen for changes, falling back to polling", "channel", ChangesChannel, "error", err)
+		listener.Close()
+		r.syncInterval = defaultSyncInterval
+		return
+	}
+	r.listener = listener
+	slog.Info("listening for route changes", "channel", ChangesChannel, "fallback_interval", r.syncInterval)
+}
+
+// coalesceChanges merges first with any notifications that arrive within
+// notifyCoalesceWindow, so a burst of writes causes a single reload.
+// A nil notification means the listener reconnected and events may have
+// been missed, which forces a full reload.
+func (r *Router) coalesceChanges(first *pq.Notification, ch <-chan *pq.Notification) reloadScope {
+	scope := reloadAll
+	if first != nil {
+		scope = scopeForPayload(first.Extra)
+	}
+
+	timer := time.NewTimer(notifyCoalesceWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case n := <-ch:
+			if n == nil {
+				scope = reloadAll
+			} else {
+				scope |= scopeForPayload(n.Extra)
+			}
+		case <-timer.C:
+			return scope
+		case <-r.ctx.Done():
+			return scope
+		}
+	}
+}
+
+// reload refreshes the caches selected by scope.
+func (r *Router) reload(scope reloadScope) error {
+	switch scope {
+	case reloadContainers:
+		return r.loadContainers()
+	case reloadRoutes:
+		return r.loadStaticRoutes()
+	}
+	return r.loadAll()
+}
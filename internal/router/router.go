@@ -3,14 +3,20 @@ package router
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"regexp"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
 )
 
 var (
@@ -24,25 +30,154 @@ var (
 type StaticRoute struct {
 	ID          int
 	Host        string // e.g., "cloud-api.eddisonso.com"
-	PathPrefix  string // e.g., "/compute" or "/"
-	Target      string // e.g., "edd-compute:80"
+	PathPrefix  string // e.g., "/compute" or "/"; the whole path or a pattern for other match types
+	MatchType   string // MatchPrefix, MatchExact or MatchRegex; empty means MatchPrefix
+	Target      string // e.g., "edd-compute:80", or "a:80,b:80" to round-robin
+	Weights     []int  // per-target weights for a weighted random split, aligned with Target; empty round-robins
 	StripPrefix bool   // Whether to strip the path prefix when proxying
-	Priority    int    // Higher priority = matched first (longer paths get higher priority)
+	Priority    int    // Higher priority = matched first among matching prefixes and equal matches (longer paths get higher priority)
+
+	// ReplacePrefix, with StripPrefix, replaces the matched prefix instead
+	// of removing it, e.g. /old-api/foo becomes /v2/foo
+	ReplacePrefix string
+
+	// Upstream TLS: re-encrypt to the backend instead of sending plaintext
+	UpstreamTLS        bool
+	UpstreamServerName string // SNI and verification name; defaults to the public Host
+	UpstreamCAFile     string // PEM CA bundle for verifying the backend; system roots if empty
+
+	// mTLS: clients of the route's host must present a certificate signed by
+	// a CA in this PEM bundle when TLS is terminated; empty accepts any client
+	ClientCAFile string
+
+	ProxyProtocol string // ProxyProtocolV1 or ProxyProtocolV2 to tell the backend the client address; empty sends none
+
+	Labels   map[string]string // arbitrary key/value tags for bulk operations
+	Draining bool              // excluded from matching while set
+
+	SlowDialThreshold time.Duration // warn when dialing Target takes longer; 0 uses the gateway default
+	DialTimeout       time.Duration // how long dialing Target may take; 0 uses the gateway default
+	IdleTimeout       time.Duration // close the backend connection after this long without traffic; 0 uses the gateway default
+	RequestTimeout    time.Duration // bounds dialing, retries and the wait for the response header; 0 is unbounded
+	DialRetries       int           // extra dial attempts after a failure, within RequestTimeout
+
+	HashKey string // request key for consistent hashing across targets: "path", "header:<name>" or "cookie:<name>"; empty round-robins
+
+	// Canary ramp: CanaryStepPercent more of the requests go to CanaryTarget
+	// for every CanaryStepInterval elapsed since CanaryStartedAt
+	CanaryTarget       string
+	CanaryStepPercent  int
+	CanaryStepInterval time.Duration
+	CanaryStartedAt    time.Time // set on registration; kept while the canary target is unchanged
+
+	BufferBody   bool  // read the whole request body before dialing the backend
+	MaxBodyBytes int64 // cap on a buffered body; 0 uses the server default
+	Compress     bool  // gzip or deflate text-like responses for clients that accept it
+
+	// Headers added to responses of TLS-terminated requests unless the
+	// backend sent them, replacing the gateway's security headers of the
+	// same name; an empty value only suppresses the gateway's header
+	ResponseHeaders map[string]string
+
+	// Basic auth: when BasicAuthUser is set, requests must carry it and a
+	// password matching the bcrypt BasicAuthHash
+	BasicAuthUser string
+	BasicAuthHash string
+
+	// Rate limit: RateLimit requests per second with bursts of RateBurst,
+	// across all clients or per client IP; 0 is unlimited
+	RateLimit         float64
+	RateBurst         int // 0 allows bursts of one second's worth of requests
+	RateLimitByClient bool
+
+	Source string // RouteSourceFile for routes from the routes file, otherwise empty
+
+	// Header condition: when HeaderName is set the route only matches
+	// requests whose HeaderName field equals HeaderValue, and wins over an
+	// unconditioned route for the same path
+	HeaderName  string
+	HeaderValue string
+
+	// Usage, filled in by ListRoutes: requests matched since the route was
+	// registered or the gateway started, and when the latest one was
+	Hits        uint64
+	LastMatched time.Time
+
+	pattern *regexp.Regexp // compiled PathPrefix of regex routes; set when the route table is built
+	targets []string       // Target split on commas; set when the route table is built
+	next    *atomic.Uint64 // round-robin position across targets
+	ring    *hashRing      // set for multi-target routes with a HashKey
+
+	canaryCount *atomic.Uint64 // requests resolved, for splitting canary traffic
+	stats       *routeStats    // hit counts, kept across reloads
 }
 
 // Router resolves container IDs to their network addresses.
 // Uses an in-memory cache with periodic sync from PostgreSQL.
 type Router struct {
 	db         *sql.DB
-	cache      sync.Map       // containerID -> *Container
-	routeTable *routeTable    // radix tree for path routing
-	routesList []StaticRoute  // flat list for ListRoutes()
+	cache      sync.Map      // containerID -> *Container
+	routeTable *routeTable   // radix tree for path routing
+	cacheSize  int           // lookups cached by each route table; 0 disables
+	routesList []StaticRoute // flat list for ListRoutes()
 	routesMu   sync.RWMutex
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
+	loaded     atomic.Bool // set once loadAll has succeeded
+
+	connectTimeout time.Duration // how long New retries the initial connection
+	connected      atomic.Bool   // false while the database is unreachable
+	lastSyncNanos  atomic.Int64  // unix nanoseconds of the last successful loadAll
+
+	dnsTemplate string   // DNS name for containers without an external IP; "" disables
+	baseDomain  string   // container hostnames are "<id>.<baseDomain>"; "" takes the first label
+	dnsFailures sync.Map // containerID -> time.Time of the last failed DNS lookup
+
+	maxStaleness time.Duration // Resolve reports ErrStale for entries older than this; 0 disables
+
+	aliases atomic.Pointer[map[string]string] // alias hostname -> containerID of cached containers, replaced on each load
+
+	targetDialTimeout time.Duration          // dial-check route targets on registration when > 0
+	targetFilter      func(addr string) bool // skips unavailable targets of multi-target routes
+
+	syncInterval time.Duration // full reload interval
+	notify       bool          // reload on NOTIFY from ChangesChannel
+	listener     *pq.Listener  // nil unless notifications are active
+
+	loadMu          sync.Mutex // serializes cache loads
+	containersToken string     // change token of the last container load, guarded by loadMu
+
+	containersChanged chan struct{} // signalled after a load changes the container cache
+	routesToken       string        // change token of the last static route load, guarded by loadMu
+
+	canaryMu sync.Mutex
+	canaries map[canaryKey]*canaryControl // paused or aborted canary ramps
+
+	statsMu    sync.Mutex
+	routeStats map[routeKey]*routeStats // hit counts by route identity
+
+	cacheStats cacheStats // route lookup cache hits and misses, kept across reloads
 }
 
+const (
+	// defaultSyncInterval is how often the full reload runs without notifications.
+	defaultSyncInterval = 5 * time.Second
+	// MinSyncInterval is the shortest allowed full reload interval.
+	MinSyncInterval = 100 * time.Millisecond
+)
+
+// WithSyncInterval sets how often the router reloads from the database.
+// It must be at least MinSyncInterval.
+func WithSyncInterval(d time.Duration) Option {
+	return func(r *Router) {
+		r.syncInterval = d
+	}
+}
+
+// Option configures optional Router behavior.
+type Option func(*Router)
+
 // Container holds routing information for a container.
 type Container struct {
 	ID           string
@@ -52,42 +187,88 @@ type Container struct {
 	SSHEnabled   bool
 	HTTPSEnabled bool
 	PortMap      map[int]int // ingress port -> target port
+
+	// AllowedMethods restricts which HTTP methods are proxied to the container.
+	// Empty means all methods are allowed.
+	AllowedMethods []string
+
+	// AuthorizedKeys are the SSH public keys allowed to connect to the
+	// container. Empty means any key is accepted.
+	AuthorizedKeys []ssh.PublicKey
+}
+
+// AllowsMethod reports whether the container accepts the given HTTP method.
+func (c *Container) AllowsMethod(method string) bool {
+	if len(c.AllowedMethods) == 0 {
+		return true
+	}
+	for _, m := range c.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
 
 // New creates a router with in-memory cache backed by PostgreSQL.
-func New(connStr string) (*Router, error) {
+func New(connStr string, opts ...Option) (*Router, error) {
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
-	// Test connection
-	if err := db.Ping(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Router{
+		db:             db,
+		ctx:            ctx,
+		cancel:         cancel,
+		syncInterval:   defaultSyncInterval,
+		connectTimeout: DefaultConnectTimeout,
+		maxStaleness:   DefaultMaxStaleness,
+		cacheSize:      DefaultCacheSize,
+
+		containersChanged: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.syncInterval < MinSyncInterval {
 		db.Close()
-		return nil, fmt.Errorf("ping database: %w", err)
-	}
-
-	// Ensure static_routes table exists
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS static_routes (
-			id SERIAL PRIMARY KEY,
-			host TEXT NOT NULL,
-			path_prefix TEXT NOT NULL,
-			target TEXT NOT NULL,
-			strip_prefix BOOLEAN NOT NULL DEFAULT false,
-			priority INT NOT NULL DEFAULT 0,
-			UNIQUE(host, path_prefix)
-		)
-	`); err != nil {
+		cancel()
+		return nil, fmt.Errorf("sync interval %v is below the minimum of %v", r.syncInterval, MinSyncInterval)
+	}
+	if r.cacheSize < 0 {
 		db.Close()
-		return nil, fmt.Errorf("create static_routes table: %w", err)
+		cancel()
+		return nil, fmt.Errorf("route cache size must not be negative, got %d", r.cacheSize)
+	}
+	if r.baseDomain != "" {
+		if err := ValidateBaseDomain(r.baseDomain); err != nil {
+			db.Close()
+			cancel()
+			return nil, err
+		}
+	}
+	if r.dnsTemplate != "" {
+		if err := ValidateDNSTemplate(r.dnsTemplate); err != nil {
+			db.Close()
+			cancel()
+			return nil, err
+		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	r := &Router{
-		db:     db,
-		ctx:    ctx,
-		cancel: cancel,
+	// Test connection, riding out a database that is still starting
+	if err := pingWithBackoff(ctx, db, r.connectTimeout); err != nil {
+		db.Close()
+		cancel()
+		return nil, err
+	}
+	r.connected.Store(true)
+
+	if err := ensureSchema(db); err != nil {
+		db.Close()
+		cancel()
+		return nil, err
 	}
 
 	// Initial load of all containers and routes into memory
@@ -98,20 +279,138 @@ func New(connStr string) (*Router, error) {
 	}
 
 	// Start background sync
+	if r.notify {
+		r.startListener(connStr)
+	}
 	r.wg.Add(1)
 	go r.syncLoop()
 
 	return r, nil
 }
 
-// loadAll loads all running containers from the database into memory.
+// schemaStatements create or migrate the tables and columns owned by the gateway.
+// Each statement must be idempotent since it runs on every startup.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS static_routes (
+		id SERIAL PRIMARY KEY,
+		host TEXT NOT NULL,
+		path_prefix TEXT NOT NULL,
+		target TEXT NOT NULL,
+		strip_prefix BOOLEAN NOT NULL DEFAULT false,
+		priority INT NOT NULL DEFAULT 0,
+		UNIQUE(host, path_prefix)
+	)`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS upstream_tls BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS upstream_server_name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS upstream_ca_file TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS draining BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS slow_dial_threshold_ms INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS dial_timeout_ms INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS idle_timeout_ms INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS hash_key TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS canary_target TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS canary_step_percent INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS canary_step_interval_ms INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS canary_started_at TIMESTAMPTZ`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS buffer_body BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS max_body_bytes BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS request_timeout_ms INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS dial_retries INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS match_type TEXT NOT NULL DEFAULT 'prefix'`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS header_name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS header_value TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS target_weights INT[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS proxy_protocol TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS rate_limit DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS rate_burst INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS rate_limit_by_client BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS compress BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS basic_auth_user TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS basic_auth_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS client_ca_file TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS response_headers JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE static_routes ADD COLUMN IF NOT EXISTS replace_prefix TEXT NOT NULL DEFAULT ''`,
+	// Routes for the same path may differ only in their header condition
+	`ALTER TABLE static_routes DROP CONSTRAINT IF EXISTS static_routes_host_path_prefix_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS static_routes_host_path_header_key
+		ON static_routes (host, path_prefix, header_name, header_value)`,
+	// Per-container method restrictions (NULL = all methods)
+	`ALTER TABLE containers ADD COLUMN IF NOT EXISTS allowed_methods TEXT[]`,
+	// Per-container SSH key allowlists, one authorized_keys line per row
+	`CREATE TABLE IF NOT EXISTS authorized_keys (
+		id SERIAL PRIMARY KEY,
+		container_id TEXT NOT NULL,
+		public_key TEXT NOT NULL,
+		UNIQUE(container_id, public_key)
+	)`,
+	// Friendly hostnames for containers, checked before the ID subdomain
+	`CREATE TABLE IF NOT EXISTS aliases (
+		hostname TEXT PRIMARY KEY,
+		container_id TEXT NOT NULL
+	)`,
+	// SSH session audit trail, written when the ssh_audit sink is enabled
+	`CREATE TABLE IF NOT EXISTS ssh_audit (
+		id BIGSERIAL PRIMARY KEY,
+		client_ip TEXT NOT NULL,
+		key_fingerprint TEXT NOT NULL,
+		container_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		result TEXT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		ended_at TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL,
+		bytes_up BIGINT NOT NULL,
+		bytes_down BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS ssh_audit_container_started ON ssh_audit (container_id, started_at)`,
+}
+
+// ensureSchema applies schemaStatements in order.
+func ensureSchema(db *sql.DB) error {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("ensure schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadAll loads all running containers and static routes from the database into memory.
 func (r *Router) loadAll() error {
-	// Load containers
+	if err := r.loadContainers(); err != nil {
+		return err
+	}
+	if _, err := r.refreshStaticRoutes(); err != nil {
+		return err
+	}
+	r.loaded.Store(true)
+	r.lastSyncNanos.Store(time.Now().UnixNano())
+	return nil
+}
+
+// loadContainers loads running containers and their ingress rules into the cache.
+// The scan is skipped when the change token is unchanged, and only entries
+// that differ from the current cache are replaced.
+func (r *Router) loadContainers() error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	token, err := r.changeToken(containersTokenQuery)
+	if err != nil {
+		return err
+	}
+	if token == r.containersToken {
+		return nil
+	}
+
 	rows, err := r.db.Query(`
 		SELECT id, namespace, external_ip, status,
-		       COALESCE(ssh_enabled, false), COALESCE(https_enabled, false)
+		       COALESCE(ssh_enabled, false), COALESCE(https_enabled, false),
+		       allowed_methods
 		FROM containers
-		WHERE status = 'running' AND external_ip IS NOT NULL AND external_ip != ''
+		WHERE status = 'running'
 	`)
 	if err != nil {
 		return fmt.Errorf("query containers: %w", err)
@@ -123,15 +422,24 @@ func (r *Router) loadAll() error {
 	for rows.Next() {
 		var c Container
 		var externalIP sql.NullString
+		var allowedMethods []string
 		if err := rows.Scan(&c.ID, &c.Namespace, &externalIP, &c.Status,
-			&c.SSHEnabled, &c.HTTPSEnabled); err != nil {
+			&c.SSHEnabled, &c.HTTPSEnabled, pq.Array(&allowedMethods)); err != nil {
 			return fmt.Errorf("scan container: %w", err)
 		}
+		for _, m := range allowedMethods {
+			if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+				c.AllowedMethods = append(c.AllowedMethods, m)
+			}
+		}
+		// Containers without an IP are only routable through DNS fallback
 		if externalIP.Valid && externalIP.String != "" {
 			c.ExternalIP = externalIP.String
-			c.PortMap = make(map[int]int)
-			newCache[c.ID] = &c
+		} else if r.dnsTemplate == "" {
+			continue
 		}
+		c.PortMap = make(map[int]int)
+		newCache[c.ID] = &c
 	}
 	if err := rows.Err(); err != nil {
 		return fmt.Errorf("iterate containers: %w", err)
@@ -157,98 +465,166 @@ func (r *Router) loadAll() error {
 		}
 	}
 
-	// Clear old entries and add new ones
+	if err := ruleRows.Err(); err != nil {
+		return fmt.Errorf("iterate ingress rules: %w", err)
+	}
+
+	if err := r.loadAuthorizedKeys(newCache); err != nil {
+		return err
+	}
+	aliases, err := r.loadAliases(newCache)
+	if err != nil {
+		return err
+	}
+
+	// Remove containers that are gone and replace those that changed
+	var removed, updated int
 	r.cache.Range(func(key, value any) bool {
 		if _, exists := newCache[key.(string)]; !exists {
 			r.cache.Delete(key)
+			removed++
 		}
 		return true
 	})
 	for id, c := range newCache {
+		if old, ok := r.cache.Load(id); ok && reflect.DeepEqual(old.(*Container), c) {
+			continue
+		}
 		r.cache.Store(id, c)
+		updated++
 	}
+	r.aliases.Store(&aliases)
+	r.containersToken = token
 
-	slog.Debug("loaded containers into cache", "count", len(newCache))
-
-	// Load static routes into radix tree
-	routeRows, err := r.db.Query(`
-		SELECT id, host, path_prefix, target, strip_prefix, priority
-		FROM static_routes
-	`)
-	if err != nil {
-		return fmt.Errorf("query static routes: %w", err)
-	}
-	defer routeRows.Close()
-
-	newTable := newRouteTable()
-	var routes []StaticRoute
-	for routeRows.Next() {
-		var route StaticRoute
-		if err := routeRows.Scan(&route.ID, &route.Host, &route.PathPrefix,
-			&route.Target, &route.StripPrefix, &route.Priority); err != nil {
-			return fmt.Errorf("scan static route: %w", err)
+	slog.Debug("loaded containers into cache", "count", len(newCache), "updated", updated, "removed", removed, "aliases", len(aliases))
+	if updated > 0 || removed > 0 {
+		select {
+		case r.containersChanged <- struct{}{}:
+		default:
 		}
-		routes = append(routes, route)
-		newTable.insert(&routes[len(routes)-1])
 	}
-	if err := routeRows.Err(); err != nil {
-		return fmt.Errorf("iterate static routes: %w", err)
-	}
-
-	r.routesMu.Lock()
-	r.routeTable = newTable
-	r.routesList = routes
-	r.routesMu.Unlock()
-
-	// Log all loaded routes for debugging
-	for _, route := range routes {
-		slog.Debug("loaded route", "host", route.Host, "path", route.PathPrefix, "target", route.Target, "strip_prefix", route.StripPrefix)
-	}
-	slog.Debug("loaded static routes into cache", "count", len(routes))
 	return nil
 }
 
-// syncLoop periodically syncs the cache from the database.
+// ContainersChanged returns a channel that receives after a sync adds,
+// changes or removes cached containers, and with them possibly the set of
+// ingress ports. Signals coalesce while nobody is receiving.
+func (r *Router) ContainersChanged() <-chan struct{} {
+	return r.containersChanged
+}
+
+// syncLoop periodically syncs the cache from the database, and reloads on
+// change notifications when a listener is active.
 func (r *Router) syncLoop() {
 	defer r.wg.Done()
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(r.syncInterval)
 	defer ticker.Stop()
 
+	var notifications <-chan *pq.Notification
+	if r.listener != nil {
+		notifications = r.listener.Notify
+	}
+
+	// While the database is unreachable, reconnection attempts back off
+	// exponentially and regular syncs are skipped
+	var backoff time.Duration
+	var retry <-chan time.Time
+	scheduleRetry := func(d time.Duration) {
+		backoff = d
+		retry = nil
+		if d > 0 {
+			retry = time.After(d)
+		}
+	}
+
 	for {
 		select {
 		case <-r.ctx.Done():
 			return
+		case <-retry:
+			scheduleRetry(r.reconnect(backoff))
 		case <-ticker.C:
+			if !r.connected.Load() {
+				if retry == nil {
+					scheduleRetry(minReconnectBackoff)
+				}
+				continue
+			}
 			if err := r.loadAll(); err != nil {
-				slog.Error("failed to sync cache", "error", err)
+				scheduleRetry(r.syncFailed("failed to sync cache", err))
+			}
+		case n := <-notifications:
+			scope := r.coalesceChanges(n, notifications)
+			if !r.connected.Load() {
+				continue
+			}
+			if err := r.reload(scope); err != nil {
+				scheduleRetry(r.syncFailed("failed to reload after change notification", err))
 			}
 		}
 	}
 }
 
+// SyncInterval returns how often the router reloads from the database.
+func (r *Router) SyncInterval() time.Duration {
+	return r.syncInterval
+}
+
+// Ping checks that the database is reachable.
+func (r *Router) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Loaded reports whether containers and routes have been loaded from the
+// database at least once.
+func (r *Router) Loaded() bool {
+	return r.loaded.Load()
+}
+
 // Close closes the database connection and stops background sync.
 func (r *Router) Close() error {
 	r.cancel()
 	r.wg.Wait()
+	if r.listener != nil {
+		r.listener.Close()
+	}
 	return r.db.Close()
 }
 
-// Resolve looks up a container by ID from the in-memory cache.
+// Resolve looks up a container by ID from the in-memory cache. When the
+// cache has not synced within the max staleness, the entry is returned
+// together with ErrStale.
 func (r *Router) Resolve(containerID string) (*Container, error) {
-	if cached, ok := r.cache.Load(containerID); ok {
-		c := cached.(*Container)
-		if c.ExternalIP != "" && c.Status == "running" {
-			return c, nil
+	cached, ok := r.cache.Load(containerID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := cached.(*Container)
+	if c.Status != "running" {
+		return nil, ErrNotFound
+	}
+	if c.ExternalIP == "" {
+		resolved, ok := r.resolveViaDNS(c)
+		if !ok {
+			return nil, ErrNoIP
 		}
+		c = resolved
+	}
+	if r.stale() {
+		return c, ErrStale
 	}
-	return nil, ErrNotFound
+	return c, nil
 }
 
-// ResolveByHostname extracts container ID from hostname (e.g., "abc123.cloud.eddisonso.com")
-// and resolves it.
+// ResolveByHostname resolves the container a hostname is an alias of, or
+// else extracts the container ID from the hostname (e.g., "abc123.cloud.eddisonso.com")
+// and resolves it. With a base domain the ID may span several labels.
 func (r *Router) ResolveByHostname(hostname string) (*Container, error) {
-	// Extract first subdomain as container ID
-	containerID := extractContainerID(hostname)
+	if containerID := r.aliasTarget(hostname); containerID != "" {
+		return r.Resolve(containerID)
+	}
+
+	containerID := r.containerIDFromHost(hostname)
 	if containerID == "" {
 		return nil, ErrNotFound
 	}
@@ -284,42 +660,90 @@ func (r *Router) InvalidateCache(containerID string) {
 	r.cache.Delete(containerID)
 }
 
+// loadAuthorizedKeys attaches the SSH keys of the authorized_keys table to
+// the containers in cache. Lines that do not parse are logged and skipped.
+func (r *Router) loadAuthorizedKeys(cache map[string]*Container) error {
+	rows, err := r.db.Query(`SELECT container_id, public_key FROM authorized_keys ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("query authorized keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var containerID, line string
+		if err := rows.Scan(&containerID, &line); err != nil {
+			return fmt.Errorf("scan authorized key: %w", err)
+		}
+		c, exists := cache[containerID]
+		if !exists {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			slog.Warn("skipping invalid authorized key", "container", containerID, "error", err)
+			continue
+		}
+		c.AuthorizedKeys = append(c.AuthorizedKeys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate authorized keys: %w", err)
+	}
+	return nil
+}
+
+// AuthorizedKeys returns the SSH public keys allowed to connect to a
+// container, from the cache. An empty list means the container has no
+// keys registered and accepts any key. The keys are read straight from the
+// cache entry, so a stale entry or one whose IP cannot be resolved still
+// enforces them. Unknown and stopped containers give ErrNotFound.
+func (r *Router) AuthorizedKeys(containerID string) ([]ssh.PublicKey, error) {
+	cached, ok := r.cache.Load(containerID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := cached.(*Container)
+	if c.Status != "running" {
+		return nil, ErrNotFound
+	}
+	return c.AuthorizedKeys, nil
+}
+
 // ResolveSSH resolves a container by ID and checks SSH access is enabled.
 func (r *Router) ResolveSSH(containerID string) (*Container, error) {
 	c, err := r.Resolve(containerID)
-	if err != nil {
+	if c == nil {
 		return nil, err
 	}
 	if !c.SSHEnabled {
 		return nil, ErrProtocolBlocked
 	}
-	return c, nil
+	return c, err
 }
 
 // ResolveHTTPS resolves a container by hostname and checks HTTPS access is enabled.
 func (r *Router) ResolveHTTPS(hostname string) (*Container, error) {
 	c, err := r.ResolveByHostname(hostname)
-	if err != nil {
+	if c == nil {
 		return nil, err
 	}
 	if !c.HTTPSEnabled {
 		return nil, ErrProtocolBlocked
 	}
-	return c, nil
+	return c, err
 }
 
 // ResolveHTTP resolves a container by hostname for a given ingress port.
 // Returns the container and target port if the ingress port is configured.
 func (r *Router) ResolveHTTP(hostname string, ingressPort int) (*Container, int, error) {
 	c, err := r.ResolveByHostname(hostname)
-	if err != nil {
+	if c == nil {
 		return nil, 0, err
 	}
 	targetPort, ok := c.PortMap[ingressPort]
 	if !ok {
 		return nil, 0, ErrProtocolBlocked
 	}
-	return c, targetPort, nil
+	return c, targetPort, err
 }
 
 // GetAllIngressPorts returns all unique ingress ports configured across all containers.
@@ -340,22 +764,137 @@ func (r *Router) GetAllIngressPorts() []int {
 }
 
 // RegisterRoute adds or updates a static route in the database.
-// Priority is automatically set based on path length (longer paths = higher priority).
-func (r *Router) RegisterRoute(host, pathPrefix, target string, stripPrefix bool) error {
-	// Auto-calculate priority based on path specificity
-	priority := len(pathPrefix) * 10
+// A priority of 0 is automatically set based on path length (longer paths = higher priority).
+// A non-empty replacePrefix takes the place of the stripped prefix.
+func (r *Router) RegisterRoute(host, pathPrefix, target string, stripPrefix bool, replacePrefix string, priority int) error {
+	return r.RegisterStaticRoute(StaticRoute{
+		Host:          host,
+		PathPrefix:    pathPrefix,
+		Target:        target,
+		StripPrefix:   stripPrefix,
+		ReplacePrefix: replacePrefix,
+		Priority:      priority,
+	})
+}
+
+// autoPriority is the priority of a route registered without one, ranking
+// longer paths first so matching picks the longest prefix.
+func autoPriority(pathPrefix string) int {
 	if pathPrefix == "/" {
-		priority = 0 // Catch-all has lowest priority
+		return 0 // Catch-all has lowest priority
 	}
+	return len(pathPrefix) * 10
+}
+
+// ErrInvalidRoute wraps every error RegisterStaticRoute returns for a route
+// it refuses to store, as opposed to a database failure.
+var ErrInvalidRoute = errors.New("invalid route")
 
-	_, err := r.db.Exec(`
-		INSERT INTO static_routes (host, path_prefix, target, strip_prefix, priority)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (host, path_prefix) DO UPDATE SET
+// RegisterStaticRoute adds or updates a static route with all of its options.
+// ID is ignored. A zero Priority is derived from the path length.
+// Draining is preserved for existing routes and false for new ones.
+// A route that fails validation is rejected with an error wrapping
+// ErrInvalidRoute.
+func (r *Router) RegisterStaticRoute(route StaticRoute) error {
+	// Hosts match case-insensitively; paths stay case-sensitive
+	route.Host = strings.ToLower(route.Host)
+	if route.MatchType == "" {
+		route.MatchType = MatchPrefix
+	}
+	if err := r.validateStaticRoute(route); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRoute, err)
+	}
+	var canaryStartedAt *time.Time
+	if route.CanaryTarget != "" {
+		if route.CanaryStartedAt.IsZero() {
+			route.CanaryStartedAt = time.Now()
+		}
+		canaryStartedAt = &route.CanaryStartedAt
+	}
+	r.checkTargetReachable(route.Host, route.PathPrefix, route.Target)
+	labels, err := json.Marshal(route.Labels)
+	if err != nil {
+		return fmt.Errorf("encode labels: %w", err)
+	}
+	if route.Labels == nil {
+		labels = []byte("{}")
+	}
+	responseHeaders, err := json.Marshal(route.ResponseHeaders)
+	if err != nil {
+		return fmt.Errorf("encode response headers: %w", err)
+	}
+	if route.ResponseHeaders == nil {
+		responseHeaders = []byte("{}")
+	}
+
+	// Auto-calculate priority based on path specificity unless overridden
+	priority := route.Priority
+	if priority == 0 {
+		priority = autoPriority(route.PathPrefix)
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO static_routes (host, path_prefix, target, strip_prefix, priority,
+			upstream_tls, upstream_server_name, upstream_ca_file, labels,
+			slow_dial_threshold_ms, dial_timeout_ms, idle_timeout_ms, hash_key,
+			canary_target, canary_step_percent, canary_step_interval_ms, canary_started_at,
+			buffer_body, max_body_bytes, source, request_timeout_ms, dial_retries, match_type,
+			header_name, header_value, target_weights, proxy_protocol,
+			rate_limit, rate_burst, rate_limit_by_client, compress,
+			basic_auth_user, basic_auth_hash, client_ca_file, response_headers, replace_prefix)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23,
+			$24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36)
+		ON CONFLICT (host, path_prefix, header_name, header_value) DO UPDATE SET
 			target = EXCLUDED.target,
 			strip_prefix = EXCLUDED.strip_prefix,
-			priority = EXCLUDED.priority
-	`, host, pathPrefix, target, stripPrefix, priority)
+			priority = EXCLUDED.priority,
+			upstream_tls = EXCLUDED.upstream_tls,
+			upstream_server_name = EXCLUDED.upstream_server_name,
+			upstream_ca_file = EXCLUDED.upstream_ca_file,
+			labels = EXCLUDED.labels,
+			slow_dial_threshold_ms = EXCLUDED.slow_dial_threshold_ms,
+			dial_timeout_ms = EXCLUDED.dial_timeout_ms,
+			idle_timeout_ms = EXCLUDED.idle_timeout_ms,
+			hash_key = EXCLUDED.hash_key,
+			canary_target = EXCLUDED.canary_target,
+			canary_step_percent = EXCLUDED.canary_step_percent,
+			canary_step_interval_ms = EXCLUDED.canary_step_interval_ms,
+			-- Re-registering the same canary must not restart its ramp
+			canary_started_at = CASE
+				WHEN static_routes.canary_target = EXCLUDED.canary_target
+					AND static_routes.canary_started_at IS NOT NULL
+				THEN static_routes.canary_started_at
+				ELSE EXCLUDED.canary_started_at
+			END,
+			buffer_body = EXCLUDED.buffer_body,
+			max_body_bytes = EXCLUDED.max_body_bytes,
+			source = EXCLUDED.source,
+			request_timeout_ms = EXCLUDED.request_timeout_ms,
+			dial_retries = EXCLUDED.dial_retries,
+			match_type = EXCLUDED.match_type,
+			target_weights = EXCLUDED.target_weights,
+			proxy_protocol = EXCLUDED.proxy_protocol,
+			rate_limit = EXCLUDED.rate_limit,
+			rate_burst = EXCLUDED.rate_burst,
+			rate_limit_by_client = EXCLUDED.rate_limit_by_client,
+			compress = EXCLUDED.compress,
+			basic_auth_user = EXCLUDED.basic_auth_user,
+			basic_auth_hash = EXCLUDED.basic_auth_hash,
+			client_ca_file = EXCLUDED.client_ca_file,
+			response_headers = EXCLUDED.response_headers,
+			replace_prefix = EXCLUDED.replace_prefix
+	`, route.Host, route.PathPrefix, route.Target, route.StripPrefix, priority,
+		route.UpstreamTLS, route.UpstreamServerName, route.UpstreamCAFile, labels,
+		route.SlowDialThreshold.Milliseconds(), route.DialTimeout.Milliseconds(), route.IdleTimeout.Milliseconds(),
+		route.HashKey,
+		route.CanaryTarget, route.CanaryStepPercent, route.CanaryStepInterval.Milliseconds(), canaryStartedAt,
+		route.BufferBody, route.MaxBodyBytes, route.Source,
+		route.RequestTimeout.Milliseconds(), route.DialRetries, route.MatchType,
+		route.HeaderName, route.HeaderValue, pq.Array(weightsArray(route.Weights)),
+		route.ProxyProtocol,
+		route.RateLimit, route.RateBurst, route.RateLimitByClient, route.Compress,
+		route.BasicAuthUser, route.BasicAuthHash, route.ClientCAFile, responseHeaders,
+		route.ReplacePrefix)
 	if err != nil {
 		return fmt.Errorf("insert static route: %w", err)
 	}
@@ -364,11 +903,21 @@ func (r *Router) RegisterRoute(host, pathPrefix, target string, stripPrefix bool
 	return r.loadStaticRoutes()
 }
 
-// UnregisterRoute removes a static route from the database.
+// UnregisterRoute removes a static route without a header condition from
+// the database.
 func (r *Router) UnregisterRoute(host, pathPrefix string) error {
+	return r.UnregisterConditionalRoute(host, pathPrefix, "", "")
+}
+
+// UnregisterConditionalRoute removes the static route for host and
+// pathPrefix with the given header condition; empty name and value select
+// the unconditioned route.
+func (r *Router) UnregisterConditionalRoute(host, pathPrefix, headerName, headerValue string) error {
+	host = strings.ToLower(host)
 	result, err := r.db.Exec(`
-		DELETE FROM static_routes WHERE host = $1 AND path_prefix = $2
-	`, host, pathPrefix)
+		DELETE FROM static_routes
+		WHERE lower(host) = $1 AND path_prefix = $2 AND header_name = $3 AND header_value = $4
+	`, host, pathPrefix, headerName, headerValue)
 	if err != nil {
 		return fmt.Errorf("delete static route: %w", err)
 	}
@@ -378,48 +927,195 @@ func (r *Router) UnregisterRoute(host, pathPrefix string) error {
 		return ErrNoRoute
 	}
 
-	// Reload routes into cache
-	return r.loadStaticRoutes()
+	// Drop the route from the tree in place rather than reloading every
+	// route; the next sync picks up the new change token
+	key := routeKey{host, pathPrefix, headerName, headerValue}
+	r.routesMu.Lock()
+	if r.routeTable != nil {
+		r.routeTable.remove(key)
+	}
+	// The tree points into routesList, so filter into a new slice
+	remaining := make([]StaticRoute, 0, len(r.routesList))
+	for _, route := range r.routesList {
+		if route.key() != key {
+			remaining = append(remaining, route)
+		}
+	}
+	r.routesList = remaining
+	r.routesMu.Unlock()
+	r.dropStats(key)
+	return nil
 }
 
-// loadStaticRoutes reloads just the static routes from the database.
-func (r *Router) loadStaticRoutes() error {
-	routeRows, err := r.db.Query(`
-		SELECT id, host, path_prefix, target, strip_prefix, priority
-		FROM static_routes
-	`)
+// staticRouteColumns is the column list matching scanStaticRoute.
+const staticRouteColumns = `id, host, path_prefix, target, strip_prefix, priority,
+	upstream_tls, upstream_server_name, upstream_ca_file, labels, draining,
+	slow_dial_threshold_ms, dial_timeout_ms, idle_timeout_ms, hash_key,
+	canary_target, canary_step_percent, canary_step_interval_ms, canary_started_at,
+	buffer_body, max_body_bytes, source, request_timeout_ms, dial_retries, match_type,
+	header_name, header_value, target_weights, proxy_protocol,
+	rate_limit, rate_burst, rate_limit_by_client, compress,
+	basic_auth_user, basic_auth_hash, client_ca_file, response_headers, replace_prefix`
+
+// scanStaticRoute scans a row selected with staticRouteColumns.
+func scanStaticRoute(rows *sql.Rows) (StaticRoute, error) {
+	var route StaticRoute
+	var labels, responseHeaders []byte
+	var slowDialMs, dialTimeoutMs, idleTimeoutMs, canaryIntervalMs, requestTimeoutMs int
+	var canaryStartedAt sql.NullTime
+	var weights []int64
+	err := rows.Scan(&route.ID, &route.Host, &route.PathPrefix,
+		&route.Target, &route.StripPrefix, &route.Priority,
+		&route.UpstreamTLS, &route.UpstreamServerName, &route.UpstreamCAFile,
+		&labels, &route.Draining, &slowDialMs, &dialTimeoutMs, &idleTimeoutMs,
+		&route.HashKey,
+		&route.CanaryTarget, &route.CanaryStepPercent, &canaryIntervalMs, &canaryStartedAt,
+		&route.BufferBody, &route.MaxBodyBytes, &route.Source,
+		&requestTimeoutMs, &route.DialRetries, &route.MatchType,
+		&route.HeaderName, &route.HeaderValue, pq.Array(&weights),
+		&route.ProxyProtocol,
+		&route.RateLimit, &route.RateBurst, &route.RateLimitByClient, &route.Compress,
+		&route.BasicAuthUser, &route.BasicAuthHash, &route.ClientCAFile, &responseHeaders,
+		&route.ReplacePrefix)
+	if err != nil {
+		return route, err
+	}
+	route.SlowDialThreshold = time.Duration(slowDialMs) * time.Millisecond
+	route.DialTimeout = time.Duration(dialTimeoutMs) * time.Millisecond
+	route.IdleTimeout = time.Duration(idleTimeoutMs) * time.Millisecond
+	route.RequestTimeout = time.Duration(requestTimeoutMs) * time.Millisecond
+	route.CanaryStepInterval = time.Duration(canaryIntervalMs) * time.Millisecond
+	route.CanaryStartedAt = canaryStartedAt.Time
+	for _, w := range weights {
+		route.Weights = append(route.Weights, int(w))
+	}
+	if err := json.Unmarshal(labels, &route.Labels); err != nil {
+		return route, fmt.Errorf("decode labels: %w", err)
+	}
+	if err := json.Unmarshal(responseHeaders, &route.ResponseHeaders); err != nil {
+		return route, fmt.Errorf("decode response headers: %w", err)
+	}
+	return route, nil
+}
+
+// buildRouteTable indexes routes into a new radix tree caching up to
+// cacheSize lookups, skipping draining routes and regex routes whose
+// pattern does not compile.
+func buildRouteTable(routes []StaticRoute, cacheSize int) *routeTable {
+	table := newRouteTableWithCacheSize(cacheSize)
+	for i := range routes {
+		if routes[i].Draining {
+			continue
+		}
+		if routes[i].MatchType == MatchRegex {
+			pattern, err := regexp.Compile(routes[i].PathPrefix)
+			if err != nil {
+				slog.Error("skipping route with invalid pattern", "host", routes[i].Host, "pattern", routes[i].PathPrefix, "error", err)
+				continue
+			}
+			routes[i].pattern = pattern
+		}
+		routes[i].targets = SplitTargets(routes[i].Target)
+		routes[i].next = new(atomic.Uint64)
+		if routes[i].HashKey != "" && len(routes[i].targets) > 1 {
+			routes[i].ring = newHashRing(routes[i].targets)
+		}
+		routes[i].canaryCount = new(atomic.Uint64)
+		table.insert(&routes[i])
+	}
+	return table
+}
+
+// queryStaticRoutes reads all static routes from the database.
+func (r *Router) queryStaticRoutes() ([]StaticRoute, error) {
+	routeRows, err := r.db.Query(`SELECT ` + staticRouteColumns + ` FROM static_routes ORDER BY id`)
 	if err != nil {
-		return fmt.Errorf("query static routes: %w", err)
+		return nil, fmt.Errorf("query static routes: %w", err)
 	}
 	defer routeRows.Close()
 
-	// Build new route table
-	newTable := newRouteTable()
 	var routes []StaticRoute
-
 	for routeRows.Next() {
-		var route StaticRoute
-		if err := routeRows.Scan(&route.ID, &route.Host, &route.PathPrefix,
-			&route.Target, &route.StripPrefix, &route.Priority); err != nil {
-			return fmt.Errorf("scan static route: %w", err)
+		route, err := scanStaticRoute(routeRows)
+		if err != nil {
+			return nil, fmt.Errorf("scan static route: %w", err)
 		}
 		routes = append(routes, route)
-		newTable.insert(&routes[len(routes)-1])
 	}
+	if err := routeRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate static routes: %w", err)
+	}
+	return routes, nil
+}
+
+// loadStaticRoutes reloads just the static routes from the database.
+func (r *Router) loadStaticRoutes() error {
+	changed, err := r.refreshStaticRoutes()
+	if err != nil {
+		return err
+	}
+	if changed {
+		r.routesMu.RLock()
+		count := len(r.routesList)
+		r.routesMu.RUnlock()
+		slog.Info("reloaded static routes", "count", count)
+	}
+	return nil
+}
+
+// refreshStaticRoutes rebuilds the route table if static_routes changed
+// since the last load, reporting whether it did.
+func (r *Router) refreshStaticRoutes() (bool, error) {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	token, err := r.changeToken(routesTokenQuery)
+	if err != nil {
+		return false, err
+	}
+	if token == r.routesToken {
+		return false, nil
+	}
+
+	routes, err := r.queryStaticRoutes()
+	if err != nil {
+		return false, err
+	}
+	r.attachStats(routes)
+	newTable := buildRouteTable(routes, r.cacheSize)
+	newTable.stats = &r.cacheStats
 
 	r.routesMu.Lock()
 	r.routeTable = newTable
 	r.routesList = routes
 	r.routesMu.Unlock()
+	r.routesToken = token
 
-	slog.Info("reloaded static routes", "count", len(routes))
-	return nil
+	// Log all loaded routes for debugging
+	for _, route := range routes {
+		slog.Debug("loaded route", "host", route.Host, "path", route.PathPrefix, "target", route.Target, "strip_prefix", route.StripPrefix)
+	}
+	slog.Debug("loaded static routes into cache", "count", len(routes))
+	return true, nil
+}
+
+// HasStaticRoute reports whether host has any static route, for any path.
+// Unlike ResolveStaticRoute it has no side effects, so it suits checks that
+// are not serving a request: no target is picked and no hit is recorded.
+func (r *Router) HasStaticRoute(host string) bool {
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	return r.routeTable != nil && r.routeTable.hasHost(host)
 }
 
 // ResolveStaticRoute finds a matching static route for the given host and path.
-// Uses radix tree for O(path_length) lookup.
-// Returns the route and the path to use (with prefix stripped if configured).
-func (r *Router) ResolveStaticRoute(host, path string) (*StaticRoute, string, error) {
+// Uses radix tree for O(path_length) lookup. headers, which may be nil, are
+// checked against routes with a header condition.
+// Returns the route and the path to use (with prefix stripped or replaced if configured).
+// Each call counts as a request to the route: it records a hit and takes
+// the next target of a multi-target route, so checks that only need to
+// know a host is routed use HasStaticRoute.
+func (r *Router) ResolveStaticRoute(host, path string, headers Headers) (*StaticRoute, string, error) {
 	r.routesMu.RLock()
 	defer r.routesMu.RUnlock()
 
@@ -430,16 +1126,41 @@ func (r *Router) ResolveStaticRoute(host, path string) (*StaticRoute, string, er
 
 	slog.Debug("route resolution: looking up", "host", host, "path", path, "known_hosts", len(r.routeTable.hosts))
 
-	route, remaining := r.routeTable.lookup(host, path)
+	route, remaining := r.routeTable.lookup(host, path, headers)
 	if route == nil {
 		slog.Debug("route resolution: no route found", "host", host, "path", path)
 		return nil, "", ErrNoRoute
 	}
 
 	slog.Debug("route resolution: found match", "host", host, "path", path, "matched_prefix", route.PathPrefix, "target", route.Target, "remaining", remaining)
+	if route.stats != nil {
+		route.stats.record(time.Now())
+	}
+
+	// Multi-target routes resolve to a copy carrying the next target in
+	// turn, or a weighted random one
+	if len(route.targets) > 1 {
+		chosen := *route
+		if len(route.Weights) == len(route.targets) {
+			chosen.Target = r.weightedTarget(route)
+		} else {
+			chosen.Target = r.nextTarget(route)
+		}
+		slog.Debug("route resolution: chose target", "host", host, "matched_prefix", route.PathPrefix, "target", chosen.Target, "of", len(route.targets))
+		route = &chosen
+	}
+	if route.CanaryTarget != "" {
+		route = r.applyCanary(route)
+	}
 
 	targetPath := path
-	if route.StripPrefix && route.PathPrefix != "/" {
+	switch {
+	case route.StripPrefix && route.ReplacePrefix != "":
+		if route.PathPrefix == "/" {
+			remaining = path
+		}
+		targetPath = replacePathPrefix(route.ReplacePrefix, remaining)
+	case route.StripPrefix && route.PathPrefix != "/":
 		targetPath = remaining
 		if targetPath == "" {
 			targetPath = "/"
@@ -449,6 +1170,29 @@ func (r *Router) ResolveStaticRoute(host, path string) (*StaticRoute, string, er
 	return route, targetPath, nil
 }
 
+// nextTarget picks a multi-target route's next target round-robin, skipping
+// targets rejected by the target filter. If every target is rejected the
+// plain round-robin choice is used.
+func (r *Router) nextTarget(route *StaticRoute) string {
+	n := uint64(len(route.targets))
+	start := route.next.Add(1) - 1
+	if r.targetFilter != nil {
+		for i := uint64(0); i < n; i++ {
+			if t := route.targets[(start+i)%n]; r.targetFilter(t) {
+				return t
+			}
+		}
+	}
+	return route.targets[start%n]
+}
+
+// SetTargetFilter installs a function that reports whether a target address
+// may be chosen for multi-target routes, e.g. to skip unhealthy backends.
+// It must be set before routes are resolved.
+func (r *Router) SetTargetFilter(available func(addr string) bool) {
+	r.targetFilter = available
+}
+
 // ListRoutes returns all configured static routes.
 func (r *Router) ListRoutes() []StaticRoute {
 	r.routesMu.RLock()
@@ -456,7 +1200,9 @@ func (r *Router) ListRoutes() []StaticRoute {
 
 	// Return a copy to avoid race conditions
 	routes := make([]StaticRoute, len(r.routesList))
-	copy(routes, r.routesList)
+	for i, route := range r.routesList {
+		routes[i] = withStats(route)
+	}
 
 	// Sort by host, then path for display
 	sort.Slice(routes, func(i, j int) bool {
@@ -468,3 +1214,135 @@ func (r *Router) ListRoutes() []StaticRoute {
 
 	return routes
 }
+
+// ClientCAFile returns the client certificate CA bundle that host's routes
+// require on TLS termination, or "" when none of them demand mTLS. The
+// handshake happens before the path is known, so the requirement covers the
+// whole host.
+func (r *Router) ClientCAFile(host string) string {
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	for _, route := range r.routesList {
+		if route.ClientCAFile != "" && strings.EqualFold(route.Host, host) {
+			return route.ClientCAFile
+		}
+	}
+	return ""
+}
+
+// validateStaticRoute checks every option of route before it is stored.
+func (r *Router) validateStaticRoute(route StaticRoute) error {
+	if route.Host == "" {
+		return errors.New("host is required")
+	}
+	if route.MatchType != MatchRegex && !strings.HasPrefix(route.PathPrefix, "/") {
+		return fmt.Errorf("path %q must start with /", route.PathPrefix)
+	}
+	if err := ValidateTarget(route.Target); err != nil {
+		return err
+	}
+	if err := ValidateWeights(route.Target, route.Weights); err != nil {
+		return err
+	}
+	if err := ValidateMatch(route.MatchType, route.PathPrefix); err != nil {
+		return err
+	}
+	if err := ValidateReplacePrefix(route.ReplacePrefix, route.StripPrefix, route.MatchType); err != nil {
+		return err
+	}
+	if err := ValidateLabels(route.Labels); err != nil {
+		return err
+	}
+	if err := ValidateHeaderMatch(route.HeaderName, route.HeaderValue); err != nil {
+		return err
+	}
+	if err := ValidateProxyProtocol(route.ProxyProtocol); err != nil {
+		return err
+	}
+	if err := ValidateHashKey(route.HashKey); err != nil {
+		return err
+	}
+	if err := validateCanary(route); err != nil {
+		return err
+	}
+	if route.MaxBodyBytes < 0 {
+		return fmt.Errorf("max body bytes must not be negative, got %d", route.MaxBodyBytes)
+	}
+	if route.RequestTimeout < 0 {
+		return fmt.Errorf("request timeout must not be negative, got %v", route.RequestTimeout)
+	}
+	if route.DialRetries < 0 || route.DialRetries > MaxDialRetries {
+		return fmt.Errorf("dial retries must be between 0 and %d, got %d", MaxDialRetries, route.DialRetries)
+	}
+	if err := ValidateRateLimit(route.RateLimit, route.RateBurst); err != nil {
+		return err
+	}
+	if err := ValidateBasicAuth(route.BasicAuthUser, route.BasicAuthHash); err != nil {
+		return err
+	}
+	if err := ValidateResponseHeaders(route.ResponseHeaders); err != nil {
+		return err
+	}
+	return r.checkClientCAFile(route)
+}
+
+// checkClientCAFile rejects route if another route on its host already
+// requires a different client CA bundle. Only one bundle can be asked for
+// in the handshake, so ClientCAFile would otherwise pick one arbitrarily.
+func (r *Router) checkClientCAFile(route StaticRoute) error {
+	if route.ClientCAFile == "" {
+		return nil
+	}
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	for _, other := range r.routesList {
+		if other.ClientCAFile == "" || other.ClientCAFile == route.ClientCAFile || !strings.EqualFold(other.Host, route.Host) {
+			continue
+		}
+		if other.PathPrefix == route.PathPrefix && other.HeaderName == route.HeaderName && other.HeaderValue == route.HeaderValue {
+			// The route being updated
+			continue
+		}
+		return fmt.Errorf("client CA file %q conflicts with %q required by route %s%s", route.ClientCAFile, other.ClientCAFile, other.Host, other.PathPrefix)
+	}
+	return nil
+}
+
+// RequiresTermination reports whether any of host's routes authenticates
+// clients, with a client certificate or basic auth. The gateway can only
+// enforce that on connections it terminates, so such a host must never be
+// passed through.
+func (r *Router) RequiresTermination(host string) bool {
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	for _, route := range r.routesList {
+		if (route.ClientCAFile != "" || route.BasicAuthUser != "") && strings.EqualFold(route.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteCacheHits returns how many static route lookups the lookup cache
+// answered. Lookups for hosts with header-conditioned routes bypass the
+// cache and are not counted.
+func (r *Router) RouteCacheHits() uint64 {
+	return r.cacheStats.hits.Load()
+}
+
+// RouteCacheMisses returns how many cacheable static route lookups had to
+// walk the route tree.
+func (r *Router) RouteCacheMisses() uint64 {
+	return r.cacheStats.misses.Load()
+}
+
+// RouteCacheSize returns the number of lookups currently cached. Every
+// route change empties the cache.
+func (r *Router) RouteCacheSize() int {
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	if r.routeTable == nil {
+		return 0
+	}
+	return r.routeTable.cache.len()
+}
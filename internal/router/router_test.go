@@ -0,0 +1,164 @@
+package router
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHasStaticRoute(t *testing.T) {
+	r := NewStatic([]StaticRoute{
+		{Host: "app.example", PathPrefix: "/api", Target: "a:80"},
+		{Host: "re.example", PathPrefix: "^/v[0-9]+/", MatchType: MatchRegex, Target: "b:80"},
+		{Host: "gone.example", PathPrefix: "/", Target: "c:80", Draining: true},
+	})
+	for host, want := range map[string]bool{
+		"app.example":   true,
+		"re.example":    true,
+		"gone.example":  false,
+		"other.example": false,
+	} {
+		if got := r.HasStaticRoute(host); got != want {
+			t.Errorf("HasStaticRoute(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if (&Router{}).HasStaticRoute("app.example") {
+		t.Error("HasStaticRoute on a router without routes = true")
+	}
+}
+
+// A connection that probes for a host's routes before resolving its first
+// request must not skew the round-robin: with one request per connection
+// every target still gets its turn.
+func TestHasStaticRouteKeepsRoundRobin(t *testing.T) {
+	r := NewStatic([]StaticRoute{{Host: "app.example", PathPrefix: "/", Target: "a:80,b:80"}})
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		if !r.HasStaticRoute("app.example") {
+			t.Fatal("HasStaticRoute(app.example) = false")
+		}
+		route, _, err := r.ResolveStaticRoute("app.example", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[route.Target]++
+	}
+	if seen["a:80"] != 2 || seen["b:80"] != 2 {
+		t.Errorf("targets chosen %v, want each twice", seen)
+	}
+}
+
+func TestRouteHitsCountOnlyResolution(t *testing.T) {
+	r := NewStatic([]StaticRoute{{Host: "app.example", PathPrefix: "/", Target: "a:80"}})
+	for i := 0; i < 3; i++ {
+		r.HasStaticRoute("app.example")
+	}
+	if hits := r.ListRoutes()[0].Hits; hits != 0 {
+		t.Fatalf("hits after probing = %d, want 0", hits)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.ResolveStaticRoute("app.example", "/x", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	route := r.ListRoutes()[0]
+	if route.Hits != 2 {
+		t.Errorf("hits after two requests = %d, want 2", route.Hits)
+	}
+	if route.LastMatched.IsZero() {
+		t.Error("LastMatched not set after a request")
+	}
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Router{maxStaleness: time.Minute}
+	r.lastSyncNanos.Store(time.Now().Add(-time.Hour).UnixNano())
+	r.cache.Store("fresh", &Container{ID: "fresh", Status: "running", ExternalIP: "10.0.0.1", AuthorizedKeys: []ssh.PublicKey{key}})
+	r.cache.Store("stale", &Container{ID: "stale", Status: "running", ExternalIP: "10.0.0.2", AuthorizedKeys: []ssh.PublicKey{key}})
+	r.cache.Store("noip", &Container{ID: "noip", Status: "running", AuthorizedKeys: []ssh.PublicKey{key}})
+	r.cache.Store("open", &Container{ID: "open", Status: "running", ExternalIP: "10.0.0.3"})
+	r.cache.Store("stopped", &Container{ID: "stopped", Status: "stopped", AuthorizedKeys: []ssh.PublicKey{key}})
+
+	// Keys must be enforced whenever the entry exists, whether or not it
+	// could be routed to right now
+	for _, id := range []string{"fresh", "stale", "noip"} {
+		keys, err := r.AuthorizedKeys(id)
+		if err != nil || len(keys) != 1 {
+			t.Errorf("AuthorizedKeys(%q) = %d keys, %v; want 1 key", id, len(keys), err)
+		}
+	}
+	if keys, err := r.AuthorizedKeys("open"); err != nil || len(keys) != 0 {
+		t.Errorf("AuthorizedKeys(open) = %d keys, %v; want none", len(keys), err)
+	}
+	for _, id := range []string{"stopped", "missing"} {
+		if _, err := r.AuthorizedKeys(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("AuthorizedKeys(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestRequiresTermination(t *testing.T) {
+	r := NewStatic([]StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "a:80"},
+		{Host: "mtls.example", PathPrefix: "/", Target: "b:80", ClientCAFile: "/etc/ca.pem"},
+		{Host: "auth.example", PathPrefix: "/admin", Target: "c:80", BasicAuthUser: "admin"},
+		{Host: "auth.example", PathPrefix: "/", Target: "c:80"},
+	})
+	for host, want := range map[string]bool{
+		"app.example":   false,
+		"mtls.example":  true,
+		"AUTH.example":  true,
+		"other.example": false,
+	} {
+		if got := r.RequiresTermination(host); got != want {
+			t.Errorf("RequiresTermination(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestLoadContainersIPv6(t *testing.T) {
+	db, d := newRecordingDB(t)
+	d.rows = func(query string) *recordingRows {
+		switch {
+		case query == containersTokenQuery:
+			return tokenRows("c1")
+		case strings.Contains(query, "FROM containers"):
+			return &recordingRows{
+				cols: []string{"id", "namespace", "external_ip", "status", "ssh_enabled", "https_enabled", "allowed_methods"},
+				rows: [][]driver.Value{{"v6", "ns-v6", "fd00::1", "running", true, false, nil}},
+			}
+		}
+		return &recordingRows{cols: []string{"a", "b", "c"}}
+	}
+	r := NewStatic(nil)
+	r.db = db
+	if err := r.loadContainers(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.Resolve("v6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ExternalIP != "fd00::1" {
+		t.Errorf("ExternalIP = %q, want fd00::1 unchanged", c.ExternalIP)
+	}
+	if addr := net.JoinHostPort(c.ExternalIP, "22"); addr != "[fd00::1]:22" {
+		t.Errorf("SSH address = %q, want [fd00::1]:22", addr)
+	}
+}
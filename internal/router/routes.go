@@ -1,10 +1,24 @@
 package router
 
-import "log/slog"
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
 
 // DefaultCacheSize is the default number of recent lookups to cache.
 const DefaultCacheSize = 512
 
+// WithRouteCacheSize sets how many recent static route lookups are cached.
+// 0 disables the cache so every lookup walks the route tree.
+func WithRouteCacheSize(n int) Option {
+	return func(r *Router) {
+		r.cacheSize = n
+	}
+}
+
 // debugLog is a helper for debug-level logging with key-value pairs.
 func debugLog(msg string, args ...any) {
 	slog.Debug(msg, args...)
@@ -12,9 +26,94 @@ func debugLog(msg string, args ...any) {
 
 // radixNode is a node in the radix tree.
 type radixNode struct {
-	prefix   string
-	route    *StaticRoute // nil if this node is not a route endpoint
-	children []*radixNode
+	prefix      string
+	route       *StaticRoute   // prefix route ending here; nil if none
+	exact       *StaticRoute   // exact route for the path ending here; nil if none
+	conditional []*StaticRoute // prefix and exact routes ending here with a header condition
+	children    []*radixNode
+}
+
+// empty reports whether the node holds no routes and has no children.
+func (n *radixNode) empty() bool {
+	return n.route == nil && n.exact == nil && len(n.conditional) == 0 && len(n.children) == 0
+}
+
+// set stores route at the node, replacing the route with the same header
+// condition and match kind. Conditioned routes are kept in routeBefore order.
+func (n *radixNode) set(route *StaticRoute) {
+	switch {
+	case route.HeaderName != "":
+		replaced := false
+		for i, c := range n.conditional {
+			if c.key() == route.key() {
+				n.conditional[i] = route
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			n.conditional = append(n.conditional, route)
+		}
+		sort.SliceStable(n.conditional, func(i, j int) bool {
+			return routeBefore(n.conditional[i], n.conditional[j])
+		})
+	case route.MatchType == MatchExact:
+		n.exact = route
+	default:
+		n.route = route
+	}
+}
+
+// unset removes the route with the given key from the node.
+func (n *radixNode) unset(key routeKey) bool {
+	if key.headerName != "" {
+		for i, c := range n.conditional {
+			if c.key() == key {
+				n.conditional = append(n.conditional[:i], n.conditional[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+	if n.route != nil || n.exact != nil {
+		n.route, n.exact = nil, nil
+		return true
+	}
+	return false
+}
+
+// pick returns the node's exact or prefix route for a request: the first
+// route whose header condition matches, else the unconditioned one.
+func (n *radixNode) pick(exact bool, headers Headers) *StaticRoute {
+	for _, c := range n.conditional {
+		if (c.MatchType == MatchExact) == exact && c.matchesHeaders(headers) {
+			return c
+		}
+	}
+	if exact {
+		return n.exact
+	}
+	return n.route
+}
+
+// routeBefore reports whether a is tried before b when both match a request
+// equally well, such as two conditioned routes for the same path or two
+// regex routes: the higher Priority first, then by target, path and header
+// condition, so the winner never depends on the order routes were loaded in.
+func routeBefore(a, b *StaticRoute) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Target != b.Target {
+		return a.Target < b.Target
+	}
+	if a.PathPrefix != b.PathPrefix {
+		return a.PathPrefix < b.PathPrefix
+	}
+	if a.HeaderName != b.HeaderName {
+		return a.HeaderName < b.HeaderName
+	}
+	return a.HeaderValue < b.HeaderValue
 }
 
 // cacheEntry stores a cached lookup result.
@@ -31,14 +130,24 @@ type lruNode struct {
 	next  *lruNode
 }
 
-// lruCache is a fixed-size LRU cache for route lookups.
+// lruCache is a fixed-size LRU cache for route lookups. It is safe for
+// concurrent use: lookups run under the router's read lock, yet even a
+// cache hit reorders the list.
 type lruCache struct {
+	mu       sync.Mutex
 	capacity int
 	items    map[string]*lruNode
 	head     *lruNode // most recent
 	tail     *lruNode // least recent
 }
 
+// cacheStats counts route lookup cache hits and misses. The router shares
+// one across route table rebuilds so the totals only grow.
+type cacheStats struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
 func newLRUCache(capacity int) *lruCache {
 	return &lruCache{
 		capacity: capacity,
@@ -47,6 +156,8 @@ func newLRUCache(capacity int) *lruCache {
 }
 
 func (c *lruCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	node, ok := c.items[key]
 	if !ok {
 		return cacheEntry{}, false
@@ -56,6 +167,8 @@ func (c *lruCache) get(key string) (cacheEntry, bool) {
 }
 
 func (c *lruCache) put(key string, value cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if node, ok := c.items[key]; ok {
 		node.value = value
 		c.moveToFront(node)
@@ -72,11 +185,21 @@ func (c *lruCache) put(key string, value cacheEntry) {
 }
 
 func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.items = make(map[string]*lruNode, c.capacity)
 	c.head = nil
 	c.tail = nil
 }
 
+// len returns the number of cached lookups.
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// moveToFront and the list helpers after it expect mu to be held.
 func (c *lruCache) moveToFront(node *lruNode) {
 	if node == c.head {
 		return
@@ -119,12 +242,17 @@ func (c *lruCache) removeLast() {
 }
 
 // routeTable provides O(path_length) routing via radix tree.
-// Each host has its own radix tree for path matching.
-// Includes an LRU cache for hot paths.
+// Each host has its own radix tree for prefix and exact path matching,
+// and an ordered list of regex routes tried when no exact route matches.
+// Includes an LRU cache for hot paths of hosts without header conditions,
+// unless the cache size is 0.
 type routeTable struct {
-	hosts     map[string]*radixNode
-	cache     *lruCache
-	cacheSize int
+	hosts       map[string]*radixNode
+	regexes     map[string][]regexRoute // by host, in the order they are tried
+	conditional map[string]bool         // hosts with header-conditioned routes, which bypass the cache
+	cache       *lruCache
+	cacheSize   int
+	stats       *cacheStats
 }
 
 func newRouteTable() *routeTable {
@@ -133,18 +261,32 @@ func newRouteTable() *routeTable {
 
 func newRouteTableWithCacheSize(cacheSize int) *routeTable {
 	return &routeTable{
-		hosts:     make(map[string]*radixNode),
-		cache:     newLRUCache(cacheSize),
-		cacheSize: cacheSize,
+		hosts:       make(map[string]*radixNode),
+		regexes:     make(map[string][]regexRoute),
+		conditional: make(map[string]bool),
+		cache:       newLRUCache(cacheSize),
+		cacheSize:   cacheSize,
+		stats:       new(cacheStats),
 	}
 }
 
-// insert adds a route to the tree and clears the cache.
+// insert adds a route to the tree and clears the cache. Regex routes must
+// have their pattern compiled. Hosts are indexed in lowercase; lookups
+// expect the request host lowercased the same way.
 func (t *routeTable) insert(route *StaticRoute) {
-	root, ok := t.hosts[route.Host]
+	host := strings.ToLower(route.Host)
+	if route.HeaderName != "" {
+		t.conditional[host] = true
+	}
+	if route.MatchType == MatchRegex {
+		t.insertRegex(host, route)
+		t.cache.clear()
+		return
+	}
+	root, ok := t.hosts[host]
 	if !ok {
 		root = &radixNode{}
-		t.hosts[route.Host] = root
+		t.hosts[host] = root
 	}
 	insert(root, route.PathPrefix, route)
 	t.cache.clear() // Invalidate cache on route change
@@ -153,7 +295,7 @@ func (t *routeTable) insert(route *StaticRoute) {
 func insert(node *radixNode, path string, route *StaticRoute) {
 	for {
 		if len(path) == 0 {
-			node.route = route
+			node.set(route)
 			return
 		}
 
@@ -170,10 +312,9 @@ func insert(node *radixNode, path string, route *StaticRoute) {
 
 		if child == nil {
 			// No matching child - create new leaf
-			node.children = append(node.children, &radixNode{
-				prefix: path,
-				route:  route,
-			})
+			leaf := &radixNode{prefix: path}
+			leaf.set(route)
+			node.children = append(node.children, leaf)
 			return
 		}
 
@@ -201,52 +342,87 @@ func insert(node *radixNode, path string, route *StaticRoute) {
 
 		if common == len(path) {
 			// The new route ends at the split point
-			newChild.route = route
+			newChild.set(route)
 		} else {
 			// Add new leaf for remaining path
-			newChild.children = append(newChild.children, &radixNode{
-				prefix: path[common:],
-				route:  route,
-			})
+			leaf := &radixNode{prefix: path[common:]}
+			leaf.set(route)
+			newChild.children = append(newChild.children, leaf)
 		}
 		return
 	}
 }
 
-// lookup finds the longest matching prefix route.
-// Returns the route and remaining path after the matched prefix.
+// insertRegex adds a regex route to the list of host, replacing a route
+// with the same pattern and condition. Conditioned routes are kept ahead of
+// unconditioned ones so a matching condition wins for the same pattern;
+// otherwise routes are kept in routeBefore order.
+func (t *routeTable) insertRegex(host string, route *StaticRoute) {
+	list := t.regexes[host]
+	replaced := false
+	for i, rr := range list {
+		if rr.route.key() == route.key() {
+			list[i] = regexRoute{pattern: route.pattern, route: route}
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		list = append(list, regexRoute{pattern: route.pattern, route: route})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].route, list[j].route
+		if (a.HeaderName != "") != (b.HeaderName != "") {
+			return a.HeaderName != ""
+		}
+		return routeBefore(a, b)
+	})
+	t.regexes[host] = list
+}
+
+// hasHost reports whether the table holds any route for host.
+func (t *routeTable) hasHost(host string) bool {
+	return t.hosts[host] != nil || len(t.regexes[host]) > 0
+}
+
+// lookup finds the route for a path: an exact route for the whole path,
+// else the first matching regex route, else the matching prefix route with
+// the highest priority, the longer prefix on a tie. With derived priorities
+// that is the longest matching prefix.
+// At each of these, a route whose header condition matches headers wins
+// over the unconditioned route; headers may be nil.
+// Returns the route and remaining path after the matched prefix; regex
+// matches leave the path whole and exact matches leave "/".
 // Checks LRU cache first for O(1) hot path lookup, falls back to
 // O(path_length) radix tree traversal on cache miss.
-func (t *routeTable) lookup(host, path string) (*StaticRoute, string) {
-	// Check cache first
+func (t *routeTable) lookup(host, path string, headers Headers) (*StaticRoute, string) {
+	// Results for hosts with header conditions depend on more than the path
+	cacheable := t.cacheSize > 0 && !t.conditional[host]
 	cacheKey := host + ":" + path
-	if entry, ok := t.cache.get(cacheKey); ok {
-		debugLog("radix lookup: cache hit", "host", host, "path", path)
-		return entry.route, entry.remaining
+	if cacheable {
+		if entry, ok := t.cache.get(cacheKey); ok {
+			t.stats.hits.Add(1)
+			debugLog("radix lookup: cache hit", "host", host, "path", path)
+			return entry.route, entry.remaining
+		}
+		t.stats.misses.Add(1)
 	}
 
 	debugLog("radix lookup: cache miss, traversing tree", "host", host, "path", path)
 
 	// Cache miss - traverse radix tree
-	root, ok := t.hosts[host]
-	if !ok {
-		debugLog("radix lookup: host not found in route table", "host", host, "path", path)
-		return nil, path
-	}
-
 	var bestRoute *StaticRoute
 	var bestLen int
 	matched := 0
-	node := root
+	node := t.hosts[host]
 	remainingPath := path
 
 	// Check root
-	if node.route != nil {
-		bestRoute = node.route
-		bestLen = 0
+	if node != nil {
+		bestRoute = node.pick(false, headers)
 	}
 
-	for len(remainingPath) > 0 {
+	for node != nil && len(remainingPath) > 0 {
 		// Find child matching first character
 		var child *radixNode
 		for _, c := range node.children {
@@ -277,22 +453,39 @@ func (t *routeTable) lookup(host, path string) (*StaticRoute, string) {
 		remainingPath = remainingPath[len(child.prefix):]
 		node = child
 
-		if node.route != nil {
-			bestRoute = node.route
+		if route := node.pick(false, headers); route != nil && (bestRoute == nil || route.Priority >= bestRoute.Priority) {
+			bestRoute = route
 			bestLen = matched
 		}
 	}
 
+	if node != nil && remainingPath == "" {
+		if exact := node.pick(true, headers); exact != nil {
+			debugLog("radix lookup: found exact route", "host", host, "path", path, "target", exact.Target)
+			if cacheable {
+				t.cache.put(cacheKey, cacheEntry{route: exact, remaining: "/"})
+			}
+			return exact, "/"
+		}
+	}
+	for _, rr := range t.regexes[host] {
+		if rr.route.matchesHeaders(headers) && rr.pattern.MatchString(path) {
+			debugLog("radix lookup: found regex route", "host", host, "path", path, "pattern", rr.route.PathPrefix, "target", rr.route.Target)
+			if cacheable {
+				t.cache.put(cacheKey, cacheEntry{route: rr.route, remaining: path})
+			}
+			return rr.route, path
+		}
+	}
+
 	if bestRoute == nil {
 		debugLog("radix lookup: no matching route", "host", host, "path", path)
 		return nil, path
 	}
 
-	// Calculate remaining path
-	remaining := remainingPath
-	if bestLen == 0 && bestRoute.PathPrefix == "/" {
-		// Root matched, remaining is everything after /
-	}
+	// Remaining path is measured from the best match, not from the deepest
+	// node visited, which may be a split or exact-only node below it
+	remaining := path[bestLen:]
 	if remaining == "" {
 		remaining = "/"
 	}
@@ -300,23 +493,42 @@ func (t *routeTable) lookup(host, path string) (*StaticRoute, string) {
 	debugLog("radix lookup: found route", "host", host, "path", path, "matched_prefix", bestRoute.PathPrefix, "target", bestRoute.Target, "remaining", remaining)
 
 	// Add to cache
-	t.cache.put(cacheKey, cacheEntry{route: bestRoute, remaining: remaining})
+	if cacheable {
+		t.cache.put(cacheKey, cacheEntry{route: bestRoute, remaining: remaining})
+	}
 
 	return bestRoute, remaining
 }
 
-// remove deletes a route from the tree and clears the cache.
-func (t *routeTable) remove(host, pathPrefix string) bool {
-	root, ok := t.hosts[host]
-	if !ok {
-		return false
+// remove deletes the route with key, of any match type, from the table and
+// clears the cache.
+func (t *routeTable) remove(key routeKey) bool {
+	host, pathPrefix := strings.ToLower(key.host), key.path
+	removed := false
+	if list := t.regexes[host]; len(list) > 0 {
+		kept := make([]regexRoute, 0, len(list))
+		for _, rr := range list {
+			if rr.route.key() == key {
+				removed = true
+				continue
+			}
+			kept = append(kept, rr)
+		}
+		if len(kept) == 0 {
+			delete(t.regexes, host)
+		} else {
+			t.regexes[host] = kept
+		}
 	}
 
-	removed := removeNode(root, pathPrefix)
-
-	// Clean up empty host
-	if root.route == nil && len(root.children) == 0 {
-		delete(t.hosts, host)
+	if root, ok := t.hosts[host]; ok {
+		if removeNode(root, pathPrefix, key) {
+			removed = true
+		}
+		// Clean up empty host
+		if root.empty() {
+			delete(t.hosts, host)
+		}
 	}
 
 	if removed {
@@ -326,26 +538,24 @@ func (t *routeTable) remove(host, pathPrefix string) bool {
 	return removed
 }
 
-func removeNode(node *radixNode, path string) bool {
+func removeNode(node *radixNode, path string, key routeKey) bool {
 	if len(path) == 0 {
-		if node.route != nil {
-			node.route = nil
-			return true
-		}
-		return false
+		return node.unset(key)
 	}
 
 	for i, child := range node.children {
 		if len(child.prefix) > 0 && child.prefix[0] == path[0] {
 			if len(path) >= len(child.prefix) && path[:len(child.prefix)] == child.prefix {
-				if removeNode(child, path[len(child.prefix):]) {
+				if removeNode(child, path[len(child.prefix):], key) {
 					// Compact: remove empty leaves, merge single-child nodes
-					if child.route == nil && len(child.children) == 0 {
+					if child.empty() {
 						node.children = append(node.children[:i], node.children[i+1:]...)
-					} else if child.route == nil && len(child.children) == 1 {
+					} else if child.route == nil && child.exact == nil && len(child.conditional) == 0 && len(child.children) == 1 {
 						only := child.children[0]
 						child.prefix = child.prefix + only.prefix
 						child.route = only.route
+						child.exact = only.exact
+						child.conditional = only.conditional
 						child.children = only.children
 					}
 					return true
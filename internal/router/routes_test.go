@@ -0,0 +1,278 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestLookupConcurrent hammers lookups from many goroutines through a cache
+// small enough that hits, misses and evictions all interleave. Run with
+// -race to check the cache's locking.
+func TestLookupConcurrent(t *testing.T) {
+	var routes []StaticRoute
+	for i := 0; i < 8; i++ {
+		routes = append(routes, StaticRoute{Host: "app.example", PathPrefix: fmt.Sprintf("/svc%d", i), Target: fmt.Sprintf("svc%d:80", i)})
+	}
+	table := buildRouteTable(routes, 4)
+	table.stats = &cacheStats{}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				svc := (g + i) % 8
+				route, _ := table.lookup("app.example", fmt.Sprintf("/svc%d/item/%d", svc, i%5), nil)
+				if want := fmt.Sprintf("svc%d:80", svc); route == nil || route.Target != want {
+					t.Errorf("lookup of /svc%d routed to %v, want %s", svc, route, want)
+					return
+				}
+				if i%500 == 0 {
+					table.cache.clear()
+				}
+				table.cache.len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkLRUList(t, table.cache)
+	if n := table.cache.len(); n > 4 {
+		t.Errorf("cache holds %d lookups, capacity is 4", n)
+	}
+}
+
+// checkLRUList checks that c's list links up with its map in both directions.
+func checkLRUList(t *testing.T, c *lruCache) {
+	t.Helper()
+	n := 0
+	var prev *lruNode
+	for node := c.head; node != nil; node = node.next {
+		if node.prev != prev {
+			t.Fatalf("node %q has a broken back link", node.key)
+		}
+		if c.items[node.key] != node {
+			t.Fatalf("node %q is not the one in the map", node.key)
+		}
+		prev = node
+		n++
+	}
+	if c.tail != prev {
+		t.Error("tail is not the last node in the list")
+	}
+	if n != len(c.items) {
+		t.Errorf("list has %d nodes, map has %d", n, len(c.items))
+	}
+}
+
+// lookupTarget returns the target and remaining path table routes host and
+// path to, or "" when no route matches.
+func lookupTarget(table *routeTable, host, path string) (string, string) {
+	route, remaining := table.lookup(host, path, nil)
+	if route == nil {
+		return "", remaining
+	}
+	return route.Target, remaining
+}
+
+func TestRouteTableInsertLookupRemove(t *testing.T) {
+	table := buildRouteTable([]StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "root:80"},
+		{Host: "app.example", PathPrefix: "/api", Target: "api:80"},
+		{Host: "app.example", PathPrefix: "/api/v1", Target: "v1:80"},
+		{Host: "app.example", PathPrefix: "/apx", Target: "apx:80"}, // splits the /api node
+		{Host: "app.example", PathPrefix: "/health", MatchType: MatchExact, Target: "health:80"},
+		{Host: "App.Example", PathPrefix: "/upper", Target: "upper:80"},
+	}, DefaultCacheSize)
+
+	// The remaining path is what follows the matched prefix, so for the "/"
+	// route it loses its leading slash
+	tests := []struct {
+		path, target, remaining string
+	}{
+		{"/", "root:80", "/"},
+		{"/about", "root:80", "about"},
+		{"/api", "api:80", "/"},
+		{"/api/users", "api:80", "/users"},
+		{"/api/v1/users", "v1:80", "/users"},
+		{"/api/v2", "api:80", "/v2"},
+		{"/apx/a", "apx:80", "/a"},
+		{"/ap", "root:80", "ap"},
+		{"/health", "health:80", "/"},
+		{"/health/deep", "root:80", "health/deep"},
+		{"/upper/x", "upper:80", "/x"},
+		{"/API", "root:80", "API"}, // paths stay case-sensitive
+	}
+	check := func(stage string) {
+		t.Helper()
+		for _, tt := range tests {
+			// Twice, so the second answer comes from the cache
+			for i := 0; i < 2; i++ {
+				target, remaining := lookupTarget(table, "app.example", tt.path)
+				if target != tt.target || remaining != tt.remaining {
+					t.Errorf("%s: lookup(%q) = %s %q, want %s %q", stage, tt.path, target, remaining, tt.target, tt.remaining)
+				}
+			}
+		}
+	}
+	check("after insert")
+
+	if table.remove(routeKey{host: "app.example", path: "/api/v2"}) {
+		t.Error("remove() of a route that does not exist reported success")
+	}
+	if !table.remove(routeKey{host: "app.example", path: "/api"}) {
+		t.Fatal("remove(/api) found nothing to remove")
+	}
+	for i := range tests {
+		switch tests[i].path {
+		case "/api":
+			tests[i].target, tests[i].remaining = "root:80", "api"
+		case "/api/users":
+			tests[i].target, tests[i].remaining = "root:80", "api/users"
+		case "/api/v2":
+			tests[i].target, tests[i].remaining = "root:80", "api/v2"
+		}
+	}
+	check("after removing /api")
+
+	for _, path := range []string{"/", "/api/v1", "/apx", "/health", "/upper"} {
+		if !table.remove(routeKey{host: "APP.example", path: path}) {
+			t.Errorf("remove(%s) found nothing to remove", path)
+		}
+	}
+	if table.hasHost("app.example") {
+		t.Error("host still in the table after removing all of its routes")
+	}
+	if target, _ := lookupTarget(table, "app.example", "/api/v1/users"); target != "" {
+		t.Errorf("lookup after removing every route = %s", target)
+	}
+}
+
+func TestUnregisterRouteRemovesInPlace(t *testing.T) {
+	db, d := newRecordingDB(t)
+	r := NewStatic([]StaticRoute{
+		{Host: "app.example", PathPrefix: "/", Target: "root:80"},
+		{Host: "app.example", PathPrefix: "/api", Target: "api:80"},
+	})
+	r.db = db
+	if route, _, _ := r.ResolveStaticRoute("app.example", "/api/x", nil); route == nil || route.Target != "api:80" {
+		t.Fatalf("before unregistering: /api/x routed to %v", route)
+	}
+
+	if err := r.UnregisterRoute("App.Example", "/api"); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.execs) != 1 || !strings.Contains(d.execs[0].query, "DELETE FROM static_routes") {
+		t.Errorf("statements run: %v, want one DELETE", d.execs)
+	}
+	if len(d.queries) != 0 {
+		t.Errorf("unregistering reloaded routes with %d queries", len(d.queries))
+	}
+	if route, remaining, _ := r.ResolveStaticRoute("app.example", "/api/x", nil); route == nil || route.Target != "root:80" || remaining != "/api/x" {
+		t.Errorf("after unregistering: /api/x routed to %v %q, want root:80", route, remaining)
+	}
+	if routes := r.ListRoutes(); len(routes) != 1 || routes[0].PathPrefix != "/" {
+		t.Errorf("ListRoutes() = %+v, want only /", routes)
+	}
+}
+
+// headerMap is a Headers backed by a map of canonical names.
+type headerMap map[string]string
+
+func (h headerMap) Get(name string) string { return h[name] }
+
+// TestEqualMatchTieBreak builds tables from two routes that match a request
+// equally well, in both orders, and checks the same route wins each time.
+func TestEqualMatchTieBreak(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    StaticRoute
+		path    string
+		headers Headers
+		want    string
+	}{
+		{
+			name: "regex by target",
+			a:    StaticRoute{Host: "app.example", PathPrefix: "^/a", MatchType: MatchRegex, Target: "b:80"},
+			b:    StaticRoute{Host: "app.example", PathPrefix: "^/[a-z]", MatchType: MatchRegex, Target: "a:80"},
+			path: "/abc",
+			want: "a:80",
+		},
+		{
+			name: "regex by priority",
+			a:    StaticRoute{Host: "app.example", PathPrefix: "^/a", MatchType: MatchRegex, Target: "b:80", Priority: 5},
+			b:    StaticRoute{Host: "app.example", PathPrefix: "^/[a-z]", MatchType: MatchRegex, Target: "a:80"},
+			path: "/abc",
+			want: "b:80",
+		},
+		{
+			name:    "header conditions by target",
+			a:       StaticRoute{Host: "app.example", PathPrefix: "/api", HeaderName: "X-Beta", HeaderValue: "1", Target: "z:80"},
+			b:       StaticRoute{Host: "app.example", PathPrefix: "/api", HeaderName: "X-Team", HeaderValue: "pay", Target: "y:80"},
+			path:    "/api/x",
+			headers: headerMap{"X-Beta": "1", "X-Team": "pay"},
+			want:    "y:80",
+		},
+		{
+			name:    "header conditions by priority",
+			a:       StaticRoute{Host: "app.example", PathPrefix: "/api", HeaderName: "X-Beta", HeaderValue: "1", Target: "z:80", Priority: 9},
+			b:       StaticRoute{Host: "app.example", PathPrefix: "/api", HeaderName: "X-Team", HeaderValue: "pay", Target: "y:80"},
+			path:    "/api/x",
+			headers: headerMap{"X-Beta": "1", "X-Team": "pay"},
+			want:    "z:80",
+		},
+		{
+			name: "priority over prefix length",
+			a:    StaticRoute{Host: "app.example", PathPrefix: "/api", Target: "api:80", Priority: 100},
+			b:    StaticRoute{Host: "app.example", PathPrefix: "/api/v1", Target: "v1:80", Priority: 7},
+			path: "/api/v1/users",
+			want: "api:80",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, routes := range [][]StaticRoute{{tt.a, tt.b}, {tt.b, tt.a}} {
+				table := buildRouteTable(routes, 0)
+				route, _ := table.lookup("app.example", tt.path, tt.headers)
+				if route == nil || route.Target != tt.want {
+					t.Errorf("routes loaded as %s, %s: %s went to %v, want %s", routes[0].Target, routes[1].Target, tt.path, route, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterStaticRouteClientCAConflict(t *testing.T) {
+	db, d := newRecordingDB(t)
+	r := &Router{db: db}
+	r.routesList = []StaticRoute{
+		{Host: "secure.example", PathPrefix: "/admin", Target: "a:80", ClientCAFile: "/etc/ca/admin.pem"},
+		{Host: "secure.example", PathPrefix: "/", Target: "a:80"},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		route StaticRoute
+		ok    bool
+	}{
+		{"same bundle", StaticRoute{Host: "secure.example", PathPrefix: "/ops", Target: "a:80", ClientCAFile: "/etc/ca/admin.pem"}, true},
+		{"no bundle", StaticRoute{Host: "secure.example", PathPrefix: "/public", Target: "a:80"}, true},
+		{"other host", StaticRoute{Host: "other.example", PathPrefix: "/", Target: "a:80", ClientCAFile: "/etc/ca/other.pem"}, true},
+		{"updating the route", StaticRoute{Host: "secure.example", PathPrefix: "/admin", Target: "a:80", ClientCAFile: "/etc/ca/new.pem"}, true},
+		{"different bundle", StaticRoute{Host: "SECURE.example", PathPrefix: "/ops", Target: "a:80", ClientCAFile: "/etc/ca/ops.pem"}, false},
+	} {
+		before := len(d.execs)
+		err := r.RegisterStaticRoute(tt.route)
+		inserted := len(d.execs) > before
+		if tt.ok && !inserted {
+			t.Errorf("%s: RegisterStaticRoute() did not insert, error = %v", tt.name, err)
+		}
+		if !tt.ok && (!errors.Is(err, ErrInvalidRoute) || inserted) {
+			t.Errorf("%s: RegisterStaticRoute() error = %v, inserted = %v; want ErrInvalidRoute before inserting", tt.name, err, inserted)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// routeStats counts the requests matched by one route. It is keyed by the
+// route's identity so counts carry over route table reloads.
+type routeStats struct {
+	hits        atomic.Uint64
+	lastMatched atomic.Int64 // unix nanoseconds; 0 if never matched
+}
+
+// record counts a request matched at now.
+func (s *routeStats) record(now time.Time) {
+	s.hits.Add(1)
+	s.lastMatched.Store(now.UnixNano())
+}
+
+// attachStats gives each route the stats of its identity, creating them for
+// new routes and dropping those of routes no longer present.
+func (r *Router) attachStats(routes []StaticRoute) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	stats := make(map[routeKey]*routeStats, len(routes))
+	for i := range routes {
+		key := routes[i].key()
+		s := r.routeStats[key]
+		if s == nil {
+			s = new(routeStats)
+		}
+		stats[key] = s
+		routes[i].stats = s
+	}
+	r.routeStats = stats
+}
+
+// dropStats forgets the stats of an unregistered route.
+func (r *Router) dropStats(key routeKey) {
+	r.statsMu.Lock()
+	delete(r.routeStats, key)
+	r.statsMu.Unlock()
+}
+
+// withStats returns route with Hits and LastMatched filled in.
+func withStats(route StaticRoute) StaticRoute {
+	if route.stats == nil {
+		return route
+	}
+	route.Hits = route.stats.hits.Load()
+	if ns := route.stats.lastMatched.Load(); ns != 0 {
+		route.LastMatched = time.Unix(0, ns)
+	}
+	return route
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultMaxStaleness is how long a cached container stays trusted without
+// a successful sync. It is far above any sync interval, so only an extended
+// database outage trips it.
+const DefaultMaxStaleness = time.Hour
+
+// ErrStale is returned alongside a container when the cache has not been
+// confirmed by a sync for longer than the max staleness. Callers may still
+// route to the returned container.
+var ErrStale = errors.New("container cache entry is stale")
+
+// WithMaxStaleness sets how long the cache may go without a successful sync
+// before Resolve reports ErrStale. Zero disables the check.
+func WithMaxStaleness(d time.Duration) Option {
+	return func(r *Router) {
+		r.maxStaleness = d
+	}
+}
+
+// CacheAge describes how current the container cache is.
+type CacheAge struct {
+	Containers   int       `json:"containers"`
+	OldestSynced time.Time `json:"oldest_synced,omitzero"`
+	OldestAge    string    `json:"oldest_age,omitempty"`
+	MaxStaleness string    `json:"max_staleness,omitempty"`
+	Stale        bool      `json:"stale"`
+}
+
+// CacheAge reports the number of cached containers and the age of the
+// cache. Every successful sync confirms every entry, so the oldest entry is
+// as old as the last sync.
+func (r *Router) CacheAge() CacheAge {
+	var age CacheAge
+	r.cache.Range(func(_, _ any) bool {
+		age.Containers++
+		return true
+	})
+	if age.Containers > 0 && r.lastSyncNanos.Load() != 0 {
+		age.OldestSynced = r.lastSync()
+		oldest := time.Since(age.OldestSynced)
+		age.OldestAge = oldest.Round(time.Second).String()
+		age.Stale = r.maxStaleness > 0 && oldest > r.maxStaleness
+	}
+	if r.maxStaleness > 0 {
+		age.MaxStaleness = r.maxStaleness.String()
+	}
+	return age
+}
+
+// stale reports whether the cache has gone too long without a successful
+// sync. A router that never synced holds no database entries to distrust.
+func (r *Router) stale() bool {
+	last := r.lastSyncNanos.Load()
+	return r.maxStaleness > 0 && last != 0 && time.Since(time.Unix(0, last)) > r.maxStaleness
+}
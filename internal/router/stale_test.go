@@ -0,0 +1,51 @@
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStaleness(t *testing.T) {
+	fleet := &fakeFleet{
+		tokens:     map[string]string{"containers": "c1", "routes": "r1"},
+		containers: map[string]string{"web": "ns-web"},
+	}
+	db, d := newRecordingDB(t)
+	d.rows = fleet.rows
+	r := NewStatic(nil)
+	r.db = db
+	r.routesToken = "r1"
+	r.maxStaleness = time.Minute
+
+	if err := r.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	web, _ := r.cache.Load("web")
+	if _, err := r.Resolve("web"); err != nil {
+		t.Fatalf("Resolve(web) after sync error = %v", err)
+	}
+
+	// An outage: no sync has succeeded for longer than the max staleness
+	r.lastSyncNanos.Store(time.Now().Add(-time.Hour).UnixNano())
+	if c, err := r.Resolve("web"); !errors.Is(err, ErrStale) || c == nil {
+		t.Errorf("Resolve(web) = %v, %v; want the container with ErrStale", c, err)
+	}
+	if age := r.CacheAge(); !age.Stale || age.Containers != 1 {
+		t.Errorf("CacheAge() = %+v, want 1 stale container", age)
+	}
+
+	// A sync that finds nothing changed confirms the entries in place
+	if err := r.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.cache.Load("web"); got != web {
+		t.Error("no-op sync replaced the cached container")
+	}
+	if _, err := r.Resolve("web"); err != nil {
+		t.Errorf("Resolve(web) after recovery error = %v", err)
+	}
+	if age := r.CacheAge(); age.Stale {
+		t.Errorf("CacheAge() = %+v, want fresh", age)
+	}
+}
@@ -0,0 +1,28 @@
+package router
+
+import "context"
+
+// NewStatic returns a router that serves a fixed set of static routes and
+// no containers, without a database, as if the routes had just been loaded.
+// It is meant for exercising routing on its own, e.g. in tests; anything
+// that writes to the database, such as registering a route, is not
+// supported.
+func NewStatic(routes []StaticRoute) *Router {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Router{
+		ctx:          ctx,
+		cancel:       cancel,
+		syncInterval: defaultSyncInterval,
+		maxStaleness: DefaultMaxStaleness,
+		cacheSize:    DefaultCacheSize,
+
+		containersChanged: make(chan struct{}, 1),
+	}
+	routes = append([]StaticRoute(nil), routes...)
+	r.attachStats(routes)
+	r.routeTable = buildRouteTable(routes, r.cacheSize)
+	r.routeTable.stats = &r.cacheStats
+	r.routesList = routes
+	r.loaded.Store(true)
+	return r
+}
@@ -0,0 +1,49 @@
+package router
+
+import "time"
+
+// Stats is a point-in-time summary of the router's state.
+type Stats struct {
+	Containers   int       `json:"containers"`    // cached containers
+	StaticRoutes int       `json:"static_routes"` // loaded static routes, draining ones included
+	Hosts        int       `json:"hosts"`         // distinct hosts in the route table
+	CacheHits    uint64    `json:"cache_hits"`
+	CacheMisses  uint64    `json:"cache_misses"`
+	CacheHitRate float64   `json:"cache_hit_rate"` // hits over cacheable lookups; 0 before any
+	LastSync     time.Time `json:"last_sync,omitzero"`
+	Connected    bool      `json:"connected"` // whether the database answered the last sync
+}
+
+// Stats returns a snapshot of the router's cache and route table sizes,
+// lookup cache effectiveness and database status. It takes the route read
+// lock only briefly, so it is safe to call during a sync.
+func (r *Router) Stats() Stats {
+	stats := Stats{
+		CacheHits:   r.cacheStats.hits.Load(),
+		CacheMisses: r.cacheStats.misses.Load(),
+		Connected:   r.Connected(),
+	}
+	if lookups := stats.CacheHits + stats.CacheMisses; lookups > 0 {
+		stats.CacheHitRate = float64(stats.CacheHits) / float64(lookups)
+	}
+	if r.lastSyncNanos.Load() != 0 {
+		stats.LastSync = r.lastSync()
+	}
+	r.cache.Range(func(_, _ any) bool {
+		stats.Containers++
+		return true
+	})
+
+	r.routesMu.RLock()
+	defer r.routesMu.RUnlock()
+	stats.StaticRoutes = len(r.routesList)
+	if t := r.routeTable; t != nil {
+		stats.Hosts = len(t.hosts)
+		for host := range t.regexes {
+			if _, ok := t.hosts[host]; !ok {
+				stats.Hosts++
+			}
+		}
+	}
+	return stats
+}
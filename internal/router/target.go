@@ -0,0 +1,144 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidTarget is returned when a route target is not a usable backend address.
+var ErrInvalidTarget = errors.New("invalid route target")
+
+// MaxDialRetries caps a route's DialRetries.
+const MaxDialRetries = 5
+
+// PROXY protocol versions sent ahead of a backend connection.
+const (
+	ProxyProtocolV1 = "v1" // text header
+	ProxyProtocolV2 = "v2" // binary header
+)
+
+// ValidateProxyProtocol checks a PROXY protocol version; empty disables it.
+func ValidateProxyProtocol(version string) error {
+	switch version {
+	case "", ProxyProtocolV1, ProxyProtocolV2:
+		return nil
+	}
+	return fmt.Errorf("unknown PROXY protocol version %q: want %s or %s", version, ProxyProtocolV1, ProxyProtocolV2)
+}
+
+// ValidateRateLimit checks a route's request rate limit; a zero rate is
+// unlimited.
+func ValidateRateLimit(rate float64, burst int) error {
+	if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return fmt.Errorf("rate limit must be a non-negative number of requests per second, got %v", rate)
+	}
+	if burst < 0 {
+		return fmt.Errorf("rate burst must not be negative, got %d", burst)
+	}
+	return nil
+}
+
+// ValidateBasicAuth checks a route's basic auth credentials: a user name
+// without colons and a bcrypt hash, both set or both empty.
+func ValidateBasicAuth(user, hash string) error {
+	switch {
+	case user == "" && hash == "":
+		return nil
+	case user == "" || hash == "":
+		return errors.New("basic auth needs both a user and a password hash")
+	case strings.ContainsAny(user, ":\r\n"):
+		return fmt.Errorf("basic auth user %q must not contain colons or line breaks", user)
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("basic auth hash is not a bcrypt hash: %w", err)
+	}
+	return nil
+}
+
+// SplitTargets splits a comma-separated target list, dropping empty entries.
+func SplitTargets(target string) []string {
+	var targets []string
+	for _, t := range strings.Split(target, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// MultiTarget reports whether the route balances across several targets.
+func (r *StaticRoute) MultiTarget() bool {
+	return len(r.targets) > 1
+}
+
+// ValidateTarget checks that target is a host:port address with a valid port,
+// or a comma-separated list of them.
+func ValidateTarget(target string) error {
+	targets := SplitTargets(target)
+	if len(targets) == 0 {
+		return fmt.Errorf("%w: empty", ErrInvalidTarget)
+	}
+	for _, t := range targets {
+		if err := validateAddr(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAddr checks a single host:port target. Scheme-prefixed targets
+// (unix://, srv://, ...) are rejected because the proxy only dials TCP addresses.
+func validateAddr(target string) error {
+	if scheme, _, ok := strings.Cut(target, "://"); ok {
+		return fmt.Errorf("%w: %q: unsupported scheme %q", ErrInvalidTarget, target, scheme)
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidTarget, target, err)
+	}
+	if host == "" {
+		return fmt.Errorf("%w: %q: missing host", ErrInvalidTarget, target)
+	}
+	if strings.ContainsAny(host, " /") {
+		return fmt.Errorf("%w: %q: invalid host", ErrInvalidTarget, target)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%w: %q: invalid port %q", ErrInvalidTarget, target, port)
+	}
+	return nil
+}
+
+// checkTargetReachable dials each target once when dial checks are enabled,
+// logging a warning on failure. Registration still proceeds since the
+// backend may simply not be up yet.
+func (r *Router) checkTargetReachable(host, pathPrefix, target string) {
+	if r.targetDialTimeout <= 0 {
+		return
+	}
+	for _, addr := range SplitTargets(target) {
+		conn, err := net.DialTimeout("tcp", addr, r.targetDialTimeout)
+		if err != nil {
+			slog.Warn("route target unreachable", "host", host, "path", pathPrefix, "target", addr, "error", err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+// WithTargetDialCheck makes route registration dial each target with the
+// given timeout and warn if it cannot be reached.
+func WithTargetDialCheck(timeout time.Duration) Option {
+	return func(r *Router) {
+		r.targetDialTimeout = timeout
+	}
+}
@@ -0,0 +1,41 @@
+package router
+
+import "fmt"
+
+// Change tokens fingerprint the rows a load reads, so the sync loop can
+// detect that nothing changed with one small query instead of a full scan.
+// Each is an md5 over the relevant columns in a stable order; an empty
+// table yields "-" so that it never matches the initial zero token.
+const (
+	containersTokenQuery = `
+		SELECT
+			(SELECT COALESCE(md5(string_agg(concat_ws('|', id, namespace, external_ip, status,
+				ssh_enabled, https_enabled, allowed_methods::text), ',' ORDER BY id)), '-')
+			 FROM containers
+			 WHERE status = 'running')
+			||
+			(SELECT COALESCE(md5(string_agg(concat_ws('|', container_id, port, target_port), ','
+				ORDER BY container_id, port)), '-')
+			 FROM ingress_rules)
+			||
+			(SELECT COALESCE(md5(string_agg(concat_ws('|', container_id, public_key), ','
+				ORDER BY container_id, public_key)), '-')
+			 FROM authorized_keys)
+			||
+			(SELECT COALESCE(md5(string_agg(concat_ws('|', hostname, container_id), ','
+				ORDER BY hostname)), '-')
+			 FROM aliases)
+	`
+	routesTokenQuery = `
+		SELECT COALESCE(md5(string_agg(s::text, ',' ORDER BY s.id)), '-') FROM static_routes s
+	`
+)
+
+// changeToken runs a token query.
+func (r *Router) changeToken(query string) (string, error) {
+	var token string
+	if err := r.db.QueryRow(query).Scan(&token); err != nil {
+		return "", fmt.Errorf("query change token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+// fakeFleet answers the sync queries: change tokens from tokens and the
+// running containers from containers, by ID and namespace.
+type fakeFleet struct {
+	tokens     map[string]string
+	containers map[string]string
+}
+
+func (f *fakeFleet) rows(query string) *recordingRows {
+	switch {
+	case query == containersTokenQuery:
+		return tokenRows(f.tokens["containers"])
+	case query == routesTokenQuery:
+		return tokenRows(f.tokens["routes"])
+	case strings.Contains(query, "FROM containers"):
+		rows := &recordingRows{cols: []string{"id", "namespace", "external_ip", "status", "ssh_enabled", "https_enabled", "allowed_methods"}}
+		for id, ns := range f.containers {
+			rows.rows = append(rows.rows, []driver.Value{id, ns, "10.0.0.1", "running", false, true, nil})
+		}
+		return rows
+	}
+	return &recordingRows{cols: []string{"a", "b", "c"}}
+}
+
+func TestSyncSkipsUnchanged(t *testing.T) {
+	fleet := &fakeFleet{
+		tokens:     map[string]string{"containers": "c1", "routes": "r1"},
+		containers: map[string]string{"web": "ns-web"},
+	}
+	db, d := newRecordingDB(t)
+	d.rows = fleet.rows
+	r := NewStatic([]StaticRoute{{Host: "app.example", PathPrefix: "/", Target: "a:80"}})
+	r.db = db
+	r.routesToken = "r1"
+
+	if err := r.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.cache.Load("web"); !ok {
+		t.Fatal("container web not loaded")
+	}
+	table := r.routeTable
+
+	d.queries = nil
+	if err := r.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.queries) != 2 {
+		t.Errorf("no-op sync ran %d queries, want only the two change tokens", len(d.queries))
+	}
+	if r.routeTable != table {
+		t.Error("no-op sync rebuilt the route table")
+	}
+
+	// database/sql allocates for the token queries themselves; a sync that
+	// finds nothing changed must not allocate anything on top of them
+	tokens := testing.AllocsPerRun(50, func() {
+		r.changeToken(containersTokenQuery)
+		r.changeToken(routesTokenQuery)
+	})
+	if got := testing.AllocsPerRun(50, func() { r.loadAll() }); got > tokens {
+		t.Errorf("no-op sync made %v allocations, the two token queries alone %v", got, tokens)
+	}
+}
+
+func TestSyncDiffsContainers(t *testing.T) {
+	fleet := &fakeFleet{
+		tokens:     map[string]string{"containers": "c1"},
+		containers: map[string]string{"web": "ns-web", "db": "ns-db"},
+	}
+	db, d := newRecordingDB(t)
+	d.rows = fleet.rows
+	r := NewStatic(nil)
+	r.db = db
+
+	if err := r.loadContainers(); err != nil {
+		t.Fatal(err)
+	}
+	web, _ := r.cache.Load("web")
+	<-r.containersChanged
+
+	// db changes, web stays, api arrives
+	fleet.tokens["containers"] = "c2"
+	fleet.containers = map[string]string{"web": "ns-web", "db": "ns-db2", "api": "ns-api"}
+	if err := r.loadContainers(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.cache.Load("web"); got != web {
+		t.Error("unchanged container web was replaced")
+	}
+	if got, _ := r.cache.Load("db"); got == nil || got.(*Container).Namespace != "ns-db2" {
+		t.Errorf("changed container db = %+v, want namespace ns-db2", got)
+	}
+	if _, ok := r.cache.Load("api"); !ok {
+		t.Error("new container api not added")
+	}
+	select {
+	case <-r.containersChanged:
+	default:
+		t.Error("changed sync did not signal containersChanged")
+	}
+
+	fleet.tokens["containers"] = "c3"
+	fleet.containers = map[string]string{"api": "ns-api"}
+	if err := r.loadContainers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"web", "db"} {
+		if _, ok := r.cache.Load(id); ok {
+			t.Errorf("container %s still cached after it stopped", id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidWeights is returned when route weights do not fit the route's targets.
+var ErrInvalidWeights = errors.New("invalid route weights")
+
+// ValidateWeights checks per-target weights against a route target. Empty
+// weights mean round-robin; otherwise there must be one non-negative weight
+// per target and at least one must be positive.
+func ValidateWeights(target string, weights []int) error {
+	if len(weights) == 0 {
+		return nil
+	}
+	if n := len(SplitTargets(target)); len(weights) != n {
+		return fmt.Errorf("%w: got %d for %d targets", ErrInvalidWeights, len(weights), n)
+	}
+	total := 0
+	for _, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("%w: negative weight %d", ErrInvalidWeights, w)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: at least one must be positive", ErrInvalidWeights)
+	}
+	return nil
+}
+
+// weightedTarget draws one of the route's targets at random in proportion
+// to its weight. Targets rejected by the target filter are left out of the
+// draw unless that would leave nothing to choose from.
+func (r *Router) weightedTarget(route *StaticRoute) string {
+	total := 0
+	for i, t := range route.targets {
+		if r.targetFilter == nil || r.targetFilter(t) {
+			total += route.Weights[i]
+		}
+	}
+	filtered := total > 0
+	if !filtered {
+		for _, w := range route.Weights {
+			total += w
+		}
+	}
+
+	n := rand.IntN(total)
+	for i, t := range route.targets {
+		if filtered && r.targetFilter != nil && !r.targetFilter(t) {
+			continue
+		}
+		if n < route.Weights[i] {
+			slog.Debug("route resolution: chose weighted target", "host", route.Host, "matched_prefix", route.PathPrefix, "target", t, "variant", i, "weight", route.Weights[i], "total", total)
+			return t
+		}
+		n -= route.Weights[i]
+	}
+	return route.targets[len(route.targets)-1]
+}
+
+// SetRouteWeights replaces the target weights of the unconditioned route
+// for host and pathPrefix. Empty weights restore round-robin. Requests
+// already proxied are unaffected; new requests use the new split once the
+// route table is reloaded.
+func (r *Router) SetRouteWeights(host, pathPrefix string, weights []int) error {
+	var route *StaticRoute
+	for _, rt := range r.ListRoutes() {
+		if strings.EqualFold(rt.Host, host) && rt.PathPrefix == pathPrefix && rt.HeaderName == "" {
+			route = &rt
+			break
+		}
+	}
+	if route == nil {
+		return ErrNoRoute
+	}
+	if err := ValidateWeights(route.Target, weights); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE static_routes SET target_weights = $3
+		WHERE host = $1 AND path_prefix = $2 AND header_name = ''
+	`, route.Host, pathPrefix, pq.Array(weightsArray(weights)))
+	if err != nil {
+		return fmt.Errorf("update route weights: %w", err)
+	}
+	slog.Info("route weights updated", "host", host, "path", pathPrefix, "target", route.Target, "weights", weights)
+	return r.loadStaticRoutes()
+}
+
+// weightsArray converts weights for storage in an INT[] column.
+func weightsArray(weights []int) []int64 {
+	arr := make([]int64, len(weights))
+	for i, w := range weights {
+		arr[i] = int64(w)
+	}
+	return arr
+}
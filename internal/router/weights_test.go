@@ -0,0 +1,44 @@
+package router
+
+import "testing"
+
+func TestSetRouteWeights(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	r := &Router{db: db}
+	r.routesList = []StaticRoute{{Host: "app.example", PathPrefix: "/", Target: "a:80,b:80"}}
+
+	if err := r.SetRouteWeights("app.example", "/", []int{1, 3}); err != nil {
+		t.Fatalf("SetRouteWeights() error = %v", err)
+	}
+	if len(rec.execs) != 1 {
+		t.Fatalf("got %d statements executed, want 1", len(rec.execs))
+	}
+	args := rec.execs[0].args
+	if len(args) != 3 {
+		t.Fatalf("got %d arguments, want 3", len(args))
+	}
+	if got, ok := args[2].(string); !ok || got != "{1,3}" {
+		t.Errorf("weights argument = %#v, want array literal \"{1,3}\"", args[2])
+	}
+}
+
+func TestValidateWeights(t *testing.T) {
+	tests := []struct {
+		target  string
+		weights []int
+		ok      bool
+	}{
+		{"a:80,b:80", nil, true},
+		{"a:80,b:80", []int{1, 3}, true},
+		{"a:80,b:80", []int{0, 1}, true},
+		{"a:80,b:80", []int{1}, false},
+		{"a:80,b:80", []int{-1, 2}, false},
+		{"a:80,b:80", []int{0, 0}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateWeights(tt.target, tt.weights)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateWeights(%q, %v) = %v, want ok=%v", tt.target, tt.weights, err, tt.ok)
+		}
+	}
+}
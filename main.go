@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"eddisonso.com/edd-gateway/internal/admin"
 	"eddisonso.com/edd-gateway/internal/k8s"
+	"eddisonso.com/edd-gateway/internal/logging"
+	"eddisonso.com/edd-gateway/internal/metrics"
 	"eddisonso.com/edd-gateway/internal/proxy"
 	"eddisonso.com/edd-gateway/internal/router"
 	"eddisonso.com/go-gfs/pkg/gfslog"
+	"golang.org/x/crypto/acme/autocert"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,8 +29,47 @@ type routeConfig struct {
 	Routes []struct {
 		Host        string `yaml:"host"`
 		Path        string `yaml:"path"`
+		Match       string `yaml:"match"`
 		Target      string `yaml:"target"`
+		Weights     []int  `yaml:"weights"`
 		StripPrefix bool   `yaml:"strip_prefix"`
+
+		ReplacePrefix string `yaml:"replace_prefix"`
+		Priority      int    `yaml:"priority"`
+
+		HeaderName  string `yaml:"header_name"`
+		HeaderValue string `yaml:"header_value"`
+
+		UpstreamTLS        bool   `yaml:"upstream_tls"`
+		UpstreamServerName string `yaml:"upstream_server_name"`
+		UpstreamCAFile     string `yaml:"upstream_ca_file"`
+		ClientCAFile       string `yaml:"client_ca_file"`
+		ProxyProtocol      string `yaml:"proxy_protocol"`
+
+		Labels          map[string]string `yaml:"labels"`
+		ResponseHeaders map[string]string `yaml:"response_headers"`
+
+		SlowDialThreshold time.Duration `yaml:"slow_dial_threshold"`
+		DialTimeout       time.Duration `yaml:"dial_timeout"`
+		IdleTimeout       time.Duration `yaml:"idle_timeout"`
+		RequestTimeout    time.Duration `yaml:"request_timeout"`
+		DialRetries       int           `yaml:"dial_retries"`
+		HashKey           string        `yaml:"hash_key"`
+
+		CanaryTarget       string        `yaml:"canary_target"`
+		CanaryStepPercent  int           `yaml:"canary_step_percent"`
+		CanaryStepInterval time.Duration `yaml:"canary_step_interval"`
+
+		BufferBody   bool  `yaml:"buffer_body"`
+		MaxBodyBytes int64 `yaml:"max_body_bytes"`
+		Compress     bool  `yaml:"compress"`
+
+		BasicAuthUser string `yaml:"basic_auth_user"`
+		BasicAuthHash string `yaml:"basic_auth_hash"`
+
+		RateLimit         float64 `yaml:"rate_limit"`
+		RateBurst         int     `yaml:"rate_burst"`
+		RateLimitByClient bool    `yaml:"rate_limit_by_client"`
 	} `yaml:"routes"`
 }
 
@@ -27,10 +77,81 @@ func main() {
 	sshPort := flag.Int("ssh-port", 22, "SSH proxy port")
 	httpPort := flag.Int("http-port", 80, "HTTP proxy port")
 	httpsPort := flag.Int("https-port", 443, "HTTPS/TLS proxy port")
+	multiPorts := flag.String("multi-ports", proxy.DefaultMultiPortRange, "Port range for multi-protocol (SSH/HTTP/TLS auto-detecting) listeners")
+	multiPortMode := flag.String("multi-port-mode", proxy.MultiPortsAll, "Which -multi-ports to bind: all, or ingress for only the ports containers have ingress rules for (opened and closed as containers come and go)")
 	fallbackAddr := flag.String("fallback", "", "Fallback upstream for non-container traffic (e.g., 192.168.3.150)")
+	passthroughProxyProtocol := flag.String("passthrough-proxy-protocol", "", "PROXY protocol header sent on TLS passthrough to containers: v1, v2 or empty for none")
+	missingSNI := flag.String("missing-sni", "close", "TLS passthrough for ClientHellos without SNI: close, fallback or backend")
+	missingSNIBackend := flag.String("missing-sni-backend", "", "host:port to pass TLS connections without SNI to when -missing-sni=backend")
+	defaultSNIHost := flag.String("default-sni-host", "", "Hostname to route TLS connections without SNI as (overrides -missing-sni for them)")
+	passthroughALPN := flag.String("passthrough-alpn", "", "Comma-separated ALPN protocols (e.g. h2) passed through to -fallback instead of terminated when the client prefers them; such connections skip all per-route settings, and hosts with mTLS or basic auth routes are always terminated")
 	logService := flag.String("log-service", "", "Log service address")
-	tlsCert := flag.String("tls-cert", "", "TLS certificate file for TLS termination")
-	tlsKey := flag.String("tls-key", "", "TLS private key file for TLS termination")
+	errorBuffer := flag.Int("error-buffer", logging.DefaultErrorBufferSize, "Recent error log records kept for the admin /debug/errors endpoint (0 disables)")
+	logBuffer := flag.Int("log-buffer", logging.DefaultBufferSize, "Log records buffered for the log service before new ones are dropped")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file for TLS termination (comma-separated for several, selected by SNI)")
+	tlsKey := flag.String("tls-key", "", "TLS private key file for TLS termination (comma-separated, matching -tls-cert)")
+	tlsMinVersion := flag.String("tls-min-version", proxy.DefaultTLSMinVersion, "Lowest TLS version accepted for TLS termination: 1.2 or 1.3")
+	tlsCiphers := flag.String("tls-ciphers", "", "Comma-separated TLS 1.2 cipher suites accepted for TLS termination, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (empty uses Go's defaults)")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Terminate TLS with a generated self-signed certificate, for local development only (not with -tls-cert or -acme-email)")
+	tlsSelfSignedHosts := flag.String("tls-self-signed-hosts", proxy.DefaultSelfSignedHosts, "Comma-separated hostnames and IPs the -tls-self-signed certificate is valid for")
+	acmeEmail := flag.String("acme-email", "", "Contact email for Let's Encrypt; enables on-demand certificates for static route hosts")
+	acmeCacheDir := flag.String("acme-cache-dir", "", "Directory for ACME account keys and certificates (default: the -acme-cache-secret Kubernetes Secret)")
+	acmeCacheSecret := flag.String("acme-cache-secret", k8s.DefaultCertCacheSecret, "Kubernetes Secret for ACME account keys and certificates when -acme-cache-dir is unset")
+	httpsRedirect := flag.Bool("https-redirect", false, "Redirect plain HTTP requests to HTTPS for static route hosts covered by -tls-cert")
+	hsts := flag.String("hsts", "", "Strict-Transport-Security value added to TLS-terminated responses, e.g. max-age=31536000; includeSubDomains (empty disables)")
+	nosniff := flag.Bool("nosniff", false, "Add X-Content-Type-Options: nosniff to TLS-terminated responses")
+	securityHeaders := flag.String("security-headers", "", "Extra headers added to TLS-terminated responses, e.g. X-Frame-Options=DENY|Referrer-Policy=no-referrer (routes may override)")
+	certCheckInterval := flag.Duration("cert-check-interval", proxy.DefaultCertCheckInterval, "How often to check loaded TLS certificates for upcoming expiry (0 disables)")
+	certExpiryWindow := flag.Duration("cert-expiry-window", proxy.DefaultCertExpiryWindow, "Warn when a loaded TLS certificate expires within this window")
+	accessLogFormat := flag.String("access-log-format", "off", "Access log format: off, json, combined or common")
+	requestIDHeader := flag.String("request-id-header", proxy.DefaultRequestIDHeader, "Header carrying each HTTP request's correlation ID, kept from the client or generated, forwarded to backends and logged (empty disables)")
+	accessLogFile := flag.String("access-log-file", "", "File to append access log entries to (default: stdout for Apache formats, the log service for json)")
+	memShedThreshold := flag.Float64("memory-shed-threshold", 0, "Fraction of the memory limit above which non-critical connections are shed (0 disables)")
+	memLimit := flag.Uint64("memory-limit", 0, "Memory limit in bytes for shedding (0 detects the cgroup limit)")
+	proxyProtocolPorts := flag.String("proxy-protocol-ports", "", "Listener ports whose connections start with a PROXY protocol v1/v2 header from a load balancer, e.g. 80,443,8000-8099")
+	proxyProtocolTrusted := flag.String("proxy-protocol-trusted", "", "CIDRs of the load balancers allowed to send PROXY headers on -proxy-protocol-ports, e.g. 10.0.0.0/8 (required with -proxy-protocol-ports)")
+	trustedProxies := flag.String("trusted-proxies", "", "CIDRs of proxies in front of the gateway whose X-Forwarded-Proto is trusted for plain HTTP requests, e.g. 10.0.0.0/8,192.168.1.5")
+	portAllowlist := flag.String("port-allowlist", "", "Client source CIDRs allowed per listener port, e.g. 8500-8599=10.0.0.0/8|192.168.1.0/24 (other ports are unrestricted)")
+	maxHostConnections := flag.Int("max-host-connections", 0, "Maximum concurrent client connections per destination host (0 for unlimited; -host-connection-limits overrides)")
+	hostConnectionLimits := flag.String("host-connection-limits", "", "Concurrent client connection limits for specific hosts, e.g. api.example.com=200,static.example.com=50 (0 for unlimited)")
+	sshAudit := flag.String("ssh-audit", "log", "Where to write SSH session audit records: log (event=ssh_audit via the log service), db (ssh_audit table), both as log,db, or none")
+	sshRate := flag.Float64("ssh-rate", 0, "SSH connections per second allowed from each client IP before the handshake (0 disables)")
+	sshBurst := flag.Int("ssh-burst", proxy.DefaultSSHBurst, "SSH connections a client IP may open at once before -ssh-rate applies")
+	portReservations := flag.String("port-reservations", "", "Connection capacity and per-protocol reserved slots for multi-protocol ports, e.g. 8000-8999=200|ssh:50|http:100")
+	portPriority := flag.String("port-priority", "", "Shedding priority per listener port, e.g. 8080=normal,8000-8999=low (SSH port is critical unless listed)")
+	backendPoolSize := flag.Int("backend-pool-size", proxy.DefaultBackendPoolSize, "Idle keep-alive connections kept per HTTP backend (0 disables pooling)")
+	backendIdleTimeout := flag.Duration("backend-idle-timeout", proxy.DefaultBackendIdleTimeout, "How long pooled HTTP backend connections may stay idle")
+	firstReadTimeouts := flag.String("first-read-timeouts", "", "First-read timeouts by protocol (ssh, http, tls, multi) or port, e.g. http=5s,ssh=60s,8022=60s")
+	shutdownTimeout := flag.Duration("shutdown-timeout", proxy.DefaultShutdownTimeout, "Grace period for in-flight connections on shutdown")
+	httpIdleTimeout := flag.Duration("http-idle-timeout", proxy.DefaultHTTPIdleTimeout, "Idle timeout for kept-alive HTTP client connections")
+	maxHeaderLine := flag.Int("max-header-line-bytes", proxy.DefaultMaxHeaderLineBytes, "Maximum length of a single HTTP request header line")
+	ejectAfter := flag.Int("eject-after", proxy.DefaultEjectThreshold, "Consecutive dial failures after which a backend is skipped by multi-target routes (0 disables)")
+	ejectCooldown := flag.Duration("eject-cooldown", proxy.DefaultEjectCooldown, "How long an ejected backend stays out of rotation before it is re-probed")
+	healthCheckInterval := flag.Duration("health-check-interval", 0, "Actively probe static route targets at this interval (0 disables)")
+	healthCheckPath := flag.String("health-check-path", "", "HTTP path to GET for active health checks, e.g. /healthz (empty uses a TCP connect)")
+	healthCheckTimeout := flag.Duration("health-check-timeout", proxy.DefaultHealthCheckTimeout, "Timeout for a single active health probe")
+	errorPages := flag.String("error-pages", "", "Directory of error page templates named by status code or default, e.g. 502.html, default.json (empty sends plain text)")
+	maintenancePage := flag.String("maintenance-page", "", "HTML file served with 503 to hosts put in maintenance through the admin API (empty uses a built-in page)")
+	retryAfter := flag.String("retry-after", "", "Retry-After delays for 503 and 429 responses by cause, e.g. overload=1s,draining=30s (causes: overload, draining, not_ready, circuit_open, rate_limited, maintenance)")
+	debugErrors := flag.Bool("debug-errors", false, "Include the backend address and error category in 502 responses (never enable in production)")
+	metricsPort := flag.Int("metrics-port", 0, "Port for the Prometheus /metrics endpoint (0 disables)")
+	dialTimeout := flag.Duration("dial-timeout", proxy.DefaultDialTimeout, "How long a backend dial may take (routes may override)")
+	copyBufferSize := flag.Int("copy-buffer-size", proxy.DefaultCopyBufferSize, "Size in bytes of the pooled buffers used to relay proxied connections")
+	maxBufferedBody := flag.Int64("max-buffered-body", proxy.DefaultMaxBufferedBody, "Largest request body buffered for routes with buffer_body, in bytes (routes may override)")
+	proxyIdleTimeout := flag.Duration("proxy-idle-timeout", proxy.DefaultProxyIdleTimeout, "Close proxied HTTP backend connections after this long without traffic in either direction (0 disables; routes may override)")
+	slowDialThreshold := flag.Duration("slow-dial-threshold", 0, "Log a warning when a backend dial takes longer than this (0 disables; routes may override)")
+	maxConnections := flag.Int("max-connections", 0, "Maximum concurrent connections across all listeners (0 for unlimited)")
+	maxConnectionsPerIP := flag.Int("max-connections-per-ip", 0, "Maximum concurrent connections from a single client address (0 for unlimited)")
+	strictLimits := flag.Bool("strict-limits", false, "Exit at startup if RLIMIT_NOFILE or the ephemeral port range is too small for the listeners and expected connections, instead of warning")
+	checkRouteTargets := flag.Duration("check-route-targets", 0, "Dial each static route target with this timeout on registration and warn if unreachable (0 disables)")
+	syncInterval := flag.Duration("sync-interval", envDuration("SYNC_INTERVAL"), "How often to reload routing data from PostgreSQL, at least 100ms (0 uses 5s, or 1m with -listen-changes; env SYNC_INTERVAL)")
+	routeCacheSize := flag.Int("route-cache-size", envInt("ROUTE_CACHE_SIZE", router.DefaultCacheSize), "Recent static route lookups to cache (0 disables the cache; env ROUTE_CACHE_SIZE)")
+	dbConnectTimeout := flag.Duration("db-connect-timeout", router.DefaultConnectTimeout, "How long to retry an unreachable PostgreSQL at startup, with exponential backoff, before exiting")
+	maxStaleness := flag.Duration("max-staleness", router.DefaultMaxStaleness, "How long cached containers may go without a successful database sync before lookups log them as stale (0 disables)")
+	containerDNSTemplate := flag.String("container-dns-template", "", "Resolve running containers with no external IP recorded through this DNS name, with {id} and {namespace} placeholders, e.g. {id}.pods.cluster.local (empty disables)")
+	baseDomain := flag.String("base-domain", "", "Domain container hostnames end in, e.g. cloud.eddisonso.com; the container ID is everything before it (empty takes the first label)")
+	listenChanges := flag.Bool("listen-changes", false, "Reload on PostgreSQL NOTIFY gateway_changes instead of polling every 5s (polls every minute as a fallback)")
+	adminPort := flag.Int("admin-port", 0, "Port for the admin endpoints /healthz, /readyz, /backends, /targets, /certificates, /debug/errors, /debug/keys, /debug/cache, /debug/router, /canaries and /routes (0 disables)")
 	flag.Parse()
 
 	// Logger setup
@@ -39,8 +160,17 @@ func main() {
 		LogServiceAddr: *logService,
 		MinLevel:       slog.LevelDebug,
 	})
-	slog.SetDefault(logger.Logger)
 	defer logger.Close()
+	// Never let a slow or unreachable log service stall the proxy
+	logHandler := logging.NewAsyncHandler(logger.Logger.Handler(), *logBuffer)
+	defer logHandler.Close()
+	var errorRing *logging.ErrorRing
+	if *errorBuffer > 0 {
+		errorRing = logging.NewErrorRing(*errorBuffer)
+		slog.SetDefault(slog.New(logging.Tee(logHandler, errorRing)))
+	} else {
+		slog.SetDefault(slog.New(logHandler))
+	}
 
 	// Initialize SSH client key from K8s Secret
 	if err := k8s.InitClientKey(); err != nil {
@@ -55,7 +185,26 @@ func main() {
 	}
 
 	// Router for container lookups
-	r, err := router.New(dbConnStr)
+	routerOpts := []router.Option{
+		router.WithConnectTimeout(*dbConnectTimeout),
+		router.WithMaxStaleness(*maxStaleness),
+		router.WithRouteCacheSize(*routeCacheSize),
+	}
+	if *containerDNSTemplate != "" {
+		routerOpts = append(routerOpts, router.WithDNSFallback(*containerDNSTemplate))
+	}
+	if *baseDomain != "" {
+		routerOpts = append(routerOpts, router.WithBaseDomain(*baseDomain))
+	}
+	if *checkRouteTargets > 0 {
+		routerOpts = append(routerOpts, router.WithTargetDialCheck(*checkRouteTargets))
+	}
+	if *listenChanges {
+		routerOpts = append(routerOpts, router.WithChangeNotifications(*syncInterval))
+	} else if *syncInterval > 0 {
+		routerOpts = append(routerOpts, router.WithSyncInterval(*syncInterval))
+	}
+	r, err := router.New(dbConnStr, routerOpts...)
 	if err != nil {
 		slog.Error("failed to create router", "error", err)
 		os.Exit(1)
@@ -67,35 +216,326 @@ func main() {
 	if routesFile == "" {
 		routesFile = "routes.yaml"
 	}
-	if data, err := os.ReadFile(routesFile); err == nil {
-		var cfg routeConfig
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			slog.Error("failed to parse routes.yaml", "error", err)
-		} else {
-			for _, rt := range cfg.Routes {
-				if err := r.RegisterRoute(rt.Host, rt.Path, rt.Target, rt.StripPrefix); err != nil {
-					slog.Warn("failed to register route", "host", rt.Host, "path", rt.Path, "error", err)
-				} else {
-					slog.Info("registered route", "host", rt.Host, "path", rt.Path, "target", rt.Target)
-				}
-			}
-		}
-	} else {
-		slog.Debug("no routes.yaml found, skipping static routes", "path", routesFile)
-	}
+	syncRouteFile(r, routesFile)
 
 	// Create proxy server
 	srv := proxy.NewServer(r, *fallbackAddr)
+	srv.SetHTTPIdleTimeout(*httpIdleTimeout)
+	srv.SetMaxHeaderLineBytes(*maxHeaderLine)
+	srv.SetBackendPoolSize(*backendPoolSize)
+	srv.SetBackendIdleTimeout(*backendIdleTimeout)
+	srv.SetMaxConnections(*maxConnections)
+	srv.SetMaxConnectionsPerIP(*maxConnectionsPerIP)
+	srv.SetSlowDialThreshold(*slowDialThreshold)
+	srv.SetDialTimeout(*dialTimeout)
+	srv.SetProxyIdleTimeout(*proxyIdleTimeout)
+	srv.SetMaxBufferedBody(*maxBufferedBody)
+	srv.SetCopyBufferSize(*copyBufferSize)
+	srv.SetPassiveEjection(*ejectAfter, *ejectCooldown)
+	srv.SetSSHRateLimit(*sshRate, *sshBurst)
+	srv.LoadClientCAs()
+	auditSinks, err := proxy.ParseSSHAuditSinks(*sshAudit)
+	if err != nil {
+		slog.Error("invalid SSH audit sinks", "error", err)
+		os.Exit(1)
+	}
+	srv.SetSSHAudit(auditSinks)
+	if *healthCheckInterval > 0 {
+		srv.SetHealthCheckProbe(*healthCheckPath, *healthCheckTimeout)
+		srv.StartHealthChecks(*healthCheckInterval)
+	}
+	sniPolicy, err := proxy.ParseMissingSNIPolicy(*missingSNI)
+	if err != nil {
+		slog.Error("invalid missing-SNI policy", "error", err)
+		os.Exit(1)
+	}
+	if err := srv.SetMissingSNIPolicy(sniPolicy, *missingSNIBackend); err != nil {
+		slog.Error("invalid missing-SNI policy", "error", err)
+		os.Exit(1)
+	}
+	if err := srv.SetDefaultSNIHost(*defaultSNIHost); err != nil {
+		slog.Error("invalid default SNI host", "error", err)
+		os.Exit(1)
+	}
+	alpnProtocols, err := proxy.ParsePassthroughALPN(*passthroughALPN)
+	if err != nil {
+		slog.Error("invalid passthrough ALPN", "error", err)
+		os.Exit(1)
+	}
+	srv.SetPassthroughALPN(alpnProtocols)
+	if err := srv.SetPassthroughProxyProtocol(*passthroughProxyProtocol); err != nil {
+		slog.Error("invalid passthrough PROXY protocol", "error", err)
+		os.Exit(1)
+	}
+	retryDelays, err := proxy.ParseRetryAfter(*retryAfter)
+	if err != nil {
+		slog.Error("invalid retry-after delays", "error", err)
+		os.Exit(1)
+	}
+	srv.SetRetryAfter(retryDelays)
+	if *errorPages != "" {
+		if err := srv.LoadErrorPages(*errorPages); err != nil {
+			slog.Error("failed to load error pages", "error", err)
+			os.Exit(1)
+		}
+	}
+	if *maintenancePage != "" {
+		page, err := os.ReadFile(*maintenancePage)
+		if err != nil {
+			slog.Error("failed to read maintenance page", "error", err)
+			os.Exit(1)
+		}
+		srv.SetMaintenancePage(string(page))
+	}
+	if *debugErrors {
+		slog.Warn("debug error responses enabled: backend addresses will be exposed to clients")
+		srv.SetDebugErrors(true)
+	}
+
+	// Per-protocol and per-port first-read timeouts
+	protocolTimeouts, portTimeouts, err := proxy.ParseFirstReadTimeouts(*firstReadTimeouts)
+	if err != nil {
+		slog.Error("invalid first-read timeouts", "error", err)
+		os.Exit(1)
+	}
+	for protocol, d := range protocolTimeouts {
+		srv.SetFirstReadTimeout(protocol, d)
+	}
+	for port, d := range portTimeouts {
+		srv.SetPortFirstReadTimeout(port, d)
+	}
+
+	// Per-port source allowlists
+	allowlists, err := proxy.ParsePortAllowlists(*portAllowlist)
+	if err != nil {
+		slog.Error("invalid port allowlist", "error", err)
+		os.Exit(1)
+	}
+	for port, prefixes := range allowlists {
+		srv.SetPortAllowlist(port, prefixes)
+	}
+
+	trusted, err := proxy.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		slog.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	srv.SetTrustedProxies(trusted)
+
+	proxiedPorts, err := proxy.ParseProxyProtocolPorts(*proxyProtocolPorts)
+	if err != nil {
+		slog.Error("invalid PROXY protocol ports", "error", err)
+		os.Exit(1)
+	}
+	proxyTrusted, err := proxy.ParseProxyProtocolTrusted(*proxyProtocolTrusted)
+	if err != nil {
+		slog.Error("invalid PROXY protocol trusted sources", "error", err)
+		os.Exit(1)
+	}
+	if len(proxiedPorts) > 0 && len(proxyTrusted) == 0 {
+		slog.Error("-proxy-protocol-ports requires -proxy-protocol-trusted")
+		os.Exit(1)
+	}
+	srv.SetProxyProtocolTrusted(proxyTrusted)
+	for _, port := range proxiedPorts {
+		srv.SetPortProxyProtocol(port, true)
+	}
+
+	reservations, err := proxy.ParsePortReservations(*portReservations)
+	if err != nil {
+		slog.Error("invalid port reservations", "error", err)
+		os.Exit(1)
+	}
+	for port, res := range reservations {
+		if err := srv.SetPortReservation(port, res); err != nil {
+			slog.Error("invalid port reservation", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	hostLimits, err := proxy.ParseHostConnectionLimits(*hostConnectionLimits)
+	if err != nil {
+		slog.Error("invalid host connection limits", "error", err)
+		os.Exit(1)
+	}
+	srv.SetDefaultHostConnectionLimit(*maxHostConnections)
+	for host, n := range hostLimits {
+		srv.SetHostConnectionLimit(host, n)
+	}
+
+	// Access logging: to -access-log-file when set, otherwise JSON goes
+	// through slog and Apache formats to stdout
+	format, err := proxy.ParseAccessLogFormat(*accessLogFormat)
+	if err != nil {
+		slog.Error("invalid access log format", "error", err)
+		os.Exit(1)
+	}
+	var accessLogOut io.Writer
+	switch {
+	case *accessLogFile != "" && format != proxy.AccessLogOff:
+		f, err := os.OpenFile(*accessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			slog.Error("failed to open access log file", "path", *accessLogFile, "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		accessLogOut = f
+	case format != proxy.AccessLogJSON:
+		accessLogOut = os.Stdout
+	}
+	srv.SetAccessLog(format, accessLogOut)
+	if err := srv.SetRequestIDHeader(*requestIDHeader); err != nil {
+		slog.Error("invalid request ID header", "error", err)
+		os.Exit(1)
+	}
+
+	// Shed non-critical connections under memory pressure
+	if *memShedThreshold > 0 {
+		priorities, err := proxy.ParsePortPriorities(*portPriority)
+		if err != nil {
+			slog.Error("invalid port priorities", "error", err)
+			os.Exit(1)
+		}
+		if _, ok := priorities[*sshPort]; !ok {
+			priorities[*sshPort] = proxy.PriorityCritical
+		}
+		if err := srv.SetMemoryShedding(proxy.MemoryShedConfig{
+			Threshold:       *memShedThreshold,
+			Limit:           *memLimit,
+			Priorities:      priorities,
+			DefaultPriority: proxy.PriorityNormal,
+		}); err != nil {
+			slog.Error("failed to enable memory shedding", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// The TLS policy applies to the termination config created below
+	minVersion, err := proxy.ParseTLSMinVersion(*tlsMinVersion)
+	if err != nil {
+		slog.Error("invalid TLS policy", "error", err)
+		os.Exit(1)
+	}
+	cipherSuites, err := proxy.ParseTLSCiphers(*tlsCiphers)
+	if err != nil {
+		slog.Error("invalid TLS policy", "error", err)
+		os.Exit(1)
+	}
+	if err := srv.SetTLSPolicy(minVersion, cipherSuites); err != nil {
+		slog.Error("invalid TLS policy", "error", err)
+		os.Exit(1)
+	}
+
+	srv.SetCertExpiryWindow(*certExpiryWindow)
 
 	// Load TLS certificate for termination if provided
 	if *tlsCert != "" && *tlsKey != "" {
-		if err := srv.LoadTLSCert(*tlsCert, *tlsKey); err != nil {
-			slog.Error("failed to load TLS certificate", "error", err)
+		certFiles, keyFiles := strings.Split(*tlsCert, ","), strings.Split(*tlsKey, ",")
+		if len(certFiles) != len(keyFiles) {
+			slog.Error("-tls-cert and -tls-key must list the same number of files")
+			os.Exit(1)
+		}
+		for i := range certFiles {
+			if err := srv.LoadTLSCert(strings.TrimSpace(certFiles[i]), strings.TrimSpace(keyFiles[i])); err != nil {
+				slog.Error("failed to load TLS certificate", "error", err)
+				os.Exit(1)
+			}
+		}
+		slog.Info("TLS termination enabled")
+	}
+	if *tlsSelfSigned {
+		if *tlsCert != "" || *tlsKey != "" || *acmeEmail != "" {
+			slog.Error("-tls-self-signed cannot be combined with -tls-cert, -tls-key or -acme-email")
+			os.Exit(1)
+		}
+		hosts, err := proxy.ParseSelfSignedHosts(*tlsSelfSignedHosts)
+		if err != nil {
+			slog.Error("invalid self-signed certificate hosts", "error", err)
+			os.Exit(1)
+		}
+		if err := srv.UseSelfSignedCert(hosts); err != nil {
+			slog.Error("failed to generate self-signed certificate", "error", err)
 			os.Exit(1)
 		}
 		slog.Info("TLS termination enabled")
 	}
 
+	// On-demand certificates for static route hosts
+	if *acmeEmail != "" {
+		var cache autocert.Cache
+		if *acmeCacheDir != "" {
+			cache = autocert.DirCache(*acmeCacheDir)
+		} else {
+			secretCache, err := k8s.NewSecretCache(*acmeCacheSecret)
+			if err != nil {
+				slog.Error("failed to create ACME certificate cache", "error", err)
+				os.Exit(1)
+			}
+			cache = secretCache
+		}
+		srv.EnableACME(*acmeEmail, cache)
+	}
+	if (*tlsCert != "" || *tlsSelfSigned || *acmeEmail != "") && *certCheckInterval > 0 {
+		srv.StartCertExpiryChecks(*certCheckInterval)
+	}
+	srv.SetHTTPSRedirect(*httpsRedirect)
+	extraHeaders, err := proxy.ParseResponseHeaders(*securityHeaders)
+	if err != nil {
+		slog.Error("invalid security headers", "error", err)
+		os.Exit(1)
+	}
+	var responseHeaders []proxy.ResponseHeader
+	if *hsts != "" {
+		responseHeaders = append(responseHeaders, proxy.ResponseHeader{Name: "Strict-Transport-Security", Value: *hsts})
+	}
+	if *nosniff {
+		responseHeaders = append(responseHeaders, proxy.ResponseHeader{Name: "X-Content-Type-Options", Value: "nosniff"})
+	}
+	srv.SetSecurityHeaders(append(responseHeaders, extraHeaders...))
+
+	// Serve metrics on a dedicated port, never on an ingress listener
+	if *metricsPort > 0 {
+		metrics.NewCounterFunc("gateway_connections_shed_total",
+			"Connections rejected under memory pressure.", srv.ShedCount)
+		metrics.NewCounterFunc("gateway_ssh_throttled_total",
+			"SSH connections rejected by the per-source rate limit.", srv.SSHThrottledCount)
+		metrics.NewCounterFunc("gateway_log_records_dropped_total",
+			"Log records dropped because the log buffer was full.", logHandler.Dropped)
+		metrics.NewCounterFunc("gateway_route_cache_hits_total",
+			"Static route lookups answered from the lookup cache.", r.RouteCacheHits)
+		metrics.NewCounterFunc("gateway_route_cache_misses_total",
+			"Cacheable static route lookups that walked the route tree.", r.RouteCacheMisses)
+		metrics.NewGaugeFunc("gateway_route_cache_size",
+			"Static route lookups currently cached.",
+			func() float64 { return float64(r.RouteCacheSize()) })
+		metrics.NewGaugeFunc("gateway_max_connections",
+			"Configured maximum concurrent connections (0 for unlimited).",
+			func() float64 { return float64(*maxConnections) })
+		metrics.NewGaugeFunc("gateway_connection_saturation",
+			"Active connections as a fraction of gateway_max_connections (0 when unlimited).", srv.Saturation)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			addr := fmt.Sprintf(":%d", *metricsPort)
+			slog.Info("metrics listening", "addr", addr)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				slog.Error("metrics listener failed", "error", err)
+			}
+		}()
+	}
+
+	// Health and readiness probes on a dedicated admin port
+	if *adminPort > 0 {
+		adminSrv := admin.New(r, srv)
+		adminSrv.SetErrorRing(errorRing)
+		adminSrv.SetRoutesToken(os.Getenv(admin.RoutesTokenEnv))
+		go func() {
+			if err := adminSrv.ListenAndServe(*adminPort); err != nil {
+				slog.Error("admin listener failed", "error", err)
+			}
+		}()
+	}
+
 	// Start SSH listener
 	go func() {
 		if err := srv.ListenSSH(*sshPort); err != nil {
@@ -116,23 +556,155 @@ func main() {
 		}
 	}()
 
-	// Start multi-protocol listeners on all allowed ingress ports (8000-8999)
-	for port := 8000; port <= 8999; port++ {
-		p := port
-		go func() {
-			if err := srv.ListenMulti(p); err != nil {
-				slog.Error("multi listener failed", "port", p, "error", err)
-			}
-		}()
+	multiLo, multiHi, err := proxy.ParseMultiPortRange(*multiPorts)
+	if err != nil {
+		slog.Error("invalid multi-protocol ports", "error", err)
+		os.Exit(1)
+	}
+	if err := proxy.ValidateMultiPortMode(*multiPortMode); err != nil {
+		slog.Error("invalid multi-protocol port mode", "error", err)
+		os.Exit(1)
 	}
 
-	slog.Info("gateway started", "ssh", *sshPort, "http", *httpPort, "https", *httpsPort, "extra_ports", "8000-8999")
+	// Check descriptor headroom for the SSH, HTTP and TLS listeners plus
+	// every multi-protocol port that may be bound
+	if check, err := proxy.CheckOSLimits(3+multiHi-multiLo+1, *maxConnections); err != nil {
+		if *strictLimits {
+			slog.Error("startup limit check failed", "error", err, "required_fds", check.RequiredFDs, "fd_limit", check.FDLimit, "fd_hard_limit", check.FDHardLimit)
+			os.Exit(1)
+		}
+		slog.Warn("startup limit check failed", "error", err, "required_fds", check.RequiredFDs, "fd_limit", check.FDLimit, "fd_hard_limit", check.FDHardLimit)
+	} else {
+		slog.Info("startup limit check passed", "required_fds", check.RequiredFDs, "fd_limit", check.FDLimit, "ephemeral_ports", check.EphemeralPorts)
+	}
 
-	// Wait for shutdown
+	// Start multi-protocol listeners on the whole range, or follow the
+	// ingress ports in use
+	if *multiPortMode == proxy.MultiPortsIngress {
+		srv.StartIngressListeners(multiLo, multiHi, r.SyncInterval())
+	} else {
+		for port := multiLo; port <= multiHi; port++ {
+			p := port
+			go func() {
+				if err := srv.ListenMulti(p); err != nil {
+					slog.Error("multi listener failed", "port", p, "error", err)
+				}
+			}()
+		}
+	}
+
+	slog.Info("gateway started", "ssh", *sshPort, "http", *httpPort, "https", *httpsPort, "extra_ports", fmt.Sprintf("%d-%d", multiLo, multiHi), "extra_ports_mode", *multiPortMode, "sync_interval", r.SyncInterval())
+
+	// Wait for shutdown, reloading static routes and TLS certificates on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		slog.Info("received SIGHUP, reloading static routes", "path", routesFile)
+		syncRouteFile(r, routesFile)
+		if *tlsCert == "" {
+			continue
+		}
+		slog.Info("reloading TLS certificates")
+		if err := srv.ReloadTLSCert(); err != nil {
+			slog.Error("failed to reload TLS certificates, keeping current ones", "error", err)
+		}
+	}
+
+	slog.Info("gateway shutting down", "timeout", *shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("shutdown deadline exceeded, remaining connections were force-closed", "error", err)
+	}
+}
+
+// syncRouteFile registers the static routes in path and removes routes that
+// an earlier version of the file registered. A missing or unparsable file
+// leaves the current routes untouched.
+func syncRouteFile(r *router.Router, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Debug("no routes.yaml found, skipping static routes", "path", path)
+		return
+	}
+	var cfg routeConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		slog.Error("failed to parse routes.yaml, keeping current routes", "path", path, "error", err)
+		return
+	}
+	routes := make([]router.StaticRoute, 0, len(cfg.Routes))
+	for _, rt := range cfg.Routes {
+		routes = append(routes, router.StaticRoute{
+			Host:               rt.Host,
+			PathPrefix:         rt.Path,
+			MatchType:          rt.Match,
+			Target:             rt.Target,
+			Weights:            rt.Weights,
+			StripPrefix:        rt.StripPrefix,
+			ReplacePrefix:      rt.ReplacePrefix,
+			Priority:           rt.Priority,
+			HeaderName:         rt.HeaderName,
+			HeaderValue:        rt.HeaderValue,
+			UpstreamTLS:        rt.UpstreamTLS,
+			UpstreamServerName: rt.UpstreamServerName,
+			UpstreamCAFile:     rt.UpstreamCAFile,
+			ClientCAFile:       rt.ClientCAFile,
+			ProxyProtocol:      rt.ProxyProtocol,
+			Labels:             rt.Labels,
+			ResponseHeaders:    rt.ResponseHeaders,
+			SlowDialThreshold:  rt.SlowDialThreshold,
+			DialTimeout:        rt.DialTimeout,
+			IdleTimeout:        rt.IdleTimeout,
+			RequestTimeout:     rt.RequestTimeout,
+			DialRetries:        rt.DialRetries,
+			HashKey:            rt.HashKey,
+			CanaryTarget:       rt.CanaryTarget,
+			CanaryStepPercent:  rt.CanaryStepPercent,
+			CanaryStepInterval: rt.CanaryStepInterval,
+			BufferBody:         rt.BufferBody,
+			MaxBodyBytes:       rt.MaxBodyBytes,
+			Compress:           rt.Compress,
+			BasicAuthUser:      rt.BasicAuthUser,
+			BasicAuthHash:      rt.BasicAuthHash,
+			RateLimit:          rt.RateLimit,
+			RateBurst:          rt.RateBurst,
+			RateLimitByClient:  rt.RateLimitByClient,
+		})
+	}
+	if err := r.SyncFileRoutes(routes); err != nil {
+		slog.Warn("failed to register some routes", "path", path, "error", err)
+	}
+}
 
-	slog.Info("gateway shutting down")
-	srv.Close()
+// envInt parses an integer from the named environment variable, returning
+// fallback if it is unset. An invalid value is fatal.
+func envInt(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Error("invalid integer in environment", "variable", name, "value", v, "error", err)
+		os.Exit(1)
+	}
+	return n
+}
+
+// envDuration parses a duration from the named environment variable,
+// returning 0 if it is unset. An invalid value is fatal.
+func envDuration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Error("invalid duration in environment", "variable", name, "value", v, "error", err)
+		os.Exit(1)
+	}
+	return d
 }